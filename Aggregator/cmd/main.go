@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/Wladim1r/aggregator/gateway/cluster"
+	"github.com/Wladim1r/aggregator/gateway/control"
 	"github.com/Wladim1r/aggregator/gateway/converting"
+	"github.com/Wladim1r/aggregator/gateway/delivery"
 	"github.com/Wladim1r/aggregator/gateway/strman"
 	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/Wladim1r/aggregator/periferia/kaffka"
 	"github.com/Wladim1r/aggregator/periferia/reddis"
+	"github.com/Wladim1r/shared/shard"
 	"github.com/gin-gonic/gin"
 
 	"github.com/Wladim1r/aggregator/models"
@@ -36,58 +39,58 @@ func main() {
 	dailyStatChan := make(chan models.DailyStat, 500)
 	// kafkaMsgChan := make(chan models.KafkaMsg, 500)
 
-	streamManager := strman.NewStreamManager()
+	tradeChan := make(chan models.AggTrade, 1000)
+	candleChan := make(chan models.Candle, 500)
 
-	r := gin.Default()
+	rawDepthChan := make(chan []byte, 1000)
+	bookStatChan := make(chan models.BookStat, 500)
 
-	// start stream
-	r.GET("/coin", func(c *gin.Context) {
-		// now query like /symbol?name=btcusdt&id=3
+	var depthChan chan []byte
+	if getenv.GetBool("DEPTH_ENABLED", true) {
+		depthChan = rawDepthChan
+	}
 
-		symbol := c.Query("symbol")
-		idStr := c.Query("id")
+	// Trades and order books of all followed symbols come over one stream
+	subscriptions := converting.NewSubscriptions(rawMsgsChan, depthChan)
 
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "failed to parse 'id' into int: " + err.Error(),
-			})
-			return
-		}
+	// Followers survive restarts, streams of followed symbols are resumed before serving
+	cfgRedis := reddis.LoadRedisConfig()
+	followerStore := reddis.NewFollowerStore(cfgRedis)
+	defer followerStore.Close()
+
+	// Symbols are spread over replicas sharing the follower store, REPLICA_ADDR
+	// is the control address other services reach this replica on
+	member := cluster.NewMember(
+		shard.NewRegistry(followerStore.Client()),
+		getenv.GetString("REPLICA_ADDR", ""),
+	)
+	if err := member.Join(ctx); err != nil {
+		slog.Error("Could not join cluster", "error", err)
+	}
 
-		started := streamManager.AddCoin(ctx, wg, symbol, id, rawMsgsChan)
-
-		if started {
-			c.JSON(http.StatusOK, gin.H{
-				"status": "started",
-				"symbol": symbol,
-			})
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"status": fmt.Sprintf("for user number %d already active", id),
-				"symbol": symbol,
-			})
-		}
-	})
+	streamManager := strman.NewStreamManager(subscriptions, followerStore, member)
+	if err := streamManager.Restore(ctx); err != nil {
+		slog.Error("Could not restore followers, waiting for Profile to sync them", "error", err)
+	}
 
-	// stop stream
-	r.DELETE("/coin", func(c *gin.Context) {
-		symbol := c.Query("symbol")
-		idStr := c.Query("id")
-
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "failed to parse 'id' into int: " + err.Error(),
-			})
-			return
+	// Every user gets prices of followed symbols on its own channel, as often as its prefs allow
+	throttle := delivery.NewThrottle(reddis.NewPrefsStore(followerStore.Client()))
+	if err := throttle.Load(ctx); err != nil {
+		slog.Error("Could not load delivery prefs, using defaults", "error", err)
+	}
+	rebalance := func(ctx context.Context) error {
+		if err := throttle.Load(ctx); err != nil {
+			slog.Warn("Could not reload delivery prefs", "error", err)
 		}
+		return streamManager.Reload(ctx)
+	}
 
-		streamManager.DeleteCoin(symbol, id)
+	r := gin.Default()
 
+	// circuit breakers state of upstream endpoints
+	r.GET("/breakers", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"status": fmt.Sprintf("for user number %d stopped", id),
-			"symbol": symbol,
+			"breakers": converting.Breakers.Status(),
 		})
 	})
 
@@ -104,24 +107,50 @@ func main() {
 	}()
 
 	// cfgKafka := kaffka.LoadKafkaConfig()
-	// producer := kaffka.NewProducer(cfgKafka)
+	// producer := kaffka.NewProducer[models.KafkaMsg](cfgKafka)
 
-	cfgRedis := reddis.LoadRedisConfig()
-	saver := reddis.NewSaver(cfgRedis, streamManager)
+	// Final candles are written to Kafka only when it is enabled
+	var candleKafkaChan chan models.Candle
+	if getenv.GetBool("CANDLE_KAFKA_ENABLED", false) {
+		candleKafkaChan = make(chan models.Candle, 500)
+
+		cfgCandleKafka := kaffka.LoadKafkaConfig()
+		cfgCandleKafka.Topic = getenv.GetString("CANDLE_KAFKA_TOPIC", "binance.kline")
+		candleProducer := kaffka.NewProducer[models.Candle](cfgCandleKafka)
+
+		wg.Add(1)
+		go candleProducer.Start(ctx, wg, candleKafkaChan)
+	}
+
+	saver := reddis.NewSaver(cfgRedis, streamManager, throttle)
+
+	wg.Add(15)
 
-	wg.Add(7)
+	go converting.Recorder.Start(ctx, wg)
+	go subscriptions.Start(ctx, wg)
+	// Profile tells which users follow which symbols over the control API
+	go control.StartServer(ctx, wg, streamManager, member, throttle)
+	go member.Start(ctx, wg, rebalance)
+	// Prefs set through other replicas are reloaded periodically
+	go throttle.Start(ctx, wg)
 
 	go converting.DistributeMessages(ctx, wg, rawMsgsChan, rawAggTradeChan, rawMiniTickerChan)
 
-	go converting.ReceiveMiniTickerMessage(ctx, wg, rawMsgsChan)
+	// Daily stats of all symbols are streamed by the replica owning their shard only
+	go converting.ReceiveMiniTickerMessage(ctx, wg, rawMsgsChan, member)
 
 	go converting.ConvertRawToArrDS(ctx, wg, rawMiniTickerChan, dailyStatChan)
-	go converting.ConvertRawToSS(ctx, wg, rawAggTradeChan, secondStatChan)
+	go converting.ConvertRawToSS(ctx, wg, rawAggTradeChan, secondStatChan, tradeChan)
+	go converting.ConvertTradesToCandles(ctx, wg, tradeChan, candleChan, candleKafkaChan)
+	go converting.ConvertRawToBookStat(ctx, wg, rawDepthChan, bookStatChan)
 
 	// go converting.ReceiveKafkaMsg(ctx, wg, dailyStatChan, kafkaMsgChan)
 	// go producer.Start(ctx, wg, kafkaMsgChan)
 
 	go saver.Start(ctx, wg, secondStatChan)
+	go saver.StartBook(ctx, wg, bookStatChan)
+	go saver.StartCandles(ctx, wg, candleChan)
+	go saver.StartDaily(ctx, wg, dailyStatChan)
 
 	<-c
 	slog.Info("👾 Received Interruption signal")
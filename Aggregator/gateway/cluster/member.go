@@ -0,0 +1,129 @@
+package cluster
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/shared/shard"
+)
+
+// Member is this replica in the cluster. Without an address sharding is off
+// and the replica owns every symbol
+type Member struct {
+	self     string
+	reg      *shard.Registry
+	mu       sync.RWMutex
+	replicas []string
+}
+
+func NewMember(reg *shard.Registry, self string) *Member {
+	m := &Member{self: self, reg: reg}
+	if self != "" {
+		m.replicas = []string{self}
+	}
+	return m
+}
+
+// Owner returns the replica owning symbol, "" when sharding is off
+func (m *Member) Owner(symbol string) string {
+	if m.self == "" {
+		return ""
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return shard.Owner(symbol, m.replicas)
+}
+
+func (m *Member) Owns(symbol string) bool {
+	owner := m.Owner(symbol)
+	return owner == "" || owner == m.self
+}
+
+// Replicas returns the live replicas this replica knows of, nil when sharding is off
+func (m *Member) Replicas() []string {
+	if m.self == "" {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.replicas)
+}
+
+// Join announces this replica and learns the others, it is called before
+// followers are restored so that only owned symbols are subscribed
+func (m *Member) Join(ctx context.Context) error {
+	if m.self == "" {
+		return nil
+	}
+	if err := m.reg.Heartbeat(ctx, m.self); err != nil {
+		return err
+	}
+	m.refresh(ctx)
+	return nil
+}
+
+// Start heartbeats until ctx is done and calls rebalance whenever replicas
+// join or leave, so symbols of a dead replica are picked up by the others
+func (m *Member) Start(ctx context.Context, wg *sync.WaitGroup, rebalance func(context.Context) error) {
+	defer wg.Done()
+
+	if m.self == "" {
+		slog.Info("Sharding is off, this replica owns every symbol")
+		return
+	}
+
+	slog.Info("🧩 Starting cluster member", "replica", m.self, "ttl", m.reg.TTL)
+
+	ticker := time.NewTicker(m.reg.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := m.reg.Heartbeat(ctx, m.self); err != nil {
+			slog.Warn("Could not send heartbeat", "replica", m.self, "error", err)
+		} else if m.refresh(ctx) {
+			if err := rebalance(ctx); err != nil {
+				slog.Error("Could not rebalance symbols", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if err := m.reg.Leave(leaveCtx, m.self); err != nil {
+				slog.Warn("Could not leave cluster", "replica", m.self, "error", err)
+			}
+			cancel()
+			slog.Info("Got interruption signal, left cluster", "replica", m.self)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh reports whether the set of live replicas changed
+func (m *Member) refresh(ctx context.Context) bool {
+	replicas, err := m.reg.Members(ctx)
+	if err != nil {
+		slog.Warn("Could not list replicas", "error", err)
+		return false
+	}
+	if !slices.Contains(replicas, m.self) {
+		replicas = append(replicas, m.self)
+		slices.Sort(replicas)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.Equal(replicas, m.replicas) {
+		return false
+	}
+
+	slog.Info("Replicas changed", "before", m.replicas, "after", replicas)
+	m.replicas = replicas
+	return true
+}
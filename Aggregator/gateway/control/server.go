@@ -0,0 +1,260 @@
+package control
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/aggregator/gateway/delivery"
+	"github.com/Wladim1r/aggregator/gateway/strman"
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/Wladim1r/proto-crypto/gen/protos/aggregator-profile"
+	"github.com/Wladim1r/shared/tlsconf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Peers allowed to call the control service when TLS_ALLOW is empty
+const defaultTLSAllow = "/aggregator.AggregatorControl/*=profile;/grpc.health.v1.Health/*=*"
+
+// OwnerTrailer names the replica owning the symbol when a call reached another one
+const OwnerTrailer = "aggregator-owner"
+
+// ReplicasHeader lists the replicas Profile split a Sync by, comma separated
+const ReplicasHeader = "aggregator-replicas"
+
+// Symbols as the Socket service takes them, optionally prefixed with a venue: "okx:btcusdt"
+var symbolPattern = regexp.MustCompile(`^([a-z]+:)?[a-z0-9_-]{2,32}$`)
+
+// Cluster tells which replica owns a symbol, it is a *cluster.Member
+type Cluster interface {
+	Owner(symbol string) string
+	Owns(symbol string) bool
+	Replicas() []string
+}
+
+type server struct {
+	aggregator.UnimplementedAggregatorControlServer
+	sm       *strman.StreamManager
+	member   Cluster
+	throttle *delivery.Throttle
+}
+
+func (s *server) Follow(ctx context.Context, req *aggregator.FollowRequest) (*aggregator.FollowResponse, error) {
+	symbol, err := validate(req.Symbol, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwner(ctx, symbol); err != nil {
+		return nil, err
+	}
+
+	changed, followers, err := s.sm.AddCoin(ctx, symbol, int(req.UserId))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &aggregator.FollowResponse{
+		Symbol:    symbol,
+		Followers: int32(followers),
+		Changed:   changed,
+	}, nil
+}
+
+func (s *server) Unfollow(ctx context.Context, req *aggregator.FollowRequest) (*aggregator.FollowResponse, error) {
+	symbol, err := validate(req.Symbol, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkOwner(ctx, symbol); err != nil {
+		return nil, err
+	}
+
+	changed, followers, err := s.sm.DeleteCoin(ctx, symbol, int(req.UserId))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &aggregator.FollowResponse{
+		Symbol:    symbol,
+		Followers: int32(followers),
+		Changed:   changed,
+	}, nil
+}
+
+func (s *server) ListFollowers(
+	ctx context.Context,
+	req *aggregator.ListFollowersRequest,
+) (*aggregator.ListFollowersResponse, error) {
+	if req.Symbol != "" {
+		if _, err := validate(req.Symbol, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot := s.sm.Snapshot(req.Symbol)
+	resp := &aggregator.ListFollowersResponse{
+		Symbols: make([]*aggregator.SymbolFollowers, 0, len(snapshot)),
+	}
+	for symbol, users := range snapshot {
+		sf := &aggregator.SymbolFollowers{Symbol: symbol}
+		for _, id := range users {
+			sf.UserIds = append(sf.UserIds, int64(id))
+		}
+		slices.Sort(sf.UserIds)
+		resp.Symbols = append(resp.Symbols, sf)
+	}
+	sort.Slice(resp.Symbols, func(i, j int) bool {
+		return resp.Symbols[i].Symbol < resp.Symbols[j].Symbol
+	})
+	return resp, nil
+}
+
+// Sync is validated as a whole, a single bad entry rejects the request and nothing changes.
+// Symbols of other replicas are skipped, Profile sends every replica its own share
+func (s *server) Sync(ctx context.Context, req *aggregator.SyncRequest) (*aggregator.SyncResponse, error) {
+	if err := s.checkReplicas(ctx); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string][]int, len(req.Symbols))
+	for _, sf := range req.Symbols {
+		for _, id := range sf.UserIds {
+			symbol, err := validate(sf.Symbol, id)
+			if err != nil {
+				return nil, err
+			}
+			wanted[symbol] = append(wanted[symbol], int(id))
+		}
+	}
+
+	followed, unfollowed, err := s.sm.Sync(ctx, wanted)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &aggregator.SyncResponse{
+		Followed:   int32(followed),
+		Unfollowed: int32(unfollowed),
+	}, nil
+}
+
+// SetDelivery is sent to every replica, each of them may serve symbols of the user
+func (s *server) SetDelivery(
+	ctx context.Context,
+	req *aggregator.DeliveryRequest,
+) (*aggregator.DeliveryResponse, error) {
+	if req.UserId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user id %d", req.UserId)
+	}
+	if req.IntervalMs < 0 || req.ThresholdBps < 0 || req.ThresholdBps > 10000 {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"invalid delivery prefs: interval %dms, threshold %d bps", req.IntervalMs, req.ThresholdBps)
+	}
+
+	prefs := delivery.Prefs{
+		Interval:     time.Duration(req.IntervalMs) * time.Millisecond,
+		ThresholdBps: int(req.ThresholdBps),
+	}
+	if err := s.throttle.Set(ctx, int(req.UserId), prefs); err != nil {
+		slog.Error("Could not save delivery prefs", "error", err)
+		return nil, status.Errorf(codes.Unavailable, "could not save delivery prefs: %v", err)
+	}
+	return &aggregator.DeliveryResponse{
+		IntervalMs:   req.IntervalMs,
+		ThresholdBps: req.ThresholdBps,
+	}, nil
+}
+
+// checkOwner refuses symbols of other replicas, the caller retries on the owner
+func (s *server) checkOwner(ctx context.Context, symbol string) error {
+	if s.member.Owns(symbol) {
+		return nil
+	}
+
+	owner := s.member.Owner(symbol)
+	grpc.SetTrailer(ctx, metadata.Pairs(OwnerTrailer, owner))
+	return status.Errorf(codes.FailedPrecondition, "symbol %q is owned by replica %s", symbol, owner)
+}
+
+// checkReplicas refuses a Sync split by other replicas than the ones known
+// here. The share would be wrong while the replicas change, and owned symbols
+// sent to another replica would lose their followers. Profile syncs again
+func (s *server) checkReplicas(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ReplicasHeader)
+	replicas := s.member.Replicas()
+	if len(values) == 0 || replicas == nil {
+		return nil
+	}
+
+	theirs := strings.Split(values[0], ",")
+	slices.Sort(theirs)
+	if slices.Equal(theirs, replicas) {
+		return nil
+	}
+
+	slog.Info("Sync split by other replicas, refused", "theirs", theirs, "ours", replicas)
+	grpc.SetTrailer(ctx, metadata.Pairs(ReplicasHeader, strings.Join(replicas, ",")))
+	return status.Errorf(codes.Aborted, "replicas changed: sync was split by %v, live are %v", theirs, replicas)
+}
+
+func validate(symbol string, userID int64) (string, error) {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if !symbolPattern.MatchString(symbol) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid symbol %q", symbol)
+	}
+	if userID <= 0 {
+		return "", status.Errorf(codes.InvalidArgument, "invalid user id %d", userID)
+	}
+	return symbol, nil
+}
+
+// storeError reports a failed write of the follower store, nothing was changed then
+func storeError(err error) error {
+	slog.Error("Could not save followers", "error", err)
+	return status.Errorf(codes.Unavailable, "could not save followers: %v", err)
+}
+
+// StartServer serves the control API on CONTROL_ADDR until ctx is done
+func StartServer(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	sm *strman.StreamManager,
+	member Cluster,
+	throttle *delivery.Throttle,
+) {
+	defer wg.Done()
+
+	address := getenv.GetString("CONTROL_ADDR", ":50061")
+
+	listen, err := net.Listen("tcp", address)
+	if err != nil {
+		slog.Error("Could not listen control address", "address", address, "error", err)
+		return
+	}
+
+	opts, err := tlsconf.ServerOptions(tlsconf.LoadFromEnv(), tlsconf.PolicyFromEnv(defaultTLSAllow))
+	if err != nil {
+		slog.Error("Could not set up TLS", "error", err)
+		return
+	}
+	svr := grpc.NewServer(opts...)
+	aggregator.RegisterAggregatorControlServer(svr, &server{sm: sm, member: member, throttle: throttle})
+
+	go func() {
+		slog.Info("👂 Control server listening", "address", address)
+		if err := svr.Serve(listen); err != nil {
+			slog.Error("Failed to run control server", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Got interruption signal, stopping control server")
+	svr.GracefulStop()
+}
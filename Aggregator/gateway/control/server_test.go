@@ -0,0 +1,214 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/Wladim1r/aggregator/gateway/converting"
+	"github.com/Wladim1r/aggregator/gateway/strman"
+	"github.com/Wladim1r/proto-crypto/gen/protos/aggregator-profile"
+	"github.com/Wladim1r/shared/shard"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// replicas is a cluster of fixed replicas, sharding is off without self
+type replicas struct {
+	self string
+	all  []string
+}
+
+func (r *replicas) Owner(symbol string) string {
+	if r.self == "" {
+		return ""
+	}
+	return shard.Owner(symbol, r.all)
+}
+
+func (r *replicas) Owns(symbol string) bool {
+	owner := r.Owner(symbol)
+	return owner == "" || owner == r.self
+}
+
+func (r *replicas) Replicas() []string {
+	if r.self == "" {
+		return nil
+	}
+	return slices.Clone(r.all)
+}
+
+// symbols returns n symbols owned by replica
+func (r *replicas) symbols(replica string, n int) []string {
+	var res []string
+	for i := 0; len(res) < n; i++ {
+		if symbol := fmt.Sprintf("coin%dusdt", i); shard.Owner(symbol, r.all) == replica {
+			res = append(res, symbol)
+		}
+	}
+	return res
+}
+
+// startServer serves the control API of member over an in-memory connection
+func startServer(t *testing.T, member *replicas) (aggregator.AggregatorControlClient, *strman.StreamManager) {
+	t.Helper()
+
+	sm := strman.NewStreamManager(converting.NewSubscriptions(make(chan []byte), nil), nil, member)
+	listen := bufconn.Listen(1 << 20)
+	svr := grpc.NewServer()
+	aggregator.RegisterAggregatorControlServer(svr, &server{sm: sm, member: member})
+	go svr.Serve(listen)
+	t.Cleanup(svr.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///control",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listen.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return aggregator.NewAggregatorControlClient(conn), sm
+}
+
+func syncRequest(follows map[string][]int64) *aggregator.SyncRequest {
+	req := &aggregator.SyncRequest{}
+	for symbol, users := range follows {
+		req.Symbols = append(req.Symbols, &aggregator.SymbolFollowers{Symbol: symbol, UserIds: users})
+	}
+	return req
+}
+
+func expectCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Fatalf("err = %v, want code %v", err, want)
+	}
+}
+
+func TestSyncOwnedSymbols(t *testing.T) {
+	member := &replicas{self: "a:50061", all: []string{"a:50061", "b:50061"}}
+	client, sm := startServer(t, member)
+	ours, theirs := member.symbols("a:50061", 2), member.symbols("b:50061", 1)
+
+	resp, err := client.Sync(context.Background(), syncRequest(map[string][]int64{
+		ours[0]:   {1, 2, 2},
+		ours[1]:   {3},
+		theirs[0]: {4},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Symbols of the other replica are left to it
+	if resp.Followed != 3 || resp.Unfollowed != 0 {
+		t.Fatalf("response = %v, want 3 followed", resp)
+	}
+	if snapshot := sm.Snapshot(""); len(snapshot) != 2 || len(snapshot[ours[0]]) != 2 {
+		t.Fatalf("followers = %v, want %s and %s only", snapshot, ours[0], ours[1])
+	}
+
+	// The wanted state is complete, missing follows are removed
+	resp, err = client.Sync(context.Background(), syncRequest(map[string][]int64{ours[0]: {1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Followed != 0 || resp.Unfollowed != 2 {
+		t.Fatalf("response = %v, want 2 unfollowed", resp)
+	}
+}
+
+func TestSyncInvalid(t *testing.T) {
+	client, sm := startServer(t, &replicas{})
+	if _, err := client.Sync(context.Background(), syncRequest(map[string][]int64{"btcusdt": {1}})); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		follows map[string][]int64
+	}{
+		{"bad symbol", map[string][]int64{"ethusdt": {1}, "btc usdt!": {1}}},
+		{"too short", map[string][]int64{"ethusdt": {1}, "b": {1}}},
+		{"no user", map[string][]int64{"ethusdt": {1, 0}}},
+		{"negative user", map[string][]int64{"ethusdt": {-2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Sync(context.Background(), syncRequest(tt.follows))
+			expectCode(t, err, codes.InvalidArgument)
+
+			// A bad entry rejects the whole request
+			if snapshot := sm.Snapshot(""); len(snapshot) != 1 || len(snapshot["btcusdt"]) != 1 {
+				t.Fatalf("followers = %v, want btcusdt untouched", snapshot)
+			}
+		})
+	}
+}
+
+func TestSyncReplicasHeader(t *testing.T) {
+	member := &replicas{self: "a:50061", all: []string{"a:50061", "b:50061"}}
+	client, sm := startServer(t, member)
+	ours := member.symbols("a:50061", 1)
+	req := syncRequest(map[string][]int64{ours[0]: {1}})
+
+	// Split by a replica that is gone
+	var trailer metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), ReplicasHeader, "a:50061,b:50061,c:50061")
+	_, err := client.Sync(ctx, req, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.Aborted)
+	if got := trailer.Get(ReplicasHeader); !slices.Equal(got, []string{"a:50061,b:50061"}) {
+		t.Fatalf("trailer = %v, want the live replicas", got)
+	}
+	if snapshot := sm.Snapshot(""); len(snapshot) != 0 {
+		t.Fatalf("followers = %v, want nothing synced", snapshot)
+	}
+
+	// Order does not matter, a request without the header is taken as is
+	for _, header := range []string{"b:50061,a:50061", ""} {
+		ctx := context.Background()
+		if header != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, ReplicasHeader, header)
+		}
+		if _, err := client.Sync(ctx, req); err != nil {
+			t.Fatalf("header %q: %v", header, err)
+		}
+	}
+
+	// Without sharding every split is accepted
+	client, _ = startServer(t, &replicas{})
+	ctx = metadata.AppendToOutgoingContext(context.Background(), ReplicasHeader, "c:50061")
+	if _, err := client.Sync(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowOwner(t *testing.T) {
+	member := &replicas{self: "a:50061", all: []string{"a:50061", "b:50061"}}
+	client, sm := startServer(t, member)
+	ours, theirs := member.symbols("a:50061", 1), member.symbols("b:50061", 1)
+
+	var trailer metadata.MD
+	_, err := client.Follow(context.Background(),
+		&aggregator.FollowRequest{Symbol: theirs[0], UserId: 1}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.FailedPrecondition)
+	if got := trailer.Get(OwnerTrailer); !slices.Equal(got, []string{"b:50061"}) {
+		t.Fatalf("trailer = %v, want owner b:50061", got)
+	}
+
+	resp, err := client.Follow(context.Background(), &aggregator.FollowRequest{Symbol: ours[0], UserId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Changed || resp.Followers != 1 || !sm.Follows(ours[0]) {
+		t.Fatalf("response = %v, want %s followed", resp, ours[0])
+	}
+}
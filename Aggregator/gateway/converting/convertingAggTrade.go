@@ -11,14 +11,20 @@ import (
 	"github.com/Wladim1r/aggregator/models"
 )
 
+// ConvertRawToSS reduces aggTrades to second stats, parsed trades are
+// also passed to tradeChan for the candle builder when it is not nil
 func ConvertRawToSS(
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	inChan chan []byte,
 	outChan chan models.SecondStat,
+	tradeChan chan models.AggTrade,
 ) {
 	defer wg.Done()
 	defer close(outChan)
+	if tradeChan != nil {
+		defer close(tradeChan)
+	}
 
 	wgWorker := new(sync.WaitGroup)
 	aggTrChan := make(chan models.AggTrade, 100)
@@ -41,6 +47,12 @@ func ConvertRawToSS(
 				slog.Error("Could not parse bytes into aggTrade struct", "error", err)
 				continue
 			}
+			if aggTrade.EventType == models.EventStale {
+				slog.Warn("Trade stream stale state changed",
+					"exchange", aggTrade.Exchange,
+					"symbol", aggTrade.Symbol,
+					"stale", aggTrade.Stale)
+			}
 
 			select {
 			case <-ctx.Done():
@@ -49,6 +61,18 @@ func ConvertRawToSS(
 				return
 			case aggTrChan <- aggTrade:
 			}
+
+			// Stale events carry no trade for candles
+			if tradeChan == nil || aggTrade.EventType == models.EventStale {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				slog.Info("Got Interruption signal, stopping to converting messages from stream")
+				wgWorker.Wait()
+				return
+			case tradeChan <- aggTrade:
+			}
 		}
 	}
 }
@@ -63,6 +87,8 @@ func receiveSecondStat(
 
 	// Map to store latest price per symbol
 	latestPrices := make(map[string]float64)
+	// Symbols whose trade stream is silent, their last price is sent marked stale
+	staleSymbols := make(map[string]bool)
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -77,15 +103,28 @@ func receiveSecondStat(
 			if !ok {
 				return
 			}
-			// Update latest price for this symbol
 			symbol := strings.ToLower(msg.Symbol)
+			if msg.EventType == models.EventStale {
+				if msg.Kind != "trade" || symbol == "" {
+					continue
+				}
+				if msg.Stale {
+					staleSymbols[symbol] = true
+				} else {
+					delete(staleSymbols, symbol)
+				}
+				continue
+			}
+			// Update latest price for this symbol
 			latestPrices[symbol] = msg.PriceFloat()
+			delete(staleSymbols, symbol)
 		case <-ticker.C:
 			// Every second, send latest prices for all symbols
 			for symbol, price := range latestPrices {
 				secondStat := models.SecondStat{
 					Symbol: symbol,
 					Price:  price,
+					Stale:  staleSymbols[symbol],
 				}
 				select {
 				case <-ctx.Done():
@@ -0,0 +1,251 @@
+package converting
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/Wladim1r/aggregator/models"
+	"github.com/shopspring/decimal"
+)
+
+const eventKline = "kline"
+
+var (
+	CandleIntervals = getenv.GetSlice("CANDLE_INTERVALS", []string{"1s", "1m", "5m", "1h"})
+	// How long a candle stays open after its close time for trades arriving late
+	CandleGrace = getenv.GetTime("CANDLE_GRACE", 2*time.Second)
+	// How often updates of open candles are sent
+	CandleUpdateInterval = getenv.GetTime("CANDLE_UPDATE_INTERVAL", time.Second)
+)
+
+type candleInterval struct {
+	name string
+	ms   int64
+}
+
+func parseIntervals(names []string) []candleInterval {
+	intervals := make([]candleInterval, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		d, err := time.ParseDuration(name)
+		if err != nil || d < time.Second {
+			slog.Error("Invalid candle interval, skipping", "interval", name, "error", err)
+			continue
+		}
+		intervals = append(intervals, candleInterval{name: name, ms: d.Milliseconds()})
+	}
+	return intervals
+}
+
+type candleKey struct {
+	symbol   string
+	interval string
+	openTime int64
+}
+
+// candleState is a candle being built, trades may come out of order,
+// so open and close prices are taken from the earliest and the latest trade
+type candleState struct {
+	candle         models.Candle
+	openTradeTime  int64
+	closeTradeTime int64
+	dirty          bool
+}
+
+func newCandleState(symbol string, interval candleInterval, openTime int64) *candleState {
+	return &candleState{
+		candle: models.Candle{
+			EventType: eventKline,
+			Symbol:    symbol,
+			Interval:  interval.name,
+			OpenTime:  openTime,
+			CloseTime: openTime + interval.ms - 1,
+		},
+	}
+}
+
+func (cs *candleState) add(trade models.AggTrade, price, qty decimal.Decimal) {
+	c := &cs.candle
+
+	if c.Trades == 0 || trade.TradeTime < cs.openTradeTime {
+		c.Open = price
+		cs.openTradeTime = trade.TradeTime
+	}
+	if c.Trades == 0 || trade.TradeTime >= cs.closeTradeTime {
+		c.Close = price
+		cs.closeTradeTime = trade.TradeTime
+	}
+	if c.Trades == 0 || price.GreaterThan(c.High) {
+		c.High = price
+	}
+	if c.Trades == 0 || price.LessThan(c.Low) {
+		c.Low = price
+	}
+
+	c.Volume = c.Volume.Add(qty)
+	c.QuoteVolume = c.QuoteVolume.Add(qty.Mul(price))
+	// Buyer is the maker, so the seller took liquidity
+	if trade.IsBuyer {
+		c.SellVolume = c.SellVolume.Add(qty)
+	} else {
+		c.BuyVolume = c.BuyVolume.Add(qty)
+	}
+	c.Trades++
+	cs.dirty = true
+}
+
+// candleBuilder buckets trades into candles of every interval by their trade
+// time. A candle is final once grace has passed after its close time, trades
+// for final candles are dropped as late
+type candleBuilder struct {
+	intervals  []candleInterval
+	grace      time.Duration
+	candles    map[candleKey]*candleState
+	lateTrades int
+}
+
+func newCandleBuilder(intervals []candleInterval, grace time.Duration) *candleBuilder {
+	return &candleBuilder{
+		intervals: intervals,
+		grace:     grace,
+		candles:   make(map[candleKey]*candleState),
+	}
+}
+
+// add puts the trade received at now into the open candles
+func (b *candleBuilder) add(trade models.AggTrade, now time.Time) error {
+	price, err := decimal.NewFromString(trade.Price)
+	if err != nil {
+		return fmt.Errorf("invalid trade price %q: %w", trade.Price, err)
+	}
+	qty, err := decimal.NewFromString(trade.Quantity)
+	if err != nil {
+		return fmt.Errorf("invalid trade quantity %q: %w", trade.Quantity, err)
+	}
+
+	symbol := strings.ToLower(trade.Symbol)
+	deadline := now.Add(-b.grace).UnixMilli()
+
+	for _, interval := range b.intervals {
+		openTime := trade.TradeTime - trade.TradeTime%interval.ms
+		if openTime+interval.ms <= deadline {
+			// The candle is already final
+			b.lateTrades++
+			if b.lateTrades%100 == 1 {
+				slog.Warn("Dropping late trades",
+					"symbol", symbol,
+					"interval", interval.name,
+					"trade_time", trade.TradeTime,
+					"total", b.lateTrades)
+			}
+			continue
+		}
+
+		key := candleKey{symbol: symbol, interval: interval.name, openTime: openTime}
+		cs, exists := b.candles[key]
+		if !exists {
+			cs = newCandleState(symbol, interval, openTime)
+			b.candles[key] = cs
+		}
+		cs.add(trade, price, qty)
+	}
+	return nil
+}
+
+// flush returns candles which changed since the last flush and are still
+// open, and candles which became final at now. Final candles are forgotten
+func (b *candleBuilder) flush(now time.Time) (updates, finals []models.Candle) {
+	deadline := now.Add(-b.grace).UnixMilli()
+
+	for key, cs := range b.candles {
+		if cs.candle.CloseTime < deadline {
+			cs.candle.Final = true
+			delete(b.candles, key)
+			finals = append(finals, cs.candle)
+			continue
+		}
+
+		if cs.dirty {
+			cs.dirty = false
+			updates = append(updates, cs.candle)
+		}
+	}
+	return updates, finals
+}
+
+// ConvertTradesToCandles builds OHLCV candles of every interval from trades.
+// Updates of open candles and final candles go to outChan, final candles
+// also go to finalChan when it is not nil. Updates are dropped when outChan
+// is full, final candles wait for room, there is no later candle replacing them
+func ConvertTradesToCandles(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	inChan chan models.AggTrade,
+	outChan chan models.Candle,
+	finalChan chan models.Candle,
+) {
+	defer wg.Done()
+	defer close(outChan)
+	if finalChan != nil {
+		defer close(finalChan)
+	}
+
+	builder := newCandleBuilder(parseIntervals(CandleIntervals), CandleGrace)
+	slog.Info("🕯️ Starting candle builder", "intervals", CandleIntervals, "grace", CandleGrace)
+
+	ticker := time.NewTicker(CandleUpdateInterval)
+	defer ticker.Stop()
+
+	sendFinal := func(ch chan models.Candle, c models.Candle) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case ch <- c:
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got Interruption signal, stopping to building candles")
+			return
+		case trade, ok := <-inChan:
+			if !ok {
+				return
+			}
+
+			if err := builder.add(trade, time.Now()); err != nil {
+				slog.Error("Could not add trade to candles", "symbol", trade.Symbol, "error", err)
+			}
+		case now := <-ticker.C:
+			updates, finals := builder.flush(now)
+
+			for _, c := range finals {
+				if !sendFinal(outChan, c) {
+					return
+				}
+				if finalChan != nil && !sendFinal(finalChan, c) {
+					return
+				}
+			}
+
+			for _, c := range updates {
+				select {
+				case <-ctx.Done():
+					return
+				case outChan <- c:
+				default:
+					slog.Debug("Candle channel is full, dropping update",
+						"symbol", c.Symbol,
+						"interval", c.Interval)
+				}
+			}
+		}
+	}
+}
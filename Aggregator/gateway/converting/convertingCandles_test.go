@@ -0,0 +1,179 @@
+package converting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/aggregator/models"
+	"github.com/shopspring/decimal"
+)
+
+func trade(tradeTime int64, price, qty string, isBuyer bool) models.AggTrade {
+	return models.AggTrade{
+		Symbol:    "BTCUSDT",
+		Price:     price,
+		Quantity:  qty,
+		TradeTime: tradeTime,
+		IsBuyer:   isBuyer,
+	}
+}
+
+func TestCandleBuilderClose(t *testing.T) {
+	b := newCandleBuilder(parseIntervals([]string{"1m"}), 2*time.Second)
+	// 12:00:00 of some day, the start of a minute
+	start := time.UnixMilli(1718000000000 - 1718000000000%60000)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Out of order trades, open and close come from the earliest and the latest one
+	for _, tr := range []models.AggTrade{
+		trade(at(20*time.Second).UnixMilli(), "101", "1", false),
+		trade(at(5*time.Second).UnixMilli(), "100", "2", true),
+		trade(at(50*time.Second).UnixMilli(), "99", "1", false),
+		trade(at(30*time.Second).UnixMilli(), "103", "0.5", false),
+	} {
+		if err := b.add(tr, at(55*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updates, finals := b.flush(at(56 * time.Second))
+	if len(finals) != 0 || len(updates) != 1 {
+		t.Fatalf("got %d updates and %d finals, want 1 update", len(updates), len(finals))
+	}
+	if updates[0].Final {
+		t.Fatal("open candle is marked final")
+	}
+
+	// Nothing changed, nothing to send
+	if updates, finals = b.flush(at(57 * time.Second)); len(updates)+len(finals) != 0 {
+		t.Fatalf("got %d updates and %d finals without new trades", len(updates), len(finals))
+	}
+
+	// Still open within the grace period after the close time
+	if updates, finals = b.flush(at(61 * time.Second)); len(finals) != 0 {
+		t.Fatal("candle is final within the grace period")
+	}
+
+	_, finals = b.flush(at(62*time.Second + time.Millisecond))
+	if len(finals) != 1 {
+		t.Fatalf("got %d finals after the grace period, want 1", len(finals))
+	}
+
+	c := finals[0]
+	want := map[string][2]decimal.Decimal{
+		"open":         {c.Open, decimal.RequireFromString("100")},
+		"high":         {c.High, decimal.RequireFromString("103")},
+		"low":          {c.Low, decimal.RequireFromString("99")},
+		"close":        {c.Close, decimal.RequireFromString("99")},
+		"volume":       {c.Volume, decimal.RequireFromString("4.5")},
+		"quote volume": {c.QuoteVolume, decimal.RequireFromString("451.5")},
+		"buy volume":   {c.BuyVolume, decimal.RequireFromString("2.5")},
+		"sell volume":  {c.SellVolume, decimal.RequireFromString("2")},
+	}
+	for name, v := range want {
+		if !v[0].Equal(v[1]) {
+			t.Errorf("%s = %s, want %s", name, v[0], v[1])
+		}
+	}
+	if !c.Final || c.Trades != 4 || c.Symbol != "btcusdt" {
+		t.Errorf("candle = %+v", c)
+	}
+	if c.OpenTime != start.UnixMilli() || c.CloseTime != start.UnixMilli()+59999 {
+		t.Errorf("candle spans %d-%d", c.OpenTime, c.CloseTime)
+	}
+
+	// The candle is forgotten once final
+	if updates, finals = b.flush(at(70 * time.Second)); len(updates)+len(finals) != 0 {
+		t.Fatal("final candle was sent twice")
+	}
+}
+
+func TestCandleBuilderLateTrades(t *testing.T) {
+	b := newCandleBuilder(parseIntervals([]string{"1s", "1m"}), 2*time.Second)
+	start := time.UnixMilli(1718000000000 - 1718000000000%60000)
+	tradeTime := start.Add(10 * time.Second).UnixMilli()
+
+	// Within the grace period of the 1s candle the trade still counts
+	if err := b.add(trade(tradeTime, "100", "1", false), start.Add(12*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// Past it the 1s candle is final, the trade only goes to the 1m candle
+	if err := b.add(trade(tradeTime, "100", "1", false), start.Add(13*time.Second+time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if b.lateTrades != 1 {
+		t.Fatalf("late trades = %d, want 1", b.lateTrades)
+	}
+
+	_, finals := b.flush(start.Add(13*time.Second + time.Millisecond))
+	if len(finals) != 1 || finals[0].Interval != "1s" || finals[0].Trades != 1 {
+		t.Fatalf("finals = %+v, want the 1s candle with 1 trade", finals)
+	}
+	updates, _ := b.flush(start.Add(13*time.Second + time.Millisecond))
+	if len(updates) != 0 {
+		t.Fatal("1m candle was sent again without changes")
+	}
+
+	_, finals = b.flush(start.Add(63 * time.Second))
+	if len(finals) != 1 || finals[0].Interval != "1m" || finals[0].Trades != 2 {
+		t.Fatalf("finals = %+v, want the 1m candle with 2 trades", finals)
+	}
+}
+
+func TestCandleBuilderInvalidTrade(t *testing.T) {
+	b := newCandleBuilder(parseIntervals([]string{"1m"}), time.Second)
+	if err := b.add(trade(1718000000000, "x", "1", false), time.UnixMilli(1718000000000)); err == nil {
+		t.Fatal("expected an error for an invalid price")
+	}
+	if updates, finals := b.flush(time.UnixMilli(1718000000000)); len(updates)+len(finals) != 0 {
+		t.Fatal("invalid trade made a candle")
+	}
+}
+
+// Final candles wait for a full channel instead of being dropped
+func TestConvertTradesToCandlesKeepsFinals(t *testing.T) {
+	intervals, grace, every := CandleIntervals, CandleGrace, CandleUpdateInterval
+	CandleIntervals, CandleGrace, CandleUpdateInterval = []string{"1s"}, 0, 10*time.Millisecond
+	defer func() { CandleIntervals, CandleGrace, CandleUpdateInterval = intervals, grace, every }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	inChan := make(chan models.AggTrade)
+	outChan := make(chan models.Candle)
+	finalChan := make(chan models.Candle)
+
+	wg.Add(1)
+	go ConvertTradesToCandles(ctx, &wg, inChan, outChan, finalChan)
+
+	inChan <- trade(time.Now().UnixMilli(), "100", "1", false)
+
+	// Nobody reads for longer than the candle lives
+	time.Sleep(1100 * time.Millisecond)
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case c := <-outChan:
+			if !c.Final {
+				continue
+			}
+			select {
+			case f := <-finalChan:
+				if f.OpenTime != c.OpenTime {
+					t.Fatalf("final candle %d, want %d", f.OpenTime, c.OpenTime)
+				}
+			case <-deadline:
+				t.Fatal("final candle did not reach finalChan")
+			}
+			cancel()
+			wg.Wait()
+			return
+		case <-deadline:
+			t.Fatal("final candle was dropped")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package converting
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"log/slog"
@@ -27,6 +28,9 @@ func ConvertRawToArrDS(
 
 	defer close(workerChan)
 
+	// Last ticker of every symbol, sent once more when the stream goes stale or comes back
+	lastTickers := make(map[string]models.MiniTicker)
+
 	wgWorker.Add(numWorkers)
 	for range 4 {
 		go ReceiveDailyStat(ctx, wgWorker, workerChan, outputChan)
@@ -41,6 +45,33 @@ func ConvertRawToArrDS(
 			if !ok {
 				return
 			}
+			// Stale events of the stream come as an object, not as an array of tickers
+			if trimmed := bytes.TrimSpace(arrBytes); len(trimmed) > 0 && trimmed[0] == '{' {
+				var event models.TickerStale
+				if err := json.Unmarshal(trimmed, &event); err != nil || event.EventType != models.EventStale {
+					slog.Error("Could not parse object from miniTicker stream", "data", string(trimmed), "error", err)
+					continue
+				}
+				slog.Warn("MiniTicker stream stale state changed",
+					"stream", event.Stream,
+					"stale", event.Stale,
+					"silence_ms", event.SilenceMs)
+
+				// One stream carries the whole market, all of its stats change staleness
+				for _, msg := range lastTickers {
+					dailyStat := newDailyStat(msg)
+					dailyStat.Stale = event.Stale
+					select {
+					case <-ctx.Done():
+						wgWorker.Wait()
+						slog.Info("Got Interruption signal, stopping to converting messages from stream")
+						return
+					case outputChan <- dailyStat:
+					}
+				}
+				continue
+			}
+
 			var arrMsgs []models.MiniTicker
 			if err := json.Unmarshal(arrBytes, &arrMsgs); err != nil {
 				slog.Error("Could not parse bytes into array of miniTickers", "error", err)
@@ -48,6 +79,9 @@ func ConvertRawToArrDS(
 			}
 
 			slog.Debug("Received batch", "size", len(arrMsgs))
+			for _, msg := range arrMsgs {
+				lastTickers[msg.Symbol] = msg
+			}
 
 			select {
 			case <-ctx.Done():
@@ -90,16 +124,7 @@ func ReceiveDailyStat(
 			if !ok {
 				return
 			}
-			dailyStat := models.DailyStat{
-				EventType:  msg.EventType,
-				EventTime:  msg.EventTime,
-				RecvTime:   time.Now().UnixMilli(),
-				Symbol:     msg.Symbol,
-				ClosePrice: msg.ClosePriceFloat(),
-				OpenPrice:  msg.OpenPriceFloat(),
-				HighPrice:  msg.HighPriceFloat(),
-				LowPrice:   msg.LowPriceFloat(),
-			}
+			dailyStat := newDailyStat(msg)
 			select {
 			case <-ctx.Done():
 				slog.Info(
@@ -113,6 +138,19 @@ func ReceiveDailyStat(
 	}
 }
 
+func newDailyStat(msg models.MiniTicker) models.DailyStat {
+	return models.DailyStat{
+		EventType:  msg.EventType,
+		EventTime:  msg.EventTime,
+		RecvTime:   time.Now().UnixMilli(),
+		Symbol:     msg.Symbol,
+		ClosePrice: msg.ClosePriceFloat(),
+		OpenPrice:  msg.OpenPriceFloat(),
+		HighPrice:  msg.HighPriceFloat(),
+		LowPrice:   msg.LowPriceFloat(),
+	}
+}
+
 func ReceiveKafkaMsg(
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -0,0 +1,64 @@
+package converting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/aggregator/models"
+)
+
+func receiveStats(t *testing.T, ch chan models.DailyStat, n int) map[string]models.DailyStat {
+	t.Helper()
+
+	res := make(map[string]models.DailyStat)
+	for range n {
+		select {
+		case stat := <-ch:
+			res[stat.Symbol] = stat
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of %d daily stats", len(res), n)
+		}
+	}
+	return res
+}
+
+func TestConvertRawToArrDSStale(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []byte)
+	out := make(chan models.DailyStat, 10)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go ConvertRawToArrDS(ctx, wg, in, out)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	in <- []byte(`[{"e":"24hrMiniTicker","s":"BTCUSDT","c":"100","o":"90"},{"e":"24hrMiniTicker","s":"ETHUSDT","c":"4000","o":"4000"}]`)
+	in <- []byte(`[{"e":"24hrMiniTicker","s":"BTCUSDT","c":"110","o":"90"}]`)
+	receiveStats(t, out, 3)
+
+	// The last stats of every symbol are sent once more marked stale
+	in <- []byte(` {"e":"stale","stream":"!miniTicker@arr","stale":true,"silence_ms":60000}`)
+	stats := receiveStats(t, out, 2)
+	if btc := stats["BTCUSDT"]; !btc.Stale || btc.ClosePrice != 110 || !stats["ETHUSDT"].Stale {
+		t.Fatalf("stats = %+v, want the last ones marked stale", stats)
+	}
+
+	// And unmarked when the stream comes back
+	in <- []byte(`{"e":"stale","stream":"!miniTicker@arr","stale":false}`)
+	stats = receiveStats(t, out, 2)
+	if stats["BTCUSDT"].Stale || stats["ETHUSDT"].Stale {
+		t.Fatalf("stats = %+v, want them live again", stats)
+	}
+
+	// Other objects are not taken for markers
+	in <- []byte(`{"e":"24hrMiniTicker","s":"BTCUSDT"}`)
+	select {
+	case stat := <-out:
+		t.Fatalf("got %+v from an unexpected object", stat)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,85 @@
+package converting
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/Wladim1r/aggregator/models"
+)
+
+var (
+	BookTopN     = getenv.GetInt("BOOK_TOP_N", 10)
+	BookInterval = getenv.GetTime("BOOK_STAT_INTERVAL", time.Second)
+)
+
+// ConvertRawToBookStat turns order books from the depth streams into top-N metrics,
+// the latest book of every symbol is sent once per BookInterval
+func ConvertRawToBookStat(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	inChan chan []byte,
+	outChan chan models.BookStat,
+) {
+	defer wg.Done()
+	defer close(outChan)
+
+	latestBooks := make(map[string]models.BookStat)
+	ticker := time.NewTicker(BookInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got Interruption signal, stopping to converting order books")
+			return
+		case msg, ok := <-inChan:
+			if !ok {
+				return
+			}
+			var book models.DepthBook
+			if err := json.Unmarshal(msg, &book); err != nil {
+				slog.Error("Could not parse bytes into DepthBook struct", "error", err)
+				continue
+			}
+			if book.EventType == models.EventStale {
+				symbol := strings.ToLower(book.Symbol)
+				slog.Warn("Order book stream stale state changed", "symbol", symbol, "stale", book.Stale)
+				if book.Stale {
+					// The last book is sent once more marked stale, so readers stop trusting it
+					stat := latestBooks[symbol]
+					stat.Symbol = symbol
+					stat.EventTime = book.EventTime
+					stat.Stale = true
+					latestBooks[symbol] = stat
+				}
+				continue
+			}
+
+			stat, ok := book.TopN(BookTopN)
+			if !ok {
+				slog.Debug("Order book has an empty side, skipping", "symbol", book.Symbol)
+				continue
+			}
+			stat.Symbol = strings.ToLower(stat.Symbol)
+			latestBooks[stat.Symbol] = stat
+		case <-ticker.C:
+			for symbol, stat := range latestBooks {
+				select {
+				case <-ctx.Done():
+					slog.Info("Got Interruption signal, stopping to converting order books")
+					return
+				case outChan <- stat:
+				default:
+					slog.Debug("BookStat channel is full, dropping message", "symbol", symbol)
+				}
+			}
+			// Books of unfollowed symbols must not be sent forever
+			clear(latestBooks)
+		}
+	}
+}
@@ -8,16 +8,34 @@ import (
 	"time"
 
 	"github.com/Wladim1r/aggregator/lib/getenv"
-	"github.com/Wladim1r/proto-crypto/gen/socket-aggregator"
+	"github.com/Wladim1r/proto-crypto/gen/protos/socket-aggregator"
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/Wladim1r/shared/recorder"
+	"github.com/Wladim1r/shared/tlsconf"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 var (
 	Address    = getenv.GetString("SOCKET_SERVICE_ADDR", "socket-service:50051")
 	MaxRetries = getenv.GetInt("SOCKET_SERVICE_MAX_RETRIES", 10)
+	Reconnect  = backoff.LoadPolicy()
+	Breakers   = backoff.NewRegistry()
+	// Frames received from the Socket service are recorded when RECORD_DIR is set
+	Recorder = recorder.LoadFromEnv()
+	TLS      = tlsconf.LoadFromEnv()
+	// How often a replica checks whether it owns the miniTicker stream
+	OwnerCheck = getenv.GetTime("MINITICKER_OWNER_CHECK", 5*time.Second)
 )
 
+// MiniTickerShard is the shard key of the miniTicker stream of all symbols,
+// only the replica owning it streams and publishes daily stats
+const MiniTickerShard = "!miniTicker@arr"
+
+// Ownership tells which shard keys this replica serves, nil means all of them
+type Ownership interface {
+	Owns(key string) bool
+}
+
 type StreamReceiver interface {
 	Recv() (*socket.RawResponse, error)
 }
@@ -62,135 +80,164 @@ func DistributeMessages(
 	}
 }
 
-func ReceiveMiniTickerMessage(ctx context.Context, wg *sync.WaitGroup, outChan chan []byte) {
+// ReceiveMiniTickerMessage streams miniTickers while this replica owns
+// MiniTickerShard, the stream is closed once another replica takes it over
+func ReceiveMiniTickerMessage(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	outChan chan []byte,
+	owner Ownership,
+) {
 	defer wg.Done()
 
+	breaker := Breakers.Get(Address)
+	attempt := 0
+
 	for {
-		select {
-		case <-ctx.Done():
+		if !waitOwner(ctx, owner) {
+			return
+		}
+		if !waitReconnect(ctx, breaker, attempt) {
 			return
-		default:
 		}
 
 		slog.Info("Attempting to connect to miniTicker stream...")
 		conn, err := createClientConn(ctx)
 		if err != nil {
 			slog.Error("Failed to create gRPC client connection for miniTicker", "error", err)
-			time.Sleep(5 * time.Second)
+			breaker.Failure()
+			attempt++
 			continue
 		}
 
+		streamCtx, cancel := context.WithCancel(ctx)
 		client := socket.NewSocketServiceClient(conn)
-		stream, err := client.ReceiveRawMiniTicker(ctx, &socket.RawMiniTickerRequest{})
+		stream, err := client.ReceiveRawMiniTicker(streamCtx, &socket.RawMiniTickerRequest{})
 		if err != nil {
 			slog.Error("Could not set up miniTicker stream, will retry...", "error", err)
+			cancel()
 			conn.Close()
-			time.Sleep(5 * time.Second)
+			breaker.Failure()
+			attempt++
 			continue
 		}
 		slog.Info("Connection to miniTicker stream established")
+		breaker.Success()
+		attempt = 0
 
-		err = receiveMessages(ctx, stream, outChan)
+		go watchOwner(streamCtx, owner, cancel)
+		err = receiveMessages(streamCtx, "miniTicker", stream, outChan)
+		cancel()
 		conn.Close()
 
-		if err != nil {
-			slog.Warn("miniTicker stream connection broken", "error", err)
-		}
-
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			time.Sleep(5 * time.Second)
 		}
+		if !owns(owner) {
+			slog.Info("miniTicker stream handed over to another replica")
+			attempt = 0
+			continue
+		}
+
+		if err != nil {
+			slog.Warn("miniTicker stream connection broken", "error", err)
+		}
+		attempt++
 	}
 }
 
-func ReceiveAggTradeMessage(
-	ctx context.Context,
-	symbol string,
-	outChan chan []byte,
-) {
-	slog.Info("ReceiveAggTradeMessage started", "symbol", symbol)
-	defer slog.Info("ReceiveAggTradeMessage ended", "symbol", symbol)
+func owns(owner Ownership) bool {
+	return owner == nil || owner.Owns(MiniTickerShard)
+}
 
+// waitOwner waits until this replica owns MiniTickerShard, it returns false if ctx is done
+func waitOwner(ctx context.Context, owner Ownership) bool {
+	if owns(owner) {
+		return true
+	}
+	slog.Info("miniTicker stream is owned by another replica, waiting")
+
+	ticker := time.NewTicker(OwnerCheck)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info(
-				"ReceiveAggTradeMessage context cancelled",
-				"symbol",
-				symbol,
-				"error",
-				ctx.Err(),
-			)
-			return
-		default:
+			return false
+		case <-ticker.C:
+			if owns(owner) {
+				slog.Info("Took over miniTicker stream")
+				return true
+			}
 		}
+	}
+}
 
-		slog.Info("Attempting to connect to aggTrade stream...", "symbol", symbol)
-		conn, err := createClientConn(ctx)
-		if err != nil {
-			slog.Error(
-				"Failed to create gRPC client connection for aggTrade",
-				"symbol",
-				symbol,
-				"error",
-				err,
-			)
-			time.Sleep(5 * time.Second)
-			continue
+// watchOwner cancels the stream once this replica no longer owns MiniTickerShard
+func watchOwner(ctx context.Context, owner Ownership, cancel context.CancelFunc) {
+	ticker := time.NewTicker(OwnerCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !owns(owner) {
+				cancel()
+				return
+			}
 		}
+	}
+}
 
-		client := socket.NewSocketServiceClient(conn)
-		stream, err := client.ReceiveRawAggTrade(ctx, &socket.RawAggTradeRequest{Symbol: symbol})
-		if err != nil {
-			slog.Error(
-				"Could not set up aggTrade stream, will retry...",
-				"symbol",
-				symbol,
-				"error",
-				err,
-			)
-			conn.Close()
-			time.Sleep(5 * time.Second)
-			continue
+// waitReconnect waits before the next attempt following the reconnect policy
+// and the circuit breaker of the Socket service, it returns false if ctx is done
+func waitReconnect(ctx context.Context, breaker *backoff.Breaker, attempt int) bool {
+	if attempt > 0 {
+		delay := Reconnect.Delay(attempt)
+		slog.Info("Will retry connection", "attempt", attempt, "delay", delay)
+		if !backoff.Sleep(ctx, delay) {
+			return false
 		}
-		slog.Info("Connection to aggTrade stream established", "symbol", symbol)
-
-		err = receiveMessages(ctx, stream, outChan)
-		conn.Close()
+	}
 
-		if err != nil {
-			slog.Warn("aggTrade stream connection broken", "symbol", symbol, "error", err)
-		} else {
-			slog.Info("aggTrade stream ended normally", "symbol", symbol)
+	for {
+		wait, ok := breaker.Allow()
+		if ok {
+			return ctx.Err() == nil
 		}
-
-		select {
-		case <-ctx.Done():
-			slog.Info("ReceiveAggTradeMessage context cancelled after stream end", "symbol", symbol)
-			return
-		default:
-			slog.Info("Will retry connection in 5 seconds", "symbol", symbol)
-			time.Sleep(5 * time.Second)
+		slog.Debug("Circuit breaker is open, waiting", "address", Address, "wait", wait)
+		if !backoff.Sleep(ctx, wait) {
+			return false
 		}
 	}
 }
 
 func createClientConn(ctx context.Context) (*grpc.ClientConn, error) {
+	creds, err := tlsconf.ClientCredentials(TLS)
+	if err != nil {
+		return nil, err
+	}
 	return grpc.NewClient(
 		Address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 	)
 }
 
-func receiveMessages(ctx context.Context, stream StreamReceiver, outChan chan<- []byte) error {
+// receiveMessages forwards frames of the gRPC stream to outChan, name identifies
+// the stream in recordings
+func receiveMessages(
+	ctx context.Context,
+	name string,
+	stream StreamReceiver,
+	outChan chan<- []byte,
+) error {
 	slog.Info("📞 Starting to receive messages from gRPC stream")
 	messageCount := 0
 	droppedCount := 0
 	lastLogTime := time.Now()
-	
+
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
@@ -205,6 +252,7 @@ func receiveMessages(ctx context.Context, stream StreamReceiver, outChan chan<-
 			return err
 		}
 		messageCount++
+		Recorder.Record(name, resp.Data)
 		if messageCount%1000 == 0 {
 			slog.Debug("Received messages from gRPC stream", "count", messageCount, "dropped", droppedCount)
 		}
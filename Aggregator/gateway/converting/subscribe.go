@@ -0,0 +1,302 @@
+package converting
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/proto-crypto/gen/protos/socket-aggregator"
+	"google.golang.org/grpc/codes"
+)
+
+type subKey struct {
+	kind   socket.StreamKind
+	symbol string
+}
+
+// Subscriptions keeps trade and depth streams of all followed symbols on one
+// Subscribe stream of the Socket service. Symbols are added and removed at any
+// time, after a reconnect all of them are subscribed again
+type Subscriptions struct {
+	mu sync.Mutex
+	// Symbols which must be subscribed, true once the Socket service refused
+	// the symbol for good, it does not exist or is malformed
+	wanted map[subKey]bool
+	// Symbols the Socket service failed to serve on the current stream,
+	// they are asked again on the next one
+	failed map[subKey]struct{}
+	wake   chan struct{}
+
+	tradeChan chan []byte
+	// Order books go here, nil disables depth streams
+	depthChan chan []byte
+}
+
+func NewSubscriptions(tradeChan, depthChan chan []byte) *Subscriptions {
+	return &Subscriptions{
+		wanted:    make(map[subKey]bool),
+		failed:    make(map[subKey]struct{}),
+		wake:      make(chan struct{}, 1),
+		tradeChan: tradeChan,
+		depthChan: depthChan,
+	}
+}
+
+// Add subscribes to trades and, when enabled, order book of symbol
+func (s *Subscriptions) Add(symbol string) {
+	s.mu.Lock()
+	keys := []subKey{{kind: socket.StreamKind_TRADE, symbol: symbol}}
+	if s.depthChan != nil {
+		keys = append(keys, subKey{kind: socket.StreamKind_DEPTH, symbol: symbol})
+	}
+	for _, key := range keys {
+		s.wanted[key] = false
+		delete(s.failed, key)
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Subscriptions) Remove(symbol string) {
+	s.mu.Lock()
+	delete(s.wanted, subKey{kind: socket.StreamKind_TRADE, symbol: symbol})
+	delete(s.wanted, subKey{kind: socket.StreamKind_DEPTH, symbol: symbol})
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Subscriptions) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start keeps the Subscribe stream open until ctx is done, reconnecting
+// following the reconnect policy and the circuit breaker of the Socket service
+func (s *Subscriptions) Start(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	breaker := Breakers.Get(Address)
+	attempt := 0
+
+	for {
+		if !waitReconnect(ctx, breaker, attempt) {
+			return
+		}
+
+		slog.Info("Attempting to connect to Subscribe stream...")
+		conn, err := createClientConn(ctx)
+		if err != nil {
+			slog.Error("Failed to create gRPC client connection for Subscribe", "error", err)
+			breaker.Failure()
+			attempt++
+			continue
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		client := socket.NewSocketServiceClient(conn)
+		stream, err := client.Subscribe(streamCtx)
+		if err != nil {
+			slog.Error("Could not set up Subscribe stream, will retry...", "error", err)
+			cancel()
+			conn.Close()
+			breaker.Failure()
+			attempt++
+			continue
+		}
+		slog.Info("Connection to Subscribe stream established")
+		breaker.Success()
+		attempt = 0
+
+		s.mu.Lock()
+		clear(s.failed)
+		s.mu.Unlock()
+
+		sendDone := make(chan struct{})
+		go func() {
+			defer close(sendDone)
+			s.sendRequests(streamCtx, stream)
+		}()
+
+		err = s.receiveFrames(ctx, stream)
+		cancel()
+		<-sendDone
+		conn.Close()
+
+		if err != nil {
+			slog.Warn("Subscribe stream connection broken", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			attempt++
+		}
+	}
+}
+
+// sendRequests brings symbols subscribed on the stream in line with the wanted ones
+func (s *Subscriptions) sendRequests(
+	ctx context.Context,
+	stream socket.SocketService_SubscribeClient,
+) {
+	// The stream starts without symbols
+	subscribed := make(map[subKey]struct{})
+
+	for {
+		var add, remove []subKey
+		s.mu.Lock()
+		for key, refused := range s.wanted {
+			_, failed := s.failed[key]
+			if _, ok := subscribed[key]; !ok && !refused && !failed {
+				add = append(add, key)
+			}
+		}
+		for key := range subscribed {
+			_, failed := s.failed[key]
+			if refused, ok := s.wanted[key]; !ok || refused || failed {
+				remove = append(remove, key)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, key := range add {
+			if !sendSubscribe(stream, socket.SubscribeRequest_ADD, key) {
+				return
+			}
+			subscribed[key] = struct{}{}
+		}
+		for _, key := range remove {
+			// Refused symbols are already dropped by the server
+			if s.droppedByServer(key) {
+				delete(subscribed, key)
+				continue
+			}
+			if !sendSubscribe(stream, socket.SubscribeRequest_REMOVE, key) {
+				return
+			}
+			delete(subscribed, key)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+	}
+}
+
+func sendSubscribe(
+	stream socket.SocketService_SubscribeClient,
+	action socket.SubscribeRequest_Action,
+	key subKey,
+) bool {
+	err := stream.Send(&socket.SubscribeRequest{
+		Action:  action,
+		Symbols: []string{key.symbol},
+		Kind:    key.kind,
+	})
+	if err != nil {
+		// The receiving side gets the reason of the broken stream
+		slog.Debug("Could not send Subscribe request", "action", action, "symbol", key.symbol, "error", err)
+		return false
+	}
+	slog.Info("Sent Subscribe request", "action", action, "symbol", key.symbol, "kind", key.kind)
+	return true
+}
+
+func (s *Subscriptions) droppedByServer(key subKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, failed := s.failed[key]
+	return s.wanted[key] || failed
+}
+
+// receiveFrames forwards frames of the stream by their kind until it breaks
+func (s *Subscriptions) receiveFrames(
+	ctx context.Context,
+	stream socket.SocketService_SubscribeClient,
+) error {
+	slog.Info("📞 Starting to receive messages from Subscribe stream")
+	messageCount := 0
+	droppedCount := 0
+	lastLogTime := time.Now()
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				slog.Info("Subscribe stream closed by server", "messages_received", messageCount, "dropped", droppedCount)
+				return nil
+			}
+			return err
+		}
+
+		key := subKey{kind: resp.Kind, symbol: resp.Symbol}
+		if resp.Error != "" {
+			s.refuse(key, codes.Code(resp.Code), resp.Error)
+			continue
+		}
+
+		var (
+			outChan chan []byte
+			name    string
+		)
+		switch resp.Kind {
+		case socket.StreamKind_DEPTH:
+			outChan, name = s.depthChan, "depth:"+resp.Symbol
+		default:
+			outChan, name = s.tradeChan, "aggTrade:"+resp.Symbol
+		}
+		if outChan == nil {
+			continue
+		}
+
+		messageCount++
+		Recorder.Record(name, resp.Data)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case outChan <- resp.Data:
+		default:
+			// Channel is full, drop message but log only periodically to avoid log spam
+			droppedCount++
+			if now := time.Now(); now.Sub(lastLogTime) >= 5*time.Second {
+				slog.Warn("Output channel is full, dropping messages",
+					"kind", resp.Kind,
+					"messages_received", messageCount,
+					"total_dropped", droppedCount)
+				lastLogTime = now
+			}
+		}
+	}
+}
+
+// refuse stops asking for a symbol the Socket service cannot serve. A symbol
+// that does not exist is asked again only after it is removed and added back,
+// other failures such as an unavailable venue are retried on the next stream
+func (s *Subscriptions) refuse(key subKey, code codes.Code, reason string) {
+	sticky := code == codes.InvalidArgument || code == codes.NotFound
+	slog.Warn("Socket service refused subscription",
+		"symbol", key.symbol,
+		"kind", key.kind,
+		"code", code,
+		"error", reason,
+		"retry_on_reconnect", !sticky)
+
+	s.mu.Lock()
+	if _, ok := s.wanted[key]; ok {
+		if sticky {
+			s.wanted[key] = true
+		} else {
+			s.failed[key] = struct{}{}
+		}
+	}
+	s.mu.Unlock()
+	s.notify()
+}
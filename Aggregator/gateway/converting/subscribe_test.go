@@ -0,0 +1,107 @@
+package converting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/proto-crypto/gen/protos/socket-aggregator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// fakeSubscribeStream records the requests sent on the stream
+type fakeSubscribeStream struct {
+	grpc.ClientStream
+	sent chan *socket.SubscribeRequest
+}
+
+func (f *fakeSubscribeStream) Send(m *socket.SubscribeRequest) error {
+	f.sent <- m
+	return nil
+}
+
+func (f *fakeSubscribeStream) Recv() (*socket.SubscribeResponse, error) {
+	select {}
+}
+
+// stream runs sendRequests on a new stream, as Start does after a reconnect
+func (s *Subscriptions) stream(t *testing.T) (*fakeSubscribeStream, context.CancelFunc) {
+	t.Helper()
+
+	s.mu.Lock()
+	clear(s.failed)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeSubscribeStream{sent: make(chan *socket.SubscribeRequest, 10)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.sendRequests(ctx, stream)
+	}()
+	return stream, func() {
+		cancel()
+		<-done
+	}
+}
+
+func expectRequests(t *testing.T, stream *fakeSubscribeStream, want map[string]socket.SubscribeRequest_Action) {
+	t.Helper()
+
+	got := make(map[string]socket.SubscribeRequest_Action)
+	timeout := time.After(time.Second)
+	for len(got) < len(want) {
+		select {
+		case req := <-stream.sent:
+			got[req.Symbols[0]] = req.Action
+		case <-timeout:
+			t.Fatalf("got requests %v, want %v", got, want)
+		}
+	}
+	for symbol, action := range want {
+		if got[symbol] != action {
+			t.Fatalf("got requests %v, want %v", got, want)
+		}
+	}
+
+	select {
+	case req := <-stream.sent:
+		t.Fatalf("unexpected request %v %v", req.Action, req.Symbols)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscriptionsRefusals(t *testing.T) {
+	s := NewSubscriptions(make(chan []byte), nil)
+	s.Add("btcusdt")
+	s.Add("nosuchcoin")
+
+	stream, stop := s.stream(t)
+	expectRequests(t, stream, map[string]socket.SubscribeRequest_Action{
+		"btcusdt":    socket.SubscribeRequest_ADD,
+		"nosuchcoin": socket.SubscribeRequest_ADD,
+	})
+
+	// Neither refusal is asked again on the same stream, nor removed, the server dropped both
+	s.refuse(subKey{kind: socket.StreamKind_TRADE, symbol: "btcusdt"}, codes.Unavailable, "venue is down")
+	s.refuse(subKey{kind: socket.StreamKind_TRADE, symbol: "nosuchcoin"}, codes.InvalidArgument, "invalid symbol")
+	expectRequests(t, stream, nil)
+	stop()
+
+	// After a reconnect only the symbol which does exist is asked again
+	stream, stop = s.stream(t)
+	expectRequests(t, stream, map[string]socket.SubscribeRequest_Action{
+		"btcusdt": socket.SubscribeRequest_ADD,
+	})
+	stop()
+
+	// Adding the symbol back asks for it again
+	s.Add("nosuchcoin")
+	stream, stop = s.stream(t)
+	defer stop()
+	expectRequests(t, stream, map[string]socket.SubscribeRequest_Action{
+		"btcusdt":    socket.SubscribeRequest_ADD,
+		"nosuchcoin": socket.SubscribeRequest_ADD,
+	})
+}
@@ -0,0 +1,182 @@
+package delivery
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/Wladim1r/aggregator/models"
+)
+
+// Prefs is how often and how far the price of a symbol must move before a user gets it
+type Prefs struct {
+	Interval     time.Duration
+	ThresholdBps int
+}
+
+// Default applies to users that never set their own prefs
+var Default = Prefs{
+	Interval:     getenv.GetTime("DELIVERY_INTERVAL", time.Second),
+	ThresholdBps: getenv.GetInt("DELIVERY_THRESHOLD_BPS", 0),
+}
+
+// Sent prices older than this are forgotten, the next one is always delivered
+var forgetAfter = getenv.GetTime("DELIVERY_FORGET_AFTER", time.Hour)
+
+// Prefs set on other replicas are picked up this often
+var ReloadInterval = getenv.GetTime("DELIVERY_RELOAD_INTERVAL", 30*time.Second)
+
+// PrefsStore persists prefs of users, it is shared by all replicas
+type PrefsStore interface {
+	LoadPrefs(ctx context.Context) (map[int]Prefs, error)
+	SavePrefs(ctx context.Context, userID int, prefs Prefs) error
+}
+
+type sentKey struct {
+	userID int
+	symbol string
+}
+
+type sent struct {
+	price float64
+	stale bool
+	at    time.Time
+}
+
+// Throttle decides which prices are pushed to which user
+type Throttle struct {
+	mu     sync.Mutex
+	store  PrefsStore
+	prefs  map[int]Prefs
+	sent   map[sentKey]sent
+	pruned time.Time
+	// Bumped by every Set, a load racing with one is thrown away
+	sets int
+}
+
+func NewThrottle(store PrefsStore) *Throttle {
+	return &Throttle{
+		store: store,
+		prefs: make(map[int]Prefs),
+		sent:  make(map[sentKey]sent),
+	}
+}
+
+// Load reads prefs saved by any replica
+func (t *Throttle) Load(ctx context.Context) error {
+	prefs, err := t.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("📨 Delivery prefs loaded", "users", len(prefs))
+	return nil
+}
+
+// Start reloads prefs until ctx is done, Set changes them on one replica only
+func (t *Throttle) Start(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	slog.Info("📨 Starting delivery prefs reloader", "interval", ReloadInterval)
+
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopped reloading delivery prefs")
+			return
+		case <-ticker.C:
+			prefs, err := t.load(ctx)
+			if err != nil {
+				slog.Warn("Could not reload delivery prefs", "error", err)
+				continue
+			}
+			slog.Debug("Delivery prefs reloaded", "users", len(prefs))
+		}
+	}
+}
+
+func (t *Throttle) load(ctx context.Context) (map[int]Prefs, error) {
+	t.mu.Lock()
+	sets := t.sets
+	t.mu.Unlock()
+
+	prefs, err := t.store.LoadPrefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// The store may have been read before a Set saved, the next load gets it
+	if t.sets == sets {
+		t.prefs = prefs
+	}
+	return prefs, nil
+}
+
+// Set saves prefs of userID before using them
+func (t *Throttle) Set(ctx context.Context, userID int, prefs Prefs) error {
+	if err := t.store.SavePrefs(ctx, userID, prefs); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.prefs[userID] = prefs
+	t.sets++
+	t.mu.Unlock()
+
+	slog.Info("Delivery prefs set",
+		"userID", userID,
+		"interval", prefs.Interval,
+		"threshold_bps", prefs.ThresholdBps)
+	return nil
+}
+
+// Allow reports whether stat goes to userID now. The first price and every
+// change of staleness are always sent, others wait for the interval and the threshold
+func (t *Throttle) Allow(userID int, stat models.SecondStat, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+
+	key := sentKey{userID: userID, symbol: stat.Symbol}
+	last, ok := t.sent[key]
+	if ok && last.stale == stat.Stale {
+		prefs, set := t.prefs[userID]
+		if !set {
+			prefs = Default
+		}
+
+		if now.Sub(last.at) < prefs.Interval {
+			return false
+		}
+		if prefs.ThresholdBps > 0 && last.price != 0 &&
+			math.Abs(stat.Price-last.price)/last.price*10000 < float64(prefs.ThresholdBps) {
+			return false
+		}
+	}
+
+	t.sent[key] = sent{price: stat.Price, stale: stat.Stale, at: now}
+	return true
+}
+
+// prune drops prices of users who stopped following, at most once a minute
+func (t *Throttle) prune(now time.Time) {
+	if now.Sub(t.pruned) < time.Minute {
+		return
+	}
+	t.pruned = now
+
+	for key, last := range t.sent {
+		if now.Sub(last.at) > forgetAfter {
+			delete(t.sent, key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package delivery
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/aggregator/models"
+)
+
+// memStore is a store shared by replicas, loaded runs before a load returns
+type memStore struct {
+	mu     sync.Mutex
+	prefs  map[int]Prefs
+	loaded func()
+}
+
+func (m *memStore) LoadPrefs(ctx context.Context) (map[int]Prefs, error) {
+	m.mu.Lock()
+	prefs := maps.Clone(m.prefs)
+	m.mu.Unlock()
+
+	if m.loaded != nil {
+		m.loaded()
+	}
+	return prefs, nil
+}
+
+func (m *memStore) SavePrefs(ctx context.Context, userID int, prefs Prefs) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prefs[userID] = prefs
+	return nil
+}
+
+func TestThrottleReload(t *testing.T) {
+	store := &memStore{prefs: make(map[int]Prefs)}
+	here, other := NewThrottle(store), NewThrottle(store)
+
+	// Prefs set through another replica are used here after a reload
+	slow := Prefs{Interval: time.Hour}
+	if err := other.Set(context.Background(), 7, slow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := here.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	stat := models.SecondStat{Symbol: "btcusdt", Price: 100}
+	if !here.Allow(7, stat, now) {
+		t.Fatal("first price is not sent")
+	}
+	if here.Allow(7, stat, now.Add(time.Minute)) {
+		t.Fatal("price is sent before the interval of the reloaded prefs")
+	}
+}
+
+func TestThrottleLoadRacingSet(t *testing.T) {
+	store := &memStore{prefs: map[int]Prefs{7: {Interval: time.Hour}}}
+	throttle := NewThrottle(store)
+
+	// A Set lands between reading the store and using what was read
+	fast := Prefs{Interval: time.Millisecond}
+	store.loaded = func() {
+		store.loaded = nil
+		if err := throttle.Set(context.Background(), 7, fast); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := throttle.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := throttle.prefs[7]; got != fast {
+		t.Fatalf("prefs = %+v, want %+v set during the load", got, fast)
+	}
+}
+
+func TestThrottleStartReloads(t *testing.T) {
+	interval := ReloadInterval
+	ReloadInterval = 100 * time.Millisecond
+	t.Cleanup(func() { ReloadInterval = interval })
+
+	store := &memStore{prefs: make(map[int]Prefs)}
+	here, other := NewThrottle(store), NewThrottle(store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go here.Start(ctx, wg)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	slow := Prefs{Interval: time.Hour}
+	if err := other.Set(context.Background(), 7, slow); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the next reload the default interval of a second is used here
+	now := time.Now()
+	btc := models.SecondStat{Symbol: "btcusdt", Price: 100}
+	if !here.Allow(7, btc, now) || !here.Allow(7, btc, now.Add(time.Minute)) {
+		t.Fatal("price is held back before prefs were reloaded")
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		here.mu.Lock()
+		prefs, ok := here.prefs[7]
+		here.mu.Unlock()
+		if ok && prefs == slow {
+			break
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("prefs of user 7 = %+v after %s, want %+v", prefs, time.Second, slow)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	eth := models.SecondStat{Symbol: "ethusdt", Price: 100}
+	if !here.Allow(7, eth, now) {
+		t.Fatal("first price is not sent")
+	}
+	if here.Allow(7, eth, now.Add(time.Minute)) {
+		t.Fatal("price is sent before the interval of the reloaded prefs")
+	}
+}
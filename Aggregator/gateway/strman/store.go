@@ -0,0 +1,89 @@
+package strman
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// Follow is one user following one symbol
+type Follow struct {
+	Symbol string
+	UserID int
+}
+
+// FollowerStore persists followers. Changes are written to the store before
+// they are applied in memory, so a restart never loses an accepted follow.
+// The store is shared by all replicas
+type FollowerStore interface {
+	Load(ctx context.Context) ([]Follow, error)
+	Update(ctx context.Context, added, removed []Follow) error
+}
+
+// Ownership tells which symbols this replica serves, nil means all of them
+type Ownership interface {
+	Owns(symbol string) bool
+}
+
+func (sm *StreamManager) owns(symbol string) bool {
+	return sm.owner == nil || sm.owner.Owns(symbol)
+}
+
+// Restore loads followers saved before a restart and subscribes to their symbols
+func (sm *StreamManager) Restore(ctx context.Context) error {
+	return sm.Reload(ctx)
+}
+
+// Reload makes followers in memory equal to the owned part of the store:
+// symbols taken over from other replicas are subscribed, symbols handed over
+// are dropped here but stay in the store for their new owner
+func (sm *StreamManager) Reload(ctx context.Context) error {
+	if sm.store == nil {
+		return nil
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	follows, err := sm.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	owned := make(map[string][]int)
+	for _, f := range follows {
+		if sm.owns(f.Symbol) {
+			owned[f.Symbol] = append(owned[f.Symbol], f.UserID)
+		}
+	}
+
+	var dropped int
+	for symbol, users := range sm.Followers {
+		if _, ok := owned[symbol]; !ok {
+			dropped++
+		}
+		for _, userID := range slices.Clone(users) {
+			if !slices.Contains(owned[symbol], userID) {
+				sm.deleteLocked(symbol, userID)
+			}
+		}
+	}
+	for symbol, users := range owned {
+		for _, userID := range users {
+			sm.addLocked(symbol, userID)
+		}
+	}
+
+	slog.Info("💾 Followers reloaded",
+		"follows", len(follows),
+		"owned_symbols", len(sm.Followers),
+		"dropped_symbols", dropped)
+	return nil
+}
+
+func (sm *StreamManager) persist(ctx context.Context, added, removed []Follow) error {
+	if sm.store == nil || (len(added) == 0 && len(removed) == 0) {
+		return nil
+	}
+	return sm.store.Update(ctx, added, removed)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"slices"
 	"strings"
 	"sync"
@@ -11,71 +12,43 @@ import (
 	"github.com/Wladim1r/aggregator/gateway/converting"
 )
 
+// StreamManager tracks followers of every symbol, a symbol is subscribed on
+// the Socket service while it has at least one follower
 type StreamManager struct {
-	streams   map[string]context.CancelFunc
 	Followers map[string][]int
 	mu        sync.RWMutex
+	subs      *converting.Subscriptions
+	// Followers are kept in memory only when store is nil
+	store FollowerStore
+	// Only followers of owned symbols are kept in memory and streamed
+	owner Ownership
 }
 
-func NewStreamManager() *StreamManager {
+func NewStreamManager(subs *converting.Subscriptions, store FollowerStore, owner Ownership) *StreamManager {
 	return &StreamManager{
-		streams:   make(map[string]context.CancelFunc),
 		Followers: make(map[string][]int),
+		subs:      subs,
+		store:     store,
+		owner:     owner,
 	}
 }
 
-func (sm *StreamManager) AddCoin(
-	ctxParent context.Context,
-	wg *sync.WaitGroup,
-	symbol string,
-	userID int,
-	outChan chan []byte,
-) bool {
+// AddCoin makes userID a follower of symbol, it returns false if the user
+// already follows it, and the number of followers after the call
+func (sm *StreamManager) AddCoin(ctx context.Context, symbol string, userID int) (bool, int, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	symbol = strings.ToLower(symbol)
-
-	// Check if user is already subscribed
 	if slices.Contains(sm.Followers[symbol], userID) {
-		slog.Info(
-			"User already subscribed to coin, allowing re-subscription",
-			"symbol",
-			symbol,
-			"userID",
-			userID,
-		)
-		// Allow re-subscription - user might have disconnected and reconnected
-		return true
-	}
-
-	existingFollowers := len(sm.Followers[symbol])
-	sm.Followers[symbol] = append(sm.Followers[symbol], userID)
+		slog.Info("User already subscribed to coin", "symbol", symbol, "userID", userID)
+		return false, len(sm.Followers[symbol]), nil
+	}
 
-	// Check if stream exists and is active
-	_, streamExists := sm.streams[symbol]
-
-	if !streamExists {
-		// Stream doesn't exist - need to start it
-		if existingFollowers == 0 {
-			slog.Info("First subscriber, starting new stream", "symbol", symbol, "userID", userID)
-		} else {
-			slog.Info("Stream was stopped, restarting for existing followers",
-				"symbol", symbol,
-				"userID", userID,
-				"total_followers", len(sm.Followers[symbol]))
-		}
-		sm.start(ctxParent, wg, symbol, outChan)
-		slog.Info("Stream started", "symbol", symbol)
-	} else {
-		// Stream already exists - just add subscriber
-		slog.Info("Adding subscriber to existing stream",
-			"symbol", symbol,
-			"userID", userID,
-			"existing_followers", existingFollowers,
-			"total_followers", len(sm.Followers[symbol]),
-			"stream_exists", true)
+	if err := sm.persist(ctx, []Follow{{Symbol: symbol, UserID: userID}}, nil); err != nil {
+		return false, len(sm.Followers[symbol]), err
 	}
+	sm.addLocked(symbol, userID)
 
 	slog.Info(
 		"User added to coin",
@@ -86,71 +59,140 @@ func (sm *StreamManager) AddCoin(
 		"total_followers",
 		len(sm.Followers[symbol]),
 	)
-	return true
-}
-func (sm *StreamManager) start(
-	ctxParent context.Context,
-	wg *sync.WaitGroup,
-	symbol string,
-	outChan chan []byte,
-) {
-	ctx, cancel := context.WithCancel(ctxParent)
-	sm.streams[symbol] = cancel
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer func() {
-			sm.mu.Lock()
-			// Only clean up if there are no followers left
-			// This prevents race condition where stream restarts but followers list is cleared
-			if len(sm.Followers[symbol]) == 0 {
-				delete(sm.streams, symbol)
-				delete(sm.Followers, symbol)
-				slog.Info(
-					"Stream processing stopped and cleaned up (no followers)",
-					"symbol",
-					symbol,
-				)
-			} else {
-				// Stream stopped but there are still followers - remove cancel func but keep followers
-				// This allows stream to restart if needed
-				delete(sm.streams, symbol)
-				slog.Warn("Stream processing stopped but followers remain, will restart on next message",
-					"symbol", symbol,
-					"followers", sm.Followers[symbol])
-			}
-			sm.mu.Unlock()
-		}()
-		converting.ReceiveAggTradeMessage(ctx, symbol, outChan)
-	}()
+	return true, len(sm.Followers[symbol]), nil
 }
 
-func (sm *StreamManager) DeleteCoin(symbol string, userID int) {
+// DeleteCoin removes userID from followers of symbol, it returns false if the
+// user did not follow it, and the number of followers after the call
+func (sm *StreamManager) DeleteCoin(ctx context.Context, symbol string, userID int) (bool, int, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	symbol = strings.ToLower(symbol)
+	if !slices.Contains(sm.Followers[symbol], userID) {
+		return false, len(sm.Followers[symbol]), nil
+	}
 
-	userList, ok := sm.Followers[symbol]
-	if !ok {
-		return
+	if err := sm.persist(ctx, nil, []Follow{{Symbol: symbol, UserID: userID}}); err != nil {
+		return false, len(sm.Followers[symbol]), err
 	}
+	sm.deleteLocked(symbol, userID)
 
-	for i, id := range userList {
-		if id == userID {
-			sm.Followers[symbol] = append(userList[:i], userList[i+1:]...)
-			slog.Info("User removed from coin", "symbol", symbol, "userID", userID)
-			break
-		}
+	slog.Info("User removed from coin", "symbol", symbol, "userID", userID)
+	return true, len(sm.Followers[symbol]), nil
+}
+
+func (sm *StreamManager) addLocked(symbol string, userID int) bool {
+	if slices.Contains(sm.Followers[symbol], userID) {
+		return false
+	}
+
+	sm.Followers[symbol] = append(sm.Followers[symbol], userID)
+	if len(sm.Followers[symbol]) == 1 {
+		slog.Info("First subscriber, subscribing to symbol", "symbol", symbol, "userID", userID)
+		sm.subs.Add(symbol)
 	}
+	return true
+}
 
+func (sm *StreamManager) deleteLocked(symbol string, userID int) bool {
+	i := slices.Index(sm.Followers[symbol], userID)
+	if i < 0 {
+		return false
+	}
+
+	sm.Followers[symbol] = slices.Delete(sm.Followers[symbol], i, i+1)
 	if len(sm.Followers[symbol]) == 0 {
-		if cancel, exists := sm.streams[symbol]; exists {
-			cancel()
-			slog.Info("Stream cancellation signal sent", "symbol", symbol)
+		delete(sm.Followers, symbol)
+		sm.subs.Remove(symbol)
+		slog.Info("No followers left, unsubscribed from symbol", "symbol", symbol)
+	}
+	return true
+}
+
+// Sync makes followers of owned symbols exactly the wanted ones, owned symbols
+// missing in wanted lose all of their followers and symbols owned by other
+// replicas are skipped. It returns how many follows were added and removed
+func (sm *StreamManager) Sync(ctx context.Context, wanted map[string][]int) (int, int, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	normalized := make(map[string][]int, len(wanted))
+	for symbol, users := range wanted {
+		symbol = strings.ToLower(symbol)
+		if !sm.owns(symbol) {
+			slog.Debug("Skipping symbol of another replica", "symbol", symbol)
+			continue
+		}
+		for _, userID := range users {
+			if !slices.Contains(normalized[symbol], userID) {
+				normalized[symbol] = append(normalized[symbol], userID)
+			}
 		}
 	}
+
+	var added, removed []Follow
+	for symbol, users := range sm.Followers {
+		for _, userID := range users {
+			if !slices.Contains(normalized[symbol], userID) {
+				removed = append(removed, Follow{Symbol: symbol, UserID: userID})
+			}
+		}
+	}
+	for symbol, users := range normalized {
+		for _, userID := range users {
+			if !slices.Contains(sm.Followers[symbol], userID) {
+				added = append(added, Follow{Symbol: symbol, UserID: userID})
+			}
+		}
+	}
+
+	if err := sm.persist(ctx, added, removed); err != nil {
+		return 0, 0, err
+	}
+	for _, f := range removed {
+		sm.deleteLocked(f.Symbol, f.UserID)
+	}
+	for _, f := range added {
+		sm.addLocked(f.Symbol, f.UserID)
+	}
+
+	if len(added) > 0 || len(removed) > 0 {
+		slog.Info("Followers synced",
+			"followed", len(added),
+			"unfollowed", len(removed),
+			"symbols", len(sm.Followers))
+	}
+	return len(added), len(removed), nil
+}
+
+// Snapshot returns a copy of followers of symbol, or of every symbol when it is empty
+func (sm *StreamManager) Snapshot(symbol string) map[string][]int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if symbol != "" {
+		symbol = strings.ToLower(symbol)
+		users, ok := sm.Followers[symbol]
+		if !ok {
+			return map[string][]int{}
+		}
+		return map[string][]int{symbol: slices.Clone(users)}
+	}
+
+	snapshot := maps.Clone(sm.Followers)
+	for symbol, users := range snapshot {
+		snapshot[symbol] = slices.Clone(users)
+	}
+	return snapshot
+}
+
+// Follows reports whether symbol has followers on this replica
+func (sm *StreamManager) Follows(symbol string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return len(sm.Followers[strings.ToLower(symbol)]) > 0
 }
 
 func (sm *StreamManager) GetFollowers(symbol string) []int {
@@ -3,7 +3,8 @@ module github.com/Wladim1r/aggregator
 go 1.24.4
 
 require (
-	github.com/Wladim1r/proto-crypto v0.1.3
+	github.com/Wladim1r/shared v0.0.0
+	github.com/Wladim1r/proto-crypto v0.3.0
 	github.com/google/uuid v1.6.0
 	github.com/segmentio/kafka-go v0.4.49
 	github.com/shopspring/decimal v1.4.0
@@ -50,3 +51,8 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
 )
+
+replace (
+	github.com/Wladim1r/proto-crypto => ../proto-crypto
+	github.com/Wladim1r/shared => ../shared
+)
@@ -38,3 +38,21 @@ func GetSlice(key string, defaultVal []string) []string {
 	}
 	return defaultVal
 }
+
+func GetFloat(key string, defaultVal float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultVal
+}
+
+func GetBool(key string, defaultVal bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultVal
+}
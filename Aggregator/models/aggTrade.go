@@ -6,19 +6,26 @@ import (
 )
 
 type AggTrade struct {
-	EventType        string `json:"e"` // "aggTrade"
-	EventTime        int64  `json:"E"` // Время когда сервер отправил
-	Symbol           string `json:"s"` // Торговая пара
-	AggregateTradeID int64  `json:"a"` // Уникальный ID
-	Price            string `json:"p"` // Цена сделки
-	Quantity         string `json:"q"` // Объем сделки
-	FirstTradeID     int64  `json:"f"` // ID первой микросделки
-	LastTradeID      int64  `json:"l"` // ID последней микросделки
-	TradeTime        int64  `json:"T"` // Время самой сделки
-	IsBuyer          bool   `json:"m"` // Направление
-	Ignore           bool   `json:"M"` // Игнорировать (всегда true)
+	EventType        string `json:"e"`     // "aggTrade" или "trade"
+	Exchange         string `json:"x"`     // Биржа
+	EventTime        int64  `json:"E"`     // Время когда сервер отправил
+	Symbol           string `json:"s"`     // Торговая пара
+	AggregateTradeID int64  `json:"a"`     // Уникальный ID
+	TradeID          string `json:"t"`     // ID сделки на бирже
+	Price            string `json:"p"`     // Цена сделки
+	Quantity         string `json:"q"`     // Объем сделки
+	FirstTradeID     int64  `json:"f"`     // ID первой микросделки
+	LastTradeID      int64  `json:"l"`     // ID последней микросделки
+	TradeTime        int64  `json:"T"`     // Время самой сделки
+	IsBuyer          bool   `json:"m"`     // Направление
+	Ignore           bool   `json:"M"`     // Игнорировать (всегда true)
+	Kind             string `json:"k"`     // Тип потока, только для "stale"
+	Stale            bool   `json:"stale"` // Поток молчит, только для "stale"
 }
 
+// EventStale - событие Socket о том, что поток перестал или снова начал присылать данные
+const EventStale = "stale"
+
 func (at *AggTrade) PriceFloat() float64 {
 	pf, err := strconv.ParseFloat(at.Price, 64)
 	if err != nil {
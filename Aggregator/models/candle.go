@@ -0,0 +1,40 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Candle - OHLCV свеча, поля названы как в kline потоке Binance
+type Candle struct {
+	EventType   string          `json:"e"` // "kline"
+	Symbol      string          `json:"s"` // Торговая пара
+	Interval    string          `json:"i"` // Интервал: 1s, 1m, 5m, 1h
+	OpenTime    int64           `json:"t"` // Время открытия свечи
+	CloseTime   int64           `json:"T"` // Время закрытия свечи
+	Open        decimal.Decimal `json:"o"`
+	High        decimal.Decimal `json:"h"`
+	Low         decimal.Decimal `json:"l"`
+	Close       decimal.Decimal `json:"c"`
+	Volume      decimal.Decimal `json:"v"`           // Объем (base asset)
+	QuoteVolume decimal.Decimal `json:"q"`           // Объем (quote asset)
+	BuyVolume   decimal.Decimal `json:"buy_volume"`  // Объем сделок, где покупатель - тейкер
+	SellVolume  decimal.Decimal `json:"sell_volume"` // Объем сделок, где продавец - тейкер
+	Trades      int             `json:"n"`           // Количество сделок
+	Final       bool            `json:"x"`           // Свеча закрыта и больше не изменится
+}
+
+func (c Candle) KafkaKey() string {
+	return c.Symbol
+}
+
+func (c Candle) KafkaTime() time.Time {
+	return time.UnixMilli(c.CloseTime)
+}
+
+// KafkaID одинаков для одной и той же свечи, повторная отправка не создаст дубль
+func (c Candle) KafkaID() string {
+	return fmt.Sprintf("%s:%s:%d", c.Symbol, c.Interval, c.OpenTime)
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"log/slog"
+	"strconv"
+)
+
+type DepthBook struct {
+	EventType    string      `json:"e"`     // "depth"
+	Exchange     string      `json:"x"`     // Биржа
+	EventTime    int64       `json:"E"`     // Время последнего обновления
+	Symbol       string      `json:"s"`     // Торговая пара
+	LastUpdateID int64       `json:"u"`     // ID последнего обновления стакана
+	Bids         [][2]string `json:"b"`     // Заявки на покупку [цена, объем], лучшая первая
+	Asks         [][2]string `json:"a"`     // Заявки на продажу [цена, объем], лучшая первая
+	Stale        bool        `json:"stale"` // Только для "stale": поток стакана молчит
+}
+
+type BookLevel struct {
+	Price    float64 `json:"p"`
+	Quantity float64 `json:"q"`
+}
+
+// BookStat - метрики верхних N уровней стакана
+type BookStat struct {
+	Symbol    string      `json:"s"`
+	EventTime int64       `json:"E"`
+	BestBid   float64     `json:"bid"`
+	BestAsk   float64     `json:"ask"`
+	MidPrice  float64     `json:"mid"`
+	Spread    float64     `json:"spread"`
+	SpreadBps float64     `json:"spread_bps"` // Спред в базисных пунктах от средней цены
+	BidVolume float64     `json:"bid_volume"` // Суммарный объем N лучших заявок на покупку
+	AskVolume float64     `json:"ask_volume"` // Суммарный объем N лучших заявок на продажу
+	Imbalance float64     `json:"imbalance"`  // (bid - ask) / (bid + ask), от -1 до 1
+	Bids      []BookLevel `json:"b"`
+	Asks      []BookLevel `json:"a"`
+	Stale     bool        `json:"stale"` // Стакан устарел, поток молчит
+}
+
+func parseLevels(levels [][2]string, n int) []BookLevel {
+	n = min(n, len(levels))
+	out := make([]BookLevel, 0, n)
+	for _, lvl := range levels[:n] {
+		price, err := strconv.ParseFloat(lvl[0], 64)
+		if err != nil {
+			slog.Error("Could not parse level price into float64", "error", err)
+			continue
+		}
+		qty, err := strconv.ParseFloat(lvl[1], 64)
+		if err != nil {
+			slog.Error("Could not parse level quantity into float64", "error", err)
+			continue
+		}
+		out = append(out, BookLevel{Price: price, Quantity: qty})
+	}
+	return out
+}
+
+// TopN считает метрики по n лучшим уровням, ok = false если одна из сторон пуста
+func (db *DepthBook) TopN(n int) (BookStat, bool) {
+	stat := BookStat{
+		Symbol:    db.Symbol,
+		EventTime: db.EventTime,
+		Bids:      parseLevels(db.Bids, n),
+		Asks:      parseLevels(db.Asks, n),
+	}
+	if len(stat.Bids) == 0 || len(stat.Asks) == 0 {
+		return stat, false
+	}
+
+	stat.BestBid = stat.Bids[0].Price
+	stat.BestAsk = stat.Asks[0].Price
+	stat.MidPrice = (stat.BestBid + stat.BestAsk) / 2
+	stat.Spread = stat.BestAsk - stat.BestBid
+	if stat.MidPrice > 0 {
+		stat.SpreadBps = stat.Spread / stat.MidPrice * 10000
+	}
+
+	for _, lvl := range stat.Bids {
+		stat.BidVolume += lvl.Quantity
+	}
+	for _, lvl := range stat.Asks {
+		stat.AskVolume += lvl.Quantity
+	}
+	if total := stat.BidVolume + stat.AskVolume; total > 0 {
+		stat.Imbalance = (stat.BidVolume - stat.AskVolume) / total
+	}
+
+	return stat, true
+}
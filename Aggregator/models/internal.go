@@ -10,6 +10,7 @@ type SecondStat struct {
 	UserID int     `json:"user_id"`
 	Symbol string  `json:"s"`
 	Price  float64 `json:"p"`
+	Stale  bool    `json:"stale"` // Цена устарела, поток сделок молчит
 }
 
 type DailyStat struct {
@@ -21,6 +22,7 @@ type DailyStat struct {
 	OpenPrice  float64 `json:"o"`
 	HighPrice  float64 `json:"h"`
 	LowPrice   float64 `json:"l"`
+	Stale      bool    `json:"stale"` // Статистика устарела, поток тикеров молчит
 }
 
 func (ds *DailyStat) ChangeInPrice() decimal.Decimal {
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/shopspring/decimal"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type KafkaMsg struct {
 	MessageID     string          `json:"message_id"`
@@ -15,3 +19,15 @@ type KafkaMsg struct {
 	ChangePrice   decimal.Decimal `json:"change_price"`
 	ChangePercent decimal.Decimal `json:"change_percent"`
 }
+
+func (km KafkaMsg) KafkaKey() string {
+	return km.Symbol
+}
+
+func (km KafkaMsg) KafkaTime() time.Time {
+	return time.UnixMilli(km.RecvTime)
+}
+
+func (km KafkaMsg) KafkaID() string {
+	return km.MessageID
+}
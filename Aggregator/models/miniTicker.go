@@ -5,6 +5,16 @@ import (
 	"strconv"
 )
 
+// TickerStale - событие Socket о том, что поток тикеров молчит или ожил.
+// Приходит объектом, а не массивом тикеров
+type TickerStale struct {
+	EventType string `json:"e"`          // "stale"
+	EventTime int64  `json:"E"`          // Время события
+	Stream    string `json:"stream"`     // Поток биржи
+	Stale     bool   `json:"stale"`      // false - данные снова идут
+	SilenceMs int64  `json:"silence_ms"` // Сколько поток молчал
+}
+
 type MiniTicker struct {
 	EventType     string `json:"e"` // "24hrMiniTicker"
 	EventTime     int64  `json:"E"` // Время отправки
@@ -12,14 +12,23 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
-type producer struct {
+// Message is a value the producer writes to Kafka
+type Message interface {
+	KafkaKey() string
+	KafkaTime() time.Time
+	KafkaID() string
+}
+
+var _ Message = models.KafkaMsg{}
+
+type producer[T Message] struct {
 	writer      *kafka.Writer
 	config      kafkaConfig
-	batchBuffer []*models.KafkaMsg
+	batchBuffer []T
 	batchTimer  *time.Timer
 }
 
-func NewProducer(cfg kafkaConfig) *producer {
+func NewProducer[T Message](cfg kafkaConfig) *producer[T] {
 	slog.Info("🔄 Initializing Kafka producer", "brokers", cfg.Brockers, "topic", cfg.Topic)
 
 	// Сначала проверим доступность Kafka
@@ -84,15 +93,15 @@ func NewProducer(cfg kafkaConfig) *producer {
 
 	slog.Info("✅ Kafka producer initialized successfully")
 
-	return &producer{
+	return &producer[T]{
 		writer:      writer,
 		config:      cfg,
-		batchBuffer: make([]*models.KafkaMsg, 0, cfg.BatchSize),
+		batchBuffer: make([]T, 0, cfg.BatchSize),
 		batchTimer:  time.NewTimer(cfg.BatchTimeOut),
 	}
 }
 
-func (p *producer) Start(ctx context.Context, wg *sync.WaitGroup, inputChan chan models.KafkaMsg) {
+func (p *producer[T]) Start(ctx context.Context, wg *sync.WaitGroup, inputChan chan T) {
 	defer wg.Done()
 	defer p.writer.Close() // Добавьте закрытие writer
 
@@ -131,7 +140,7 @@ func (p *producer) Start(ctx context.Context, wg *sync.WaitGroup, inputChan chan
 			}
 
 			// Добавляем сообщение в буфер
-			p.batchBuffer = append(p.batchBuffer, &msg)
+			p.batchBuffer = append(p.batchBuffer, msg)
 
 			// Если буфер заполнен, отправляем
 			if len(p.batchBuffer) >= p.config.BatchSize {
@@ -143,7 +152,7 @@ func (p *producer) Start(ctx context.Context, wg *sync.WaitGroup, inputChan chan
 	}
 }
 
-func (p *producer) sendToKafka(ctx context.Context) {
+func (p *producer[T]) sendToKafka(ctx context.Context) {
 	if len(p.batchBuffer) == 0 {
 		return
 	}
@@ -157,11 +166,11 @@ func (p *producer) sendToKafka(ctx context.Context) {
 			continue
 		}
 		arrMsgs = append(arrMsgs, kafka.Message{
-			Key:   []byte(msg.Symbol),
+			Key:   []byte(msg.KafkaKey()),
 			Value: jsonData,
-			Time:  time.UnixMilli(msg.RecvTime),
+			Time:  msg.KafkaTime(),
 			Headers: []kafka.Header{
-				{Key: "message_id", Value: []byte(msg.MessageID)},
+				{Key: "message_id", Value: []byte(msg.KafkaID())},
 			},
 		})
 	}
@@ -14,8 +14,19 @@ type redisConfig struct {
 	TTL         time.Duration
 	RetryDelay  time.Duration
 	PingTimeout time.Duration
+	// Prices go over Pub/Sub or, with "streams", into capped Redis Streams that
+	// Profile reads with a consumer group and can replay after reconnects
+	Transport    string
+	StreamPrefix string
+	StreamMaxLen int64
+	// Last price and 24h stats of every followed symbol are kept in one hash
+	// per symbol, forgotten after CacheTTL without updates
+	CachePrefix string
+	CacheTTL    time.Duration
 }
 
+const TransportStreams = "streams"
+
 func LoadRedisConfig() redisConfig {
 	return redisConfig{
 		Addr:        getenv.GetString("REDIS_ADDR", "redis:6379"),
@@ -25,5 +36,12 @@ func LoadRedisConfig() redisConfig {
 		TTL:         getenv.GetTime("REDIS_TTL", 30*time.Second),
 		RetryDelay:  getenv.GetTime("REDIS_RETRY_DELAY", 2*time.Second),
 		PingTimeout: getenv.GetTime("REDIS_PING_TIMEOUT", 5*time.Second),
+
+		Transport:    getenv.GetString("PRICE_TRANSPORT", "pubsub"),
+		StreamPrefix: getenv.GetString("PRICE_STREAM_PREFIX", "prices:"),
+		StreamMaxLen: int64(getenv.GetInt("PRICE_STREAM_MAXLEN", 100)),
+
+		CachePrefix: getenv.GetString("PRICE_CACHE_PREFIX", "last:"),
+		CacheTTL:    getenv.GetTime("PRICE_CACHE_TTL", 24*time.Hour),
 	}
 }
@@ -0,0 +1,123 @@
+package reddis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wladim1r/aggregator/gateway/strman"
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/redis/go-redis/v9"
+)
+
+// followerStore keeps every follow as a "<symbol>|<userID>" member of one set,
+// so each change is a single atomic command
+type followerStore struct {
+	rdb *redis.Client
+	cfg redisConfig
+	key string
+}
+
+func NewFollowerStore(cfg redisConfig) *followerStore {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DBnum,
+	})
+
+	return &followerStore{
+		rdb: rdb,
+		cfg: cfg,
+		key: getenv.GetString("FOLLOWERS_KEY", "aggregator:followers"),
+	}
+}
+
+// Load retries while Redis is starting up, it is called once before serving
+func (fs *followerStore) Load(ctx context.Context) ([]strman.Follow, error) {
+	var (
+		members []string
+		err     error
+	)
+	for attempt := 1; attempt <= fs.cfg.MaxRetries; attempt++ {
+		members, err = fs.rdb.SMembers(ctx, fs.key).Result()
+		if err == nil {
+			break
+		}
+
+		slog.Warn("Could not load followers, retrying",
+			"attempt", attempt,
+			"delay", fs.cfg.RetryDelay,
+			"error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(fs.cfg.RetryDelay):
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load followers: %w", err)
+	}
+
+	follows := make([]strman.Follow, 0, len(members))
+	for _, member := range members {
+		f, err := parseFollow(member)
+		if err != nil {
+			slog.Warn("Skipping broken follower entry", "member", member, "error", err)
+			continue
+		}
+		follows = append(follows, f)
+	}
+	return follows, nil
+}
+
+// Update applies added and removed follows in one transaction
+func (fs *followerStore) Update(ctx context.Context, added, removed []strman.Follow) error {
+	ctx, cancel := context.WithTimeout(ctx, fs.cfg.PingTimeout)
+	defer cancel()
+
+	_, err := fs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(removed) > 0 {
+			pipe.SRem(ctx, fs.key, members(removed)...)
+		}
+		if len(added) > 0 {
+			pipe.SAdd(ctx, fs.key, members(added)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("update followers: %w", err)
+	}
+	return nil
+}
+
+// Client is shared with the replica registry
+func (fs *followerStore) Client() *redis.Client {
+	return fs.rdb
+}
+
+func (fs *followerStore) Close() error {
+	return fs.rdb.Close()
+}
+
+func members(follows []strman.Follow) []any {
+	out := make([]any, len(follows))
+	for i, f := range follows {
+		out[i] = f.Symbol + "|" + strconv.Itoa(f.UserID)
+	}
+	return out
+}
+
+func parseFollow(member string) (strman.Follow, error) {
+	symbol, id, ok := strings.Cut(member, "|")
+	if !ok || symbol == "" {
+		return strman.Follow{}, fmt.Errorf("no separator")
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return strman.Follow{}, err
+	}
+	return strman.Follow{Symbol: symbol, UserID: userID}, nil
+}
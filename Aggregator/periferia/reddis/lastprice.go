@@ -0,0 +1,90 @@
+package reddis
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/aggregator/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Fields of the "<CachePrefix><symbol>" hash, Profile reads them for snapshots
+const (
+	fieldPrice      = "p"
+	fieldTime       = "t"
+	fieldStale      = "stale"
+	fieldOpen       = "o"
+	fieldHigh       = "h"
+	fieldLow        = "l"
+	fieldClose      = "c"
+	fieldChangePct  = "change_pct"
+	fieldDailyTime  = "daily_t"
+	fieldDailyStale = "daily_stale"
+)
+
+// cacheLastPrice keeps the last price of msg for snapshots of newly connected users
+func (s *saver) cacheLastPrice(ctx context.Context, pipe redis.Pipeliner, msg models.SecondStat, now time.Time) {
+	key := s.cfg.CachePrefix + strings.ToLower(msg.Symbol)
+	pipe.HSet(ctx, key,
+		fieldPrice, msg.Price,
+		fieldTime, now.UnixMilli(),
+		fieldStale, msg.Stale,
+	)
+	pipe.Expire(ctx, key, s.cfg.CacheTTL)
+}
+
+// StartDaily keeps 24h stats of followed symbols next to their last price,
+// the client is closed by Start
+func (s *saver) StartDaily(ctx context.Context, wg *sync.WaitGroup, inChan chan models.DailyStat) {
+	defer wg.Done()
+
+	slog.Info("✍️ Starting Redis daily stat writer")
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping Redis daily stat writer")
+			return
+		case stat, ok := <-inChan:
+			if !ok {
+				slog.Info("Input channel closed, stopping Redis daily stat writer")
+				return
+			}
+
+			// The mini ticker covers the whole market, most symbols are not followed
+			if !s.sm.Follows(stat.Symbol) {
+				continue
+			}
+
+			if err := s.saveDailyStat(ctx, stat); err != nil {
+				slog.Error("Failed to save DailyStat to Redis", "symbol", stat.Symbol, "error", err)
+			}
+		}
+	}
+}
+
+func (s *saver) saveDailyStat(ctx context.Context, stat models.DailyStat) error {
+	var changePct float64
+	if stat.ClosePrice != 0 {
+		changePct = stat.ChangeInPercent().InexactFloat64()
+	}
+
+	key := s.cfg.CachePrefix + strings.ToLower(stat.Symbol)
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			fieldOpen, stat.OpenPrice,
+			fieldHigh, stat.HighPrice,
+			fieldLow, stat.LowPrice,
+			fieldClose, stat.ClosePrice,
+			fieldChangePct, changePct,
+			fieldDailyTime, stat.EventTime,
+			fieldDailyStale, stat.Stale,
+		)
+		pipe.Expire(ctx, key, s.cfg.CacheTTL)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,77 @@
+package reddis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wladim1r/aggregator/gateway/delivery"
+	"github.com/Wladim1r/aggregator/lib/getenv"
+	"github.com/redis/go-redis/v9"
+)
+
+// prefsStore keeps delivery prefs in one hash, "<userID>" -> "<intervalMs>:<thresholdBps>"
+type prefsStore struct {
+	rdb *redis.Client
+	key string
+}
+
+func NewPrefsStore(rdb *redis.Client) *prefsStore {
+	return &prefsStore{
+		rdb: rdb,
+		key: getenv.GetString("DELIVERY_KEY", "aggregator:delivery"),
+	}
+}
+
+func (ps *prefsStore) LoadPrefs(ctx context.Context) (map[int]delivery.Prefs, error) {
+	fields, err := ps.rdb.HGetAll(ctx, ps.key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("load delivery prefs: %w", err)
+	}
+
+	prefs := make(map[int]delivery.Prefs, len(fields))
+	for field, value := range fields {
+		userID, err := strconv.Atoi(field)
+		if err != nil {
+			slog.Warn("Skipping broken delivery prefs", "user", field, "error", err)
+			continue
+		}
+		p, err := parsePrefs(value)
+		if err != nil {
+			slog.Warn("Skipping broken delivery prefs", "user", field, "value", value, "error", err)
+			continue
+		}
+		prefs[userID] = p
+	}
+	return prefs, nil
+}
+
+func (ps *prefsStore) SavePrefs(ctx context.Context, userID int, prefs delivery.Prefs) error {
+	value := strconv.FormatInt(prefs.Interval.Milliseconds(), 10) + ":" + strconv.Itoa(prefs.ThresholdBps)
+	if err := ps.rdb.HSet(ctx, ps.key, strconv.Itoa(userID), value).Err(); err != nil {
+		return fmt.Errorf("save delivery prefs: %w", err)
+	}
+	return nil
+}
+
+func parsePrefs(value string) (delivery.Prefs, error) {
+	ms, bps, ok := strings.Cut(value, ":")
+	if !ok {
+		return delivery.Prefs{}, fmt.Errorf("no separator")
+	}
+	interval, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return delivery.Prefs{}, err
+	}
+	threshold, err := strconv.Atoi(bps)
+	if err != nil {
+		return delivery.Prefs{}, err
+	}
+	return delivery.Prefs{
+		Interval:     time.Duration(interval) * time.Millisecond,
+		ThresholdBps: threshold,
+	}, nil
+}
@@ -4,20 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/Wladim1r/aggregator/gateway/delivery"
 	"github.com/Wladim1r/aggregator/gateway/strman"
 	"github.com/Wladim1r/aggregator/models"
 	"github.com/redis/go-redis/v9"
 )
 
 type saver struct {
-	rdb *redis.Client
-	cfg redisConfig
-	sm  *strman.StreamManager
+	rdb      *redis.Client
+	cfg      redisConfig
+	sm       *strman.StreamManager
+	throttle *delivery.Throttle
 }
 
-func NewSaver(cfg redisConfig, sm *strman.StreamManager) *saver {
+func NewSaver(cfg redisConfig, sm *strman.StreamManager, throttle *delivery.Throttle) *saver {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Addr,
 		Password: cfg.Password,
@@ -25,9 +30,10 @@ func NewSaver(cfg redisConfig, sm *strman.StreamManager) *saver {
 	})
 
 	return &saver{
-		rdb: rdb,
-		cfg: cfg,
-		sm:  sm,
+		rdb:      rdb,
+		cfg:      cfg,
+		sm:       sm,
+		throttle: throttle,
 	}
 }
 
@@ -45,8 +51,86 @@ func (s *saver) saveSecondStat(
 		slog.Error("Could not parse SecondStat struct into []bytes", "error", err)
 		return err
 	}
-	cmd := s.rdb.Publish(ctx, streamName, data)
-	if cmd.Err() != nil {
+	if err := s.publish(ctx, s.rdb, streamName, data).Err(); err != nil {
+		slog.Error("Could not sent msg to Redis", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// publish sends a price to the channel name, or to the capped stream of that
+// name when prices go over Redis Streams
+func (s *saver) publish(ctx context.Context, cmd redis.Cmdable, name string, data []byte) redis.Cmder {
+	if s.cfg.Transport == TransportStreams {
+		return cmd.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.cfg.StreamPrefix + name,
+			MaxLen: s.cfg.StreamMaxLen,
+			Approx: true,
+			Values: map[string]any{"data": data},
+		})
+	}
+	return cmd.Publish(ctx, name, data)
+}
+
+// UserChannel is where prices of followed symbols are published for one user
+func UserChannel(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// saveUserStats caches msg as the last price and publishes it to followers the
+// throttle lets it through to, it returns how many got it
+func (s *saver) saveUserStats(ctx context.Context, msg models.SecondStat, followers []int) (int, error) {
+	now := time.Now()
+	pipe := s.rdb.Pipeline()
+	s.cacheLastPrice(ctx, pipe, msg, now)
+	sent := 0
+	for _, id := range followers {
+		if !s.throttle.Allow(id, msg, now) {
+			continue
+		}
+
+		msg.UserID = id
+		data, err := json.Marshal(msg)
+		if err != nil {
+			slog.Error("Could not parse SecondStat struct into []bytes", "error", err)
+			return 0, err
+		}
+		s.publish(ctx, pipe, UserChannel(id), data)
+		sent++
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Could not sent msgs to Redis", "error", err)
+		return 0, err
+	}
+	return sent, nil
+}
+
+// saveBookStat publishes order book metrics into the "<symbol>@book" channel
+func (s *saver) saveBookStat(ctx context.Context, msg models.BookStat) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Could not parse BookStat struct into []bytes", "error", err)
+		return err
+	}
+	if err := s.rdb.Publish(ctx, strings.ToLower(msg.Symbol)+"@book", data).Err(); err != nil {
+		slog.Error("Could not sent msg to Redis", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// saveCandle publishes a candle into the "<symbol>@kline_<interval>" channel
+func (s *saver) saveCandle(ctx context.Context, msg models.Candle) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Could not parse Candle struct into []bytes", "error", err)
+		return err
+	}
+	channel := strings.ToLower(msg.Symbol) + "@kline_" + msg.Interval
+	if err := s.rdb.Publish(ctx, channel, data).Err(); err != nil {
 		slog.Error("Could not sent msg to Redis", "error", err)
 		return err
 	}
@@ -63,7 +147,7 @@ func (s *saver) Start(ctx context.Context, wg *sync.WaitGroup, inChan chan model
 		return
 	}
 
-	slog.Info("✍️ Starting Redis writer")
+	slog.Info("✍️ Starting Redis writer", "transport", s.cfg.Transport)
 
 	for {
 		select {
@@ -82,15 +166,19 @@ func (s *saver) Start(ctx context.Context, wg *sync.WaitGroup, inChan chan model
 			if err := s.saveSecondStat(ctx, stat.Symbol, stat); err != nil {
 				slog.Error("Failed to save SecondStat to Redis",
 					"symbol", stat.Symbol,
-					"userID", stat.UserID,
 					"error", err,
 				)
 				continue
 			}
 
-			// for _, id := range followers {
-			// 	stat.UserID = id
-			// }
+			sentTo, err := s.saveUserStats(ctx, stat, followers)
+			if err != nil {
+				slog.Error("Failed to save SecondStat to Redis for followers",
+					"symbol", stat.Symbol,
+					"error", err,
+				)
+				continue
+			}
 
 			slog.Debug(
 				"Saved to Redis for followers",
@@ -98,7 +186,60 @@ func (s *saver) Start(ctx context.Context, wg *sync.WaitGroup, inChan chan model
 				stat.Symbol,
 				"count",
 				len(followers),
+				"sent",
+				sentTo,
 			)
 		}
 	}
 }
+
+// StartBook publishes order book metrics, the client is closed by Start
+func (s *saver) StartBook(ctx context.Context, wg *sync.WaitGroup, inChan chan models.BookStat) {
+	defer wg.Done()
+
+	slog.Info("✍️ Starting Redis order book writer")
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping Redis order book writer")
+			return
+		case stat, ok := <-inChan:
+			if !ok {
+				slog.Info("Input channel closed, stopping Redis order book writer")
+				return
+			}
+
+			if err := s.saveBookStat(ctx, stat); err != nil {
+				slog.Error("Failed to save BookStat to Redis", "symbol", stat.Symbol, "error", err)
+			}
+		}
+	}
+}
+
+// StartCandles publishes candles, the client is closed by Start
+func (s *saver) StartCandles(ctx context.Context, wg *sync.WaitGroup, inChan chan models.Candle) {
+	defer wg.Done()
+
+	slog.Info("✍️ Starting Redis candle writer")
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping Redis candle writer")
+			return
+		case candle, ok := <-inChan:
+			if !ok {
+				slog.Info("Input channel closed, stopping Redis candle writer")
+				return
+			}
+
+			if err := s.saveCandle(ctx, candle); err != nil {
+				slog.Error("Failed to save Candle to Redis",
+					"symbol", candle.Symbol,
+					"interval", candle.Interval,
+					"error", err)
+			}
+		}
+	}
+}
@@ -11,9 +11,13 @@ import (
 	repo "github.com/Wladim1r/auth/internal/api/repository"
 	serv "github.com/Wladim1r/auth/internal/api/service"
 	"github.com/Wladim1r/auth/periferia/db"
+	"github.com/Wladim1r/shared/tlsconf"
 	"google.golang.org/grpc"
 )
 
+// Peers allowed to call the service when TLS_ALLOW is empty
+const defaultTLSAllow = "/auth.Auth/*=profile;/grpc.health.v1.Health/*=*"
+
 func main() {
 	db := db.MustLoad()
 
@@ -31,7 +35,11 @@ func main() {
 		panic(err)
 	}
 
-	svr := grpc.NewServer()
+	opts, err := tlsconf.ServerOptions(tlsconf.LoadFromEnv(), tlsconf.PolicyFromEnv(defaultTLSAllow))
+	if err != nil {
+		panic(err)
+	}
+	svr := grpc.NewServer(opts...)
 
 	hand.RegisterServer(svr, uServ, tServ, uRepo)
 
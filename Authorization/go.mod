@@ -4,6 +4,7 @@ go 1.24.4
 
 require (
 	github.com/Wladim1r/proto-crypto v0.2.1
+	github.com/Wladim1r/shared v0.0.0
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	golang.org/x/crypto v0.43.0
@@ -27,3 +28,5 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251022142026-3a174f9686a8 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
 )
+
+replace github.com/Wladim1r/shared => ../shared
@@ -16,11 +16,15 @@ import (
 	"github.com/Wladim1r/profile/internal/api/profile/service"
 	"github.com/Wladim1r/profile/lib/getenv"
 	"github.com/Wladim1r/profile/lib/midware"
+	"github.com/Wladim1r/profile/periferia/control"
 	"github.com/Wladim1r/profile/periferia/db"
+	"github.com/Wladim1r/profile/periferia/reddis"
 	"github.com/Wladim1r/proto-crypto/gen/protos/auth-portfile"
+	"github.com/Wladim1r/shared/shard"
+	"github.com/Wladim1r/shared/tlsconf"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -31,22 +35,68 @@ func main() {
 	wg := new(sync.WaitGroup)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	uServ, cServ := service.NewProfileService(uRepo, cRepo)
-	connManager := connmanager.NewConnManager(ctx, wg, &http.Client{})
-
-	handServ := handler.NewHandler(uServ, cServ, &connManager)
-
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
+	creds, err := tlsconf.ClientCredentials(tlsconf.LoadFromEnv())
+	if err != nil {
+		panic(err)
+	}
+
 	conn, err := grpc.NewClient(
 		getenv.GetString("GRPC_ADDR", "localhost:50051"),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 	)
 	if err != nil {
 		panic(err)
 	}
 
+	// Follows go to the Aggregator replica owning the symbol, replicas are
+	// read from Redis and AGGREGATOR_ADDR is used while none are registered
+	rdb := redis.NewClient(&redis.Options{
+		Addr: getenv.GetString("REDIS_ADDR", "redis:6379"),
+	})
+	defer rdb.Close()
+
+	ctl := control.NewClient(
+		func(addr string) (grpc.ClientConnInterface, error) {
+			return grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+		},
+		shard.NewRegistry(rdb),
+		getenv.GetString("AGGREGATOR_ADDR", "aggregator-service:50061"),
+	)
+
+	// Symbols are checked against the catalog before coins are added or traded
+	clServ, err := service.NewCatalogService(service.CatalogFile, service.CatalogURL)
+	if err != nil {
+		panic(err)
+	}
+
+	lRepo := repository.NewLedgerRepository(db)
+	uServ, cServ := service.NewProfileService(uRepo, cRepo, lRepo, clServ)
+	connManager := connmanager.NewConnManager(ctx, wg, ctl, clServ, cRepo)
+
+	// Portfolios are valued at the last prices cached by the Aggregator
+	vServ := service.NewValuationService(uRepo, reddis.NewPriceCache(rdb), clServ)
+
+	// Portfolio values are snapshotted periodically for history charts, their
+	// change is told apart from coins bought in between by the ledger
+	hServ := service.NewHistoryService(
+		repository.NewSnapshotsRepository(db),
+		lRepo,
+		vServ,
+		reddis.NewPriceCache(rdb),
+		clServ,
+	)
+
+	// Coins and their cost are derived from the ledger of transactions
+	lServ := service.NewLedgerService(cRepo, lRepo, reddis.NewPriceCache(rdb), clServ)
+
+	// Coins are kept in named portfolios of the user
+	pServ := service.NewPortfoliosService(repository.NewPortfoliosRepository(db), cRepo)
+
+	handServ := handler.NewHandler(uServ, cServ, pServ, vServ, hServ, lServ, clServ, &connManager, ctl)
+
 	authConn := auth.NewAuthClient(conn)
 
 	handAuth := hand.NewClient(authConn, uServ)
@@ -77,13 +127,38 @@ func main() {
 			coins.POST("/symbol", handServ.AddCoin)
 			coins.PATCH("/symbol", handServ.UpdateCoin)
 			coins.DELETE("/symbol", handServ.DeleteCoin)
+			coins.GET("/transactions", handServ.GetTransactions)
+			coins.POST("/transaction", handServ.RecordTransaction)
+			coins.DELETE("/transaction/:id", handServ.DeleteTransaction)
+			coins.GET("/positions", handServ.GetPositions)
+		}
+
+		symbols := v2.Group("/symbols")
+		{
+			symbols.GET("", handServ.SearchSymbols)
+			symbols.GET("/complete", handServ.CompleteSymbols)
+			symbols.GET("/:symbol", handServ.GetSymbol)
+		}
+
+		portfolios := v2.Group("/portfolios")
+		{
+			portfolios.GET("", handServ.GetPortfolios)
+			portfolios.POST("", handServ.CreatePortfolio)
+			portfolios.GET("/:id", handServ.GetPortfolio)
+			portfolios.PATCH("/:id", handServ.RenamePortfolio)
+			portfolios.DELETE("/:id", handServ.DeletePortfolio)
+			portfolios.POST("/:id/import", handServ.ImportPortfolio)
+			portfolios.GET("/:id/export", handServ.ExportPortfolio)
 		}
 
 		user := v2.Group("/user")
 		{
-			// user.GET("/profile", handServ.GetUserProfile)
+			user.GET("/profile", handServ.GetUserProfile)
+			user.GET("/profile/history", handServ.GetUserProfileHistory)
 			user.DELETE("/profile", handServ.DeleteUserProfile)
 			user.GET("/profile/ws", handServ.GetUserProfileWS)
+			user.PUT("/delivery", handServ.SetDelivery)
+			user.PUT("/currency", handServ.SetCurrency)
 		}
 	}
 
@@ -98,8 +173,10 @@ func main() {
 		}
 	}()
 
-	wg.Add(1)
+	wg.Add(3)
 	go connManager.Run()
+	go hServ.Run(ctx, wg)
+	go clServ.Run(ctx, wg)
 
 	<-c
 
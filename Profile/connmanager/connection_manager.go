@@ -3,35 +3,81 @@ package connmanager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
-	"net/url"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/Wladim1r/profile/lib/rates"
+	"github.com/Wladim1r/profile/periferia/control"
 	"github.com/Wladim1r/profile/periferia/reddis"
 	"github.com/gorilla/websocket"
 	"github.com/shopspring/decimal"
 )
 
 type client struct {
-	Conn     *websocket.Conn
-	Profile  *models.User
-	Prices   map[string]decimal.Decimal
-	SendChan chan []byte
+	Conn    *websocket.Conn
+	Profile *models.User
+	Prices  map[string]decimal.Decimal
+	Stale   map[string]bool
+	Changes map[string]decimal.Decimal
+	// Symbols whose 24h change stopped updating
+	StaleChanges map[string]bool
+	SendChan     chan []byte
+	// Cost and realized profit of coins, derived from the ledger
+	Positions map[string]models.Position
+	// The portfolio watched by the connection, 0 for all of them
+	PortfolioID uint
+	// Values are reported in Currency, prices of Links convert quotes into it
+	Currency string
+	Links    []string
+	// Currency was chosen for the connection, the reporting currency of the user does not change it
+	Chosen bool
+	// Prices come from the dispatcher and from the snapshot sent on connect
+	mu sync.Mutex
+}
+
+// How often the followers are pushed to the Aggregator, it may have restarted in between
+var SyncInterval = getenv.GetTime("AGGREGATOR_SYNC_INTERVAL", 30*time.Second)
+
+// How soon followers are pushed again after the Aggregator replicas changed under a sync
+var ResyncDelay = getenv.GetTime("AGGREGATOR_RESYNC_DELAY", 5*time.Second)
+
+// Last ticks per coin sent on connect, there are some only with PRICE_TRANSPORT=streams
+var ReplayTicks = getenv.GetInt("PRICE_REPLAY_TICKS", 1)
+
+// Assets knows which assets a symbol trades and the pairs linking assets
+type Assets interface {
+	Assets(symbol string) (base, quote string, ok bool)
+	Links(from, to string) ([]string, bool)
+}
+
+// Holders lists users holding each coin, they follow it while offline too
+type Holders interface {
+	GetHolders() (map[string][]int, error)
 }
 
 type ConnectionManager struct {
-	clients    map[int]*client
-	mu         sync.RWMutex
-	httpClient *http.Client
+	clients map[int]*client
+	mu      sync.RWMutex
+
+	assets  Assets
+	holders Holders
+
+	control  *control.Client
+	syncChan chan struct{}
 
+	// Prices come on one Redis channel per connected user, already
+	// throttled by the Aggregator
 	subscriber *reddis.Subscriber
 
-	activeRedisSub map[string]struct{}
-	userSubCoins   map[string]map[int]struct{}
+	userSubCoins map[string]map[int]struct{}
 
 	mainCtx context.Context
 	mainWg  *sync.WaitGroup
@@ -40,16 +86,20 @@ type ConnectionManager struct {
 func NewConnManager(
 	ctx context.Context,
 	wg *sync.WaitGroup,
-	httpClient *http.Client,
+	ctl *control.Client,
+	assets Assets,
+	holders Holders,
 ) ConnectionManager {
 	return ConnectionManager{
-		clients:        make(map[int]*client),
-		subscriber:     reddis.NewSubscriber(),
-		activeRedisSub: make(map[string]struct{}),
-		userSubCoins:   make(map[string]map[int]struct{}),
-		mainCtx:        ctx,
-		mainWg:         wg,
-		httpClient:     httpClient,
+		clients:      make(map[int]*client),
+		assets:       assets,
+		holders:      holders,
+		subscriber:   reddis.NewSubscriber(),
+		userSubCoins: make(map[string]map[int]struct{}),
+		mainCtx:      ctx,
+		mainWg:       wg,
+		control:      ctl,
+		syncChan:     make(chan struct{}, 1),
 	}
 }
 
@@ -61,6 +111,9 @@ func (cm *ConnectionManager) Run() {
 
 	slog.Info("Starting ConnectionManager Redis dispatcher")
 
+	cm.mainWg.Add(1)
+	go cm.syncLoop()
+
 	for {
 		select {
 		case <-cm.mainCtx.Done():
@@ -71,6 +124,7 @@ func (cm *ConnectionManager) Run() {
 				return
 			}
 			cm.processRedisMessage(msg)
+			cm.subscriber.Ack(cm.mainCtx, msg)
 		}
 	}
 }
@@ -79,26 +133,121 @@ func (cm *ConnectionManager) FollowCoin(userID int, symbol string) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	symbol = strings.ToLower(symbol)
+
 	if _, ok := cm.userSubCoins[symbol]; !ok {
 		cm.userSubCoins[symbol] = make(map[int]struct{})
 	}
 	cm.userSubCoins[symbol][userID] = struct{}{}
 	slog.Info("CONN_MANAGER: User followed coin", "userID", userID, "symbol", symbol)
+}
 
-	if _, ok := cm.activeRedisSub[symbol]; !ok {
-		if err := cm.subscriber.Subscribe(cm.mainCtx, symbol); err != nil {
-			slog.Error(
-				"CONN_MANAGER: Could not subscribe on coin stream",
-				"coin",
-				symbol,
-				"error",
-				err.Error(),
-			)
+// UnfollowCoin stops delivering prices of symbol to userID
+func (cm *ConnectionManager) UnfollowCoin(userID int, symbol string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	symbol = strings.ToLower(symbol)
+
+	users, ok := cm.userSubCoins[symbol]
+	if !ok {
+		return
+	}
+	delete(users, userID)
+	slog.Info("CONN_MANAGER: User unfollowed coin", "userID", userID, "symbol", symbol)
+
+	if len(users) == 0 {
+		delete(cm.userSubCoins, symbol)
+	}
+}
+
+// RequestSync pushes the followers to the Aggregator soon
+func (cm *ConnectionManager) RequestSync() {
+	select {
+	case cm.syncChan <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop keeps followers on the Aggregator equal to the users holding or
+// following coins here. It runs on start too, so followers left over from
+// before a restart are dropped
+func (cm *ConnectionManager) syncLoop() {
+	defer cm.mainWg.Done()
+
+	ticker := time.NewTicker(SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		// Replicas learn of each other within seconds, a refused share is sent again then
+		var resync <-chan time.Time
+
+		// Without the holders the sync would drop followers of offline users
+		held, err := cm.holders.GetHolders()
+		if err != nil {
+			slog.Warn("CONN_MANAGER: Could not read holders, followers are not synced", "error", err)
+		} else {
+			wanted := func() map[string][]int { return cm.wantedFollowers(held) }
+			if err := cm.control.Sync(cm.mainCtx, wanted); err != nil {
+				slog.Warn("CONN_MANAGER: Could not sync followers with Aggregator", "error", err)
+				if errors.Is(err, control.ErrReplicasChanged) {
+					resync = time.After(ResyncDelay)
+				}
+			}
+		}
+
+		select {
+		case <-cm.mainCtx.Done():
 			return
+		case <-ticker.C:
+		case <-cm.syncChan:
+		case <-resync:
+		}
+	}
+}
+
+// wantedFollowers merges users holding coins in the database with the ones
+// following coins since, held comes from Holders
+func (cm *ConnectionManager) wantedFollowers(held map[string][]int) map[string][]int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	users := make(map[string]map[int]struct{}, len(held)+len(cm.userSubCoins))
+	follow := func(symbol string, userID int) {
+		if _, ok := users[symbol]; !ok {
+			users[symbol] = make(map[int]struct{})
+		}
+		users[symbol][userID] = struct{}{}
+	}
+
+	for symbol, ids := range held {
+		for _, userID := range ids {
+			follow(symbol, userID)
+		}
+	}
+	for symbol, ids := range cm.userSubCoins {
+		for userID := range ids {
+			follow(symbol, userID)
+		}
+	}
+
+	// Connected users get prices of the pairs converting their coins too
+	for userID, client := range cm.clients {
+		client.mu.Lock()
+		for _, symbol := range client.Links {
+			follow(symbol, userID)
+		}
+		client.mu.Unlock()
+	}
+
+	wanted := make(map[string][]int, len(users))
+	for symbol, ids := range users {
+		for userID := range ids {
+			wanted[symbol] = append(wanted[symbol], userID)
 		}
-		cm.activeRedisSub[symbol] = struct{}{}
-		slog.Info("CONN_MANAGER: New active Redis subscription created", "symbol", symbol)
+		slices.Sort(wanted[symbol])
 	}
+	return wanted
 }
 
 func (cm *ConnectionManager) UnfollowAllCoins(userID int) {
@@ -110,44 +259,28 @@ func (cm *ConnectionManager) UnfollowAllCoins(userID int) {
 
 		// Если больше нет подписчиков на этот символ
 		if len(users) == 0 {
-			slog.Info("No more subscribers, unsubscribing from Redis", "symbol", symbol)
+			slog.Info("No more subscribers", "symbol", symbol)
 			delete(cm.userSubCoins, symbol)
-			delete(cm.activeRedisSub, symbol)
-			if err := cm.subscriber.Unsubscribe(cm.mainCtx, symbol); err != nil {
-				slog.Error("Failed to unsubscribe from Redis", "symbol", symbol, "error", err)
-			} else {
-				slog.Info("Unsubscribed from Redis channel (no subscribers)", "symbol", symbol)
-			}
 		}
 	}
 }
 
+// processRedisMessage delivers a price published for one user, only the
+// portfolio of that user is recomputed
 func (cm *ConnectionManager) processRedisMessage(msg reddis.Message) {
-	cm.mu.RLock()
-	// Создаем копию ID подписчиков, чтобы избежать гонки состояний
-	// при итерации и одновременной отписке пользователя.
-	userIDs := make([]int, 0, len(cm.userSubCoins[msg.Channel]))
-	for id := range cm.userSubCoins[msg.Channel] {
-		userIDs = append(userIDs, id)
-	}
-	cm.mu.RUnlock()
-
-	slog.Info("Processing Redis message",
-		"channel", msg.Channel,
-		"subscribers_count", len(userIDs))
-
 	var secStat models.SecondStat
 	if err := json.Unmarshal([]byte(msg.Payload), &secStat); err != nil {
 		slog.Error("Failed to parse JSON into 'SecondStat'", "error", err)
 		return
 	}
 
-	if len(userIDs) != 0 {
-		for _, id := range userIDs {
-			if err := cm.WriteToUser(id, secStat); err != nil {
-				slog.Warn("Failed to write to user", "user_id", id, "error", err)
-			}
-		}
+	slog.Debug("Processing Redis message",
+		"channel", msg.Channel,
+		"user_id", secStat.UserID,
+		"symbol", secStat.Symbol)
+
+	if err := cm.WriteToUser(int(secStat.UserID), secStat); err != nil {
+		slog.Warn("Failed to write to user", "user_id", secStat.UserID, "error", err)
 	}
 }
 
@@ -196,7 +329,7 @@ func (c *client) writer(ctx context.Context, wg *sync.WaitGroup) {
 
 func (c *client) reader(cm *ConnectionManager) {
 	defer func() {
-		cm.unregister(int(c.Profile.ID))
+		cm.unregister(int(c.Profile.ID), c)
 	}()
 
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -227,7 +360,18 @@ func (c *client) reader(cm *ConnectionManager) {
 	}
 }
 
-func (cm *ConnectionManager) Register(userID int, profile *models.User, conn *websocket.Conn) {
+// Register starts sending prices of coins in profile, which holds coins of
+// the watched portfolio only. A chosen currency is kept when the user changes
+// the reporting currency
+func (cm *ConnectionManager) Register(
+	userID int,
+	portfolioID uint,
+	currency string,
+	chosen bool,
+	profile *models.User,
+	positions map[string]models.Position,
+	conn *websocket.Conn,
+) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -241,11 +385,19 @@ func (cm *ConnectionManager) Register(userID int, profile *models.User, conn *we
 
 	sendChan := make(chan []byte, 100)
 	client := &client{
-		Conn:     conn,
-		Profile:  profile,
-		Prices:   make(map[string]decimal.Decimal),
-		SendChan: sendChan,
+		Conn:         conn,
+		Profile:      profile,
+		Prices:       make(map[string]decimal.Decimal),
+		Stale:        make(map[string]bool),
+		Changes:      make(map[string]decimal.Decimal),
+		StaleChanges: make(map[string]bool),
+		Positions:    positions,
+		PortfolioID:  portfolioID,
+		Currency:     currency,
+		Chosen:       chosen,
+		SendChan:     sendChan,
 	}
+	client.Links = cm.links(client)
 
 	cm.clients[userID] = client
 
@@ -253,13 +405,153 @@ func (cm *ConnectionManager) Register(userID int, profile *models.User, conn *we
 	for k := range cm.clients {
 		keys = append(keys, k)
 	}
-	slog.Info("CONN_MANAGER: User registered", "userID", userID, "active_clients", keys)
+	slog.Info("CONN_MANAGER: User registered",
+		"userID", userID,
+		"portfolioID", portfolioID,
+		"active_clients", keys)
+
+	if err := cm.subscriber.Subscribe(cm.mainCtx, reddis.UserChannel(userID)); err != nil {
+		slog.Error("CONN_MANAGER: Could not subscribe on user prices", "userID", userID, "error", err)
+	}
 
 	cm.mainWg.Add(1)
 	go client.writer(cm.mainCtx, cm.mainWg)
 	go client.reader(cm)
+
+	// Coins of the user were followed before the connection was registered
+	cm.RequestSync()
+
+	go func() {
+		cm.sendSnapshot(userID, snapshotSymbols(profile.Coins, client.Links))
+		cm.replay(userID, profile.Coins)
+	}()
+}
+
+// links returns pairs valuing coins of the client in its currency and
+// converting their profits from the quote, c.mu must be held unless the
+// client is not registered yet
+func (cm *ConnectionManager) links(c *client) []string {
+	symbols := make([]string, 0, len(c.Profile.Coins))
+	for _, coin := range c.Profile.Coins {
+		symbols = append(symbols, coin.Symbol)
+	}
+	links := rates.ValueLinks(cm.assets, symbols, c.Currency)
+
+	for _, symbol := range symbols {
+		if _, quote, ok := cm.assets.Assets(symbol); ok {
+			path, _ := cm.assets.Links(quote, c.Currency)
+			links = append(links, path...)
+		}
+	}
+	slices.Sort(links)
+	return slices.Compact(links)
+}
+
+func snapshotSymbols(coins []models.Coin, links []string) []string {
+	symbols := make([]string, 0, len(coins)+len(links))
+	for _, coin := range coins {
+		symbols = append(symbols, strings.ToLower(coin.Symbol))
+	}
+	return append(symbols, links...)
+}
+
+// SetCurrency reports values of a connected user in the new reporting currency
+// from now on, the pairs converting into it are followed and their cached
+// prices are sent. A connection with a chosen currency keeps it
+func (cm *ConnectionManager) SetCurrency(userID int, currency string) {
+	var (
+		links   []string
+		changed bool
+	)
+	err := cm.writeToUser(userID, func(c *client) {
+		if c.Chosen {
+			return
+		}
+		c.Currency = currency
+		c.Links = cm.links(c)
+		links, changed = c.Links, true
+	})
+	if err != nil {
+		slog.Debug("CONN_MANAGER: Currency not sent, user is not connected", "userID", userID)
+		return
+	}
+	if !changed {
+		slog.Debug("CONN_MANAGER: Currency kept, the connection chose its own", "userID", userID)
+		return
+	}
+
+	cm.RequestSync()
+	cm.sendSnapshot(userID, links)
+}
+
+// sendSnapshot sends cached prices of symbols of the user in one message,
+// so the portfolio is complete without waiting for the next tick of each coin
+func (cm *ConnectionManager) sendSnapshot(userID int, symbols []string) {
+	prices, err := cm.subscriber.LastPrices(cm.mainCtx, symbols)
+	if err != nil {
+		slog.Warn("CONN_MANAGER: Could not read cached prices", "userID", userID, "error", err)
+		return
+	}
+	if len(prices) == 0 {
+		return
+	}
+
+	err = cm.writeToUser(userID, func(c *client) {
+		for symbol, last := range prices {
+			c.setPrice(symbol, last.Price, last.Stale)
+			if last.HasDaily {
+				c.Changes[symbol] = decimal.NewFromFloat(last.ChangePct)
+				if last.DailyStale {
+					c.StaleChanges[symbol] = true
+				} else {
+					delete(c.StaleChanges, symbol)
+				}
+			}
+		}
+	})
+	if err != nil {
+		slog.Debug("CONN_MANAGER: User left before snapshot", "userID", userID)
+		return
+	}
+	slog.Info("CONN_MANAGER: Snapshot sent", "userID", userID, "coins", len(prices))
+}
+
+// replay sends the last ticks of every coin to a freshly connected user, so
+// the portfolio is complete before new prices arrive
+func (cm *ConnectionManager) replay(userID int, coins []models.Coin) {
+	if ReplayTicks <= 0 {
+		return
+	}
+
+	for _, coin := range coins {
+		symbol := strings.ToLower(coin.Symbol)
+		msgs, err := cm.subscriber.Replay(cm.mainCtx, symbol, ReplayTicks)
+		if err != nil {
+			slog.Warn("CONN_MANAGER: Could not replay prices", "symbol", symbol, "error", err)
+			continue
+		}
+
+		for _, msg := range msgs {
+			var secStat models.SecondStat
+			if err := json.Unmarshal([]byte(msg.Payload), &secStat); err != nil {
+				slog.Error("Failed to parse JSON into 'SecondStat'", "error", err)
+				continue
+			}
+			if err := cm.WriteToUser(userID, secStat); err != nil {
+				slog.Debug("CONN_MANAGER: User left during replay", "userID", userID)
+				return
+			}
+		}
+	}
 }
 func (cm *ConnectionManager) WriteToUser(userID int, msg models.SecondStat) error {
+	return cm.writeToUser(userID, func(c *client) {
+		c.setPrice(msg.Symbol, msg.Price, msg.Stale)
+	})
+}
+
+// writeToUser applies update to the client of userID and sends the recomputed portfolio
+func (cm *ConnectionManager) writeToUser(userID int, update func(c *client)) error {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
@@ -268,25 +560,10 @@ func (cm *ConnectionManager) WriteToUser(userID int, msg models.SecondStat) erro
 		return fmt.Errorf("Connection for user %d does not exist", userID)
 	}
 
-	client.Prices[msg.Symbol] = decimal.NewFromFloat(msg.Price)
-
-	profile := models.Profile{
-		ID:   uint(userID),
-		Name: client.Profile.Name,
-		Coins: models.CoinsProfile{
-			Quantities: make(map[string]decimal.Decimal),
-			Prices:     make(map[string]decimal.Decimal),
-			Totals:     make(map[string]decimal.Decimal),
-		},
-	}
-
-	for _, coin := range client.Profile.Coins {
-		if price, ok := client.Prices[coin.Symbol]; ok {
-			profile.Coins.Quantities[coin.Symbol] = coin.Quantity
-			profile.Coins.Prices[coin.Symbol] = price
-			profile.Coins.Totals[coin.Symbol] = price.Mul(coin.Quantity)
-		}
-	}
+	client.mu.Lock()
+	update(client)
+	profile := client.portfolio(userID, cm.assets)
+	client.mu.Unlock()
 
 	profileJSON, err := json.Marshal(profile)
 	if err != nil {
@@ -302,34 +579,155 @@ func (cm *ConnectionManager) WriteToUser(userID int, msg models.SecondStat) erro
 	return nil
 }
 
-func (cm *ConnectionManager) unregister(userID int) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
+// Watching returns the portfolio watched by the connection of userID
+func (cm *ConnectionManager) Watching(userID int) (uint, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 
 	client, ok := cm.clients[userID]
 	if !ok {
-		return // already unregistered
+		return 0, false
+	}
+	return client.PortfolioID, true
+}
+
+// UpdatePositions replaces coins of a connected user after the ledger changed
+// and sends the recomputed portfolio. Positions of another portfolio than the
+// watched one are ignored, the user may have reconnected in between
+func (cm *ConnectionManager) UpdatePositions(
+	userID int,
+	portfolioID uint,
+	positions map[string]models.Position,
+) {
+	var relinked bool
+	err := cm.writeToUser(userID, func(c *client) {
+		if c.PortfolioID != portfolioID {
+			return
+		}
+
+		coins := make([]models.Coin, 0, len(positions))
+		for symbol, pos := range positions {
+			if pos.Quantity.IsPositive() {
+				coins = append(coins, models.Coin{
+					Symbol:   symbol,
+					Quantity: pos.Quantity,
+					UserID:   uint(userID),
+				})
+			}
+		}
+		sort.Slice(coins, func(i, j int) bool { return coins[i].Symbol < coins[j].Symbol })
+
+		c.Profile.Coins = coins
+		c.Positions = positions
+
+		links := cm.links(c)
+		relinked = !slices.Equal(links, c.Links)
+		c.Links = links
+	})
+	if err != nil {
+		slog.Debug("CONN_MANAGER: Positions not sent, user is not connected", "userID", userID)
+		return
+	}
+	if relinked {
+		cm.RequestSync()
+	}
+}
+
+func (c *client) setPrice(symbol string, price float64, stale bool) {
+	c.Prices[symbol] = decimal.NewFromFloat(price)
+	if stale {
+		c.Stale[symbol] = true
+	} else {
+		delete(c.Stale, symbol)
+	}
+}
+
+// portfolio values coins as the REST valuation does, through the prices the
+// client got, c.mu must be held. Coins without a rate to the currency are
+// listed as unpriced and left out of the total
+func (c *client) portfolio(userID int, assets Assets) models.Profile {
+	profile := models.Profile{
+		ID:          uint(userID),
+		Name:        c.Profile.Name,
+		PortfolioID: c.PortfolioID,
+		Coins: models.CoinsProfile{
+			Quantities:   make(map[string]decimal.Decimal),
+			Prices:       make(map[string]decimal.Decimal),
+			Totals:       make(map[string]decimal.Decimal),
+			Stale:        make(map[string]bool),
+			Changes:      make(map[string]decimal.Decimal),
+			StaleChanges: make(map[string]bool),
+			Realized:     make(map[string]decimal.Decimal),
+			Unrealized:   make(map[string]decimal.Decimal),
+			Currency:     c.Currency,
+			Total:        decimal.Zero,
+			Assets:       make(map[string]models.AssetProfile),
+		},
+	}
+
+	graph := rates.FromPrices(assets, c.Prices)
+
+	for _, coin := range c.Profile.Coins {
+		profile.Coins.Quantities[coin.Symbol] = coin.Quantity
+		if price, ok := c.Prices[coin.Symbol]; ok {
+			profile.Coins.Prices[coin.Symbol] = price
+		}
+		if c.Stale[coin.Symbol] {
+			profile.Coins.Stale[coin.Symbol] = true
+		}
+		if change, ok := c.Changes[coin.Symbol]; ok {
+			profile.Coins.Changes[coin.Symbol] = change
+		}
+		if c.StaleChanges[coin.Symbol] {
+			profile.Coins.StaleChanges[coin.Symbol] = true
+		}
+
+		_, total, ok := graph.Value(assets, coin.Symbol, coin.Quantity, c.Currency)
+		if !ok {
+			profile.Coins.Unpriced = append(profile.Coins.Unpriced, coin.Symbol)
+			continue
+		}
+		profile.Coins.Totals[coin.Symbol] = total
+		profile.Coins.Total = profile.Coins.Total.Add(total)
+
+		base, quote, _ := assets.Assets(coin.Symbol)
+		asset := profile.Coins.Assets[base]
+		asset.Quantity = asset.Quantity.Add(coin.Quantity)
+		asset.Value = asset.Value.Add(total)
+		profile.Coins.Assets[base] = asset
+
+		// Cost and realized profit are in the quote of the pair
+		pos, ok := c.Positions[coin.Symbol]
+		if !ok {
+			continue
+		}
+		if rate, ok := graph.Rate(quote, c.Currency); ok {
+			profile.Coins.Realized[coin.Symbol] = pos.Realized.Mul(rate).Round(8)
+			profile.Coins.Unrealized[coin.Symbol] = total.Sub(pos.CostBasis.Mul(rate)).Round(8)
+		}
+	}
+	sort.Strings(profile.Coins.Unpriced)
+	return profile
+}
+
+// unregister removes client of userID, a client replaced by a reconnect of
+// the user is closed by Register already and leaves the new one in place
+func (cm *ConnectionManager) unregister(userID int, client *client) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if current, ok := cm.clients[userID]; !ok || current != client {
+		return // already unregistered or replaced
 	}
 
 	slog.Info("CONN_MANAGER: Unregistering user", "userID", userID)
 
 	// Отписываемся от всех монет пользователя
 	for _, coin := range client.Profile.Coins {
-		symbol := coin.Symbol
+		symbol := strings.ToLower(coin.Symbol)
 		if users, ok := cm.userSubCoins[symbol]; ok {
 			delete(users, userID)
 
-			// Notify aggregator that a user has unfollowed
-			urlQuery := fmt.Sprintf(
-				"http://aggregator-service:8088/coin?symbol=%s&id=%d",
-				url.QueryEscape(symbol),
-				userID,
-			)
-			req, err := http.NewRequestWithContext(cm.mainCtx, http.MethodDelete, urlQuery, nil)
-			if err == nil {
-				go cm.httpClient.Do(req)
-			}
-
 			remainingUsers := make([]int, 0, len(users))
 			for k := range users {
 				remainingUsers = append(remainingUsers, k)
@@ -347,24 +745,17 @@ func (cm *ConnectionManager) unregister(userID int) {
 			// Если больше нет подписчиков
 			if len(users) == 0 {
 				delete(cm.userSubCoins, symbol)
-				delete(cm.activeRedisSub, symbol)
-
-				if err := cm.subscriber.Unsubscribe(cm.mainCtx, symbol); err != nil {
-					slog.Error(
-						"CONN_MANAGER: Failed to unsubscribe from Redis",
-						"symbol",
-						symbol,
-						"error",
-						err,
-					)
-				} else {
-					slog.Info("CONN_MANAGER: Unsubscribed from Redis (user disconnected)", "symbol", symbol)
-				}
 			}
 		}
 	}
 
+	if err := cm.subscriber.Unsubscribe(cm.mainCtx, reddis.UserChannel(userID)); err != nil {
+		slog.Error("CONN_MANAGER: Failed to unsubscribe from user prices", "userID", userID, "error", err)
+	}
+
 	delete(cm.clients, userID)
+	// The Aggregator stops streams nobody follows any more
+	cm.RequestSync()
 
 	if client.Conn != nil {
 		client.Conn.Close()
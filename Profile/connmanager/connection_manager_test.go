@@ -0,0 +1,101 @@
+package connmanager
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// assets splits symbols listed as base and quote, without pairs linking assets
+type assets map[string][2]string
+
+func (a assets) Assets(symbol string) (string, string, bool) {
+	pair, ok := a[symbol]
+	return pair[0], pair[1], ok
+}
+
+func (a assets) Links(from, to string) ([]string, bool) {
+	return nil, from == to
+}
+
+func dec(v string) decimal.Decimal {
+	return decimal.RequireFromString(v)
+}
+
+func testClient(coins map[string]string, prices map[string]string) *client {
+	c := &client{
+		Profile:      &models.User{Name: "satoshi"},
+		Prices:       make(map[string]decimal.Decimal),
+		Stale:        make(map[string]bool),
+		Changes:      make(map[string]decimal.Decimal),
+		StaleChanges: make(map[string]bool),
+		Currency:     "usdt",
+		SendChan:     make(chan []byte, 10),
+	}
+	for symbol, quantity := range coins {
+		c.Profile.Coins = append(c.Profile.Coins, models.Coin{Symbol: symbol, Quantity: dec(quantity)})
+	}
+	for symbol, price := range prices {
+		c.Prices[symbol] = dec(price)
+	}
+	return c
+}
+
+func TestPortfolioValuesByBase(t *testing.T) {
+	listed := assets{
+		"ethbtc":  {"eth", "btc"},
+		"ethusdt": {"eth", "usdt"},
+		"btcusdt": {"btc", "usdt"},
+		"wifusdt": {"wif", "usdt"},
+	}
+	c := testClient(
+		map[string]string{"ethbtc": "2", "btcusdt": "1", "wifusdt": "100"},
+		map[string]string{"ethbtc": "0.05", "ethusdt": "4900", "btcusdt": "100000"},
+	)
+	c.Positions = map[string]models.Position{
+		"btcusdt": {Quantity: dec("1"), CostBasis: dec("90000"), Realized: dec("10")},
+	}
+
+	profile := c.portfolio(7, listed)
+	coins := profile.Coins
+
+	// ethbtc is valued as eth, like the REST valuation does
+	if !coins.Totals["ethbtc"].Equal(dec("9800")) || !coins.Prices["ethbtc"].Equal(dec("0.05")) {
+		t.Fatalf("ethbtc = %s at %s, want 9800 at its own price 0.05", coins.Totals["ethbtc"], coins.Prices["ethbtc"])
+	}
+	if !coins.Total.Equal(dec("109800")) {
+		t.Fatalf("total = %s, want 109800", coins.Total)
+	}
+	if !coins.Unrealized["btcusdt"].Equal(dec("10000")) || !coins.Realized["btcusdt"].Equal(dec("10")) {
+		t.Fatalf("profits = %v and %v, want 10000 unrealized and 10 realized", coins.Unrealized, coins.Realized)
+	}
+	// A coin without a price is listed, not dropped
+	if !slices.Equal(coins.Unpriced, []string{"wifusdt"}) || !coins.Quantities["wifusdt"].Equal(dec("100")) {
+		t.Fatalf("unpriced = %v, quantities = %v, want wifusdt listed", coins.Unpriced, coins.Quantities)
+	}
+}
+
+func TestSetCurrencyKeepsChosen(t *testing.T) {
+	c := testClient(map[string]string{"btcusdt": "1"}, map[string]string{"btcusdt": "100000"})
+	c.Currency, c.Chosen = "btc", true
+	cm := &ConnectionManager{
+		clients: map[int]*client{7: c},
+		assets:  assets{"btcusdt": {"btc", "usdt"}},
+	}
+
+	cm.SetCurrency(7, "eur")
+
+	if c.Currency != "btc" {
+		t.Fatalf("currency = %s, want btc chosen for the connection", c.Currency)
+	}
+	var profile models.Profile
+	if err := json.Unmarshal(<-c.SendChan, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Coins.Currency != "btc" {
+		t.Fatalf("profile currency = %s, want btc", profile.Coins.Currency)
+	}
+}
@@ -3,7 +3,8 @@ module github.com/Wladim1r/profile
 go 1.24.4
 
 require (
-	github.com/Wladim1r/proto-crypto v0.2.1
+	github.com/Wladim1r/shared v0.0.0
+	github.com/Wladim1r/proto-crypto v0.3.0
 	github.com/gin-gonic/gin v1.11.0
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/gorilla/websocket v1.5.3
@@ -11,6 +12,7 @@ require (
 	github.com/redis/go-redis/v9 v9.17.2
 	github.com/shopspring/decimal v1.4.0
 	google.golang.org/grpc v1.76.0
+	google.golang.org/protobuf v1.36.10
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.31.1
 )
@@ -55,5 +57,9 @@ require (
 	golang.org/x/text v0.28.0 // indirect
 	golang.org/x/tools v0.36.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b // indirect
-	google.golang.org/protobuf v1.36.10 // indirect
+)
+
+replace (
+	github.com/Wladim1r/proto-crypto => ../proto-crypto
+	github.com/Wladim1r/shared => ../shared
 )
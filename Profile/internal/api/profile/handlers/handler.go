@@ -1,35 +1,165 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
-	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Wladim1r/profile/connmanager"
 	"github.com/Wladim1r/profile/internal/api/profile/service"
 	"github.com/Wladim1r/profile/internal/models"
 	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/periferia/control"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type handler struct {
-	us service.UsersService
-	cs service.CoinsService
-	cm *connmanager.ConnectionManager
-	cl *http.Client
+	us  service.UsersService
+	cs  service.CoinsService
+	ps  service.PortfoliosService
+	vs  service.ValuationService
+	hs  service.HistoryService
+	ls  service.LedgerService
+	cl  service.CatalogService
+	cm  *connmanager.ConnectionManager
+	ctl *control.Client
 }
 
 func NewHandler(
 	us service.UsersService,
 	cs service.CoinsService,
+	ps service.PortfoliosService,
+	vs service.ValuationService,
+	hs service.HistoryService,
+	ls service.LedgerService,
+	cl service.CatalogService,
 	cm *connmanager.ConnectionManager,
+	ctl *control.Client,
 ) *handler {
-	return &handler{us: us, cs: cs, cm: cm, cl: &http.Client{}}
+	return &handler{us: us, cs: cs, ps: ps, vs: vs, hs: hs, ls: ls, cl: cl, cm: cm, ctl: ctl}
+}
+
+var quotePattern = regexp.MustCompile(`^[a-z]{2,10}$`)
+
+// queryQuote reads the "quote" query parameter, "" when it is missing and the
+// reporting currency of the user applies. It answers and returns false when it is invalid
+func queryQuote(c *gin.Context) (string, bool) {
+	quote := strings.ToLower(c.Query("quote"))
+	if quote != "" && !quotePattern.MatchString(quote) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid quote currency",
+		})
+		return "", false
+	}
+	return quote, true
+}
+
+// aggregatorError answers with the status matching the error of the Aggregator control API
+func aggregatorError(c *gin.Context, message string, err error) {
+	code := http.StatusBadGateway
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.Unavailable, codes.DeadlineExceeded:
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, gin.H{
+		"error": message + ": " + status.Convert(err).Message(),
+	})
+}
+
+// portfolioID reads the "portfolio" query parameter. Without it writes go to
+// the default portfolio and reads cover all of them, which is 0. It answers
+// with the error and returns false when the portfolio is not of the user
+func (h *handler) portfolioID(c *gin.Context, userID float64, write bool) (uint, bool) {
+	v := c.Query("portfolio")
+	if v == "" && !write {
+		return 0, true
+	}
+
+	var (
+		portfolio *models.Portfolio
+		err       error
+	)
+	if v == "" {
+		portfolio, err = h.ps.DefaultPortfolio(userID)
+	} else {
+		id, perr := strconv.ParseUint(v, 10, 64)
+		if perr != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid 'portfolio', portfolio id is expected",
+			})
+			return 0, false
+		}
+		portfolio, err = h.ps.GetPortfolio(userID, uint(id))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return 0, false
+	}
+
+	return portfolio.ID, true
+}
+
+// refreshPositions sends positions changed by the ledger to the websocket of the user
+func (h *handler) refreshPositions(userID float64) {
+	portfolioID, ok := h.cm.Watching(int(userID))
+	if !ok {
+		return
+	}
+
+	positions, err := h.ls.Holdings(userID, portfolioID, service.DefaultCostMethod)
+	if err != nil {
+		slog.Warn("Could not read positions", "userID", userID, "error", err)
+		return
+	}
+	h.cm.UpdatePositions(int(userID), portfolioID, positions)
+}
+
+// followChange starts the price stream of a coin the change opened and stops it
+// for a closed one. It answers with the error and returns false when the Aggregator fails
+func (h *handler) followChange(
+	c *gin.Context,
+	userID float64,
+	update *service.LedgerUpdate,
+	done string,
+) bool {
+	switch {
+	case update.Opened():
+		h.cm.FollowCoin(int(userID), update.Symbol)
+		if _, err := h.ctl.Follow(c.Request.Context(), update.Symbol, int(userID)); err != nil {
+			aggregatorError(c, done+", but price stream is not started", err)
+			return false
+		}
+	case update.Closed():
+		h.cm.UnfollowCoin(int(userID), update.Symbol)
+		if _, err := h.ctl.Unfollow(c.Request.Context(), update.Symbol, int(userID)); err != nil {
+			aggregatorError(c, done+", but price stream is not stopped", err)
+			return false
+		}
+	}
+	return true
 }
 
 func (h *handler) GetCoins(c *gin.Context) {
@@ -43,7 +173,12 @@ func (h *handler) GetCoins(c *gin.Context) {
 
 	userID := userIDany.(float64)
 
-	coins, err := h.cs.GetCoins(userID)
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+
+	coins, err := h.cs.GetCoins(userID, portfolioID)
 	if err != nil {
 		switch {
 		case errors.Is(err, errs.ErrRecordingWNF):
@@ -86,10 +221,27 @@ func (h *handler) AddCoin(c *gin.Context) {
 
 	userID := userIDany.(float64)
 
+	portfolioID, ok := h.portfolioID(c, userID, true)
+	if !ok {
+		return
+	}
+
 	symbol := strings.ToLower(req.Symbol)
 
-	if err := h.cs.AddCoin(userID, symbol, req.Quantity); err != nil {
+	if _, err := h.cs.AddCoin(userID, portfolioID, symbol, req.Quantity); err != nil {
 		switch {
+		case errors.Is(err, errs.ErrUnknownSymbol), errors.Is(err, errs.ErrSymbolNotTrading):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrInvalidTx):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrOversold):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
 		case errors.Is(err, errs.ErrDB):
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -102,49 +254,86 @@ func (h *handler) AddCoin(c *gin.Context) {
 		return
 	}
 
+	h.refreshPositions(userID)
 	h.cm.FollowCoin(int(userID), symbol)
 
-	urlQeury := fmt.Sprintf(
-		"http://aggregator-service:8088/coin?symbol=%s&id=%d",
-		url.QueryEscape(symbol),
-		int(userID),
-	)
-
-	reqHTTP, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, urlQeury, nil)
+	// The coin is saved, a failed call is repaired by the next sync of followers
+	followers, err := h.ctl.Follow(c.Request.Context(), symbol, int(userID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+		aggregatorError(c, "coin added, but price stream is not started", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "coin has successfully added",
+		"followers": followers,
+	})
+}
+
+func (h *handler) UpdateCoin(c *gin.Context) {
+	var req models.CoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid body request",
 		})
 		return
 	}
 
-	resp, err := h.cl.Do(reqHTTP)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to send http request: " + err.Error(),
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
 		})
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	userID := userIDany.(float64)
+
+	portfolioID, ok := h.portfolioID(c, userID, true)
+	if !ok {
+		return
+	}
+
+	symbol := strings.ToLower(req.Symbol)
+
+	update, err := h.cs.UpdateCoin(userID, portfolioID, symbol, req.Quantity)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to read body response: " + err.Error(),
-		})
+		switch {
+		case errors.Is(err, errs.ErrUnknownSymbol), errors.Is(err, errs.ErrSymbolNotTrading):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrInvalidTx):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrOversold):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
 		return
 	}
 
-	var respBody map[string]interface{}
-	json.Unmarshal(body, &respBody)
+	h.refreshPositions(userID)
+	if !h.followChange(c, userID, update, "coin updated") {
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":            "coin has successfully added",
-		"aggregator message": respBody,
+	c.JSON(http.StatusOK, gin.H{
+		"message": "choosed coin updated V",
 	})
 }
 
-func (h *handler) UpdateCoin(c *gin.Context) {
+func (h *handler) DeleteCoin(c *gin.Context) {
 	var req models.CoinRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -163,8 +352,28 @@ func (h *handler) UpdateCoin(c *gin.Context) {
 
 	userID := userIDany.(float64)
 
-	if err := h.cs.UpdateCoin(userID, req.Symbol, req.Quantity); err != nil {
+	portfolioID, ok := h.portfolioID(c, userID, true)
+	if !ok {
+		return
+	}
+
+	symbol := strings.ToLower(req.Symbol)
+
+	update, err := h.cs.DeleteCoin(userID, portfolioID, symbol)
+	if err != nil {
 		switch {
+		case errors.Is(err, errs.ErrUnknownSymbol), errors.Is(err, errs.ErrSymbolNotTrading):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrInvalidTx):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrOversold):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
 		case errors.Is(err, errs.ErrDB):
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -177,13 +386,58 @@ func (h *handler) UpdateCoin(c *gin.Context) {
 		return
 	}
 
+	h.refreshPositions(userID)
+	// The coin may still be held in another portfolio
+	if !h.followChange(c, userID, update, "coin deleted") {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "choosed coin updated V",
 	})
 }
 
-func (h *handler) DeleteCoin(c *gin.Context) {
-	var req models.CoinRequest
+// GetTransactions returns the ledger of the user, of one coin when "symbol" is set
+func (h *handler) GetTransactions(c *gin.Context) {
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+
+	txs, err := h.ls.Transactions(userID, portfolioID, strings.ToLower(c.Query("symbol")))
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": txs,
+	})
+}
+
+// RecordTransaction adds a buy, sell, transfer or fee to the ledger, the coin
+// is followed when it is opened and unfollowed when nothing is left
+func (h *handler) RecordTransaction(c *gin.Context) {
+	var req models.TransactionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "invalid body request",
@@ -201,10 +455,24 @@ func (h *handler) DeleteCoin(c *gin.Context) {
 
 	userID := userIDany.(float64)
 
-	symbol := strings.ToLower(req.Symbol)
+	portfolioID, ok := h.portfolioID(c, userID, true)
+	if !ok {
+		return
+	}
+
+	req.Symbol = strings.ToLower(req.Symbol)
 
-	if err := h.cs.DeleteCoin(userID, symbol); err != nil {
+	update, err := h.ls.Record(userID, portfolioID, req)
+	if err != nil {
 		switch {
+		case errors.Is(err, errs.ErrInvalidTx):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrOversold):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
 		case errors.Is(err, errs.ErrDB):
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -217,52 +485,297 @@ func (h *handler) DeleteCoin(c *gin.Context) {
 		return
 	}
 
-	urlQeury := fmt.Sprintf(
-		"http://aggregator-service:8088/coin?symbol=%s&id=%d",
-		url.QueryEscape(symbol),
-		int(userID),
-	)
+	h.refreshPositions(userID)
+	if !h.followChange(c, userID, update, "transaction recorded") {
+		return
+	}
 
-	reqHTTP, err := http.NewRequestWithContext(
-		c.Request.Context(),
-		http.MethodDelete,
-		urlQeury,
-		nil,
-	)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "transaction has successfully recorded",
+		"transaction": update.Transaction,
+		"quantity":    update.After,
+	})
+}
+
+// DeleteTransaction removes a transaction unless later ones spend its coins
+func (h *handler) DeleteTransaction(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid transaction id",
 		})
 		return
 	}
 
-	resp, err := h.cl.Do(reqHTTP)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to send http request: " + err.Error(),
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
 		})
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	userID := userIDany.(float64)
+
+	update, err := h.ls.DeleteTransaction(userID, uint(id))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to read body response: " + err.Error(),
-		})
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "transaction not found",
+			})
+		case errors.Is(err, errs.ErrOversold):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
 		return
 	}
 
-	var respBody map[string]interface{}
-	json.Unmarshal(body, &respBody)
+	h.refreshPositions(userID)
+	if !h.followChange(c, userID, update, "transaction deleted") {
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "choosed coin updated V",
+		"message":  "transaction has deleted",
+		"quantity": update.After,
 	})
 }
 
+// GetPositions returns coins with their cost, realized and unrealized profit
+// by the "method" query parameter: fifo, lifo or average
+func (h *handler) GetPositions(c *gin.Context) {
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	method := service.CostMethod(strings.ToLower(c.DefaultQuery("method", string(service.DefaultCostMethod))))
+	if !method.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid 'method', one of fifo, lifo or average is expected",
+		})
+		return
+	}
+
+	currency, ok := queryQuote(c)
+	if !ok {
+		return
+	}
+
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+
+	if currency == "" {
+		user, err := h.us.GetUserProfileByUserID(userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errs.ErrRecordingWNF):
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": err.Error(),
+				})
+			case errors.Is(err, errs.ErrDB):
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "unknown error: " + err.Error(),
+				})
+			}
+			return
+		}
+		currency = service.Currency(user)
+	}
+
+	positions, err := h.ls.Positions(c.Request.Context(), userID, portfolioID, method, currency)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, positions)
+}
+
 // ------------------------------------------------------------------
 
+// GetUserProfile values the coins of the user at the latest known prices, in the
+// quote currency of the "quote" query parameter or the reporting currency of the user
+func (h *handler) GetUserProfile(c *gin.Context) {
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	quote, ok := queryQuote(c)
+	if !ok {
+		return
+	}
+
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+
+	valuation, err := h.vs.Valuate(c.Request.Context(), userID, portfolioID, quote)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "prices are not available: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, valuation)
+}
+
+// GetUserProfileHistory returns portfolio value between "from" and "to" (RFC 3339,
+// the last 24h by default) with one point per "interval" (1h by default), in
+// the currency of "quote" or the reporting currency of the user
+func (h *handler) GetUserProfileHistory(c *gin.Context) {
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid 'to', RFC 3339 time is expected",
+			})
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid 'from', RFC 3339 time is expected",
+			})
+			return
+		}
+		from = t
+	}
+
+	interval, err := time.ParseDuration(c.DefaultQuery("interval", "1h"))
+	if err != nil || interval <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid 'interval', positive duration such as 15m or 1h is expected",
+		})
+		return
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "'from' must be before 'to'",
+		})
+		return
+	}
+
+	currency, ok := queryQuote(c)
+	if !ok {
+		return
+	}
+
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+
+	if currency == "" {
+		user, err := h.us.GetUserProfileByUserID(userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errs.ErrRecordingWNF):
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": err.Error(),
+				})
+			case errors.Is(err, errs.ErrDB):
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "unknown error: " + err.Error(),
+				})
+			}
+			return
+		}
+		currency = service.Currency(user)
+	}
+
+	history, err := h.hs.History(c.Request.Context(), userID, portfolioID, currency, from, to, interval)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrNoRate):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "history is not kept in this currency: " + err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
 func (h *handler) DeleteUserProfile(c *gin.Context) {
 	userIDany, ok := c.Get("user_id")
 	if !ok {
@@ -293,6 +806,90 @@ func (h *handler) DeleteUserProfile(c *gin.Context) {
 	})
 }
 
+// SetDelivery tells the Aggregator how often and on which price moves the user gets prices
+func (h *handler) SetDelivery(c *gin.Context) {
+	var req models.DeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if err := h.ctl.SetDelivery(c.Request.Context(), int(userID), interval, req.ThresholdBps); err != nil {
+		aggregatorError(c, "delivery prefs are not set", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "delivery prefs have successfully set",
+		"interval_ms":   req.IntervalMs,
+		"threshold_bps": req.ThresholdBps,
+	})
+}
+
+// SetCurrency chooses the reporting currency of valuations, positions and the websocket profile
+func (h *handler) SetCurrency(c *gin.Context) {
+	var req models.CurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	currency, err := h.us.SetCurrency(userID, req.Currency)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrUnknownAsset):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	h.cm.SetCurrency(int(userID), currency)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "reporting currency has successfully set",
+		"currency": currency,
+	})
+}
+
 func (h *handler) GetUserProfileWS(c *gin.Context) {
 	userIDany, ok := c.Get("user_id")
 	if !ok {
@@ -323,6 +920,38 @@ func (h *handler) GetUserProfileWS(c *gin.Context) {
 		return
 	}
 
+	// The stream covers one portfolio with ?portfolio=<id>, all of them without it
+	portfolioID, ok := h.portfolioID(c, userID, false)
+	if !ok {
+		return
+	}
+	user.Coins = service.MergeCoins(user.Coins, portfolioID)
+
+	// Values are in ?quote= for this connection, in the reporting currency without it
+	currency, ok := queryQuote(c)
+	if !ok {
+		return
+	}
+	chosen := currency != ""
+	if !chosen {
+		currency = service.Currency(user)
+	}
+
+	positions, err := h.ls.Holdings(userID, portfolioID, service.DefaultCostMethod)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true
@@ -342,5 +971,5 @@ func (h *handler) GetUserProfileWS(c *gin.Context) {
 		h.cm.FollowCoin(int(userID), strings.ToLower(coin.Symbol))
 	}
 
-	h.cm.Register(int(userID), user, conn)
+	h.cm.Register(int(userID), portfolioID, currency, chosen, user, positions, conn)
 }
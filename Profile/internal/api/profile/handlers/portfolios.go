@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Wladim1r/profile/internal/api/profile/service"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/gin-gonic/gin"
+)
+
+// pathPortfolioID reads the portfolio id of the path, it answers and returns false when it is invalid
+func pathPortfolioID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid portfolio id",
+		})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func (h *handler) GetPortfolios(c *gin.Context) {
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	portfolios, err := h.ps.GetPortfolios(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"portfolios": portfolios,
+	})
+}
+
+func (h *handler) GetPortfolio(c *gin.Context) {
+	id, ok := pathPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	portfolio, err := h.ps.GetPortfolio(userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, portfolio)
+}
+
+func (h *handler) CreatePortfolio(c *gin.Context) {
+	var req models.PortfolioRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	portfolio, err := h.ps.CreatePortfolio(userID, strings.TrimSpace(req.Name))
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrPortfolioExists):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "portfolio has successfully created",
+		"portfolio": portfolio,
+	})
+}
+
+func (h *handler) RenamePortfolio(c *gin.Context) {
+	id, ok := pathPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	var req models.PortfolioRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid body request",
+		})
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	if err := h.ps.RenamePortfolio(userID, id, strings.TrimSpace(req.Name)); err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrPortfolioExists):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "portfolio has renamed",
+	})
+}
+
+// DeletePortfolio removes the portfolio with its coins and transactions, price
+// streams of coins held in no other portfolio are stopped
+func (h *handler) DeletePortfolio(c *gin.Context) {
+	id, ok := pathPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	closed, err := h.ps.DeletePortfolio(userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	h.refreshPositions(userID)
+	for _, symbol := range closed {
+		h.cm.UnfollowCoin(int(userID), symbol)
+	}
+	// Followers on the Aggregator are dropped by the next sync
+	h.cm.RequestSync()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "portfolio has deleted",
+	})
+}
+
+// Imported files larger than this are refused
+var maxImportBytes = int64(getenv.GetInt("IMPORT_MAX_BYTES", 5<<20))
+
+// ImportPortfolio records transactions of a CSV or JSON file in the portfolio,
+// all of them or none. Rows that can not be recorded are answered with their numbers
+func (h *handler) ImportPortfolio(c *gin.Context) {
+	id, ok := pathPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	if _, err := h.ps.GetPortfolio(userID, id); err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		format = service.FormatCSV
+		if strings.Contains(c.ContentType(), "json") {
+			format = service.FormatJSON
+		}
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	txs, rows, err := service.ReadTransactions(body, format, strings.ToLower(c.Query("dialect")))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "file is too large",
+			})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+	if len(rows) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "file has invalid rows, nothing is imported",
+			"rows":  rows,
+		})
+		return
+	}
+
+	res, rows, err := h.ls.Import(userID, id, txs)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrInvalidImport) && len(rows) > 0:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "file has invalid rows, nothing is imported",
+				"rows":  rows,
+			})
+		case errors.Is(err, errs.ErrInvalidImport):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	h.refreshPositions(userID)
+	for _, symbol := range res.Opened {
+		h.cm.FollowCoin(int(userID), symbol)
+	}
+	// Followers on the Aggregator are added by the next sync
+	h.cm.RequestSync()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "transactions have imported",
+		"result":  res,
+	})
+}
+
+// ExportPortfolio sends the ledger of the portfolio as a CSV or JSON file ImportPortfolio takes back
+func (h *handler) ExportPortfolio(c *gin.Context) {
+	id, ok := pathPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", service.FormatCSV))
+	if format != service.FormatCSV && format != service.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid 'format', csv or json is expected",
+		})
+		return
+	}
+
+	userIDany, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "no cookie",
+		})
+		return
+	}
+
+	userID := userIDany.(float64)
+
+	portfolio, err := h.ps.GetPortfolio(userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingWNF):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "portfolio not found",
+			})
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	txs, err := h.ls.Transactions(userID, id, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrDB):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	// Coins follow from the transactions
+	portfolio.Coins = nil
+
+	contentType := "text/csv"
+	if format == service.FormatJSON {
+		contentType = "application/json"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="portfolio-%d.%s"`, id, format))
+	c.Status(http.StatusOK)
+
+	if err := service.WriteTransactions(c.Writer, format, portfolio, txs); err != nil {
+		slog.Warn("Could not export portfolio", "userID", userID, "portfolioID", id, "error", err)
+	}
+}
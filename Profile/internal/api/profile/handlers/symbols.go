@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/gin-gonic/gin"
+)
+
+// queryLimit reads the "limit" query parameter, 0 when it is missing.
+// It answers and returns false when it is invalid
+func queryLimit(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return 0, true
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid 'limit', positive number is expected",
+		})
+		return 0, false
+	}
+	return limit, true
+}
+
+// SearchSymbols lists catalog symbols matching ?q=, optionally quoted in ?quote=
+func (h *handler) SearchSymbols(c *gin.Context) {
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	symbols := h.cl.Search(strings.TrimSpace(c.Query("q")), c.Query("quote"), limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbols": symbols,
+	})
+}
+
+// CompleteSymbols suggests trading symbols starting with ?q=
+func (h *handler) CompleteSymbols(c *gin.Context) {
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	prefix := strings.TrimSpace(c.Query("q"))
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "'q' is required",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbols": h.cl.Complete(prefix, limit),
+	})
+}
+
+func (h *handler) GetSymbol(c *gin.Context) {
+	symbol, err := h.cl.Symbol(c.Param("symbol"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrUnknownSymbol):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "unknown error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, symbol)
+}
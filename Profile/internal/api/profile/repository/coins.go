@@ -3,24 +3,29 @@ package repository
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Wladim1r/profile/internal/models"
 	"github.com/Wladim1r/profile/lib/errs"
-	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// CoinsRepository reads coins, they are written with the ledger
 type CoinsRepository interface {
-	GetCoins(userID uint) ([]*models.Coin, error)
-	AddCoin(coin *models.Coin) error
-	UpdateCoin(userID uint, symbol string, quantity decimal.Decimal) error
-	DeleteCoin(userID uint, symbol string) error
+	GetCoins(userID, portfolioID uint) ([]*models.Coin, error)
+	GetHolders() (map[string][]int, error)
 }
 
-func (pr *repository) GetCoins(userID uint) ([]*models.Coin, error) {
+// GetCoins returns coins of a portfolio, of every one when portfolioID is 0
+func (pr *repository) GetCoins(userID, portfolioID uint) ([]*models.Coin, error) {
 	var coins []*models.Coin
 
-	if err := pr.db.Where("user_id = ?", userID).Find(&coins).Error; err != nil {
+	query := pr.db.Where("user_id = ?", userID)
+	if portfolioID != 0 {
+		query = query.Where("portfolio_id = ?", portfolioID)
+	}
+
+	if err := query.Find(&coins).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("%w: %s", errs.ErrRecordingWNF, err.Error())
 		}
@@ -31,29 +36,26 @@ func (pr *repository) GetCoins(userID uint) ([]*models.Coin, error) {
 	return coins, nil
 }
 
-func (pr *repository) AddCoin(coin *models.Coin) error {
-	if err := pr.db.Create(&coin).Error; err != nil {
-		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+// GetHolders returns users holding each symbol in any of their portfolios
+func (pr *repository) GetHolders() (map[string][]int, error) {
+	var rows []struct {
+		Symbol string
+		UserID uint
 	}
 
-	return nil
-}
-
-func (pr *repository) UpdateCoin(userID uint, symbol string, quantity decimal.Decimal) error {
-	if err := pr.db.Model(&models.Coin{}).Where("user_id = ? AND symbol = ?", userID, symbol).Update("quantity", quantity).Error; err != nil {
-		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	err := pr.db.Model(&models.Coin{}).
+		Distinct("symbol", "user_id").
+		Where("quantity > 0").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
 	}
 
-	return nil
-}
-
-func (pr *repository) DeleteCoin(userID uint, symbol string) error {
-	if err := pr.db.Where("user_id = ? AND symbol = ?", userID, symbol).Delete(&models.Coin{}).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("%w: %s", errs.ErrRecordingWNF, err.Error())
-		}
-		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	holders := make(map[string][]int)
+	for _, row := range rows {
+		symbol := strings.ToLower(row.Symbol)
+		holders[symbol] = append(holders[symbol], int(row.UserID))
 	}
 
-	return nil
+	return holders, nil
 }
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// LedgerChange gets transactions of one symbol of a portfolio in execution
+// order and the quantity of the coin before the ledger was kept. It returns
+// transactions to save, IDs of transactions to delete and the quantity held afterwards
+type LedgerChange func(
+	txs []models.Transaction,
+	held decimal.Decimal,
+) (add []models.Transaction, remove []uint, quantity decimal.Decimal, err error)
+
+type LedgerRepository interface {
+	GetTransactions(userID, portfolioID uint, symbol string) ([]models.Transaction, error)
+	GetTransaction(userID, id uint) (*models.Transaction, error)
+	UpdateLedger(
+		userID, portfolioID uint,
+		symbol string,
+		change LedgerChange,
+	) (before, after, elsewhere decimal.Decimal, err error)
+	UpdateLedgers(userID, portfolioID uint, changes map[string]LedgerChange) (map[string]LedgerResult, error)
+}
+
+// LedgerResult is the quantity of a coin in a portfolio before and after a
+// change, and the quantity held in other portfolios of the user
+type LedgerResult struct {
+	Before    decimal.Decimal
+	After     decimal.Decimal
+	Elsewhere decimal.Decimal
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &repository{db: db}
+}
+
+// GetTransactions returns transactions of symbol in a portfolio, of every
+// symbol when it is empty and of every portfolio when portfolioID is 0
+func (r *repository) GetTransactions(userID, portfolioID uint, symbol string) ([]models.Transaction, error) {
+	query := r.db.Where("user_id = ?", userID)
+	if portfolioID != 0 {
+		query = query.Where("portfolio_id = ?", portfolioID)
+	}
+	if symbol != "" {
+		query = query.Where("symbol = ?", symbol)
+	}
+
+	var txs []models.Transaction
+	if err := query.Order("executed_at, id").Find(&txs).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return txs, nil
+}
+
+func (r *repository) GetTransaction(userID, id uint) (*models.Transaction, error) {
+	var tx models.Transaction
+	res := r.db.Where("user_id = ? AND id = ?", userID, id).Limit(1).Find(&tx)
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: transaction %d", errs.ErrRecordingWNF, id)
+	}
+
+	return &tx, nil
+}
+
+// UpdateLedger applies change to the ledger of symbol in a portfolio, see UpdateLedgers
+func (r *repository) UpdateLedger(
+	userID, portfolioID uint,
+	symbol string,
+	change LedgerChange,
+) (decimal.Decimal, decimal.Decimal, decimal.Decimal, error) {
+	res, err := r.UpdateLedgers(userID, portfolioID, map[string]LedgerChange{symbol: change})
+	if err != nil {
+		return decimal.Zero, decimal.Zero, decimal.Zero, err
+	}
+
+	return res[symbol].Before, res[symbol].After, res[symbol].Elsewhere, nil
+}
+
+// UpdateLedgers applies changes to ledgers of their symbols in a portfolio and
+// stores resulting quantities in its coins, a coin is removed when nothing is
+// left. Every change is made before anything is written, when some fail their
+// errors are joined and nothing is saved. Changes of one user are serialized,
+// every one sees the whole ledger
+func (r *repository) UpdateLedgers(
+	userID, portfolioID uint,
+	changes map[string]LedgerChange,
+) (map[string]LedgerResult, error) {
+	symbols := make([]string, 0, len(changes))
+	for symbol := range changes {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+
+	results := make(map[string]LedgerResult, len(changes))
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", userID).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+
+		writes := make(map[string]ledgerWrite, len(symbols))
+
+		var failed []error
+		for _, symbol := range symbols {
+			var txs []models.Transaction
+			if err := tx.Where("user_id = ? AND portfolio_id = ? AND symbol = ?", userID, portfolioID, symbol).
+				Order("executed_at, id").
+				Find(&txs).Error; err != nil {
+				return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+			}
+
+			// A coin added twice before the ledger was kept has several rows
+			var all []models.Coin
+			if err := tx.Where("user_id = ? AND symbol = ?", userID, symbol).
+				Order("id").
+				Find(&all).Error; err != nil {
+				return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+			}
+
+			var (
+				res   LedgerResult
+				coins []models.Coin
+			)
+			for _, coin := range all {
+				if coin.PortfolioID != portfolioID {
+					res.Elsewhere = res.Elsewhere.Add(coin.Quantity)
+					continue
+				}
+				coins = append(coins, coin)
+				res.Before = res.Before.Add(coin.Quantity)
+			}
+
+			add, remove, quantity, err := changes[symbol](txs, res.Before)
+			if err != nil {
+				failed = append(failed, err)
+				continue
+			}
+			res.After = quantity
+
+			results[symbol] = res
+			writes[symbol] = ledgerWrite{coins: coins, add: add, remove: remove, quantity: quantity}
+		}
+		if len(failed) > 0 {
+			return errors.Join(failed...)
+		}
+
+		for _, symbol := range symbols {
+			if err := writeLedger(tx, userID, portfolioID, symbol, writes[symbol]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ledgerWrite is a change of one symbol made and waiting to be saved
+type ledgerWrite struct {
+	coins    []models.Coin // of the portfolio, before the change
+	add      []models.Transaction
+	remove   []uint
+	quantity decimal.Decimal
+}
+
+func writeLedger(tx *gorm.DB, userID, portfolioID uint, symbol string, w ledgerWrite) error {
+	if len(w.remove) > 0 {
+		if err := tx.Where("user_id = ? AND id IN ?", userID, w.remove).
+			Delete(&models.Transaction{}).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+	}
+	if len(w.add) > 0 {
+		if err := tx.Create(&w.add).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+	}
+
+	keep := uint(0)
+	if w.quantity.IsPositive() {
+		if len(w.coins) == 0 {
+			coin := models.Coin{
+				Symbol:      symbol,
+				Quantity:    w.quantity,
+				UserID:      userID,
+				PortfolioID: portfolioID,
+			}
+			if err := tx.Create(&coin).Error; err != nil {
+				return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+			}
+			return nil
+		}
+
+		keep = w.coins[0].ID
+		if err := tx.Model(&models.Coin{}).Where("id = ?", keep).
+			Update("quantity", w.quantity).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+	}
+
+	if err := tx.Where("user_id = ? AND portfolio_id = ? AND symbol = ? AND id <> ?",
+		userID, portfolioID, symbol, keep).
+		Delete(&models.Coin{}).Error; err != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Name of the portfolio a user gets when they have none
+var defaultPortfolio = getenv.GetString("DEFAULT_PORTFOLIO", "main")
+
+type PortfoliosRepository interface {
+	MigratePortfolios() error
+	GetPortfolios(userID uint) ([]models.Portfolio, error)
+	GetPortfolio(userID, id uint) (*models.Portfolio, error)
+	DefaultPortfolio(userID uint) (*models.Portfolio, error)
+	CreatePortfolio(portfolio *models.Portfolio) error
+	RenamePortfolio(userID, id uint, name string) error
+	DeletePortfolio(userID, id uint) error
+}
+
+func NewPortfoliosRepository(db *gorm.DB) PortfoliosRepository {
+	return &repository{db: db}
+}
+
+// MigratePortfolios gives every user with coins or transactions a default
+// portfolio and moves there those without one
+func (r *repository) MigratePortfolios() error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO portfolios (user_id, name, created_at)
+			SELECT DISTINCT user_id, ?, NOW() FROM (
+				SELECT user_id FROM coins WHERE portfolio_id = 0
+				UNION SELECT user_id FROM transactions WHERE portfolio_id = 0
+			) AS owners
+			WHERE NOT EXISTS (SELECT 1 FROM portfolios p WHERE p.user_id = owners.user_id)
+			ON CONFLICT DO NOTHING`,
+			defaultPortfolio,
+		).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+
+		for _, table := range []string{"coins", "transactions"} {
+			if err := tx.Exec(`
+				UPDATE ` + table + ` t SET portfolio_id = (
+					SELECT MIN(p.id) FROM portfolios p WHERE p.user_id = t.user_id
+				) WHERE t.portfolio_id = 0`,
+			).Error; err != nil {
+				return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+func (r *repository) GetPortfolios(userID uint) ([]models.Portfolio, error) {
+	var portfolios []models.Portfolio
+	if err := r.db.Preload("Coins").
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&portfolios).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return portfolios, nil
+}
+
+func (r *repository) GetPortfolio(userID, id uint) (*models.Portfolio, error) {
+	var portfolio models.Portfolio
+	res := r.db.Preload("Coins").Where("user_id = ? AND id = ?", userID, id).Limit(1).Find(&portfolio)
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: portfolio %d", errs.ErrRecordingWNF, id)
+	}
+
+	return &portfolio, nil
+}
+
+// DefaultPortfolio returns the oldest portfolio of the user, it is created when there is none
+func (r *repository) DefaultPortfolio(userID uint) (*models.Portfolio, error) {
+	portfolio := models.Portfolio{UserID: userID, Name: defaultPortfolio}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ?", userID).Order("id").Limit(1).Find(&portfolio)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			return nil
+		}
+
+		// Another request may be creating it too
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&portfolio).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Order("id").Limit(1).Find(&portfolio).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return &portfolio, nil
+}
+
+func (r *repository) CreatePortfolio(portfolio *models.Portfolio) error {
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(portfolio)
+	if res.Error != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: %q", errs.ErrPortfolioExists, portfolio.Name)
+	}
+
+	return nil
+}
+
+func (r *repository) RenamePortfolio(userID, id uint, name string) error {
+	var taken int64
+	if err := r.db.Model(&models.Portfolio{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, id).
+		Count(&taken).Error; err != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+	if taken > 0 {
+		return fmt.Errorf("%w: %q", errs.ErrPortfolioExists, name)
+	}
+
+	res := r.db.Model(&models.Portfolio{}).Where("user_id = ? AND id = ?", userID, id).Update("name", name)
+	if res.Error != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: portfolio %d", errs.ErrRecordingWNF, id)
+	}
+
+	return nil
+}
+
+// DeletePortfolio removes the portfolio with its coins and transactions
+func (r *repository) DeletePortfolio(userID, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Ledger changes of the user wait until the portfolio is gone
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", userID).Error; err != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+		}
+
+		res := tx.Where("user_id = ? AND id = ?", userID, id).Delete(&models.Portfolio{})
+		if res.Error != nil {
+			return fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: portfolio %d", errs.ErrRecordingWNF, id)
+		}
+
+		for _, model := range []any{&models.Coin{}, &models.Transaction{}} {
+			if err := tx.Where("user_id = ? AND portfolio_id = ?", userID, id).
+				Delete(model).Error; err != nil {
+				return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+			}
+		}
+		return nil
+	})
+}
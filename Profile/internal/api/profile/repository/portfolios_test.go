@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/shopspring/decimal"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens a schema of its own in the database of TEST_POSTGRES_DSN, a
+// key=value DSN. Tests are skipped without one
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	config := &gorm.Config{Logger: logger.Discard}
+
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	db, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Coin{}, &models.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createUsers(t *testing.T, db *gorm.DB, ids ...uint) {
+	t.Helper()
+
+	for _, id := range ids {
+		if err := db.Create(&models.User{ID: id, Name: fmt.Sprintf("user%d", id)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// transferIn is a change adding quantity of symbol to a portfolio
+func transferIn(userID, portfolioID uint, symbol, quantity string) LedgerChange {
+	q := decimal.RequireFromString(quantity)
+	return func(txs []models.Transaction, held decimal.Decimal) ([]models.Transaction, []uint, decimal.Decimal, error) {
+		tx := models.Transaction{
+			UserID:      userID,
+			PortfolioID: portfolioID,
+			Symbol:      symbol,
+			Type:        models.TxTransferIn,
+			Quantity:    q,
+			ExecutedAt:  time.Now().UTC(),
+		}
+		return []models.Transaction{tx}, nil, held.Add(q), nil
+	}
+}
+
+func TestPortfolios(t *testing.T) {
+	db := testDB(t)
+	createUsers(t, db, 1, 2)
+	pr := NewPortfoliosRepository(db)
+
+	// The default portfolio is made once and stays the oldest
+	def, err := pr.DefaultPortfolio(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Name != defaultPortfolio {
+		t.Fatalf("default portfolio = %+v, want %q", def, defaultPortfolio)
+	}
+	trading := models.Portfolio{UserID: 1, Name: "trading"}
+	if err := pr.CreatePortfolio(&trading); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := pr.DefaultPortfolio(1); err != nil || again.ID != def.ID {
+		t.Fatalf("default portfolio = %+v, %v, want %d again", again, err, def.ID)
+	}
+
+	taken := models.Portfolio{UserID: 1, Name: "trading"}
+	if err := pr.CreatePortfolio(&taken); !errors.Is(err, errs.ErrPortfolioExists) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrPortfolioExists)
+	}
+	// Names are unique per user
+	other := models.Portfolio{UserID: 2, Name: "trading"}
+	if err := pr.CreatePortfolio(&other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pr.RenamePortfolio(1, trading.ID, defaultPortfolio); !errors.Is(err, errs.ErrPortfolioExists) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrPortfolioExists)
+	}
+	if err := pr.RenamePortfolio(1, trading.ID, "trading"); err != nil {
+		t.Fatalf("renaming to the same name: %v", err)
+	}
+	if err := pr.RenamePortfolio(1, trading.ID, "swing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pr.RenamePortfolio(1, other.ID, "stolen"); !errors.Is(err, errs.ErrRecordingWNF) {
+		t.Fatalf("err = %v, want %v renaming a portfolio of another user", err, errs.ErrRecordingWNF)
+	}
+
+	portfolios, err := pr.GetPortfolios(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(portfolios) != 2 || portfolios[0].ID != def.ID || portfolios[1].Name != "swing" {
+		t.Fatalf("portfolios = %+v, want %s and swing", portfolios, defaultPortfolio)
+	}
+	if _, err := pr.GetPortfolio(1, other.ID); !errors.Is(err, errs.ErrRecordingWNF) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrRecordingWNF)
+	}
+}
+
+func TestDeletePortfolio(t *testing.T) {
+	db := testDB(t)
+	createUsers(t, db, 1)
+	pr := NewPortfoliosRepository(db)
+	lr := NewLedgerRepository(db)
+	_, cr := NewProfileRepository(db)
+
+	kept, trading := models.Portfolio{UserID: 1, Name: "main"}, models.Portfolio{UserID: 1, Name: "trading"}
+	for _, p := range []*models.Portfolio{&kept, &trading} {
+		if err := pr.CreatePortfolio(p); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := lr.UpdateLedger(1, p.ID, "btcusdt", transferIn(1, p.ID, "btcusdt", "1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pr.DeletePortfolio(1, trading.ID); err != nil {
+		t.Fatal(err)
+	}
+	coins, err := cr.GetCoins(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err := lr.GetTransactions(1, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coins) != 1 || coins[0].PortfolioID != kept.ID || len(txs) != 1 || txs[0].PortfolioID != kept.ID {
+		t.Fatalf("coins = %+v, transactions = %+v, want those of main only", coins, txs)
+	}
+
+	if err := pr.DeletePortfolio(1, trading.ID); !errors.Is(err, errs.ErrRecordingWNF) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrRecordingWNF)
+	}
+}
+
+func TestMigratePortfolios(t *testing.T) {
+	db := testDB(t)
+	createUsers(t, db, 1, 2, 3)
+	pr := NewPortfoliosRepository(db)
+	_, cr := NewProfileRepository(db)
+
+	// User 1 predates portfolios, user 2 made one since
+	old := models.Portfolio{UserID: 2, Name: "old"}
+	if err := pr.CreatePortfolio(&old); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []uint{1, 2} {
+		coin := models.Coin{UserID: userID, Symbol: "btcusdt", Quantity: decimal.NewFromInt(1)}
+		if err := db.Create(&coin).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx := models.Transaction{UserID: 1, Symbol: "ethusdt", Type: models.TxTransferIn,
+		Quantity: decimal.NewFromInt(2), ExecutedAt: time.Now().UTC()}
+	if err := db.Create(&tx).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrating again changes nothing
+	for range 2 {
+		if err := pr.MigratePortfolios(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	portfolios, err := pr.GetPortfolios(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(portfolios) != 1 || portfolios[0].Name != defaultPortfolio {
+		t.Fatalf("portfolios of user 1 = %+v, want %q", portfolios, defaultPortfolio)
+	}
+	def := portfolios[0].ID
+	if coins, _ := cr.GetCoins(1, def); len(coins) != 1 {
+		t.Fatalf("coins of user 1 = %+v, want btcusdt in %q", coins, defaultPortfolio)
+	}
+	if txs, _ := NewLedgerRepository(db).GetTransactions(1, def, ""); len(txs) != 1 {
+		t.Fatalf("transactions of user 1 = %+v, want ethusdt in %q", txs, defaultPortfolio)
+	}
+
+	portfolios, err = pr.GetPortfolios(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(portfolios) != 1 || len(portfolios[0].Coins) != 1 {
+		t.Fatalf("portfolios of user 2 = %+v, want btcusdt moved into old", portfolios)
+	}
+	if portfolios, _ = pr.GetPortfolios(3); len(portfolios) != 0 {
+		t.Fatalf("portfolios of user 3 = %+v, want none without coins", portfolios)
+	}
+}
+
+func TestLedgersScopedToPortfolio(t *testing.T) {
+	db := testDB(t)
+	createUsers(t, db, 1, 2)
+	lr := NewLedgerRepository(db)
+	_, cr := NewProfileRepository(db)
+
+	if _, _, _, err := lr.UpdateLedger(1, 1, "btcusdt", transferIn(1, 1, "btcusdt", "1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := lr.UpdateLedger(2, 3, "btcusdt", transferIn(2, 3, "btcusdt", "5")); err != nil {
+		t.Fatal(err)
+	}
+
+	before, after, elsewhere, err := lr.UpdateLedger(1, 2, "btcusdt", transferIn(1, 2, "btcusdt", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Coins of another user are not elsewhere
+	if !before.IsZero() || !after.Equal(decimal.NewFromInt(2)) || !elsewhere.Equal(decimal.NewFromInt(1)) {
+		t.Fatalf("before, after, elsewhere = %s, %s, %s, want 0, 2, 1", before, after, elsewhere)
+	}
+
+	for portfolioID, want := range map[uint]int{0: 2, 1: 1, 2: 1} {
+		coins, err := cr.GetCoins(1, portfolioID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs, err := lr.GetTransactions(1, portfolioID, "btcusdt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(coins) != want || len(txs) != want {
+			t.Fatalf("portfolio %d: coins = %+v, transactions = %+v, want %d of each", portfolioID, coins, txs, want)
+		}
+	}
+
+	// A failing symbol keeps the others from being saved
+	_, err = lr.UpdateLedgers(1, 1, map[string]LedgerChange{
+		"ethusdt": transferIn(1, 1, "ethusdt", "1"),
+		"btcusdt": func([]models.Transaction, decimal.Decimal) ([]models.Transaction, []uint, decimal.Decimal, error) {
+			return nil, nil, decimal.Zero, errs.ErrOversold
+		},
+	})
+	if !errors.Is(err, errs.ErrOversold) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrOversold)
+	}
+	if txs, _ := lr.GetTransactions(1, 1, "ethusdt"); len(txs) != 0 {
+		t.Fatalf("transactions = %+v, want nothing saved", txs)
+	}
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SnapshotsRepository interface {
+	MigrateSnapshots() error
+	GetPortfoliosWithCoins() (map[uint][]uint, error)
+	GetCurrencies() ([]string, error)
+	SaveSnapshot(snapshot *models.PortfolioSnapshot) (bool, error)
+	SaveRates(rates []models.SnapshotRate) error
+	GetSnapshots(userID, portfolioID uint, from, to time.Time) ([]models.PortfolioSnapshot, error)
+	GetRates(from, to time.Time) ([]models.SnapshotRate, error)
+	DeleteSnapshotsBefore(before time.Time) (int64, error)
+}
+
+func NewSnapshotsRepository(db *gorm.DB) SnapshotsRepository {
+	return &repository{db: db}
+}
+
+// MigrateSnapshots drops the index allowing one snapshot per user and time,
+// there is one per portfolio now
+func (r *repository) MigrateSnapshots() error {
+	migrator := r.db.Migrator()
+	if !migrator.HasIndex(&models.PortfolioSnapshot{}, "idx_snapshot_user_time") {
+		return nil
+	}
+	if err := migrator.DropIndex(&models.PortfolioSnapshot{}, "idx_snapshot_user_time"); err != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return nil
+}
+
+// GetPortfoliosWithCoins returns portfolios holding coins by their user
+func (r *repository) GetPortfoliosWithCoins() (map[uint][]uint, error) {
+	var rows []struct {
+		UserID      uint
+		PortfolioID uint
+	}
+
+	err := r.db.Model(&models.Coin{}).
+		Distinct("user_id", "portfolio_id").
+		Order("user_id, portfolio_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	portfolios := make(map[uint][]uint)
+	for _, row := range rows {
+		portfolios[row.UserID] = append(portfolios[row.UserID], row.PortfolioID)
+	}
+
+	return portfolios, nil
+}
+
+// GetCurrencies returns reporting currencies chosen by users
+func (r *repository) GetCurrencies() ([]string, error) {
+	var currencies []string
+	err := r.db.Model(&models.User{}).
+		Where("currency <> ''").
+		Distinct().
+		Order("currency").
+		Pluck("currency", &currencies).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return currencies, nil
+}
+
+// SaveSnapshot returns false when the portfolio already has a snapshot taken
+// at that time, another replica was first then
+func (r *repository) SaveSnapshot(snapshot *models.PortfolioSnapshot) (bool, error) {
+	saved := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Coins").Create(snapshot)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		for i := range snapshot.Coins {
+			snapshot.Coins[i].SnapshotID = snapshot.ID
+		}
+		if len(snapshot.Coins) > 0 {
+			if err := tx.Create(&snapshot.Coins).Error; err != nil {
+				return err
+			}
+		}
+		saved = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return saved, nil
+}
+
+// GetSnapshots returns snapshots of a portfolio, of every one when portfolioID is 0
+func (r *repository) GetSnapshots(userID, portfolioID uint, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	query := r.db.Preload("Coins").
+		Where("user_id = ? AND taken_at >= ? AND taken_at <= ?", userID, from, to)
+	if portfolioID != 0 {
+		query = query.Where("portfolio_id = ?", portfolioID)
+	}
+
+	var snapshots []models.PortfolioSnapshot
+	err := query.Order("taken_at, portfolio_id").Find(&snapshots).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return snapshots, nil
+}
+
+// SaveRates keeps rates already saved for the same time, another replica was first then
+func (r *repository) SaveRates(rates []models.SnapshotRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rates).Error; err != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return nil
+}
+
+func (r *repository) GetRates(from, to time.Time) ([]models.SnapshotRate, error) {
+	var rates []models.SnapshotRate
+	err := r.db.Where("taken_at >= ? AND taken_at <= ?", from, to).
+		Order("taken_at, asset").
+		Find(&rates).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return rates, nil
+}
+
+func (r *repository) DeleteSnapshotsBefore(before time.Time) (int64, error) {
+	res := r.db.Where("taken_at < ?", before).Delete(&models.PortfolioSnapshot{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if err := r.db.Where("taken_at < ?", before).Delete(&models.SnapshotRate{}).Error; err != nil {
+		return 0, fmt.Errorf("%w: %s", errs.ErrDB, err.Error())
+	}
+
+	return res.RowsAffected, nil
+}
@@ -17,15 +17,34 @@ type UsersRepository interface {
 	GetUserProfileByUserID(userID uint) (*models.User, error)
 	DeleteUserProfileByUserID(userID uint) error
 	CheckUserProfileExists(userID uint) (bool, error)
+	SetCurrency(userID uint, currency string) error
 }
 
 func (pr *repository) CreateTables() {
 	// create tables
-	if err := pr.db.AutoMigrate(&models.User{}, &models.Coin{}); err != nil {
+	if err := pr.db.AutoMigrate(
+		&models.User{},
+		&models.Portfolio{},
+		&models.Coin{},
+		&models.PortfolioSnapshot{},
+		&models.SnapshotCoin{},
+		&models.SnapshotRate{},
+		&models.Transaction{},
+	); err != nil {
 		slog.Error("Could not create db table", "error", err.Error())
 		os.Exit(1)
 	}
 
+	if err := pr.MigratePortfolios(); err != nil {
+		slog.Error("Could not move coins into portfolios", "error", err.Error())
+		os.Exit(1)
+	}
+
+	if err := pr.MigrateSnapshots(); err != nil {
+		slog.Error("Could not snapshot portfolios apart", "error", err.Error())
+		os.Exit(1)
+	}
+
 	// check table exists or not
 	// if ok := pr.db.Migrator().HasTable("user_profilies"); !ok {
 	// 	slog.Error("Table 'user_profilies' has not created idk")
@@ -68,3 +87,15 @@ func (r *repository) DeleteUserProfileByUserID(userID uint) error {
 func (r *repository) CheckUserProfileExists(userID uint) (bool, error) {
 	return true, nil
 }
+
+func (r *repository) SetCurrency(userID uint, currency string) error {
+	res := r.db.Model(&models.User{}).Where("id = ?", userID).Update("currency", currency)
+	if res.Error != nil {
+		return fmt.Errorf("%w: %s", errs.ErrDB, res.Error.Error())
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: user %d", errs.ErrRecordingWNF, userID)
+	}
+
+	return nil
+}
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/Wladim1r/profile/lib/rates"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// exchangeInfo-style document the catalog is read from, the embedded seed is used without it
+	CatalogFile = getenv.GetString("SYMBOL_CATALOG_FILE", "")
+	// How often the file is checked for changes
+	catalogRefresh = getenv.GetTime("SYMBOL_CATALOG_REFRESH", time.Minute)
+	// exchangeInfo endpoint the catalog is fetched from when there is no file
+	CatalogURL = getenv.GetString("SYMBOL_CATALOG_URL", "")
+	// How often the endpoint is fetched again
+	catalogFetch = getenv.GetTime("SYMBOL_CATALOG_FETCH_INTERVAL", time.Hour)
+	// Searches never return more symbols than this
+	maxSearchResults = getenv.GetInt("SYMBOL_SEARCH_MAX", 50)
+)
+
+//go:embed exchange_info.json
+var seedExchangeInfo []byte
+
+// CatalogService knows the symbols of the default venue. Symbols with a venue
+// prefix such as "okx:" are of other venues and are not checked
+type CatalogService interface {
+	Run(ctx context.Context, wg *sync.WaitGroup)
+	Symbol(symbol string) (*models.Symbol, error)
+	// Validate returns errs.ErrUnknownSymbol for a symbol that is not listed,
+	// and errs.ErrSymbolNotTrading when trading is required and it has no market
+	Validate(symbol string, trading bool) error
+	// CheckQuantity returns errs.ErrInvalidTx for a quantity of symbol below
+	// its minimum or off its lot size
+	CheckQuantity(symbol string, quantity decimal.Decimal) error
+	// Search ranks symbols matching query by the symbol, then by the base asset
+	Search(query, quote string, limit int) []models.Symbol
+	// Complete returns trading symbols starting with prefix, in order
+	Complete(prefix string, limit int) []string
+	// Assets returns the base and quote asset of a listed symbol, symbols of
+	// other venues are looked up without their prefix
+	Assets(symbol string) (base, quote string, ok bool)
+	// Links returns trading pairs whose prices convert from into to
+	Links(from, to string) ([]string, bool)
+	// KnownAsset reports whether amounts can be converted into asset
+	KnownAsset(asset string) bool
+}
+
+type catalog struct {
+	file string
+	url  string
+
+	mu      sync.RWMutex
+	symbols map[string]models.Symbol
+	sorted  []models.Symbol // by symbol, for prefix lookups
+	links   *rates.Graph    // of trading pairs, without prices
+	modTime time.Time
+}
+
+// NewCatalogService loads the seed and then the file when it is set, a file
+// that can not be read is an error. Without a file the symbols are fetched
+// from url when it is set, the seed is kept while the endpoint fails
+func NewCatalogService(file, url string) (CatalogService, error) {
+	c := &catalog{file: file, url: url}
+	if err := c.load(bytes.NewReader(seedExchangeInfo)); err != nil {
+		return nil, fmt.Errorf("could not load symbol seed: %w", err)
+	}
+	switch {
+	case file != "":
+		if err := c.reload(); err != nil {
+			return nil, err
+		}
+	case url != "":
+		if err := c.fetch(context.Background()); err != nil {
+			slog.Warn("Could not fetch symbol catalog, using the seed", "url", url, "error", err)
+		}
+	}
+
+	slog.Info("📒 Symbol catalog loaded", "symbols", c.size(), "file", file, "url", url)
+	return c, nil
+}
+
+// Run reloads the file when it changes, or fetches the url again, until ctx
+// is done. A failed reload keeps the previous symbols, a half written file is
+// picked up on the next check
+func (c *catalog) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if c.file == "" {
+		if c.url != "" {
+			c.runFetch(ctx)
+		}
+		return
+	}
+
+	slog.Info("📒 Starting symbol catalog refresh", "file", c.file, "interval", catalogRefresh)
+
+	ticker := time.NewTicker(catalogRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping symbol catalog refresh")
+			return
+		case <-ticker.C:
+			info, err := os.Stat(c.file)
+			if err != nil {
+				slog.Warn("Could not check symbol catalog", "file", c.file, "error", err)
+				continue
+			}
+
+			c.mu.RLock()
+			changed := !info.ModTime().Equal(c.modTime)
+			c.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := c.reload(); err != nil {
+				slog.Error("Could not reload symbol catalog, keeping previous symbols", "error", err)
+				continue
+			}
+			slog.Info("📒 Symbol catalog reloaded", "symbols", c.size())
+		}
+	}
+}
+
+func (c *catalog) runFetch(ctx context.Context) {
+	slog.Info("📒 Starting symbol catalog fetch", "url", c.url, "interval", catalogFetch)
+
+	ticker := time.NewTicker(catalogFetch)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping symbol catalog fetch")
+			return
+		case <-ticker.C:
+			if err := c.fetch(ctx); err != nil {
+				slog.Error("Could not fetch symbol catalog, keeping previous symbols", "error", err)
+				continue
+			}
+			slog.Info("📒 Symbol catalog fetched", "symbols", c.size())
+		}
+	}
+}
+
+func (c *catalog) Symbol(symbol string) (*models.Symbol, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok := c.symbols[strings.ToLower(symbol)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errs.ErrUnknownSymbol, symbol)
+	}
+	return &s, nil
+}
+
+func (c *catalog) Validate(symbol string, trading bool) error {
+	if strings.Contains(symbol, ":") {
+		return nil
+	}
+
+	s, err := c.Symbol(symbol)
+	if err != nil {
+		return err
+	}
+	if trading && !s.Trading() {
+		return fmt.Errorf("%w: %q is %s", errs.ErrSymbolNotTrading, symbol, strings.ToLower(s.Status))
+	}
+	return nil
+}
+
+// CheckQuantity follows the LOT_SIZE filter of the exchange, a quantity is at
+// least the minimum and a whole number of steps above it
+func (c *catalog) CheckQuantity(symbol string, quantity decimal.Decimal) error {
+	if strings.Contains(symbol, ":") {
+		return nil
+	}
+
+	s, err := c.Symbol(symbol)
+	if err != nil {
+		return err
+	}
+	if quantity.LessThan(s.MinQty) {
+		return fmt.Errorf("%w: quantity %s of %s is below the minimum %s",
+			errs.ErrInvalidTx, quantity, symbol, s.MinQty)
+	}
+	if s.LotSize.IsPositive() && !quantity.Sub(s.MinQty).Mod(s.LotSize).IsZero() {
+		return fmt.Errorf("%w: quantity %s of %s is not a multiple of the lot size %s",
+			errs.ErrInvalidTx, quantity, symbol, s.LotSize)
+	}
+	return nil
+}
+
+func (c *catalog) Search(query, quote string, limit int) []models.Symbol {
+	query, quote = strings.ToLower(query), strings.ToLower(quote)
+	limit = searchLimit(limit)
+
+	type match struct {
+		symbol models.Symbol
+		rank   int
+	}
+
+	c.mu.RLock()
+	var matches []match
+	for _, s := range c.sorted {
+		if quote != "" && s.Quote != quote {
+			continue
+		}
+
+		rank := 0
+		switch {
+		case query == "":
+		case s.Symbol == query:
+		case strings.HasPrefix(s.Symbol, query):
+			rank = 1
+		case strings.HasPrefix(s.Base, query):
+			rank = 2
+		case strings.Contains(s.Symbol, query):
+			rank = 3
+		default:
+			continue
+		}
+		// Markets that can not be traded go last
+		if !s.Trading() {
+			rank += 4
+		}
+		matches = append(matches, match{symbol: s, rank: rank})
+	}
+	c.mu.RUnlock()
+
+	// Symbols are sorted already, a stable sort keeps them in order within a rank
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank < matches[j].rank
+	})
+
+	res := make([]models.Symbol, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		res = append(res, m.symbol)
+	}
+	return res
+}
+
+func (c *catalog) Complete(prefix string, limit int) []string {
+	prefix = strings.ToLower(prefix)
+	limit = searchLimit(limit)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i, _ := slices.BinarySearchFunc(c.sorted, prefix, func(s models.Symbol, prefix string) int {
+		return strings.Compare(s.Symbol, prefix)
+	})
+
+	res := make([]string, 0, limit)
+	for ; i < len(c.sorted) && len(res) < limit; i++ {
+		s := c.sorted[i]
+		if !strings.HasPrefix(s.Symbol, prefix) {
+			break
+		}
+		if s.Trading() {
+			res = append(res, s.Symbol)
+		}
+	}
+	return res
+}
+
+func (c *catalog) Assets(symbol string) (string, string, bool) {
+	symbol = strings.ToLower(symbol)
+	if _, pair, ok := strings.Cut(symbol, ":"); ok {
+		symbol = pair
+	}
+
+	c.mu.RLock()
+	s, ok := c.symbols[symbol]
+	c.mu.RUnlock()
+	if !ok {
+		return "", "", false
+	}
+	return s.Base, s.Quote, true
+}
+
+func (c *catalog) Links(from, to string) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.links.Path(from, to)
+}
+
+func (c *catalog) KnownAsset(asset string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.links.Has(asset)
+}
+
+func searchLimit(limit int) int {
+	if limit <= 0 || limit > maxSearchResults {
+		return maxSearchResults
+	}
+	return limit
+}
+
+func (c *catalog) size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.symbols)
+}
+
+func (c *catalog) reload() error {
+	info, err := os.Stat(c.file)
+	if err != nil {
+		return fmt.Errorf("could not read symbol catalog: %w", err)
+	}
+
+	f, err := os.Open(c.file)
+	if err != nil {
+		return fmt.Errorf("could not read symbol catalog: %w", err)
+	}
+	defer f.Close()
+
+	if err := c.load(f); err != nil {
+		return fmt.Errorf("could not load symbol catalog %s: %w", c.file, err)
+	}
+
+	c.mu.Lock()
+	c.modTime = info.ModTime()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *catalog) fetch(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not fetch symbol catalog: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch symbol catalog: %s", resp.Status)
+	}
+	if err := c.load(resp.Body); err != nil {
+		return fmt.Errorf("could not load symbol catalog %s: %w", c.url, err)
+	}
+	return nil
+}
+
+// exchangeInfo is the part of a Binance exchangeInfo response the catalog reads
+type exchangeInfo struct {
+	Symbols []struct {
+		Symbol     string `json:"symbol"`
+		Status     string `json:"status"`
+		BaseAsset  string `json:"baseAsset"`
+		QuoteAsset string `json:"quoteAsset"`
+		Filters    []struct {
+			FilterType string          `json:"filterType"`
+			TickSize   decimal.Decimal `json:"tickSize"`
+			StepSize   decimal.Decimal `json:"stepSize"`
+			MinQty     decimal.Decimal `json:"minQty"`
+		} `json:"filters"`
+	} `json:"symbols"`
+}
+
+// load replaces the symbols with those of the document
+func (c *catalog) load(r io.Reader) error {
+	var info exchangeInfo
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return err
+	}
+	if len(info.Symbols) == 0 {
+		return errors.New("no symbols")
+	}
+
+	symbols := make(map[string]models.Symbol, len(info.Symbols))
+	for _, is := range info.Symbols {
+		s := models.Symbol{
+			Symbol: strings.ToLower(is.Symbol),
+			Base:   strings.ToLower(is.BaseAsset),
+			Quote:  strings.ToLower(is.QuoteAsset),
+			Status: strings.ToUpper(is.Status),
+		}
+		if s.Symbol == "" || s.Base == "" || s.Quote == "" {
+			return fmt.Errorf("symbol %q has no assets", is.Symbol)
+		}
+
+		for _, f := range is.Filters {
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				s.TickSize = f.TickSize
+			case "LOT_SIZE":
+				s.LotSize, s.MinQty = f.StepSize, f.MinQty
+			}
+		}
+		symbols[s.Symbol] = s
+	}
+
+	sorted := make([]models.Symbol, 0, len(symbols))
+	links := rates.New()
+	for _, s := range symbols {
+		sorted = append(sorted, s)
+		if s.Trading() {
+			links.Add(s.Symbol, s.Base, s.Quote, decimal.NewFromInt(1))
+		}
+	}
+	slices.SortFunc(sorted, func(a, b models.Symbol) int {
+		return strings.Compare(a.Symbol, b.Symbol)
+	})
+
+	c.mu.Lock()
+	c.symbols, c.sorted, c.links = symbols, sorted, links
+	c.mu.Unlock()
+	return nil
+}
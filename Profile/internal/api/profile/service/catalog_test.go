@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wladim1r/profile/lib/errs"
+)
+
+const testExchangeInfo = `{"symbols": [{"symbol": "WIFUSDT", "status": "TRADING", "baseAsset": "WIF", "quoteAsset": "USDT",
+	"filters": [{"filterType": "LOT_SIZE", "minQty": "0.1", "stepSize": "0.01"}]}]}`
+
+func TestCatalogValidate(t *testing.T) {
+	seed, err := NewCatalogService("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "exchange_info.json")
+	if err := os.WriteFile(file, []byte(testExchangeInfo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := NewCatalogService(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		catalog CatalogService
+		symbol  string
+		trading bool
+		want    error
+	}{
+		{"listed", seed, "btcusdt", true, nil},
+		{"not trading", seed, "btcbusd", true, errs.ErrSymbolNotTrading},
+		{"not trading, not required", seed, "btcbusd", false, nil},
+		// A known quote asset does not make a symbol listed
+		{"typo", seed, "btcusdtt", false, errs.ErrUnknownSymbol},
+		{"unlisted", seed, "xyzusdt", false, errs.ErrUnknownSymbol},
+		{"listed in file", listed, "wifusdt", true, nil},
+		{"replaced by file", listed, "btcusdt", false, errs.ErrUnknownSymbol},
+		{"other venue", listed, "okx:xyzusdt", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.catalog.Validate(tt.symbol, tt.trading)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, _, ok := seed.Assets("xyzusdt"); ok {
+		t.Fatal("assets of an unlisted symbol are guessed")
+	}
+	if base, quote, ok := seed.Assets("okx:ethbtc"); !ok || base != "eth" || quote != "btc" {
+		t.Fatalf("assets of okx:ethbtc = %s, %s, want eth and btc", base, quote)
+	}
+}
+
+func TestCatalogCheckQuantity(t *testing.T) {
+	c, err := NewCatalogService("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := c.Symbol("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.LotSize.Equal(dec("0.00001")) || !s.MinQty.Equal(dec("0.00001")) || !s.TickSize.Equal(dec("0.01")) {
+		t.Fatalf("btcusdt = %+v, want filters of the seed", s)
+	}
+
+	tests := []struct {
+		symbol   string
+		quantity string
+		want     error
+	}{
+		{"btcusdt", "0.5", nil},
+		{"btcusdt", "0.00001", nil},
+		{"btcusdt", "0.000001", errs.ErrInvalidTx},
+		{"btcusdt", "0.123456", errs.ErrInvalidTx},
+		{"xyzusdt", "1", errs.ErrUnknownSymbol},
+		{"okx:btcusdt", "0.123456", nil},
+	}
+	for _, tt := range tests {
+		if err := c.CheckQuantity(tt.symbol, dec(tt.quantity)); !errors.Is(err, tt.want) {
+			t.Errorf("%s of %s: err = %v, want %v", tt.quantity, tt.symbol, err, tt.want)
+		}
+	}
+}
+
+func TestCatalogFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testExchangeInfo))
+	}))
+	defer srv.Close()
+
+	c, err := NewCatalogService("", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate("wifusdt", true); err != nil {
+		t.Fatalf("fetched symbol is not listed: %v", err)
+	}
+	if err := c.CheckQuantity("wifusdt", dec("0.105")); !errors.Is(err, errs.ErrInvalidTx) {
+		t.Fatalf("err = %v, want a quantity off the lot size", err)
+	}
+
+	// The seed is kept while the endpoint fails
+	srv.Close()
+	c, err = NewCatalogService("", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate("btcusdt", true); err != nil {
+		t.Fatalf("seed symbol is not listed: %v", err)
+	}
+}
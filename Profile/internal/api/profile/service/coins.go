@@ -1,35 +1,109 @@
 package service
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
 	"github.com/shopspring/decimal"
 )
 
+// CoinsService sets quantities in a portfolio directly, the difference is
+// recorded in its ledger as a transfer at zero cost. Added coins must be
+// listed in the catalog and trading, so their price stream is live, and come
+// in quantities the exchange could fill. Coins are removed whatever the catalog says
 type CoinsService interface {
-	GetCoins(userID float64) ([]*models.Coin, error)
-	AddCoin(userID float64, symbol string, quantity float32) error
-	UpdateCoin(userID float64, symbol string, quantity float32) error
-	DeleteCoin(userID float64, symbol string) error
+	GetCoins(userID float64, portfolioID uint) ([]*models.Coin, error)
+	AddCoin(userID float64, portfolioID uint, symbol string, quantity float32) (*LedgerUpdate, error)
+	UpdateCoin(userID float64, portfolioID uint, symbol string, quantity float32) (*LedgerUpdate, error)
+	DeleteCoin(userID float64, portfolioID uint, symbol string) (*LedgerUpdate, error)
 }
 
-func (ps *service) GetCoins(userID float64) ([]*models.Coin, error) {
-	return ps.cr.GetCoins(uint(userID))
+func (ps *service) GetCoins(userID float64, portfolioID uint) ([]*models.Coin, error) {
+	return ps.cr.GetCoins(uint(userID), portfolioID)
 }
 
-func (ps *service) AddCoin(userID float64, symbol string, quantity float32) error {
+func (ps *service) AddCoin(
+	userID float64,
+	portfolioID uint,
+	symbol string,
+	quantity float32,
+) (*LedgerUpdate, error) {
 	q := decimal.NewFromFloat32(quantity)
+	if !q.IsPositive() {
+		return nil, fmt.Errorf("%w: quantity must be positive", errs.ErrInvalidTx)
+	}
+	if err := ps.checkSymbol(symbol, q); err != nil {
+		return nil, err
+	}
 
-	coin := models.Coin{Symbol: symbol, Quantity: q, UserID: uint(userID)}
-
-	return ps.cr.AddCoin(&coin)
+	return updateLedger(ps.lr, uint(userID), portfolioID, symbol,
+		func([]models.Transaction, decimal.Decimal) ([]models.Transaction, []uint, error) {
+			return []models.Transaction{transfer(uint(userID), symbol, q)}, nil, nil
+		})
 }
 
-func (ps *service) UpdateCoin(userID float64, symbol string, quantity float32) error {
+func (ps *service) UpdateCoin(
+	userID float64,
+	portfolioID uint,
+	symbol string,
+	quantity float32,
+) (*LedgerUpdate, error) {
 	q := decimal.NewFromFloat32(quantity)
+	if q.IsNegative() {
+		return nil, fmt.Errorf("%w: quantity must not be negative", errs.ErrInvalidTx)
+	}
+
+	return updateLedger(ps.lr, uint(userID), portfolioID, symbol,
+		func(_ []models.Transaction, held decimal.Decimal) ([]models.Transaction, []uint, error) {
+			if q.Equal(held) {
+				return nil, nil, nil
+			}
+			// Coins of a delisted symbol can still be sold off
+			if q.GreaterThan(held) {
+				if err := ps.checkSymbol(symbol, q); err != nil {
+					return nil, nil, err
+				}
+			}
+			return []models.Transaction{transfer(uint(userID), symbol, q.Sub(held))}, nil, nil
+		})
+}
+
+func (ps *service) DeleteCoin(userID float64, portfolioID uint, symbol string) (*LedgerUpdate, error) {
+	return updateLedger(ps.lr, uint(userID), portfolioID, symbol,
+		func(_ []models.Transaction, held decimal.Decimal) ([]models.Transaction, []uint, error) {
+			if !held.IsPositive() {
+				return nil, nil, nil
+			}
+			return []models.Transaction{transfer(uint(userID), symbol, held.Neg())}, nil, nil
+		})
+}
 
-	return ps.cr.UpdateCoin(uint(userID), symbol, q)
+// checkSymbol rejects symbols the ledger would not store, those the catalog
+// does not list as trading and quantities off their lot size
+func (ps *service) checkSymbol(symbol string, quantity decimal.Decimal) error {
+	if !symbolPattern.MatchString(symbol) {
+		return fmt.Errorf("%w: invalid symbol %q", errs.ErrInvalidTx, symbol)
+	}
+	if err := ps.cl.Validate(symbol, true); err != nil {
+		return err
+	}
+	return ps.cl.CheckQuantity(symbol, quantity)
 }
 
-func (ps *service) DeleteCoin(userID float64, symbol string) error {
-	return ps.cr.DeleteCoin(uint(userID), symbol)
+// transfer moves quantity in, or out when it is negative
+func transfer(userID uint, symbol string, quantity decimal.Decimal) models.Transaction {
+	tx := models.Transaction{
+		UserID:     userID,
+		Symbol:     symbol,
+		Type:       models.TxTransferIn,
+		Quantity:   quantity,
+		ExecutedAt: time.Now().UTC(),
+	}
+	if quantity.IsNegative() {
+		tx.Type = models.TxTransferOut
+		tx.Quantity = quantity.Neg()
+	}
+	return tx
 }
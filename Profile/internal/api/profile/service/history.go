@@ -0,0 +1,502 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// Portfolios are valued this often, every replica takes snapshots but
+	// times are rounded to the interval so each one is saved once
+	SnapshotInterval  = getenv.GetTime("SNAPSHOT_INTERVAL", 5*time.Minute)
+	SnapshotRetention = getenv.GetTime("SNAPSHOT_RETENTION", 90*24*time.Hour)
+	SnapshotQuote     = getenv.GetString("SNAPSHOT_QUOTE", getenv.GetString("DEFAULT_QUOTE", "usdt"))
+
+	// A history never has more points than this
+	maxHistoryPoints = getenv.GetInt("HISTORY_MAX_POINTS", 2000)
+
+	// Rates of these currencies are saved with snapshots besides those users
+	// chose, history is reported in them
+	historyCurrencies = strings.Split(getenv.GetString("HISTORY_CURRENCIES", "usd,usdt,eur,btc,eth"), ",")
+)
+
+type HistoryService interface {
+	Run(ctx context.Context, wg *sync.WaitGroup)
+	History(
+		ctx context.Context,
+		userID float64,
+		portfolioID uint,
+		currency string,
+		from, to time.Time,
+		interval time.Duration,
+	) (*models.History, error)
+}
+
+type history struct {
+	sr      repository.SnapshotsRepository
+	lr      repository.LedgerRepository
+	vs      ValuationService
+	prices  PriceSource
+	catalog CatalogService
+}
+
+func NewHistoryService(
+	sr repository.SnapshotsRepository,
+	lr repository.LedgerRepository,
+	vs ValuationService,
+	prices PriceSource,
+	catalog CatalogService,
+) HistoryService {
+	return &history{sr: sr, lr: lr, vs: vs, prices: prices, catalog: catalog}
+}
+
+// Run takes snapshots of every portfolio until ctx is done
+func (h *history) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	slog.Info("📸 Starting portfolio snapshots",
+		"interval", SnapshotInterval,
+		"quote", SnapshotQuote,
+		"retention", SnapshotRetention)
+
+	ticker := time.NewTicker(SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Got interruption signal, stopping portfolio snapshots")
+			return
+		case now := <-ticker.C:
+			h.takeSnapshots(ctx, now.Truncate(SnapshotInterval))
+		}
+	}
+}
+
+func (h *history) takeSnapshots(ctx context.Context, takenAt time.Time) {
+	portfolios, err := h.sr.GetPortfoliosWithCoins()
+	if err != nil {
+		slog.Error("Could not list portfolios for snapshots", "error", err)
+		return
+	}
+
+	var snapshots []models.PortfolioSnapshot
+	for userID, ids := range portfolios {
+		for _, portfolioID := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+
+			valuation, err := h.vs.Valuate(ctx, float64(userID), portfolioID, SnapshotQuote)
+			if err != nil {
+				slog.Warn("Could not value portfolio", "userID", userID, "portfolioID", portfolioID, "error", err)
+				continue
+			}
+			snapshots = append(snapshots, newSnapshot(valuation, userID, portfolioID, takenAt))
+		}
+	}
+
+	// Snapshots are useless in other currencies without the rates of their time
+	if err := h.saveRates(ctx, takenAt, snapshots); err != nil {
+		slog.Error("Could not save snapshot rates, snapshots are not taken", "error", err)
+		return
+	}
+
+	saved, incomplete := 0, 0
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		ok, err := h.sr.SaveSnapshot(snapshot)
+		if err != nil {
+			slog.Error("Could not save snapshot",
+				"userID", snapshot.UserID,
+				"portfolioID", snapshot.PortfolioID,
+				"error", err)
+			continue
+		}
+		if ok {
+			saved++
+		}
+		if snapshot.Incomplete {
+			incomplete++
+		}
+	}
+
+	deleted, err := h.sr.DeleteSnapshotsBefore(takenAt.Add(-SnapshotRetention))
+	if err != nil {
+		slog.Error("Could not delete old snapshots", "error", err)
+	}
+
+	slog.Info("Portfolio snapshots taken",
+		"taken_at", takenAt,
+		"users", len(portfolios),
+		"portfolios", len(snapshots),
+		"saved", saved,
+		"incomplete", incomplete,
+		"deleted", deleted)
+}
+
+// newSnapshot keeps the priced coins of a valuation, a coin without a price
+// makes the snapshot incomplete
+func newSnapshot(valuation *models.Valuation, userID, portfolioID uint, takenAt time.Time) models.PortfolioSnapshot {
+	snapshot := models.PortfolioSnapshot{
+		UserID:      userID,
+		PortfolioID: portfolioID,
+		TakenAt:     takenAt,
+		Quote:       valuation.Quote,
+		Total:       valuation.Total,
+		Incomplete:  len(valuation.Missing) > 0,
+	}
+	for _, cv := range valuation.Coins {
+		if cv.Price == nil {
+			continue
+		}
+		snapshot.Coins = append(snapshot.Coins, models.SnapshotCoin{
+			Symbol:   cv.Symbol,
+			Quantity: cv.Quantity,
+			Price:    *cv.Price,
+			Value:    *cv.Total,
+		})
+	}
+	return snapshot
+}
+
+// saveRates keeps what reporting currencies and quotes of the held coins are
+// worth in SnapshotQuote at takenAt
+func (h *history) saveRates(ctx context.Context, takenAt time.Time, snapshots []models.PortfolioSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	chosen, err := h.sr.GetCurrencies()
+	if err != nil {
+		return err
+	}
+	assets := append([]string{SnapshotQuote, DefaultCurrency}, historyCurrencies...)
+	assets = append(assets, chosen...)
+	for _, snapshot := range snapshots {
+		for _, coin := range snapshot.Coins {
+			if _, quote, ok := h.catalog.Assets(coin.Symbol); ok {
+				assets = append(assets, quote)
+			}
+		}
+	}
+	slices.Sort(assets)
+	assets = slices.Compact(assets)
+
+	var symbols []string
+	for _, asset := range assets {
+		links, _ := h.catalog.Links(asset, SnapshotQuote)
+		symbols = append(symbols, links...)
+	}
+	slices.Sort(symbols)
+
+	prices, err := h.prices.LastPrices(ctx, slices.Compact(symbols))
+	if err != nil {
+		return err
+	}
+	graph := RateGraph(h.catalog, prices)
+
+	rates := make([]models.SnapshotRate, 0, len(assets))
+	for _, asset := range assets {
+		if rate, ok := graph.Rate(asset, SnapshotQuote); ok {
+			rates = append(rates, models.SnapshotRate{TakenAt: takenAt, Asset: asset, Rate: rate})
+		}
+	}
+	return h.sr.SaveRates(rates)
+}
+
+// snapshotPoint is the value of the chosen portfolios at one moment
+type snapshotPoint struct {
+	at         time.Time
+	quote      string
+	total      decimal.Decimal
+	values     map[string]decimal.Decimal
+	prices     map[string]decimal.Decimal
+	rates      map[string]decimal.Decimal // of assets in the quote of the rates
+	incomplete bool
+}
+
+// rate is what one from was worth in to at the time of the point
+func (p snapshotPoint) rate(from, to string) (decimal.Decimal, bool) {
+	if from == to {
+		return decimal.NewFromInt(1), true
+	}
+
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return decimal.Zero, false
+	}
+	toRate, ok := p.rates[to]
+	if !ok || !toRate.IsPositive() {
+		return decimal.Zero, false
+	}
+	return fromRate.Div(toRate), true
+}
+
+// History keeps the last snapshot of every interval between from and to, of a
+// portfolio or of all of them when portfolioID is 0. Values are converted into
+// currency at the rates saved with the snapshots, profits are counted between
+// the first and the last complete point
+func (h *history) History(
+	ctx context.Context,
+	userID float64,
+	portfolioID uint,
+	currency string,
+	from, to time.Time,
+	interval time.Duration,
+) (*models.History, error) {
+	if points := to.Sub(from) / interval; points > time.Duration(maxHistoryPoints) {
+		interval = to.Sub(from) / time.Duration(maxHistoryPoints)
+	}
+
+	snapshots, err := h.sr.GetSnapshots(uint(userID), portfolioID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := h.sr.GetRates(from, to)
+	if err != nil {
+		return nil, err
+	}
+	points := mergeSnapshots(snapshots, rates)
+
+	hist := &models.History{
+		PortfolioID: portfolioID,
+		Quote:       currency,
+		From:        from,
+		To:          to,
+		Interval:    interval.String(),
+		Points:      make([]models.HistoryPoint, 0),
+	}
+	if len(points) == 0 {
+		return hist, nil
+	}
+
+	lastBucket := time.Duration(-1)
+	for _, p := range points {
+		rate, ok := p.rate(p.quote, currency)
+		if !ok {
+			continue
+		}
+
+		point := models.HistoryPoint{
+			Time:       p.at,
+			Total:      p.total.Mul(rate).Round(8),
+			Coins:      make(map[string]decimal.Decimal, len(p.values)),
+			Incomplete: p.incomplete,
+		}
+		for symbol, value := range p.values {
+			point.Coins[symbol] = value.Mul(rate).Round(8)
+		}
+
+		// Later snapshots of the same interval replace earlier ones, unless
+		// they are incomplete and the earlier one is not
+		if bucket := p.at.Sub(from) / interval; bucket == lastBucket {
+			if prev := &hist.Points[len(hist.Points)-1]; !point.Incomplete || prev.Incomplete {
+				*prev = point
+			}
+		} else {
+			hist.Points = append(hist.Points, point)
+			lastBucket = bucket
+		}
+	}
+	if len(hist.Points) == 0 {
+		return nil, fmt.Errorf("%w: %s into %q", errs.ErrNoRate, SnapshotQuote, currency)
+	}
+
+	first, last, ok := completeRange(hist.Points)
+	if !ok {
+		return hist, nil
+	}
+
+	var txs []models.Transaction
+	if last.Time.After(first.Time) {
+		txs, err = h.lr.GetTransactions(uint(userID), portfolioID, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	flows, unpriced := netFlows(txs, first.Time, last.Time, points, currency, h.catalog)
+	hist.Unpriced = unpriced
+
+	total := decimal.Zero
+	for _, flow := range flows {
+		total = total.Add(flow)
+	}
+	pnl := newPnL(first.Total, last.Total, total)
+	hist.PnL = &pnl
+
+	hist.CoinsPnL = make(map[string]models.PnL)
+	for symbol, end := range last.Coins {
+		hist.CoinsPnL[symbol] = newPnL(first.Coins[symbol], end, flows[symbol])
+	}
+	for symbol, start := range first.Coins {
+		if _, ok := last.Coins[symbol]; !ok {
+			hist.CoinsPnL[symbol] = newPnL(start, decimal.Zero, flows[symbol])
+		}
+	}
+	for symbol, flow := range flows {
+		if _, ok := hist.CoinsPnL[symbol]; !ok {
+			hist.CoinsPnL[symbol] = newPnL(decimal.Zero, decimal.Zero, flow)
+		}
+	}
+	return hist, nil
+}
+
+// completeRange returns the first and the last point without unpriced coins
+func completeRange(points []models.HistoryPoint) (first, last models.HistoryPoint, ok bool) {
+	for _, p := range points {
+		if p.Incomplete {
+			continue
+		}
+		if !ok {
+			first, ok = p, true
+		}
+		last = p
+	}
+	return first, last, ok
+}
+
+// mergeSnapshots sums snapshots of portfolios taken at the same time, with
+// the rates saved then
+func mergeSnapshots(snapshots []models.PortfolioSnapshot, rates []models.SnapshotRate) []snapshotPoint {
+	byTime := make(map[int64]map[string]decimal.Decimal)
+	for _, r := range rates {
+		at := r.TakenAt.UnixNano()
+		if byTime[at] == nil {
+			byTime[at] = make(map[string]decimal.Decimal)
+		}
+		byTime[at][r.Asset] = r.Rate
+	}
+
+	var points []snapshotPoint
+	for _, snapshot := range snapshots {
+		if n := len(points); n == 0 || !points[n-1].at.Equal(snapshot.TakenAt) {
+			points = append(points, snapshotPoint{
+				at:     snapshot.TakenAt,
+				quote:  snapshot.Quote,
+				values: make(map[string]decimal.Decimal),
+				prices: make(map[string]decimal.Decimal),
+				rates:  byTime[snapshot.TakenAt.UnixNano()],
+			})
+		}
+		p := &points[len(points)-1]
+
+		p.total = p.total.Add(snapshot.Total)
+		p.incomplete = p.incomplete || snapshot.Incomplete
+		for _, coin := range snapshot.Coins {
+			p.values[coin.Symbol] = p.values[coin.Symbol].Add(coin.Value)
+			p.prices[coin.Symbol] = coin.Price
+		}
+	}
+	return points
+}
+
+// netFlows returns value brought into the portfolio by transactions after from
+// up to to, by symbol and in currency at the rates of the next snapshot. Coins
+// bought count with their fee, sold ones without it, so fees are a loss.
+// Transfers without a price are valued at the price of the next snapshot
+func netFlows(
+	txs []models.Transaction,
+	from, to time.Time,
+	points []snapshotPoint,
+	currency string,
+	catalog CatalogService,
+) (map[string]decimal.Decimal, []string) {
+	flows := make(map[string]decimal.Decimal)
+	var unpriced []string
+
+	for _, tx := range txs {
+		if !tx.ExecutedAt.After(from) || tx.ExecutedAt.After(to) || tx.Type == models.TxFee {
+			// Coins paid as a fee leave without bringing anything in
+			continue
+		}
+
+		_, quote, _ := catalog.Assets(tx.Symbol)
+		value, ok := decimal.Zero, false
+		for _, p := range points {
+			if p.at.Before(tx.ExecutedAt) {
+				continue
+			}
+			if value, ok = p.flow(tx, quote, currency); ok {
+				break
+			}
+		}
+		if !ok {
+			unpriced = append(unpriced, tx.Symbol)
+			continue
+		}
+
+		var amount decimal.Decimal
+		switch tx.Type {
+		case models.TxBuy, models.TxTransferIn:
+			amount = value
+		case models.TxSell, models.TxTransferOut:
+			amount = value.Neg()
+		}
+		flows[tx.Symbol] = flows[tx.Symbol].Add(amount.Round(8))
+	}
+
+	slices.Sort(unpriced)
+	return flows, slices.Compact(unpriced)
+}
+
+// flow is the value of tx in currency at the rates of the point. Fees are paid
+// on top of a buy and out of a sale, a transfer without a price is valued at
+// the price of the coin in the point
+func (p snapshotPoint) flow(tx models.Transaction, quote, currency string) (decimal.Decimal, bool) {
+	value := tx.Quantity.Mul(tx.Price)
+	switch tx.Type {
+	case models.TxBuy:
+		value = value.Add(tx.Fee)
+	case models.TxSell:
+		value = value.Sub(tx.Fee)
+	}
+
+	if tx.Price.IsZero() && (tx.Type == models.TxTransferIn || tx.Type == models.TxTransferOut) {
+		price, ok := p.prices[tx.Symbol]
+		if !ok {
+			return decimal.Zero, false
+		}
+		quote, value = p.quote, tx.Quantity.Mul(price)
+	}
+	if quote == "" {
+		return decimal.Zero, false
+	}
+
+	rate, ok := p.rate(quote, currency)
+	if !ok {
+		return decimal.Zero, false
+	}
+	return value.Mul(rate), true
+}
+
+// newPnL counts flows invested on top of the start, the percent is taken of both
+func newPnL(start, end, flows decimal.Decimal) models.PnL {
+	pnl := models.PnL{
+		Start:    start,
+		End:      end,
+		Flows:    flows,
+		Absolute: end.Sub(start).Sub(flows),
+	}
+
+	invested := start
+	if flows.IsPositive() {
+		invested = invested.Add(flows)
+	}
+	if invested.IsPositive() {
+		percent := pnl.Absolute.Div(invested).Mul(decimal.NewFromInt(100)).Round(4)
+		pnl.Percent = &percent
+	}
+	return pnl
+}
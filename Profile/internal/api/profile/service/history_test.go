@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/shopspring/decimal"
+)
+
+type fakeSnapshots struct {
+	repository.SnapshotsRepository
+	portfolios map[uint][]uint
+	currencies []string
+	snapshots  []models.PortfolioSnapshot
+	rates      []models.SnapshotRate
+}
+
+func (f *fakeSnapshots) GetPortfoliosWithCoins() (map[uint][]uint, error) {
+	return f.portfolios, nil
+}
+
+func (f *fakeSnapshots) GetCurrencies() ([]string, error) {
+	return f.currencies, nil
+}
+
+func (f *fakeSnapshots) SaveSnapshot(snapshot *models.PortfolioSnapshot) (bool, error) {
+	f.snapshots = append(f.snapshots, *snapshot)
+	return true, nil
+}
+
+func (f *fakeSnapshots) SaveRates(rates []models.SnapshotRate) error {
+	f.rates = append(f.rates, rates...)
+	return nil
+}
+
+func (f *fakeSnapshots) DeleteSnapshotsBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeSnapshots) GetSnapshots(userID, portfolioID uint, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	var res []models.PortfolioSnapshot
+	for _, s := range f.snapshots {
+		if portfolioID == 0 || s.PortfolioID == portfolioID {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeSnapshots) GetRates(from, to time.Time) ([]models.SnapshotRate, error) {
+	return f.rates, nil
+}
+
+type fakeLedger struct {
+	repository.LedgerRepository
+	txs []models.Transaction
+}
+
+func (f *fakeLedger) GetTransactions(userID, portfolioID uint, symbol string) ([]models.Transaction, error) {
+	var res []models.Transaction
+	for _, tx := range f.txs {
+		if portfolioID == 0 || tx.PortfolioID == portfolioID {
+			res = append(res, tx)
+		}
+	}
+	return res, nil
+}
+
+type fakePrices map[string]float64
+
+func (f fakePrices) LastPrices(ctx context.Context, symbols []string) (map[string]models.LastPrice, error) {
+	res := make(map[string]models.LastPrice)
+	for _, symbol := range symbols {
+		if price, ok := f[symbol]; ok {
+			res[symbol] = models.LastPrice{Price: price}
+		}
+	}
+	return res, nil
+}
+
+// fakeValuations values portfolios by their ID
+type fakeValuations map[uint]*models.Valuation
+
+func (f fakeValuations) Valuate(
+	ctx context.Context,
+	userID float64,
+	portfolioID uint,
+	quote string,
+) (*models.Valuation, error) {
+	return f[portfolioID], nil
+}
+
+func dec(v string) decimal.Decimal {
+	return decimal.RequireFromString(v)
+}
+
+func snapshot(portfolioID uint, at time.Time, coins map[string]string) models.PortfolioSnapshot {
+	s := models.PortfolioSnapshot{PortfolioID: portfolioID, TakenAt: at, Quote: "usdt"}
+	for symbol, value := range coins {
+		s.Total = s.Total.Add(dec(value))
+		s.Coins = append(s.Coins, models.SnapshotCoin{Symbol: symbol, Value: dec(value), Price: dec("100000")})
+	}
+	return s
+}
+
+// eurRate is one eur worth rate usdt at the time
+func eurRate(at time.Time, rate string) []models.SnapshotRate {
+	return []models.SnapshotRate{
+		{TakenAt: at, Asset: "usdt", Rate: dec("1")},
+		{TakenAt: at, Asset: "eur", Rate: dec(rate)},
+	}
+}
+
+func newTestHistory(t *testing.T, sr *fakeSnapshots, txs []models.Transaction) *history {
+	t.Helper()
+
+	catalog, err := NewCatalogService("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Today's rate, history must not be converted at it
+	prices := fakePrices{"eurusdt": 1.1}
+	return NewHistoryService(sr, &fakeLedger{txs: txs}, nil, prices, catalog).(*history)
+}
+
+func TestHistoryFlows(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	sr := &fakeSnapshots{
+		snapshots: []models.PortfolioSnapshot{
+			snapshot(1, start, map[string]string{"btcusdt": "1000"}),
+			snapshot(2, start, map[string]string{"ethusdt": "500"}),
+			snapshot(1, end, map[string]string{"btcusdt": "2100"}),
+			snapshot(2, end, map[string]string{"ethusdt": "450"}),
+		},
+		rates: append(eurRate(start, "1.25"), eurRate(end, "1.6")...),
+	}
+	txs := []models.Transaction{
+		// Before the first point, already in its value
+		{PortfolioID: 1, Symbol: "btcusdt", Type: models.TxBuy, Quantity: dec("0.01"), Price: dec("100000"),
+			ExecutedAt: start.Add(-time.Hour)},
+		{PortfolioID: 1, Symbol: "btcusdt", Type: models.TxBuy, Quantity: dec("0.01"), Price: dec("100000"),
+			Fee: dec("1"), ExecutedAt: start.Add(time.Hour)},
+		// Without a price it is valued at the next snapshot
+		{PortfolioID: 2, Symbol: "ethusdt", Type: models.TxTransferOut, Quantity: dec("0.001"),
+			ExecutedAt: start.Add(time.Hour)},
+	}
+	h := newTestHistory(t, sr, txs)
+
+	hist, err := h.History(context.Background(), 1, 1, "usdt", start, start.Add(3*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist.Points) != 2 || !hist.Points[0].Total.Equal(dec("1000")) {
+		t.Fatalf("points = %+v, want two of portfolio 1", hist.Points)
+	}
+	// 1100 more is worth, 1001 of it was paid in
+	if !hist.PnL.Flows.Equal(dec("1001")) || !hist.PnL.Absolute.Equal(dec("99")) {
+		t.Fatalf("pnl = %+v, want flows 1001 and profit 99", hist.PnL)
+	}
+	if want := dec("4.9475"); !hist.PnL.Percent.Equal(want) {
+		t.Fatalf("percent = %s, want %s of 2001 invested", hist.PnL.Percent, want)
+	}
+
+	// Portfolios together in eur, each point and flow at the rate of its time
+	hist, err = h.History(context.Background(), 1, 0, "eur", start, start.Add(3*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hist.Points[0].Total.Equal(dec("1200")) || !hist.Points[1].Total.Equal(dec("1593.75")) {
+		t.Fatalf("points = %+v, want totals 1200 and 1593.75 eur", hist.Points)
+	}
+	if btc := hist.CoinsPnL["btcusdt"]; !btc.Flows.Equal(dec("625.625")) || !btc.Absolute.Equal(dec("-113.125")) {
+		t.Fatalf("btcusdt pnl = %+v, want flows 625.625 and profit -113.125", btc)
+	}
+	// 0.001 eth moved out at the 100000 of the next snapshot
+	if eth := hist.CoinsPnL["ethusdt"]; !eth.Flows.Equal(dec("-62.5")) || !eth.Absolute.Equal(dec("-56.25")) {
+		t.Fatalf("ethusdt pnl = %+v, want flows -62.5 and profit -56.25", eth)
+	}
+	if !hist.PnL.Absolute.Equal(dec("-169.375")) {
+		t.Fatalf("pnl = %+v, want profit -169.375", hist.PnL)
+	}
+}
+
+func TestHistoryNoRate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := newTestHistory(t, &fakeSnapshots{
+		snapshots: []models.PortfolioSnapshot{snapshot(1, start, map[string]string{"btcusdt": "1000"})},
+		rates:     eurRate(start, "1.25"),
+	}, nil)
+
+	_, err := h.History(context.Background(), 1, 0, "gbp", start, start.Add(time.Hour), time.Hour)
+	if !errors.Is(err, errs.ErrNoRate) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrNoRate)
+	}
+}
+
+func TestHistoryIncomplete(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	missing := snapshot(1, start.Add(time.Hour), map[string]string{"btcusdt": "1050"})
+	missing.Incomplete = true
+	lateMissing := snapshot(1, start.Add(2*time.Hour+30*time.Minute), map[string]string{"btcusdt": "900"})
+	lateMissing.Incomplete = true
+	last := snapshot(1, start.Add(3*time.Hour), map[string]string{"btcusdt": "1100"})
+	last.Incomplete = true
+
+	h := newTestHistory(t, &fakeSnapshots{snapshots: []models.PortfolioSnapshot{
+		snapshot(1, start, map[string]string{"btcusdt": "1000"}),
+		missing,
+		snapshot(1, start.Add(2*time.Hour), map[string]string{"btcusdt": "1200"}),
+		// Does not replace the complete point of its interval
+		lateMissing,
+		last,
+	}}, nil)
+
+	hist, err := h.History(context.Background(), 1, 0, "usdt", start, start.Add(4*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist.Points) != 4 {
+		t.Fatalf("points = %+v, want one per hour", hist.Points)
+	}
+	if !hist.Points[1].Incomplete || hist.Points[2].Incomplete || !hist.Points[2].Total.Equal(dec("1200")) {
+		t.Fatalf("points = %+v, want the second incomplete and the third complete", hist.Points)
+	}
+	// Profit is counted up to the last complete point
+	if !hist.PnL.End.Equal(dec("1200")) || !hist.PnL.Absolute.Equal(dec("200")) {
+		t.Fatalf("pnl = %+v, want 200 up to 1200", hist.PnL)
+	}
+}
+
+func TestTakeSnapshots(t *testing.T) {
+	takenAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	price, total := dec("100000"), dec("50000")
+	sr := &fakeSnapshots{
+		portfolios: map[uint][]uint{7: {1, 2}},
+		currencies: []string{"bnb"},
+	}
+	h := newTestHistory(t, sr, nil)
+	h.prices = fakePrices{"eurusdt": 1.25, "btcusdt": 100000}
+	h.vs = fakeValuations{
+		1: {Quote: "usdt", Total: total, Coins: []models.CoinValuation{
+			{Symbol: "btcusdt", Quantity: dec("0.5"), Price: &price, Total: &total},
+		}},
+		2: {Quote: "usdt", Missing: []string{"wifusdt"}, Coins: []models.CoinValuation{
+			{Symbol: "wifusdt", Quantity: dec("10")},
+		}},
+	}
+
+	h.takeSnapshots(context.Background(), takenAt)
+
+	if len(sr.snapshots) != 2 {
+		t.Fatalf("snapshots = %+v, want one per portfolio", sr.snapshots)
+	}
+	for _, s := range sr.snapshots {
+		if s.Incomplete != (s.PortfolioID == 2) {
+			t.Fatalf("snapshot of portfolio %d incomplete = %v", s.PortfolioID, s.Incomplete)
+		}
+	}
+
+	rates := make(map[string]decimal.Decimal)
+	for _, r := range sr.rates {
+		rates[r.Asset] = r.Rate
+	}
+	want := map[string]string{"usdt": "1", "usd": "1", "eur": "1.25", "btc": "100000"}
+	if len(rates) != len(want) {
+		t.Fatalf("rates = %v, want %v, eth and bnb have no price", rates, want)
+	}
+	for asset, rate := range want {
+		if !rates[asset].Equal(dec(rate)) {
+			t.Fatalf("rate of %s = %s, want %s", asset, rates[asset], rate)
+		}
+	}
+}
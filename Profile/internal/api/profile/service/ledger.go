@@ -0,0 +1,664 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/shopspring/decimal"
+)
+
+// CostMethod decides which coins a sale takes, and so what they cost
+type CostMethod string
+
+const (
+	FIFO        CostMethod = "fifo"    // the oldest coins first
+	LIFO        CostMethod = "lifo"    // the newest coins first
+	AverageCost CostMethod = "average" // every coin costs the average
+)
+
+// Symbols as the Aggregator accepts them, with an optional venue prefix
+var symbolPattern = regexp.MustCompile(`^([a-z]+:)?[a-z0-9_-]{2,32}$`)
+
+var txTypes = []models.TransactionType{
+	models.TxBuy,
+	models.TxSell,
+	models.TxTransferIn,
+	models.TxTransferOut,
+	models.TxFee,
+}
+
+// Cost method of positions in websocket payloads and of GET /v2/coin/positions without ?method=
+var DefaultCostMethod = CostMethod(getenv.GetString("COST_METHOD", string(FIFO)))
+
+func (m CostMethod) Valid() bool {
+	return m == FIFO || m == LIFO || m == AverageCost
+}
+
+// TxError is a transaction the ledger can not take
+type TxError struct {
+	Tx  models.Transaction
+	Err error
+}
+
+func (e *TxError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// LedgerUpdate is the quantity of a coin in a portfolio before and after a change of the ledger
+type LedgerUpdate struct {
+	Symbol      string
+	PortfolioID uint
+	Before      decimal.Decimal
+	After       decimal.Decimal
+	Elsewhere   decimal.Decimal     // held in other portfolios of the user
+	Transaction *models.Transaction // the recorded one, nil when nothing was recorded
+}
+
+// Opened reports whether the user holds the coin since the change
+func (u *LedgerUpdate) Opened() bool {
+	return !u.Elsewhere.IsPositive() && !u.Before.IsPositive() && u.After.IsPositive()
+}
+
+// Closed reports whether the user holds no more of the coin since the change
+func (u *LedgerUpdate) Closed() bool {
+	return !u.Elsewhere.IsPositive() && u.Before.IsPositive() && !u.After.IsPositive()
+}
+
+// LedgerService keeps one ledger per portfolio, portfolioID 0 reads all of them
+type LedgerService interface {
+	Record(userID float64, portfolioID uint, req models.TransactionRequest) (*LedgerUpdate, error)
+	Import(userID float64, portfolioID uint, txs []models.Transaction) (*models.ImportResult, []models.RowError, error)
+	DeleteTransaction(userID float64, id uint) (*LedgerUpdate, error)
+	Transactions(userID float64, portfolioID uint, symbol string) ([]models.Transaction, error)
+	// Holdings are positions of every coin without prices, keyed by symbol
+	Holdings(userID float64, portfolioID uint, method CostMethod) (map[string]models.Position, error)
+	// Positions are priced in the quote of their symbol and summed in currency
+	Positions(
+		ctx context.Context,
+		userID float64,
+		portfolioID uint,
+		method CostMethod,
+		currency string,
+	) (*models.Positions, error)
+}
+
+type ledger struct {
+	cr      repository.CoinsRepository
+	lr      repository.LedgerRepository
+	prices  PriceSource
+	catalog CatalogService
+}
+
+func NewLedgerService(
+	cr repository.CoinsRepository,
+	lr repository.LedgerRepository,
+	prices PriceSource,
+	catalog CatalogService,
+) LedgerService {
+	return &ledger{cr: cr, lr: lr, prices: prices, catalog: catalog}
+}
+
+func (l *ledger) Record(userID float64, portfolioID uint, req models.TransactionRequest) (*LedgerUpdate, error) {
+	tx := NewTransaction(req)
+	tx.UserID = uint(userID)
+	if err := l.validate(tx); err != nil {
+		return nil, err
+	}
+
+	return updateLedger(l.lr, uint(userID), portfolioID, tx.Symbol,
+		func([]models.Transaction, decimal.Decimal) ([]models.Transaction, []uint, error) {
+			return []models.Transaction{tx}, nil, nil
+		})
+}
+
+// Import records transactions of a file in one database transaction. Nothing
+// is saved when any of them is invalid or spends more coins than held, the
+// failed rows are returned with errs.ErrInvalidImport then
+func (l *ledger) Import(
+	userID float64,
+	portfolioID uint,
+	txs []models.Transaction,
+) (*models.ImportResult, []models.RowError, error) {
+	var rows []models.RowError
+
+	bySymbol := make(map[string][]models.Transaction)
+	for _, tx := range txs {
+		tx.UserID = uint(userID)
+		if err := l.validate(tx); err != nil {
+			rows = append(rows, models.RowError{Row: tx.Row, Error: err.Error()})
+			continue
+		}
+		bySymbol[tx.Symbol] = append(bySymbol[tx.Symbol], tx)
+	}
+	if len(rows) > 0 {
+		return nil, rows, errs.ErrInvalidImport
+	}
+	if len(bySymbol) == 0 {
+		return nil, nil, fmt.Errorf("%w: no transactions", errs.ErrInvalidImport)
+	}
+
+	changes := make(map[string]repository.LedgerChange, len(bySymbol))
+	for symbol, add := range bySymbol {
+		change := &ledgerChange{
+			userID:      uint(userID),
+			portfolioID: portfolioID,
+			symbol:      symbol,
+			build: func([]models.Transaction, decimal.Decimal) ([]models.Transaction, []uint, error) {
+				return add, nil, nil
+			},
+		}
+		changes[symbol] = func(
+			txs []models.Transaction,
+			held decimal.Decimal,
+		) ([]models.Transaction, []uint, decimal.Decimal, error) {
+			added, remove, quantity, err := change.apply(txs, held)
+			var txErr *TxError
+			if errors.As(err, &txErr) {
+				rows = append(rows, models.RowError{Row: txErr.Tx.Row, Error: err.Error()})
+			}
+			return added, remove, quantity, err
+		}
+	}
+
+	results, err := l.lr.UpdateLedgers(uint(userID), portfolioID, changes)
+	if err != nil {
+		if len(rows) > 0 {
+			sort.Slice(rows, func(i, j int) bool { return rows[i].Row < rows[j].Row })
+			return nil, rows, errs.ErrInvalidImport
+		}
+		return nil, nil, err
+	}
+
+	res := &models.ImportResult{Imported: len(txs)}
+	for symbol, r := range results {
+		res.Symbols = append(res.Symbols, symbol)
+		update := LedgerUpdate{Before: r.Before, After: r.After, Elsewhere: r.Elsewhere}
+		if update.Opened() {
+			res.Opened = append(res.Opened, symbol)
+		}
+	}
+	slices.Sort(res.Symbols)
+	slices.Sort(res.Opened)
+	return res, nil, nil
+}
+
+// DeleteTransaction removes a transaction when the ledger stays valid without it
+func (l *ledger) DeleteTransaction(userID float64, id uint) (*LedgerUpdate, error) {
+	tx, err := l.lr.GetTransaction(uint(userID), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return updateLedger(l.lr, uint(userID), tx.PortfolioID, tx.Symbol,
+		func([]models.Transaction, decimal.Decimal) ([]models.Transaction, []uint, error) {
+			return nil, []uint{id}, nil
+		})
+}
+
+func (l *ledger) Transactions(userID float64, portfolioID uint, symbol string) ([]models.Transaction, error) {
+	return l.lr.GetTransactions(uint(userID), portfolioID, symbol)
+}
+
+// Holdings replays ledgers of portfolios one by one and sums positions of the
+// same coin. Coins added before the ledger was kept have no transactions, they
+// are held at zero cost
+func (l *ledger) Holdings(
+	userID float64,
+	portfolioID uint,
+	method CostMethod,
+) (map[string]models.Position, error) {
+	txs, err := l.lr.GetTransactions(uint(userID), portfolioID, "")
+	if err != nil {
+		return nil, err
+	}
+	coins, err := l.cr.GetCoins(uint(userID), portfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgers := make(map[uint][]models.Transaction)
+	for _, tx := range txs {
+		ledgers[tx.PortfolioID] = append(ledgers[tx.PortfolioID], tx)
+	}
+
+	books := make(map[uint]map[string]*book, len(ledgers))
+	for id, entries := range ledgers {
+		if books[id], err = replay(entries, method); err != nil {
+			return nil, err
+		}
+	}
+	for _, coin := range coins {
+		symbol := strings.ToLower(coin.Symbol)
+		if _, ok := books[coin.PortfolioID][symbol]; ok {
+			continue
+		}
+		if books[coin.PortfolioID] == nil {
+			books[coin.PortfolioID] = make(map[string]*book)
+		}
+		b := newBook(symbol, method)
+		b.open(coin.Quantity, decimal.Zero)
+		books[coin.PortfolioID][symbol] = b
+	}
+
+	positions := make(map[string]models.Position)
+	for _, portfolio := range books {
+		for symbol, b := range portfolio {
+			pos, ok := positions[symbol]
+			if !ok {
+				positions[symbol] = b.position()
+				continue
+			}
+			positions[symbol] = mergePositions(pos, b.position())
+		}
+	}
+	return positions, nil
+}
+
+func mergePositions(a, b models.Position) models.Position {
+	a.Quantity = a.Quantity.Add(b.Quantity)
+	a.CostBasis = a.CostBasis.Add(b.CostBasis)
+	a.Realized = a.Realized.Add(b.Realized)
+	a.Fees = a.Fees.Add(b.Fees)
+	a.AvgCost = nil
+	if a.Quantity.IsPositive() {
+		avg := a.CostBasis.Div(a.Quantity).Round(8)
+		a.AvgCost = &avg
+	}
+	return a
+}
+
+// Positions are holdings at the latest known prices, coins sold out are kept for their realized profit
+func (l *ledger) Positions(
+	ctx context.Context,
+	userID float64,
+	portfolioID uint,
+	method CostMethod,
+	currency string,
+) (*models.Positions, error) {
+	holdings, err := l.Holdings(userID, portfolioID, method)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]string, 0, len(holdings))
+	for symbol := range holdings {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+
+	// Quotes are converted through the pairs linking them to the currency
+	wanted := slices.Clone(symbols)
+	for _, symbol := range symbols {
+		if _, quote, ok := l.catalog.Assets(symbol); ok {
+			links, _ := l.catalog.Links(quote, currency)
+			wanted = append(wanted, links...)
+		}
+	}
+	slices.Sort(wanted)
+
+	// Positions without prices are still worth returning
+	prices, err := l.prices.LastPrices(ctx, slices.Compact(wanted))
+	if err != nil {
+		slog.Warn("Could not read prices of positions", "userID", userID, "error", err)
+	}
+	graph := RateGraph(l.catalog, prices)
+
+	res := &models.Positions{
+		PortfolioID: portfolioID,
+		Method:      string(method),
+		Positions:   make([]models.Position, 0, len(symbols)),
+		Currency:    currency,
+	}
+	for _, symbol := range symbols {
+		pos := holdings[symbol]
+		pos.Asset, pos.Quote, _ = l.catalog.Assets(symbol)
+		last, priced := prices[symbol]
+		if priced {
+			price := decimal.NewFromFloat(last.Price)
+			value := price.Mul(pos.Quantity)
+			unrealized := value.Sub(pos.CostBasis)
+			pos.Price = &price
+			pos.Value = &value
+			pos.Unrealized = &unrealized
+			pos.Stale = last.Stale
+		}
+
+		rate, rated := graph.Rate(pos.Quote, currency)
+		if rated {
+			pos.Rate = &rate
+		}
+		res.Positions = append(res.Positions, pos)
+
+		// A position is summed whole or not at all, closed ones need no price
+		if !rated || (!priced && pos.Quantity.IsPositive()) {
+			res.Missing = append(res.Missing, symbol)
+			continue
+		}
+		res.CostBasis = res.CostBasis.Add(pos.CostBasis.Mul(rate).Round(8))
+		res.Realized = res.Realized.Add(pos.Realized.Mul(rate).Round(8))
+		if priced {
+			res.Value = res.Value.Add(pos.Value.Mul(rate).Round(8))
+			res.Unrealized = res.Unrealized.Add(pos.Unrealized.Mul(rate).Round(8))
+		}
+	}
+	return res, nil
+}
+
+// updateLedger saves changes built from the ledger of symbol when the whole
+// ledger stays valid with them
+func updateLedger(
+	lr repository.LedgerRepository,
+	userID, portfolioID uint,
+	symbol string,
+	build func(txs []models.Transaction, quantity decimal.Decimal) (add []models.Transaction, remove []uint, err error),
+) (*LedgerUpdate, error) {
+	change := &ledgerChange{userID: userID, portfolioID: portfolioID, symbol: symbol, build: build}
+
+	before, after, elsewhere, err := lr.UpdateLedger(userID, portfolioID, symbol, change.apply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LedgerUpdate{
+		Symbol:      symbol,
+		PortfolioID: portfolioID,
+		Before:      before,
+		After:       after,
+		Elsewhere:   elsewhere,
+		Transaction: change.recorded(),
+	}, nil
+}
+
+// ledgerChange builds a change of the ledger of one symbol. Coins held before
+// the ledger was kept are recorded first as a transfer at zero cost
+type ledgerChange struct {
+	userID      uint
+	portfolioID uint
+	symbol      string
+	build       func(txs []models.Transaction, quantity decimal.Decimal) (add []models.Transaction, remove []uint, err error)
+
+	opening int
+	added   []models.Transaction // IDs are set once saved
+}
+
+func (c *ledgerChange) apply(
+	txs []models.Transaction,
+	held decimal.Decimal,
+) ([]models.Transaction, []uint, decimal.Decimal, error) {
+	var opening []models.Transaction
+	if len(txs) == 0 && held.IsPositive() {
+		opening = append(opening, models.Transaction{
+			UserID:      c.userID,
+			PortfolioID: c.portfolioID,
+			Symbol:      c.symbol,
+			Type:        models.TxTransferIn,
+			Quantity:    held,
+			ExecutedAt:  time.Now().UTC(),
+		})
+		txs = opening
+	}
+
+	quantity, err := heldAfter(txs)
+	if err != nil {
+		return nil, nil, decimal.Zero, err
+	}
+
+	add, remove, err := c.build(txs, quantity)
+	if err != nil {
+		return nil, nil, decimal.Zero, err
+	}
+	for i := range add {
+		add[i].PortfolioID = c.portfolioID
+	}
+	if len(opening) > 0 {
+		for _, tx := range add {
+			if tx.ExecutedAt.Before(opening[0].ExecutedAt) {
+				opening[0].ExecutedAt = tx.ExecutedAt
+			}
+		}
+	}
+
+	all := make([]models.Transaction, 0, len(txs)+len(add))
+	for _, tx := range txs {
+		if !slices.Contains(remove, tx.ID) {
+			all = append(all, tx)
+		}
+	}
+	all = append(all, add...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].ExecutedAt.Before(all[j].ExecutedAt)
+	})
+
+	quantity, err = heldAfter(all)
+	if err != nil {
+		return nil, nil, decimal.Zero, err
+	}
+
+	c.opening = len(opening)
+	c.added = append(opening, add...)
+	return c.added, remove, quantity, nil
+}
+
+// recorded is the last transaction added by the change, nil when there is none
+func (c *ledgerChange) recorded() *models.Transaction {
+	if len(c.added) == c.opening {
+		return nil
+	}
+	return &c.added[len(c.added)-1]
+}
+
+// NewTransaction is the transaction of a request, executed now unless the request tells otherwise
+func NewTransaction(req models.TransactionRequest) models.Transaction {
+	tx := models.Transaction{
+		Symbol:     req.Symbol,
+		Type:       req.Type,
+		Quantity:   req.Quantity,
+		Price:      req.Price,
+		Fee:        req.Fee,
+		ExecutedAt: time.Now().UTC(),
+	}
+	if req.ExecutedAt != nil {
+		tx.ExecutedAt = req.ExecutedAt.UTC()
+	}
+	return tx
+}
+
+func heldAfter(txs []models.Transaction) (decimal.Decimal, error) {
+	books, err := replay(txs, FIFO)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	quantity := decimal.Zero
+	for _, b := range books {
+		quantity = quantity.Add(b.pos.Quantity)
+	}
+	return quantity, nil
+}
+
+// validate checks the transaction and that its symbol is listed. Markets that
+// stopped trading are accepted, their past trades belong to the ledger
+func (l *ledger) validate(tx models.Transaction) error {
+	if err := validateTx(tx); err != nil {
+		return err
+	}
+	if err := l.catalog.Validate(tx.Symbol, false); err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidTx, err)
+	}
+	return nil
+}
+
+func validateTx(tx models.Transaction) error {
+	switch {
+	case !symbolPattern.MatchString(tx.Symbol):
+		return fmt.Errorf("%w: invalid symbol %q", errs.ErrInvalidTx, tx.Symbol)
+	case !slices.Contains(txTypes, tx.Type):
+		return fmt.Errorf("%w: unknown type %q", errs.ErrInvalidTx, tx.Type)
+	case !tx.Quantity.IsPositive():
+		return fmt.Errorf("%w: quantity must be positive", errs.ErrInvalidTx)
+	case tx.Price.IsNegative():
+		return fmt.Errorf("%w: price must not be negative", errs.ErrInvalidTx)
+	case tx.Fee.IsNegative():
+		return fmt.Errorf("%w: fee must not be negative", errs.ErrInvalidTx)
+	case tx.ExecutedAt.After(time.Now().Add(time.Minute)):
+		return fmt.Errorf("%w: executed in the future", errs.ErrInvalidTx)
+	}
+	return nil
+}
+
+// replay applies transactions in execution order, one book per symbol
+func replay(txs []models.Transaction, method CostMethod) (map[string]*book, error) {
+	books := make(map[string]*book)
+	for _, tx := range txs {
+		b, ok := books[tx.Symbol]
+		if !ok {
+			b = newBook(tx.Symbol, method)
+			books[tx.Symbol] = b
+		}
+		if err := b.apply(tx); err != nil {
+			return nil, err
+		}
+	}
+	return books, nil
+}
+
+// lot is coins that came in together, cost is of all of them
+type lot struct {
+	quantity decimal.Decimal
+	cost     decimal.Decimal
+}
+
+// book holds lots of one symbol, with the average cost there is one lot
+type book struct {
+	method CostMethod
+	lots   []lot
+	pos    models.Position
+}
+
+func newBook(symbol string, method CostMethod) *book {
+	return &book{
+		method: method,
+		pos:    models.Position{Symbol: symbol},
+	}
+}
+
+// apply books a transaction: fees of buys are part of the cost, fees of sales
+// and transfers out reduce the profit, coins paid as a fee are lost at their cost
+func (b *book) apply(tx models.Transaction) error {
+	switch tx.Type {
+	case models.TxBuy, models.TxTransferIn:
+		b.open(tx.Quantity, tx.Quantity.Mul(tx.Price).Add(tx.Fee))
+		b.pos.Fees = b.pos.Fees.Add(tx.Fee)
+
+	case models.TxSell:
+		cost, err := b.close(tx)
+		if err != nil {
+			return err
+		}
+		proceeds := tx.Quantity.Mul(tx.Price).Sub(tx.Fee)
+		b.pos.Realized = b.pos.Realized.Add(proceeds.Sub(cost))
+		b.pos.Fees = b.pos.Fees.Add(tx.Fee)
+
+	case models.TxTransferOut:
+		// The cost leaves with the coins
+		if _, err := b.close(tx); err != nil {
+			return err
+		}
+		b.pos.Realized = b.pos.Realized.Sub(tx.Fee)
+		b.pos.Fees = b.pos.Fees.Add(tx.Fee)
+
+	case models.TxFee:
+		cost, err := b.close(tx)
+		if err != nil {
+			return err
+		}
+		b.pos.Realized = b.pos.Realized.Sub(cost).Sub(tx.Fee)
+		b.pos.Fees = b.pos.Fees.Add(cost).Add(tx.Fee)
+
+	default:
+		return fmt.Errorf("%w: unknown type %q", errs.ErrInvalidTx, tx.Type)
+	}
+	return nil
+}
+
+func (b *book) open(quantity, cost decimal.Decimal) {
+	b.pos.Quantity = b.pos.Quantity.Add(quantity)
+	b.pos.CostBasis = b.pos.CostBasis.Add(cost)
+
+	if b.method == AverageCost && len(b.lots) > 0 {
+		b.lots[0].quantity = b.lots[0].quantity.Add(quantity)
+		b.lots[0].cost = b.lots[0].cost.Add(cost)
+		return
+	}
+	b.lots = append(b.lots, lot{quantity: quantity, cost: cost})
+}
+
+// close takes the coins of tx out of lots and returns what they cost
+func (b *book) close(tx models.Transaction) (decimal.Decimal, error) {
+	if tx.Quantity.GreaterThan(b.pos.Quantity) {
+		return decimal.Zero, &TxError{
+			Tx: tx,
+			Err: fmt.Errorf("%w: %s %s %s at %s, %s held",
+				errs.ErrOversold, tx.Type, tx.Quantity, tx.Symbol,
+				tx.ExecutedAt.Format(time.RFC3339), b.pos.Quantity),
+		}
+	}
+
+	cost := decimal.Zero
+	remaining := tx.Quantity
+	for remaining.IsPositive() {
+		i := 0
+		if b.method == LIFO {
+			i = len(b.lots) - 1
+		}
+
+		l := &b.lots[i]
+		if l.quantity.LessThanOrEqual(remaining) {
+			cost = cost.Add(l.cost)
+			remaining = remaining.Sub(l.quantity)
+			b.lots = slices.Delete(b.lots, i, i+1)
+			continue
+		}
+
+		part := l.cost.Mul(remaining).Div(l.quantity)
+		l.quantity = l.quantity.Sub(remaining)
+		l.cost = l.cost.Sub(part)
+		cost = cost.Add(part)
+		remaining = decimal.Zero
+	}
+
+	b.pos.Quantity = b.pos.Quantity.Sub(tx.Quantity)
+	b.pos.CostBasis = b.pos.CostBasis.Sub(cost)
+	if b.pos.Quantity.IsZero() {
+		b.lots = nil
+		b.pos.CostBasis = decimal.Zero
+	}
+	return cost, nil
+}
+
+func (b *book) position() models.Position {
+	pos := b.pos
+	pos.CostBasis = pos.CostBasis.Round(8)
+	pos.Realized = pos.Realized.Round(8)
+	pos.Fees = pos.Fees.Round(8)
+	if pos.Quantity.IsPositive() {
+		avg := pos.CostBasis.Div(pos.Quantity).Round(8)
+		pos.AvgCost = &avg
+	}
+	return pos
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+)
+
+func tx(kind models.TransactionType, quantity, price, fee string, minute int) models.Transaction {
+	return models.Transaction{
+		Symbol:     "btcusdt",
+		Type:       kind,
+		Quantity:   dec(quantity),
+		Price:      dec(price),
+		Fee:        dec(fee),
+		ExecutedAt: time.Date(2026, 3, 1, 0, minute, 0, 0, time.UTC),
+	}
+}
+
+func replayed(t *testing.T, txs []models.Transaction, method CostMethod) *book {
+	t.Helper()
+
+	books, err := replay(txs, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return books["btcusdt"]
+}
+
+func TestBookRealizedByMethod(t *testing.T) {
+	txs := []models.Transaction{
+		tx(models.TxBuy, "1", "100", "0", 0),
+		tx(models.TxBuy, "1", "200", "0", 1),
+		tx(models.TxSell, "1.5", "300", "0", 2),
+	}
+
+	tests := []struct {
+		method    CostMethod
+		realized  string
+		costBasis string
+		avgCost   string
+	}{
+		// 1 at 100 and 0.5 at 200 are sold
+		{FIFO, "250", "100", "200"},
+		// 1 at 200 and 0.5 at 100 are sold
+		{LIFO, "200", "50", "100"},
+		// 1.5 at 150 are sold
+		{AverageCost, "225", "75", "150"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			pos := replayed(t, txs, tt.method).position()
+			if !pos.Quantity.Equal(dec("0.5")) {
+				t.Fatalf("quantity = %s, want 0.5", pos.Quantity)
+			}
+			if !pos.Realized.Equal(dec(tt.realized)) {
+				t.Errorf("realized = %s, want %s", pos.Realized, tt.realized)
+			}
+			if !pos.CostBasis.Equal(dec(tt.costBasis)) {
+				t.Errorf("cost basis = %s, want %s", pos.CostBasis, tt.costBasis)
+			}
+			if pos.AvgCost == nil || !pos.AvgCost.Equal(dec(tt.avgCost)) {
+				t.Errorf("avg cost = %v, want %s", pos.AvgCost, tt.avgCost)
+			}
+		})
+	}
+}
+
+func TestBookPartialLot(t *testing.T) {
+	b := replayed(t, []models.Transaction{
+		tx(models.TxBuy, "2", "100", "2", 0),
+		tx(models.TxBuy, "1", "400", "0", 1),
+		tx(models.TxSell, "0.5", "300", "1", 2),
+	}, FIFO)
+
+	// Half a coin of the first lot is gone, it cost 202 for 2 coins
+	if len(b.lots) != 2 {
+		t.Fatalf("lots = %+v, want both left", b.lots)
+	}
+	if first := b.lots[0]; !first.quantity.Equal(dec("1.5")) || !first.cost.Equal(dec("151.5")) {
+		t.Fatalf("first lot = %+v, want 1.5 costing 151.5", first)
+	}
+
+	pos := b.position()
+	// 150 less the fee of 1 for coins that cost 50.5
+	if !pos.Realized.Equal(dec("98.5")) {
+		t.Fatalf("realized = %s, want 98.5", pos.Realized)
+	}
+	if !pos.CostBasis.Equal(dec("551.5")) || !pos.Fees.Equal(dec("3")) {
+		t.Fatalf("position = %+v, want cost basis 551.5 and fees 3", pos)
+	}
+}
+
+func TestBookAverageAfterPartialSells(t *testing.T) {
+	b := replayed(t, []models.Transaction{
+		tx(models.TxBuy, "1", "100", "0", 0),
+		tx(models.TxBuy, "1", "200", "0", 1),
+		tx(models.TxSell, "1.5", "300", "0", 2),
+		// 0.5 at 150 and 0.5 at 350
+		tx(models.TxBuy, "0.5", "350", "0", 3),
+	}, AverageCost)
+
+	pos := b.position()
+	if pos.AvgCost == nil || !pos.AvgCost.Equal(dec("250")) {
+		t.Fatalf("avg cost = %v, want 250", pos.AvgCost)
+	}
+
+	if err := b.apply(tx(models.TxSell, "0.5", "300", "0", 4)); err != nil {
+		t.Fatal(err)
+	}
+	pos = b.position()
+	if !pos.Realized.Equal(dec("250")) {
+		t.Fatalf("realized = %s, want 225 and 25 of the second sale", pos.Realized)
+	}
+	if pos.AvgCost == nil || !pos.AvgCost.Equal(dec("250")) {
+		t.Fatalf("avg cost = %v, want 250 after a sale", pos.AvgCost)
+	}
+
+	// Selling everything leaves no cost behind
+	if err := b.apply(tx(models.TxSell, "0.5", "300", "0", 5)); err != nil {
+		t.Fatal(err)
+	}
+	if pos = b.position(); !pos.CostBasis.IsZero() || pos.AvgCost != nil || len(b.lots) != 0 {
+		t.Fatalf("position = %+v, lots = %+v, want nothing held", pos, b.lots)
+	}
+}
+
+func TestBookOversell(t *testing.T) {
+	for _, kind := range []models.TransactionType{models.TxSell, models.TxTransferOut, models.TxFee} {
+		t.Run(string(kind), func(t *testing.T) {
+			oversold := tx(kind, "1.5", "300", "0", 2)
+			_, err := replay([]models.Transaction{
+				tx(models.TxBuy, "1", "100", "0", 0),
+				oversold,
+			}, FIFO)
+
+			if !errors.Is(err, errs.ErrOversold) {
+				t.Fatalf("err = %v, want %v", err, errs.ErrOversold)
+			}
+			var txErr *TxError
+			if !errors.As(err, &txErr) || !txErr.Tx.ExecutedAt.Equal(oversold.ExecutedAt) {
+				t.Fatalf("err = %v, want the oversold transaction", err)
+			}
+		})
+	}
+}
+
+func TestBookFeeInCoins(t *testing.T) {
+	pos := replayed(t, []models.Transaction{
+		tx(models.TxBuy, "2", "100", "0", 0),
+		// A coin paid as a fee is lost at what it cost
+		tx(models.TxFee, "0.1", "0", "0", 1),
+	}, FIFO).position()
+
+	if !pos.Quantity.Equal(dec("1.9")) || !pos.Realized.Equal(dec("-10")) || !pos.Fees.Equal(dec("10")) {
+		t.Fatalf("position = %+v, want 1.9 held and 10 lost as a fee", pos)
+	}
+}
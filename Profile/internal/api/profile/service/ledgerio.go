@@ -0,0 +1,424 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/shopspring/decimal"
+)
+
+// Formats of imported and exported ledgers
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// CSV dialects, trade history exports of exchanges are read as they are
+const (
+	DialectLedger   = "ledger"   // executed_at,symbol,type,quantity,price,fee as exported here
+	DialectBinance  = "binance"  // Binance spot trade history
+	DialectCoinbase = "coinbase" // Coinbase Advanced Trade fills
+)
+
+// A file with more rows is refused as a whole
+var maxImportRows = getenv.GetInt("IMPORT_MAX_ROWS", 10000)
+
+var ledgerColumns = []string{"executed_at", "symbol", "type", "quantity", "price", "fee"}
+
+// ReadTransactions parses an imported file. Rows that can not be parsed are
+// returned with their number, an unreadable file is an error. The CSV
+// dialect is detected by the header when it is empty
+func ReadTransactions(
+	r io.Reader,
+	format, dialect string,
+) ([]models.Transaction, []models.RowError, error) {
+	switch format {
+	case FormatJSON:
+		return readJSON(r)
+	case FormatCSV:
+		return readCSV(r, dialect)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown format %q", errs.ErrInvalidImport, format)
+	}
+}
+
+func readJSON(r io.Reader) ([]models.Transaction, []models.RowError, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A list of transactions, or an export holding one
+	var reqs []models.TransactionRequest
+	if trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &reqs)
+	} else {
+		var export struct {
+			Transactions []models.TransactionRequest `json:"transactions"`
+		}
+		err = json.Unmarshal(data, &export)
+		reqs = export.Transactions
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", errs.ErrInvalidImport, err.Error())
+	}
+	if len(reqs) > maxImportRows {
+		return nil, nil, fmt.Errorf("%w: more than %d transactions", errs.ErrInvalidImport, maxImportRows)
+	}
+
+	txs := make([]models.Transaction, 0, len(reqs))
+	for i, req := range reqs {
+		req.Symbol = strings.ToLower(strings.TrimSpace(req.Symbol))
+		tx := NewTransaction(req)
+		tx.Row = i + 1
+		txs = append(txs, tx)
+	}
+	return txs, nil, nil
+}
+
+// rowParser turns a row of a dialect into transactions, fees paid in coins are transactions of their own
+type rowParser func(get func(column string) string) ([]models.Transaction, error)
+
+func readCSV(r io.Reader, dialect string) ([]models.Transaction, []models.RowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: no header: %s", errs.ErrInvalidImport, err.Error())
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+
+	if dialect == "" {
+		dialect = detectDialect(columns)
+	}
+
+	var (
+		parse    rowParser
+		required []string
+	)
+	switch dialect {
+	case DialectLedger:
+		parse, required = parseLedgerRow, []string{"symbol", "quantity"}
+	case DialectBinance:
+		parse, required = parseBinanceRow, []string{"date(utc)", "pair", "side", "price", "executed", "amount", "fee"}
+	case DialectCoinbase:
+		parse, required = parseCoinbaseRow, []string{"product", "side", "created at", "size", "size unit", "price", "fee"}
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown dialect %q", errs.ErrInvalidImport, dialect)
+	}
+	for _, column := range required {
+		if _, ok := columns[column]; !ok {
+			return nil, nil, fmt.Errorf("%w: %s file has no %q column", errs.ErrInvalidImport, dialect, column)
+		}
+	}
+
+	var (
+		txs  []models.Transaction
+		rows []models.RowError
+	)
+	for n := 0; ; n++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", errs.ErrInvalidImport, err.Error())
+		}
+		if n >= maxImportRows {
+			return nil, nil, fmt.Errorf("%w: more than %d rows", errs.ErrInvalidImport, maxImportRows)
+		}
+
+		line, _ := cr.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		parsed, err := parse(get)
+		if err != nil {
+			rows = append(rows, models.RowError{Row: line, Error: err.Error()})
+			continue
+		}
+		for i := range parsed {
+			parsed[i].Row = line
+		}
+		txs = append(txs, parsed...)
+	}
+	return txs, rows, nil
+}
+
+func detectDialect(columns map[string]int) string {
+	_, date := columns["date(utc)"]
+	_, pair := columns["pair"]
+	if date && pair {
+		return DialectBinance
+	}
+
+	_, trade := columns["trade id"]
+	_, product := columns["product"]
+	if trade && product {
+		return DialectCoinbase
+	}
+	return DialectLedger
+}
+
+// parseLedgerRow reads rows as they are exported. A file of symbols and
+// quantities only is a list of transfers in at zero cost
+func parseLedgerRow(get func(string) string) ([]models.Transaction, error) {
+	tx := models.Transaction{
+		Symbol:     strings.ToLower(get("symbol")),
+		Type:       models.TransactionType(strings.ToLower(get("type"))),
+		ExecutedAt: time.Now().UTC(),
+	}
+	if tx.Type == "" {
+		tx.Type = models.TxTransferIn
+	}
+
+	var err error
+	if tx.Quantity, err = parseAmount(get("quantity"), "quantity"); err != nil {
+		return nil, err
+	}
+	if tx.Price, err = parseOptionalAmount(get("price"), "price"); err != nil {
+		return nil, err
+	}
+	if tx.Fee, err = parseOptionalAmount(get("fee"), "fee"); err != nil {
+		return nil, err
+	}
+	if v := get("executed_at"); v != "" {
+		if tx.ExecutedAt, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	return []models.Transaction{tx}, nil
+}
+
+// parseBinanceRow reads "Date(UTC),Pair,Side,Price,Executed,Amount,Fee" where
+// executed, amount and fee end with their asset, e.g. "0.5BTC"
+func parseBinanceRow(get func(string) string) ([]models.Transaction, error) {
+	executedAt, err := time.Parse(time.DateTime, get("date(utc)"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", get("date(utc)"))
+	}
+
+	quantity, base, err := parseAssetAmount(get("executed"), "executed")
+	if err != nil {
+		return nil, err
+	}
+	_, quote, err := parseAssetAmount(get("amount"), "amount")
+	if err != nil {
+		return nil, err
+	}
+	fee, feeAsset, err := parseAssetAmount(get("fee"), "fee")
+	if err != nil {
+		return nil, err
+	}
+	price, err := parseAmount(get("price"), "price")
+	if err != nil {
+		return nil, err
+	}
+
+	txType, err := parseSide(get("side"))
+	if err != nil {
+		return nil, err
+	}
+
+	symbol := strings.ToLower(get("pair"))
+	if symbol != base+quote {
+		return nil, fmt.Errorf("pair %q is not %s quoted in %s", get("pair"), base, quote)
+	}
+
+	return tradeTransactions(symbol, txType, quantity, price, fee, feeAsset, base, quote, executedAt), nil
+}
+
+// parseCoinbaseRow reads Advanced Trade fills, where the product is "BTC-USD",
+// the size is in "size unit" and the fee is in the quote
+func parseCoinbaseRow(get func(string) string) ([]models.Transaction, error) {
+	executedAt, err := parseTime(get("created at"))
+	if err != nil {
+		return nil, err
+	}
+
+	base, quote, ok := strings.Cut(strings.ToLower(get("product")), "-")
+	if !ok || base == "" || quote == "" {
+		return nil, fmt.Errorf("invalid product %q", get("product"))
+	}
+
+	size, err := parseAmount(get("size"), "size")
+	if err != nil {
+		return nil, err
+	}
+	price, err := parseAmount(get("price"), "price")
+	if err != nil {
+		return nil, err
+	}
+	fee, err := parseOptionalAmount(get("fee"), "fee")
+	if err != nil {
+		return nil, err
+	}
+
+	quantity := size
+	switch unit := strings.ToLower(get("size unit")); unit {
+	case base:
+	case quote:
+		if !price.IsPositive() {
+			return nil, fmt.Errorf("size in %s needs a positive price", unit)
+		}
+		quantity = size.Div(price)
+	default:
+		return nil, fmt.Errorf("size unit %q is neither %s nor %s", get("size unit"), base, quote)
+	}
+
+	txType, err := parseSide(get("side"))
+	if err != nil {
+		return nil, err
+	}
+
+	return tradeTransactions(base+quote, txType, quantity, price, fee, quote, base, quote, executedAt), nil
+}
+
+// tradeTransactions is a trade with its fee. A fee in the quote is part of the
+// trade, a fee in coins is paid with them: the base of the pair or the fee
+// asset quoted in the same currency
+func tradeTransactions(
+	symbol string,
+	txType models.TransactionType,
+	quantity, price, fee decimal.Decimal,
+	feeAsset, base, quote string,
+	executedAt time.Time,
+) []models.Transaction {
+	trade := models.Transaction{
+		Symbol:     symbol,
+		Type:       txType,
+		Quantity:   quantity,
+		Price:      price,
+		ExecutedAt: executedAt,
+	}
+	if !fee.IsPositive() || feeAsset == quote {
+		trade.Fee = fee
+		return []models.Transaction{trade}
+	}
+
+	feeTx := models.Transaction{
+		Symbol:     feeAsset + quote,
+		Type:       models.TxFee,
+		Quantity:   fee,
+		ExecutedAt: executedAt,
+	}
+	if feeAsset == base {
+		feeTx.Symbol = symbol
+	}
+	return []models.Transaction{trade, feeTx}
+}
+
+func parseSide(side string) (models.TransactionType, error) {
+	switch strings.ToLower(side) {
+	case "buy":
+		return models.TxBuy, nil
+	case "sell":
+		return models.TxSell, nil
+	default:
+		return "", fmt.Errorf("invalid side %q", side)
+	}
+}
+
+func parseAmount(v, name string) (decimal.Decimal, error) {
+	d, err := decimal.NewFromString(strings.ReplaceAll(v, ",", ""))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return d, nil
+}
+
+func parseOptionalAmount(v, name string) (decimal.Decimal, error) {
+	if v == "" {
+		return decimal.Zero, nil
+	}
+	return parseAmount(v, name)
+}
+
+// parseAssetAmount splits "0.5BTC" into 0.5 and "btc"
+func parseAssetAmount(v, name string) (decimal.Decimal, string, error) {
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.' && r != ','
+	})
+	if i <= 0 {
+		return decimal.Zero, "", fmt.Errorf("invalid %s %q, amount with its asset is expected", name, v)
+	}
+
+	amount, err := parseAmount(v[:i], name)
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	return amount, strings.ToLower(v[i:]), nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, RFC 3339 is expected", v)
+}
+
+// WriteTransactions exports a ledger in a form ReadTransactions takes back
+func WriteTransactions(
+	w io.Writer,
+	format string,
+	portfolio *models.Portfolio,
+	txs []models.Transaction,
+) error {
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(struct {
+			Portfolio    *models.Portfolio    `json:"portfolio"`
+			Transactions []models.Transaction `json:"transactions"`
+		}{portfolio, txs})
+
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(ledgerColumns); err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			if err := cw.Write([]string{
+				tx.ExecutedAt.UTC().Format(time.RFC3339Nano),
+				tx.Symbol,
+				string(tx.Type),
+				tx.Quantity.String(),
+				tx.Price.String(),
+				tx.Fee.String(),
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("%w: unknown format %q", errs.ErrInvalidImport, format)
+	}
+}
@@ -0,0 +1,406 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/shopspring/decimal"
+)
+
+// memLedger keeps ledgers of one user by portfolio and symbol, coins are
+// what they hold. A change is saved only when every symbol of it applies, as
+// the database transaction does
+type memLedger struct {
+	repository.LedgerRepository
+	repository.CoinsRepository
+	txs map[uint]map[string][]models.Transaction
+}
+
+func newMemLedger() *memLedger {
+	return &memLedger{txs: make(map[uint]map[string][]models.Transaction)}
+}
+
+func (m *memLedger) GetTransactions(userID, portfolioID uint, symbol string) ([]models.Transaction, error) {
+	var res []models.Transaction
+	for id, ledgers := range m.txs {
+		if portfolioID != 0 && id != portfolioID {
+			continue
+		}
+		for s, txs := range ledgers {
+			if symbol == "" || s == symbol {
+				res = append(res, txs...)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *memLedger) GetCoins(userID, portfolioID uint) ([]*models.Coin, error) {
+	var coins []*models.Coin
+	for id, ledgers := range m.txs {
+		if portfolioID != 0 && id != portfolioID {
+			continue
+		}
+		for symbol, txs := range ledgers {
+			quantity, err := heldAfter(txs)
+			if err != nil {
+				return nil, err
+			}
+			if quantity.IsPositive() {
+				coins = append(coins, &models.Coin{Symbol: symbol, Quantity: quantity, UserID: userID, PortfolioID: id})
+			}
+		}
+	}
+	return coins, nil
+}
+
+func (m *memLedger) UpdateLedger(
+	userID, portfolioID uint,
+	symbol string,
+	change repository.LedgerChange,
+) (decimal.Decimal, decimal.Decimal, decimal.Decimal, error) {
+	res, err := m.UpdateLedgers(userID, portfolioID, map[string]repository.LedgerChange{symbol: change})
+	if err != nil {
+		return decimal.Zero, decimal.Zero, decimal.Zero, err
+	}
+	return res[symbol].Before, res[symbol].After, res[symbol].Elsewhere, nil
+}
+
+func (m *memLedger) UpdateLedgers(
+	userID, portfolioID uint,
+	changes map[string]repository.LedgerChange,
+) (map[string]repository.LedgerResult, error) {
+	results := make(map[string]repository.LedgerResult)
+	saved := make(map[string][]models.Transaction)
+
+	var failed []error
+	for _, symbol := range slices.Sorted(maps.Keys(changes)) {
+		var res repository.LedgerResult
+		for id, ledgers := range m.txs {
+			quantity, err := heldAfter(ledgers[symbol])
+			if err != nil {
+				return nil, err
+			}
+			if id == portfolioID {
+				res.Before = quantity
+			} else {
+				res.Elsewhere = res.Elsewhere.Add(quantity)
+			}
+		}
+
+		txs := m.txs[portfolioID][symbol]
+		add, remove, after, err := changes[symbol](txs, res.Before)
+		if err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		res.After = after
+
+		txs = slices.DeleteFunc(slices.Clone(txs), func(tx models.Transaction) bool {
+			return slices.Contains(remove, tx.ID)
+		})
+		txs = append(txs, add...)
+		slices.SortStableFunc(txs, func(a, b models.Transaction) int {
+			return a.ExecutedAt.Compare(b.ExecutedAt)
+		})
+		saved[symbol] = txs
+		results[symbol] = res
+	}
+	if len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+
+	if m.txs[portfolioID] == nil {
+		m.txs[portfolioID] = make(map[string][]models.Transaction)
+	}
+	maps.Copy(m.txs[portfolioID], saved)
+	return results, nil
+}
+
+func newTestLedger(t *testing.T) (*ledger, *memLedger) {
+	t.Helper()
+
+	catalog, err := NewCatalogService("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := newMemLedger()
+	return NewLedgerService(lr, lr, nil, catalog).(*ledger), lr
+}
+
+// row is the part of a read transaction the tests compare
+type row struct {
+	line     int
+	symbol   string
+	kind     models.TransactionType
+	quantity string
+	price    string
+	fee      string
+}
+
+func rowsOf(txs []models.Transaction) []row {
+	res := make([]row, 0, len(txs))
+	for _, tx := range txs {
+		res = append(res, row{tx.Row, tx.Symbol, tx.Type, tx.Quantity.String(), tx.Price.String(), tx.Fee.String()})
+	}
+	return res
+}
+
+func TestReadTransactions(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		dialect string
+		file    string
+		want    []row
+		errRows []int
+	}{
+		{
+			name:   "ledger",
+			format: FormatCSV,
+			file: "executed_at,symbol,type,quantity,price,fee\n" +
+				"2026-03-01T10:00:00Z,BTCUSDT,buy,0.5,100000,5\n" +
+				"2026-03-02T10:00:00Z,btcusdt,sell,0.25,110000,\n",
+			want: []row{
+				{2, "btcusdt", models.TxBuy, "0.5", "100000", "5"},
+				{3, "btcusdt", models.TxSell, "0.25", "110000", "0"},
+			},
+		},
+		{
+			name:   "ledger of quantities only",
+			format: FormatCSV,
+			file:   "symbol,quantity\nethusdt,2\n\nsolusdt,10\n",
+			want: []row{
+				{2, "ethusdt", models.TxTransferIn, "2", "0", "0"},
+				{4, "solusdt", models.TxTransferIn, "10", "0", "0"},
+			},
+		},
+		{
+			name:   "ledger with bad rows",
+			format: FormatCSV,
+			file: "symbol,quantity,price\n" +
+				"btcusdt,1,100\n" +
+				"btcusdt,one,100\n" +
+				"btcusdt,1,1e\n",
+			want:    []row{{2, "btcusdt", models.TxTransferIn, "1", "100", "0"}},
+			errRows: []int{3, 4},
+		},
+		{
+			name:   "binance",
+			format: FormatCSV,
+			file: "Date(UTC),Pair,Side,Price,Executed,Amount,Fee\n" +
+				"2026-03-01 10:00:00,BTCUSDT,BUY,100000,0.5BTC,50000USDT,0.0005BNB\n" +
+				"2026-03-01 11:00:00,ETHBTC,SELL,0.05,2ETH,0.1BTC,0.0001BTC\n" +
+				"2026-03-01 12:00:00,ETHUSDT,BUY,4000,1BTC,4000USDT,0USDT\n",
+			want: []row{
+				// A fee in another coin is paid with it
+				{2, "btcusdt", models.TxBuy, "0.5", "100000", "0"},
+				{2, "bnbusdt", models.TxFee, "0.0005", "0", "0"},
+				// A fee in the quote is part of the trade
+				{3, "ethbtc", models.TxSell, "2", "0.05", "0.0001"},
+			},
+			errRows: []int{4},
+		},
+		{
+			name:   "coinbase",
+			format: FormatCSV,
+			file: "Trade ID,Product,Side,Created At,Size,Size Unit,Price,Fee\n" +
+				"1,BTC-USDT,BUY,2026-03-01T10:00:00Z,0.5,BTC,100000,25\n" +
+				"2,ETH-USDT,SELL,2026-03-01T11:00:00Z,8000,USDT,4000,4\n" +
+				"3,ETH-USDT,SELL,2026-03-01T12:00:00Z,1,SOL,4000,4\n",
+			want: []row{
+				{2, "btcusdt", models.TxBuy, "0.5", "100000", "25"},
+				// The size in the quote is turned into coins
+				{3, "ethusdt", models.TxSell, "2", "4000", "4"},
+			},
+			errRows: []int{4},
+		},
+		{
+			name:    "dialect forced",
+			format:  FormatCSV,
+			dialect: DialectLedger,
+			file:    "symbol,quantity,pair,date(utc)\nbtcusdt,1,,\n",
+			want:    []row{{2, "btcusdt", models.TxTransferIn, "1", "0", "0"}},
+		},
+		{
+			name:   "json list",
+			format: FormatJSON,
+			file: `[{"symbol": " BTCUSDT ", "type": "buy", "quantity": "1", "price": "100"},
+				{"symbol": "ethusdt", "type": "transfer_in", "quantity": "2"}]`,
+			want: []row{
+				{1, "btcusdt", models.TxBuy, "1", "100", "0"},
+				{2, "ethusdt", models.TxTransferIn, "2", "0", "0"},
+			},
+		},
+		{
+			name:   "json export",
+			format: FormatJSON,
+			file:   `{"portfolio": {"name": "main"}, "transactions": [{"symbol": "btcusdt", "type": "sell", "quantity": "1"}]}`,
+			want:   []row{{1, "btcusdt", models.TxSell, "1", "0", "0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txs, rows, err := ReadTransactions(strings.NewReader(tt.file), tt.format, tt.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rowsOf(txs); !slices.Equal(got, tt.want) {
+				t.Fatalf("transactions = %+v, want %+v", got, tt.want)
+			}
+
+			var errRows []int
+			for _, r := range rows {
+				errRows = append(errRows, r.Row)
+			}
+			if !slices.Equal(errRows, tt.errRows) {
+				t.Fatalf("failed rows = %+v, want rows %v", rows, tt.errRows)
+			}
+		})
+	}
+}
+
+func TestReadTransactionsRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		dialect string
+		file    string
+	}{
+		{"unknown format", "xml", "", "<ledger/>"},
+		{"unknown dialect", FormatCSV, "kraken", "symbol,quantity\nbtcusdt,1\n"},
+		{"missing column", FormatCSV, DialectBinance, "Date(UTC),Pair,Side\n"},
+		{"no header", FormatCSV, "", ""},
+		{"broken json", FormatJSON, "", `[{"symbol": "btcusdt"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ReadTransactions(strings.NewReader(tt.file), tt.format, tt.dialect)
+			if !errors.Is(err, errs.ErrInvalidImport) {
+				t.Fatalf("err = %v, want %v", err, errs.ErrInvalidImport)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2026, 3, 1, 0, minute, 0, 0, time.UTC) }
+	buy := func(line int, symbol, quantity string, minute int) models.Transaction {
+		return models.Transaction{Row: line, Symbol: symbol, Type: models.TxBuy,
+			Quantity: dec(quantity), Price: dec("100"), ExecutedAt: at(minute)}
+	}
+	sell := func(line int, symbol, quantity string, minute int) models.Transaction {
+		tx := buy(line, symbol, quantity, minute)
+		tx.Type = models.TxSell
+		return tx
+	}
+
+	tests := []struct {
+		name    string
+		txs     []models.Transaction
+		errRows []int
+	}{
+		{
+			name:    "invalid rows",
+			txs:     []models.Transaction{buy(2, "btcusdt", "1", 0), buy(3, "xyzusdt", "1", 1), buy(4, "ethusdt", "-1", 2)},
+			errRows: []int{3, 4},
+		},
+		{
+			// ethusdt alone would apply, nothing is saved anyway
+			name:    "oversold",
+			txs:     []models.Transaction{buy(2, "ethusdt", "1", 0), buy(3, "btcusdt", "1", 0), sell(4, "btcusdt", "2", 1)},
+			errRows: []int{4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, lr := newTestLedger(t)
+
+			res, rows, err := l.Import(1, 1, tt.txs)
+			if !errors.Is(err, errs.ErrInvalidImport) || res != nil {
+				t.Fatalf("err = %v, result = %+v, want %v", err, res, errs.ErrInvalidImport)
+			}
+			var errRows []int
+			for _, r := range rows {
+				errRows = append(errRows, r.Row)
+			}
+			if !slices.Equal(errRows, tt.errRows) {
+				t.Fatalf("failed rows = %+v, want rows %v", rows, tt.errRows)
+			}
+			if len(lr.txs[1]) != 0 {
+				t.Fatalf("ledgers = %+v, want nothing saved", lr.txs)
+			}
+		})
+	}
+
+	t.Run("applied", func(t *testing.T) {
+		l, lr := newTestLedger(t)
+		lr.txs[1] = map[string][]models.Transaction{"btcusdt": {buy(0, "btcusdt", "1", 0)}}
+
+		// The sale spends coins already in the ledger
+		res, rows, err := l.Import(1, 1, []models.Transaction{
+			buy(2, "ethusdt", "3", 1),
+			sell(3, "btcusdt", "1.5", 3),
+			buy(4, "btcusdt", "1", 2),
+		})
+		if err != nil {
+			t.Fatalf("err = %v, rows = %+v", err, rows)
+		}
+		if res.Imported != 3 || !slices.Equal(res.Symbols, []string{"btcusdt", "ethusdt"}) ||
+			!slices.Equal(res.Opened, []string{"ethusdt"}) {
+			t.Fatalf("result = %+v, want 3 imported and ethusdt opened", res)
+		}
+		if len(lr.txs[1]["btcusdt"]) != 3 || len(lr.txs[1]["ethusdt"]) != 1 {
+			t.Fatalf("ledgers = %+v, want every row saved", lr.txs)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		l, _ := newTestLedger(t)
+		if _, _, err := l.Import(1, 1, nil); !errors.Is(err, errs.ErrInvalidImport) {
+			t.Fatalf("err = %v, want %v", err, errs.ErrInvalidImport)
+		}
+	})
+}
+
+func TestExportImportsBack(t *testing.T) {
+	txs := []models.Transaction{
+		{Symbol: "btcusdt", Type: models.TxBuy, Quantity: dec("0.5"), Price: dec("100000"), Fee: dec("5"),
+			ExecutedAt: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{Symbol: "bnbusdt", Type: models.TxFee, Quantity: dec("0.01"),
+			ExecutedAt: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	portfolio := &models.Portfolio{Name: "main"}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteTransactions(&buf, format, portfolio, txs); err != nil {
+				t.Fatal(err)
+			}
+			read, rows, err := ReadTransactions(&buf, format, "")
+			if err != nil || len(rows) > 0 {
+				t.Fatalf("err = %v, rows = %+v", err, rows)
+			}
+
+			if len(read) != len(txs) {
+				t.Fatalf("read %d transactions, want %d", len(read), len(txs))
+			}
+			for i, tx := range read {
+				want := txs[i]
+				if tx.Symbol != want.Symbol || tx.Type != want.Type || !tx.Quantity.Equal(want.Quantity) ||
+					!tx.Price.Equal(want.Price) || !tx.Fee.Equal(want.Fee) || !tx.ExecutedAt.Equal(want.ExecutedAt) {
+					t.Fatalf("transaction %d = %+v, want %+v", i, tx, want)
+				}
+			}
+		})
+	}
+}
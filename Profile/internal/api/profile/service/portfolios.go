@@ -0,0 +1,85 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+)
+
+type PortfoliosService interface {
+	GetPortfolios(userID float64) ([]models.Portfolio, error)
+	GetPortfolio(userID float64, id uint) (*models.Portfolio, error)
+	// DefaultPortfolio gets coins and transactions sent without a portfolio
+	DefaultPortfolio(userID float64) (*models.Portfolio, error)
+	CreatePortfolio(userID float64, name string) (*models.Portfolio, error)
+	RenamePortfolio(userID float64, id uint, name string) error
+	// DeletePortfolio returns symbols the user holds in no other portfolio
+	DeletePortfolio(userID float64, id uint) ([]string, error)
+}
+
+type portfolios struct {
+	pr repository.PortfoliosRepository
+	cr repository.CoinsRepository
+}
+
+func NewPortfoliosService(
+	pr repository.PortfoliosRepository,
+	cr repository.CoinsRepository,
+) PortfoliosService {
+	return &portfolios{pr: pr, cr: cr}
+}
+
+func (p *portfolios) GetPortfolios(userID float64) ([]models.Portfolio, error) {
+	return p.pr.GetPortfolios(uint(userID))
+}
+
+func (p *portfolios) GetPortfolio(userID float64, id uint) (*models.Portfolio, error) {
+	return p.pr.GetPortfolio(uint(userID), id)
+}
+
+func (p *portfolios) DefaultPortfolio(userID float64) (*models.Portfolio, error) {
+	return p.pr.DefaultPortfolio(uint(userID))
+}
+
+func (p *portfolios) CreatePortfolio(userID float64, name string) (*models.Portfolio, error) {
+	portfolio := models.Portfolio{UserID: uint(userID), Name: name}
+	if err := p.pr.CreatePortfolio(&portfolio); err != nil {
+		return nil, err
+	}
+
+	return &portfolio, nil
+}
+
+func (p *portfolios) RenamePortfolio(userID float64, id uint, name string) error {
+	return p.pr.RenamePortfolio(uint(userID), id, name)
+}
+
+func (p *portfolios) DeletePortfolio(userID float64, id uint) ([]string, error) {
+	coins, err := p.cr.GetCoins(uint(userID), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.pr.DeletePortfolio(uint(userID), id); err != nil {
+		return nil, err
+	}
+
+	left, err := p.cr.GetCoins(uint(userID), 0)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]struct{}, len(left))
+	for _, coin := range left {
+		held[strings.ToLower(coin.Symbol)] = struct{}{}
+	}
+
+	var closed []string
+	for _, coin := range coins {
+		symbol := strings.ToLower(coin.Symbol)
+		if _, ok := held[symbol]; !ok {
+			closed = append(closed, symbol)
+		}
+	}
+	return closed, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+)
+
+// memPortfolios keeps portfolios of one user, deleting one drops its ledgers
+type memPortfolios struct {
+	repository.PortfoliosRepository
+	lr         *memLedger
+	portfolios []models.Portfolio
+}
+
+func (m *memPortfolios) CreatePortfolio(portfolio *models.Portfolio) error {
+	for _, p := range m.portfolios {
+		if p.Name == portfolio.Name {
+			return fmt.Errorf("%w: %q", errs.ErrPortfolioExists, portfolio.Name)
+		}
+	}
+	portfolio.ID = uint(len(m.portfolios) + 1)
+	m.portfolios = append(m.portfolios, *portfolio)
+	return nil
+}
+
+func (m *memPortfolios) DeletePortfolio(userID, id uint) error {
+	i := slices.IndexFunc(m.portfolios, func(p models.Portfolio) bool { return p.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%w: portfolio %d", errs.ErrRecordingWNF, id)
+	}
+	m.portfolios = slices.Delete(m.portfolios, i, i+1)
+	delete(m.lr.txs, id)
+	return nil
+}
+
+func request(kind models.TransactionType, symbol, quantity string) models.TransactionRequest {
+	return models.TransactionRequest{Symbol: symbol, Type: kind, Quantity: dec(quantity), Price: dec("100")}
+}
+
+func TestCreatePortfolio(t *testing.T) {
+	ps := NewPortfoliosService(&memPortfolios{lr: newMemLedger()}, nil)
+
+	p, err := ps.CreatePortfolio(7, "long term")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID == 0 || p.UserID != 7 || p.Name != "long term" {
+		t.Fatalf("portfolio = %+v, want long term of user 7", p)
+	}
+	if _, err := ps.CreatePortfolio(7, "long term"); !errors.Is(err, errs.ErrPortfolioExists) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrPortfolioExists)
+	}
+}
+
+func TestDeletePortfolio(t *testing.T) {
+	l, lr := newTestLedger(t)
+	pr := &memPortfolios{lr: lr}
+	ps := NewPortfoliosService(pr, lr)
+	for _, name := range []string{"main", "trading"} {
+		if _, err := ps.CreatePortfolio(1, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, buy := range []struct {
+		portfolioID uint
+		symbol      string
+	}{{1, "btcusdt"}, {1, "ethusdt"}, {2, "btcusdt"}} {
+		if _, err := l.Record(1, buy.portfolioID, request(models.TxBuy, buy.symbol, "1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// btcusdt is still held in the other portfolio
+	closed, err := ps.DeletePortfolio(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(closed, []string{"ethusdt"}) {
+		t.Fatalf("closed = %v, want ethusdt", closed)
+	}
+	if txs, _ := lr.GetTransactions(1, 0, ""); len(txs) != 1 || txs[0].PortfolioID != 2 {
+		t.Fatalf("transactions = %+v, want the one of portfolio 2", txs)
+	}
+
+	if _, err := ps.DeletePortfolio(1, 1); !errors.Is(err, errs.ErrRecordingWNF) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrRecordingWNF)
+	}
+}
+
+func TestLedgerScopedToPortfolio(t *testing.T) {
+	l, lr := newTestLedger(t)
+	_, coins := NewProfileService(nil, lr, lr, l.catalog)
+
+	update, err := l.Record(1, 1, request(models.TxBuy, "btcusdt", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.Opened() {
+		t.Fatalf("update = %+v, want btcusdt opened", update)
+	}
+
+	// Coins of another portfolio can not be spent
+	if _, err := l.Record(1, 2, request(models.TxSell, "btcusdt", "0.5")); !errors.Is(err, errs.ErrOversold) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrOversold)
+	}
+
+	update, err = coins.AddCoin(1, 2, "btcusdt", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Opened() || !update.Elsewhere.Equal(dec("1")) || !update.After.Equal(dec("2")) {
+		t.Fatalf("update = %+v, want 2 more next to 1 held elsewhere", update)
+	}
+
+	holdings, err := l.Holdings(1, 0, FIFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !holdings["btcusdt"].Quantity.Equal(dec("3")) || !holdings["btcusdt"].CostBasis.Equal(dec("100")) {
+		t.Fatalf("holdings = %+v, want 3 coins that cost 100", holdings)
+	}
+	if holdings, _ = l.Holdings(1, 2, FIFO); !holdings["btcusdt"].Quantity.Equal(dec("2")) {
+		t.Fatalf("holdings of portfolio 2 = %+v, want 2 coins", holdings)
+	}
+
+	// Removing coins of a portfolio leaves the other one alone
+	update, err = coins.DeleteCoin(1, 1, "btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Closed() || !update.After.IsZero() {
+		t.Fatalf("update = %+v, want btcusdt removed but still held", update)
+	}
+	left, err := coins.GetCoins(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].PortfolioID != 2 || !left[0].Quantity.Equal(dec("2")) {
+		t.Fatalf("coins = %+v, want 2 btcusdt of portfolio 2", left)
+	}
+}
@@ -5,13 +5,17 @@ import "github.com/Wladim1r/profile/internal/api/profile/repository"
 type service struct {
 	ur repository.UsersRepository
 	cr repository.CoinsRepository
+	lr repository.LedgerRepository
+	cl CatalogService
 }
 
 func NewProfileService(
 	ur repository.UsersRepository,
 	cr repository.CoinsRepository,
+	lr repository.LedgerRepository,
+	cl CatalogService,
 ) (UsersService, CoinsService) {
-	s := &service{ur: ur, cr: cr}
+	s := &service{ur: ur, cr: cr, lr: lr, cl: cl}
 
 	return s, s
 }
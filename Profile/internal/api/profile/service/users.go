@@ -3,15 +3,31 @@ package service
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/errs"
+	"github.com/Wladim1r/profile/lib/getenv"
 )
 
+// Reporting currency of users who did not choose one
+var DefaultCurrency = getenv.GetString("DEFAULT_QUOTE", "usdt")
+
 type UsersService interface {
 	CreateUserProfile(userID string, name string) error
 	GetUserProfileByUserID(userID float64) (*models.User, error)
 	DeleteUserProfileByUserID(userID float64) error
 	CheckUserProfileExists(userID int) (bool, error)
+	// SetCurrency chooses the reporting currency, any asset prices can be converted into
+	SetCurrency(userID float64, currency string) (string, error)
+}
+
+// Currency returns the reporting currency of user
+func Currency(user *models.User) string {
+	if user.Currency != "" {
+		return user.Currency
+	}
+	return DefaultCurrency
 }
 
 func (r *service) CreateUserProfile(userIDstr string, name string) error {
@@ -39,3 +55,12 @@ func (r *service) DeleteUserProfileByUserID(userID float64) error {
 func (r *service) CheckUserProfileExists(userID int) (bool, error) {
 	return r.ur.CheckUserProfileExists(uint(userID))
 }
+
+func (r *service) SetCurrency(userID float64, currency string) (string, error) {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if !r.cl.KnownAsset(currency) {
+		return "", fmt.Errorf("%w: %q", errs.ErrUnknownAsset, currency)
+	}
+
+	return currency, r.ur.SetCurrency(uint(userID), currency)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/rates"
+	"github.com/shopspring/decimal"
+)
+
+// PriceSource gives the latest known prices of symbols
+type PriceSource interface {
+	LastPrices(ctx context.Context, symbols []string) (map[string]models.LastPrice, error)
+}
+
+type ValuationService interface {
+	Valuate(ctx context.Context, userID float64, portfolioID uint, quote string) (*models.Valuation, error)
+}
+
+type valuation struct {
+	ur      repository.UsersRepository
+	prices  PriceSource
+	catalog CatalogService
+}
+
+func NewValuationService(
+	ur repository.UsersRepository,
+	prices PriceSource,
+	catalog CatalogService,
+) ValuationService {
+	return &valuation{ur: ur, prices: prices, catalog: catalog}
+}
+
+// Valuate prices coins of a portfolio in quote, of all portfolios when
+// portfolioID is 0, and in the reporting currency of the user when quote is
+// empty. Coins are valued as their base asset, converted through the pairs
+// linking it to the quote
+func (v *valuation) Valuate(
+	ctx context.Context,
+	userID float64,
+	portfolioID uint,
+	quote string,
+) (*models.Valuation, error) {
+	user, err := v.ur.GetUserProfileByUserID(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if quote == "" {
+		quote = Currency(user)
+	}
+	coins := MergeCoins(user.Coins, portfolioID)
+
+	symbols := make([]string, 0, len(coins))
+	for _, coin := range coins {
+		symbols = append(symbols, coin.Symbol)
+	}
+	symbols = append(symbols, rates.ValueLinks(v.catalog, symbols, quote)...)
+	slices.Sort(symbols)
+
+	prices, err := v.prices.LastPrices(ctx, slices.Compact(symbols))
+	if err != nil {
+		return nil, err
+	}
+	graph := RateGraph(v.catalog, prices)
+
+	val := &models.Valuation{
+		UserID:      user.ID,
+		Name:        user.Name,
+		PortfolioID: portfolioID,
+		Quote:       quote,
+		Total:       decimal.Zero,
+		Coins:       make([]models.CoinValuation, 0, len(coins)),
+		Assets:      make([]models.AssetValuation, 0, len(coins)),
+	}
+	assets := make(map[string]int, len(coins))
+	for _, coin := range coins {
+		symbol := coin.Symbol
+		cv := models.CoinValuation{Symbol: symbol, Quantity: coin.Quantity}
+
+		last, ok := prices[symbol]
+		if ok {
+			pricedAt := last.Time
+			cv.PricedAt = &pricedAt
+			cv.Stale = last.Stale
+			if last.HasDaily {
+				change := decimal.NewFromFloat(last.ChangePct)
+				cv.Change24h = &change
+				cv.Change24hStale = last.DailyStale
+			}
+		}
+
+		base, _, known := v.catalog.Assets(symbol)
+		if !known {
+			base = symbol
+		}
+		i, seen := assets[base]
+		if !seen {
+			i = len(val.Assets)
+			assets[base] = i
+			val.Assets = append(val.Assets, models.AssetValuation{Asset: base})
+		}
+		asset := &val.Assets[i]
+		asset.Quantity = asset.Quantity.Add(coin.Quantity)
+
+		// Another pair of the asset prices it when this one has no price
+		price, total, ok := graph.Value(v.catalog, symbol, coin.Quantity, quote)
+		if !ok {
+			val.Missing = append(val.Missing, symbol)
+			val.Coins = append(val.Coins, cv)
+			continue
+		}
+
+		cv.Price = &price
+		cv.Total = &total
+		val.Total = val.Total.Add(total)
+		val.Coins = append(val.Coins, cv)
+
+		assetTotal := total
+		if asset.Total != nil {
+			assetTotal = asset.Total.Add(total)
+		}
+		asset.Price, asset.Total = &price, &assetTotal
+	}
+	slices.SortFunc(val.Assets, func(a, b models.AssetValuation) int {
+		return strings.Compare(a.Asset, b.Asset)
+	})
+	return val, nil
+}
+
+// RateGraph links assets by the last prices of pairs
+func RateGraph(catalog CatalogService, prices map[string]models.LastPrice) *rates.Graph {
+	byPair := make(map[string]decimal.Decimal, len(prices))
+	for symbol, last := range prices {
+		byPair[symbol] = decimal.NewFromFloat(last.Price)
+	}
+	return rates.FromPrices(catalog, byPair)
+}
+
+// MergeCoins keeps coins of a portfolio, or of all when portfolioID is 0, with
+// one coin per symbol
+func MergeCoins(coins []models.Coin, portfolioID uint) []models.Coin {
+	merged := make([]models.Coin, 0, len(coins))
+	index := make(map[string]int, len(coins))
+	for _, coin := range coins {
+		if portfolioID != 0 && coin.PortfolioID != portfolioID {
+			continue
+		}
+
+		coin.Symbol = strings.ToLower(coin.Symbol)
+		if i, ok := index[coin.Symbol]; ok {
+			merged[i].Quantity = merged[i].Quantity.Add(coin.Quantity)
+			continue
+		}
+		index[coin.Symbol] = len(merged)
+		merged = append(merged, coin)
+	}
+	return merged
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Wladim1r/profile/internal/api/profile/repository"
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+type fakeUsers struct {
+	repository.UsersRepository
+	user models.User
+}
+
+func (f *fakeUsers) GetUserProfileByUserID(userID uint) (*models.User, error) {
+	user := f.user
+	return &user, nil
+}
+
+func coin(portfolioID uint, symbol, quantity string) models.Coin {
+	return models.Coin{PortfolioID: portfolioID, Symbol: symbol, Quantity: dec(quantity)}
+}
+
+func TestMergeCoins(t *testing.T) {
+	coins := []models.Coin{
+		coin(1, "btcusdt", "1"),
+		coin(2, "ethusdt", "3"),
+		coin(2, "BTCUSDT", "0.5"),
+		// Added twice before the ledger was kept
+		coin(1, "btcusdt", "0.25"),
+	}
+
+	tests := []struct {
+		name        string
+		portfolioID uint
+		want        []string
+	}{
+		{"all portfolios", 0, []string{"btcusdt 1.75", "ethusdt 3"}},
+		{"one portfolio", 1, []string{"btcusdt 1.25"}},
+		{"another portfolio", 2, []string{"ethusdt 3", "btcusdt 0.5"}},
+		{"unknown portfolio", 3, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, c := range MergeCoins(coins, tt.portfolioID) {
+				got = append(got, c.Symbol+" "+c.Quantity.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("coins = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if coins[2].Symbol != "BTCUSDT" || !coins[0].Quantity.Equal(dec("1")) {
+		t.Fatalf("coins = %+v, merged in place", coins)
+	}
+}
+
+func TestValuate(t *testing.T) {
+	catalog, err := NewCatalogService("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUsers{user: models.User{ID: 7, Name: "satoshi", Currency: "eur", Coins: []models.Coin{
+		coin(1, "btcusdt", "1"),
+		coin(1, "solusdt", "10"),
+		coin(2, "BTCUSDT", "0.5"),
+		coin(2, "ethbtc", "2"),
+		// Held before the catalog listed its symbols
+		coin(2, "wifusdt", "100"),
+	}}}
+	prices := fakePrices{"btcusdt": 100000, "ethusdt": 4000, "ethbtc": 0.04, "btceur": 80000}
+	vs := NewValuationService(users, prices, catalog)
+
+	val, err := vs.Valuate(context.Background(), 7, 0, "usdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]string)
+	for _, cv := range val.Coins {
+		if cv.Total != nil {
+			totals[cv.Symbol] = cv.Total.String()
+		}
+	}
+	// Portfolios are merged, ethbtc is valued as eth through ethusdt
+	want := map[string]string{"btcusdt": "150000", "ethbtc": "8000"}
+	if len(val.Coins) != 4 || len(totals) != len(want) || totals["btcusdt"] != want["btcusdt"] ||
+		totals["ethbtc"] != want["ethbtc"] {
+		t.Fatalf("coins = %+v, want totals %v", val.Coins, want)
+	}
+	if !val.Total.Equal(dec("158000")) {
+		t.Fatalf("total = %s, want 158000 without unpriced coins", val.Total)
+	}
+	// Unpriced coins are listed with their quantity
+	if !slices.Equal(val.Missing, []string{"solusdt", "wifusdt"}) {
+		t.Fatalf("missing = %v, want solusdt and wifusdt", val.Missing)
+	}
+
+	var assets []string
+	for _, a := range val.Assets {
+		asset := a.Asset + " " + a.Quantity.String()
+		if a.Total != nil {
+			asset += " " + a.Total.String()
+		}
+		assets = append(assets, asset)
+	}
+	if want := []string{"btc 1.5 150000", "eth 2 8000", "sol 10", "wifusdt 100"}; !slices.Equal(assets, want) {
+		t.Fatalf("assets = %v, want %v", assets, want)
+	}
+
+	// One portfolio in the currency of the user
+	val, err = vs.Valuate(context.Background(), 7, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.Quote != "eur" || val.PortfolioID != 1 || len(val.Coins) != 2 || !val.Total.Equal(dec("80000")) {
+		t.Fatalf("valuation = %+v, want 80000 eur of portfolio 1", val)
+	}
+	if price := val.Coins[0].Price; price == nil || !price.Equal(decimal.NewFromInt(80000)) {
+		t.Fatalf("price of btcusdt = %v, want 80000 eur", price)
+	}
+}
@@ -2,6 +2,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -9,6 +11,12 @@ type User struct {
 	ID    uint   `gorm:"primaryKey"`
 	Name  string `gorm:"unique;not null"`
 	Coins []Coin `gorm:"foreignKey:UserID"`
+	// Reporting currency of valuations, the default one when empty
+	Currency string `gorm:"not null;default:''"`
+}
+
+type CurrencyRequest struct {
+	Currency string `json:"currency" binding:"required"`
 }
 
 type Coin struct {
@@ -16,20 +24,55 @@ type Coin struct {
 	Symbol   string          `gorm:"not null;"`
 	Quantity decimal.Decimal `gorm:"type:decimal(20,8);not null"`
 
-	UserID uint
-	User   User `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID      uint
+	User        User `gorm:"constraint:OnDelete:CASCADE;"`
+	PortfolioID uint `gorm:"not null;default:0;index"`
+}
+
+// Portfolio is a named book of coins, a user has one or more. Coins and
+// transactions from before portfolios belong to the oldest one of their user
+type Portfolio struct {
+	ID        uint      `gorm:"primaryKey"                                   json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_portfolio_user_name" json:"-"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_portfolio_user_name" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Coins are removed with the portfolio by hand, they may predate it
+	Coins []Coin `gorm:"foreignKey:PortfolioID;constraint:-" json:"coins"`
+
+	User User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+type PortfolioRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
 }
 
 type Profile struct {
-	ID    uint
-	Name  string
-	Coins CoinsProfile
+	ID          uint
+	Name        string
+	PortfolioID uint `json:",omitempty"` // missing when all portfolios are watched
+	Coins       CoinsProfile
 }
 
 type CoinsProfile struct {
 	Quantities map[string]decimal.Decimal
 	Prices     map[string]decimal.Decimal
 	Totals     map[string]decimal.Decimal
+	Stale      map[string]bool            `json:",omitempty"` // symbols whose price stopped updating
+	Changes    map[string]decimal.Decimal `json:",omitempty"` // price change over 24h, in percent
+	// Symbols whose 24h change stopped updating
+	StaleChanges map[string]bool            `json:",omitempty"`
+	Realized     map[string]decimal.Decimal `json:",omitempty"` // profit of sold coins
+	Unrealized   map[string]decimal.Decimal `json:",omitempty"` // profit of held coins at the current price
+	// Totals, profits and assets are in the reporting currency, prices in the quote of their symbol
+	Currency string
+	Total    decimal.Decimal
+	Assets   map[string]AssetProfile `json:",omitempty"` // coins by asset, pairs of one base together
+	Unpriced []string                `json:",omitempty"` // symbols without a rate to the currency
+}
+
+type AssetProfile struct {
+	Quantity decimal.Decimal
+	Value    decimal.Decimal
 }
 
 type UserRequest struct {
@@ -42,10 +85,17 @@ type CoinRequest struct {
 	Quantity float32 `json:"quantity" binding:"required"`
 }
 
+// DeliveryRequest sets how often the user gets prices and how far they must move
+type DeliveryRequest struct {
+	IntervalMs   int64 `json:"interval_ms"   binding:"min=0"`
+	ThresholdBps int   `json:"threshold_bps" binding:"min=0,max=10000"`
+}
+
 type SecondStat struct {
 	UserID uint    `json:"user_id"`
 	Symbol string  `json:"s"`
 	Price  float64 `json:"p"`
+	Stale  bool    `json:"stale"`
 }
 
 // type MarketTicker struct {
@@ -61,3 +111,220 @@ type SecondStat struct {
 // 	ChangePrice   decimal.Decimal `db:"change_price"`
 // 	ChangePercent decimal.Decimal `db:"change_percent"`
 // }
+
+// LastPrice is the latest known price of a symbol, kept by the Aggregator
+type LastPrice struct {
+	Price float64
+	Time  time.Time
+	Stale bool
+	// 24h stats come from another stream, they may be missing
+	HasDaily  bool
+	ChangePct float64
+	// The ticker stream is silent, ChangePct stopped updating
+	DailyStale bool
+}
+
+// Valuation is the portfolio of a user at the latest known prices, in one quote currency
+type Valuation struct {
+	UserID      uint             `json:"user_id"`
+	Name        string           `json:"name"`
+	PortfolioID uint             `json:"portfolio_id,omitempty"` // missing for all portfolios together
+	Quote       string           `json:"quote"`
+	Total       decimal.Decimal  `json:"total"`
+	Coins       []CoinValuation  `json:"coins"`
+	Assets      []AssetValuation `json:"assets"` // coins by asset, pairs of one base together
+	// Coins whose asset has no rate to the quote are not in the total
+	Missing []string `json:"missing,omitempty"`
+}
+
+type AssetValuation struct {
+	Asset    string           `json:"asset"`
+	Quantity decimal.Decimal  `json:"quantity"`
+	Price    *decimal.Decimal `json:"price,omitempty"` // in the quote of the valuation
+	Total    *decimal.Decimal `json:"total,omitempty"`
+}
+
+type CoinValuation struct {
+	Symbol    string           `json:"symbol"`
+	Quantity  decimal.Decimal  `json:"quantity"`
+	Price     *decimal.Decimal `json:"price,omitempty"`      // in the quote of the valuation
+	Total     *decimal.Decimal `json:"total,omitempty"`      // quantity times price
+	Change24h *decimal.Decimal `json:"change_24h,omitempty"` // in percent
+	// The 24h change stopped updating
+	Change24hStale bool       `json:"change_24h_stale,omitempty"`
+	PricedAt       *time.Time `json:"priced_at,omitempty"` // when the price was last updated
+	Stale          bool       `json:"stale,omitempty"`
+}
+
+// PortfolioSnapshot is the value of a portfolio at one moment, they are taken
+// periodically in one quote currency. Snapshots from before portfolios have
+// PortfolioID 0 and cover all coins of the user
+type PortfolioSnapshot struct {
+	ID          uint            `gorm:"primaryKey"`
+	UserID      uint            `gorm:"not null;uniqueIndex:idx_snapshot_portfolio_time"`
+	PortfolioID uint            `gorm:"not null;default:0;uniqueIndex:idx_snapshot_portfolio_time"`
+	TakenAt     time.Time       `gorm:"not null;uniqueIndex:idx_snapshot_portfolio_time"`
+	Quote       string          `gorm:"not null"`
+	Total       decimal.Decimal `gorm:"type:decimal(30,8);not null"`
+	Coins       []SnapshotCoin  `gorm:"foreignKey:SnapshotID"`
+	// Some held coin had no price, the total is too low
+	Incomplete bool `gorm:"not null;default:false"`
+
+	User User `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+type SnapshotCoin struct {
+	ID         uint            `gorm:"primaryKey"`
+	SnapshotID uint            `gorm:"not null;index"`
+	Symbol     string          `gorm:"not null"`
+	Quantity   decimal.Decimal `gorm:"type:decimal(20,8);not null"`
+	Price      decimal.Decimal `gorm:"type:decimal(30,8);not null"`
+	Value      decimal.Decimal `gorm:"type:decimal(30,8);not null"`
+
+	Snapshot PortfolioSnapshot `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// SnapshotRate is what one Asset was worth in the quote of the snapshots
+// taken at TakenAt, history is converted at the rates of its time
+type SnapshotRate struct {
+	ID      uint            `gorm:"primaryKey"`
+	TakenAt time.Time       `gorm:"not null;uniqueIndex:idx_snapshot_rate_time"`
+	Asset   string          `gorm:"not null;uniqueIndex:idx_snapshot_rate_time"`
+	Rate    decimal.Decimal `gorm:"type:decimal(40,20);not null"`
+}
+
+// History is the value of a portfolio over time, one point per interval. Each
+// point is converted into Quote at the rate of its time, points without one are left out
+type History struct {
+	PortfolioID uint           `json:"portfolio_id"`
+	Quote       string         `json:"quote"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Interval    string         `json:"interval"`
+	Points      []HistoryPoint `json:"points"`
+	PnL         *PnL           `json:"pnl,omitempty"`
+	CoinsPnL    map[string]PnL `json:"coins_pnl,omitempty"`
+	// Symbols whose transactions could not be converted, their flows are left out
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+type HistoryPoint struct {
+	Time  time.Time                  `json:"time"`
+	Total decimal.Decimal            `json:"total"`
+	Coins map[string]decimal.Decimal `json:"coins"`
+	// Some coin had no price, the point is not counted in profits
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// PnL is the change of value between the first and the last complete point
+// less the net flows, coins bought or transferred in between are not a profit
+type PnL struct {
+	Start decimal.Decimal `json:"start"`
+	End   decimal.Decimal `json:"end"`
+	// Bought and transferred in less sold and transferred out
+	Flows    decimal.Decimal  `json:"net_flows"`
+	Absolute decimal.Decimal  `json:"absolute"`
+	Percent  *decimal.Decimal `json:"percent,omitempty"` // missing when nothing was invested
+}
+
+type TransactionType string
+
+const (
+	TxBuy         TransactionType = "buy"
+	TxSell        TransactionType = "sell"
+	TxTransferIn  TransactionType = "transfer_in"
+	TxTransferOut TransactionType = "transfer_out"
+	TxFee         TransactionType = "fee" // coins paid as a fee, e.g. trading fees taken in BNB
+)
+
+// Transaction is one entry of the ledger of a user, coins and their cost are
+// derived from the ledger. Prices and fees are in the quote of the symbol
+type Transaction struct {
+	ID          uint            `gorm:"primaryKey"                                  json:"id"`
+	UserID      uint            `gorm:"not null;index:idx_transaction_user_symbol"  json:"-"`
+	PortfolioID uint            `gorm:"not null;default:0;index"                    json:"portfolio_id"`
+	Symbol      string          `gorm:"not null;index:idx_transaction_user_symbol"  json:"symbol"`
+	Type        TransactionType `gorm:"not null"                                    json:"type"`
+	Quantity    decimal.Decimal `gorm:"type:decimal(20,8);not null"                 json:"quantity"`
+	Price       decimal.Decimal `gorm:"type:decimal(30,8);not null"                 json:"price"`
+	Fee         decimal.Decimal `gorm:"type:decimal(30,8);not null;default:0"       json:"fee"`
+	ExecutedAt  time.Time       `gorm:"not null"                                    json:"executed_at"`
+
+	User User `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	// Row of an imported file, it is not stored
+	Row int `gorm:"-" json:"-"`
+}
+
+type TransactionRequest struct {
+	Symbol     string          `json:"symbol"      binding:"required"`
+	Type       TransactionType `json:"type"        binding:"required,oneof=buy sell transfer_in transfer_out fee"`
+	Quantity   decimal.Decimal `json:"quantity"`
+	Price      decimal.Decimal `json:"price"`
+	Fee        decimal.Decimal `json:"fee"`
+	ExecutedAt *time.Time      `json:"executed_at"` // now when missing
+}
+
+// RowError is a row of an imported file that can not be applied, row 0 is a
+// transaction already in the ledger that the import would break
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Imported int      `json:"imported"`
+	Symbols  []string `json:"symbols"`
+	Opened   []string `json:"opened,omitempty"` // coins the user did not hold before
+}
+
+// Position is a coin held by a user with its cost, derived from the ledger by
+// one cost method. Amounts are in the quote of the symbol
+type Position struct {
+	Symbol    string           `json:"symbol"`
+	Asset     string           `json:"asset,omitempty"`
+	Quote     string           `json:"quote,omitempty"`
+	Quantity  decimal.Decimal  `json:"quantity"`
+	CostBasis decimal.Decimal  `json:"cost_basis"`         // what the held coins cost, fees included
+	AvgCost   *decimal.Decimal `json:"avg_cost,omitempty"` // missing when nothing is held
+	Realized  decimal.Decimal  `json:"realized_pnl"`
+	Fees      decimal.Decimal  `json:"fees"`
+	// Missing when the symbol has no cached price
+	Price      *decimal.Decimal `json:"price,omitempty"`
+	Value      *decimal.Decimal `json:"value,omitempty"`
+	Unrealized *decimal.Decimal `json:"unrealized_pnl,omitempty"`
+	Stale      bool             `json:"stale,omitempty"`
+	// One quote in the currency of the positions, missing when there is no rate
+	Rate *decimal.Decimal `json:"rate,omitempty"`
+}
+
+type Positions struct {
+	PortfolioID uint       `json:"portfolio_id,omitempty"` // missing for all portfolios together
+	Method      string     `json:"method"`
+	Positions   []Position `json:"positions"`
+	// Sums of positions converted into the currency at current rates, positions
+	// without a rate are left out and listed in Missing
+	Currency   string          `json:"currency"`
+	Value      decimal.Decimal `json:"value"`
+	CostBasis  decimal.Decimal `json:"cost_basis"`
+	Realized   decimal.Decimal `json:"realized_pnl"`
+	Unrealized decimal.Decimal `json:"unrealized_pnl"`
+	Missing    []string        `json:"missing,omitempty"`
+}
+
+// SymbolTrading is the status of symbols with live markets
+const SymbolTrading = "TRADING"
+
+// Symbol is a market of the symbol catalog, as listed by the exchange
+type Symbol struct {
+	Symbol   string          `json:"symbol"`
+	Base     string          `json:"base"`
+	Quote    string          `json:"quote"`
+	Status   string          `json:"status"`
+	TickSize decimal.Decimal `json:"tick_size"` // price step
+	LotSize  decimal.Decimal `json:"lot_size"`  // quantity step
+	MinQty   decimal.Decimal `json:"min_qty"`
+}
+
+func (s Symbol) Trading() bool {
+	return s.Status == SymbolTrading
+}
@@ -4,12 +4,20 @@ package errs
 import "errors"
 
 var (
-	ErrDB              = errors.New("database error")
-	ErrRecordingWNC    = errors.New("recording wasn't created")
-	ErrRecordingWND    = errors.New("recording wasn't deleted")
-	ErrRecordingWNF    = errors.New("recording wasn't found")
-	ErrTokenTTL        = errors.New("token's ttl is over")
-	ErrSignToken       = errors.New("failed to sign token")
-	ErrEmptyAuthHeader = errors.New("authorization header is required")
-	ErrInvalidToken    = errors.New("token is not valid")
+	ErrDB               = errors.New("database error")
+	ErrRecordingWNC     = errors.New("recording wasn't created")
+	ErrRecordingWND     = errors.New("recording wasn't deleted")
+	ErrRecordingWNF     = errors.New("recording wasn't found")
+	ErrTokenTTL         = errors.New("token's ttl is over")
+	ErrSignToken        = errors.New("failed to sign token")
+	ErrEmptyAuthHeader  = errors.New("authorization header is required")
+	ErrInvalidToken     = errors.New("token is not valid")
+	ErrInvalidTx        = errors.New("transaction is not valid")
+	ErrOversold         = errors.New("more coins are spent than held")
+	ErrPortfolioExists  = errors.New("portfolio with this name already exists")
+	ErrInvalidImport    = errors.New("import is not valid, nothing is saved")
+	ErrUnknownSymbol    = errors.New("symbol is not listed")
+	ErrSymbolNotTrading = errors.New("symbol is not trading")
+	ErrUnknownAsset     = errors.New("no pairs convert into this asset")
+	ErrNoRate           = errors.New("no prices convert into this asset")
 )
@@ -0,0 +1,229 @@
+// Package rates converts amounts between assets. Assets are nodes of a graph
+// and every priced pair links its base and quote both ways, so a coin quoted
+// in BTC is valued in EUR through BTCUSDT and EURUSDT when there is no BTCEUR.
+// A conversion takes the path with the fewest pairs
+package rates
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// Assets worth the same without a market between them, "usdt:usd" values one usdt at one usd
+	pegs = parsePegs(getenv.GetString("ASSET_PEGS", "usdt:usd,usdc:usd,fdusd:usd,busd:usd,tusd:usd,dai:usd"))
+
+	// Paths as long as each other go through the asset listed first, the most liquid ones
+	hubs = strings.Split(getenv.GetString("RATE_HUBS", "usd,usdt,usdc,btc,eth,bnb,fdusd,eur"), ",")
+
+	// Longer chains of pairs are too far off to value anything
+	maxHops = getenv.GetInt("RATE_MAX_HOPS", 3)
+)
+
+func parsePegs(v string) map[string]string {
+	res := make(map[string]string)
+	for _, peg := range strings.Split(v, ",") {
+		asset, to, ok := strings.Cut(strings.ToLower(strings.TrimSpace(peg)), ":")
+		if ok && asset != "" && to != "" && asset != to {
+			res[asset] = to
+		}
+	}
+	return res
+}
+
+type edge struct {
+	symbol string          // the pair, "" for a peg
+	rate   decimal.Decimal // of one asset in the other
+}
+
+// Graph is not safe for concurrent changes, it is built for one valuation or
+// built once and only read afterwards
+type Graph struct {
+	edges map[string]map[string]edge
+}
+
+// New returns a graph of the pegged assets only
+func New() *Graph {
+	g := &Graph{edges: make(map[string]map[string]edge)}
+	for asset, to := range pegs {
+		g.link(asset, to, "", decimal.NewFromInt(1))
+	}
+	return g
+}
+
+// Add links base and quote by the price of symbol, one base costs price quote.
+// A pair replaces a peg between the same assets
+func (g *Graph) Add(symbol, base, quote string, price decimal.Decimal) {
+	if base == "" || quote == "" || base == quote || !price.IsPositive() {
+		return
+	}
+	g.link(base, quote, symbol, price)
+}
+
+func (g *Graph) link(base, quote, symbol string, price decimal.Decimal) {
+	g.set(base, quote, edge{symbol: symbol, rate: price})
+	// Reciprocals keep 24 decimals, chains of them stay exact in the 8 amounts are rounded to
+	g.set(quote, base, edge{symbol: symbol, rate: decimal.NewFromInt(1).DivRound(price, 24)})
+}
+
+func (g *Graph) set(from, to string, e edge) {
+	if _, ok := g.edges[from]; !ok {
+		g.edges[from] = make(map[string]edge)
+	}
+	g.edges[from][to] = e
+}
+
+// Has reports whether some pair or peg links asset
+func (g *Graph) Has(asset string) bool {
+	return len(g.edges[asset]) > 0
+}
+
+// Rate returns what one from is worth in to
+func (g *Graph) Rate(from, to string) (decimal.Decimal, bool) {
+	path, ok := g.path(from, to)
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	rate := decimal.NewFromInt(1)
+	for _, e := range path {
+		rate = rate.Mul(e.rate)
+	}
+	return rate, true
+}
+
+// Path returns the pairs converting from into to, pegs are left out
+func (g *Graph) Path(from, to string) ([]string, bool) {
+	path, ok := g.path(from, to)
+	if !ok {
+		return nil, false
+	}
+
+	symbols := make([]string, 0, len(path))
+	for _, e := range path {
+		if e.symbol != "" {
+			symbols = append(symbols, e.symbol)
+		}
+	}
+	return symbols, true
+}
+
+// path searches breadth first, neighbours are visited hubs first so the same
+// graph always converts through the same pairs
+func (g *Graph) path(from, to string) ([]edge, bool) {
+	if from == "" || to == "" {
+		return nil, false
+	}
+	if from == to {
+		return nil, true
+	}
+
+	prev := map[string]string{from: ""}
+	hops := map[string]int{from: 0}
+	queue := []string{from}
+	for len(queue) > 0 {
+		asset := queue[0]
+		queue = queue[1:]
+		if hops[asset] >= maxHops {
+			continue
+		}
+
+		for _, next := range g.neighbours(asset) {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next], hops[next] = asset, hops[asset]+1
+			if next == to {
+				return g.walk(prev, to), true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, false
+}
+
+func (g *Graph) walk(prev map[string]string, to string) []edge {
+	var path []edge
+	for asset := to; prev[asset] != ""; asset = prev[asset] {
+		path = append(path, g.edges[prev[asset]][asset])
+	}
+	slices.Reverse(path)
+	return path
+}
+
+func (g *Graph) neighbours(asset string) []string {
+	res := make([]string, 0, len(g.edges[asset]))
+	for next := range g.edges[asset] {
+		res = append(res, next)
+	}
+	slices.SortFunc(res, func(a, b string) int {
+		if ra, rb := hubRank(a), hubRank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	return res
+}
+
+func hubRank(asset string) int {
+	if i := slices.Index(hubs, asset); i >= 0 {
+		return i
+	}
+	return len(hubs)
+}
+
+// Pairs knows the assets a symbol trades and the pairs linking assets
+type Pairs interface {
+	Assets(symbol string) (base, quote string, ok bool)
+	Links(from, to string) ([]string, bool)
+}
+
+// FromPrices links assets by the prices of pairs, symbols pairs does not know are left out
+func FromPrices(pairs Pairs, prices map[string]decimal.Decimal) *Graph {
+	g := New()
+	for symbol, price := range prices {
+		if base, quote, ok := pairs.Assets(symbol); ok {
+			g.Add(symbol, base, quote, price)
+		}
+	}
+	return g
+}
+
+// Value is what quantity of symbol is worth in currency and what one coin is.
+// Coins are valued as their base asset, another pair of the asset prices them
+// when symbol has no price. False when symbol is not known or no prices link
+// its base asset to currency
+func (g *Graph) Value(
+	pairs Pairs,
+	symbol string,
+	quantity decimal.Decimal,
+	currency string,
+) (price, total decimal.Decimal, ok bool) {
+	base, _, known := pairs.Assets(symbol)
+	if !known {
+		return decimal.Zero, decimal.Zero, false
+	}
+
+	price, ok = g.Rate(base, currency)
+	if !ok {
+		return decimal.Zero, decimal.Zero, false
+	}
+	return price, price.Mul(quantity).Round(8), true
+}
+
+// ValueLinks returns the pairs besides symbols whose prices Value needs to
+// value them in currency
+func ValueLinks(pairs Pairs, symbols []string, currency string) []string {
+	var links []string
+	for _, symbol := range symbols {
+		if base, _, ok := pairs.Assets(symbol); ok {
+			path, _ := pairs.Links(base, currency)
+			links = append(links, path...)
+		}
+	}
+	slices.Sort(links)
+	return slices.Compact(links)
+}
@@ -0,0 +1,190 @@
+package rates
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func dec(v string) decimal.Decimal {
+	return decimal.RequireFromString(v)
+}
+
+func rate(t *testing.T, g *Graph, from, to, want string) {
+	t.Helper()
+
+	got, ok := g.Rate(from, to)
+	if !ok {
+		t.Fatalf("no rate of %s in %s", from, to)
+	}
+	if !got.Equal(dec(want)) {
+		t.Fatalf("rate of %s in %s = %s, want %s", from, to, got, want)
+	}
+}
+
+func path(t *testing.T, g *Graph, from, to string, want ...string) {
+	t.Helper()
+
+	got, ok := g.Path(from, to)
+	if !ok {
+		t.Fatalf("no path from %s to %s", from, to)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("path from %s to %s = %v, want %v", from, to, got, want)
+	}
+}
+
+func TestRateDirect(t *testing.T) {
+	g := New()
+	g.Add("btcusdt", "btc", "usdt", dec("100000"))
+
+	rate(t, g, "btc", "usdt", "100000")
+	rate(t, g, "usdt", "btc", "0.00001")
+	path(t, g, "usdt", "btc", "btcusdt")
+}
+
+func TestRateSameAsset(t *testing.T) {
+	g := New()
+
+	// An asset converts into itself even without pairs
+	rate(t, g, "jpy", "jpy", "1")
+	path(t, g, "jpy", "jpy")
+}
+
+func TestRateThroughQuote(t *testing.T) {
+	g := New()
+	g.Add("btcusdt", "btc", "usdt", dec("100000"))
+	g.Add("eurusdt", "eur", "usdt", dec("1.25"))
+
+	// There is no btceur, one btc is 100000 usdt at 0.8 eur each
+	rate(t, g, "btc", "eur", "80000")
+	path(t, g, "btc", "eur", "btcusdt", "eurusdt")
+}
+
+func TestRatePegs(t *testing.T) {
+	g := New()
+	g.Add("btcusdt", "btc", "usdt", dec("100000"))
+
+	// usdt is worth one usd, the peg is not a pair to follow
+	rate(t, g, "btc", "usd", "100000")
+	path(t, g, "btc", "usd", "btcusdt")
+	rate(t, g, "usdc", "usdt", "1")
+	path(t, g, "usdc", "usdt")
+
+	// A market between pegged assets replaces the peg
+	g.Add("usdtusd", "usdt", "usd", dec("0.999"))
+	rate(t, g, "usdt", "usd", "0.999")
+	path(t, g, "usdt", "usd", "usdtusd")
+}
+
+func TestRateMissing(t *testing.T) {
+	g := New()
+	g.Add("btcusdt", "btc", "usdt", dec("100000"))
+	g.Add("jpybrl", "jpy", "brl", dec("0.035"))
+
+	if r, ok := g.Rate("btc", "jpy"); ok {
+		t.Fatalf("rate of btc in jpy = %s without pairs between them", r)
+	}
+	if p, ok := g.Path("btc", "jpy"); ok {
+		t.Fatalf("path from btc to jpy = %v without pairs between them", p)
+	}
+	if _, ok := g.Rate("btc", ""); ok {
+		t.Fatal("rate of btc in no asset")
+	}
+	if g.Has("eur") || !g.Has("jpy") {
+		t.Fatal("assets are linked without pairs, or not with them")
+	}
+
+	// Pairs without a price are not linked
+	g.Add("ethusdt", "eth", "usdt", decimal.Zero)
+	if g.Has("eth") {
+		t.Fatal("eth is linked by a pair without a price")
+	}
+}
+
+func TestRateMaxHops(t *testing.T) {
+	g := New()
+	g.Add("aaabbb", "aaa", "bbb", dec("2"))
+	g.Add("bbbccc", "bbb", "ccc", dec("2"))
+	g.Add("cccddd", "ccc", "ddd", dec("2"))
+	g.Add("dddeee", "ddd", "eee", dec("2"))
+
+	rate(t, g, "aaa", "ddd", "8")
+	path(t, g, "aaa", "ddd", "aaabbb", "bbbccc", "cccddd")
+	if r, ok := g.Rate("aaa", "eee"); ok {
+		t.Fatalf("rate of aaa in eee = %s through %d pairs", r, maxHops+1)
+	}
+}
+
+func TestRateHubsFirst(t *testing.T) {
+	// Both graphs have sol in eur through usdt and through btc
+	pairs := []struct {
+		symbol, base, quote, price string
+	}{
+		{"solusdt", "sol", "usdt", "200"},
+		{"eurusdt", "eur", "usdt", "1.25"},
+		{"solbtc", "sol", "btc", "0.002"},
+		{"btceur", "btc", "eur", "90000"},
+	}
+
+	forward, backward := New(), New()
+	for i := range pairs {
+		p, q := pairs[i], pairs[len(pairs)-1-i]
+		forward.Add(p.symbol, p.base, p.quote, dec(p.price))
+		backward.Add(q.symbol, q.base, q.quote, dec(q.price))
+	}
+
+	// usdt is ahead of btc among hubs, whatever order pairs were added in
+	for _, g := range []*Graph{forward, backward} {
+		rate(t, g, "sol", "eur", "160")
+		path(t, g, "sol", "eur", "solusdt", "eurusdt")
+	}
+}
+
+// pairs splits symbols listed as base and quote, every asset links to usdt
+type pairs map[string][2]string
+
+func (p pairs) Assets(symbol string) (string, string, bool) {
+	pair, ok := p[symbol]
+	return pair[0], pair[1], ok
+}
+
+func (p pairs) Links(from, to string) ([]string, bool) {
+	if from == to {
+		return nil, true
+	}
+	return []string{from + "usdt", to + "usdt"}, true
+}
+
+func TestValue(t *testing.T) {
+	listed := pairs{
+		"ethbtc":  {"eth", "btc"},
+		"ethusdt": {"eth", "usdt"},
+		"btcusdt": {"btc", "usdt"},
+		"wifusdt": {"wif", "usdt"},
+	}
+	g := FromPrices(listed, map[string]decimal.Decimal{
+		"ethbtc":  dec("0.05"),
+		"ethusdt": dec("4900"),
+		"btcusdt": dec("100000"),
+		"xyzusdt": dec("1"),
+	})
+
+	// ethbtc is valued as eth, through ethusdt rather than through btc
+	price, total, ok := g.Value(listed, "ethbtc", dec("2"), "usdt")
+	if !ok || !price.Equal(dec("4900")) || !total.Equal(dec("9800")) {
+		t.Fatalf("value of 2 ethbtc = %s at %s, %v, want 9800 at 4900", total, price, ok)
+	}
+	if _, _, ok := g.Value(listed, "wifusdt", dec("1"), "usdt"); ok {
+		t.Fatal("wifusdt is valued without a price")
+	}
+	if _, _, ok := g.Value(listed, "xyzusdt", dec("1"), "usdt"); ok {
+		t.Fatal("unlisted xyzusdt is valued")
+	}
+
+	links := ValueLinks(listed, []string{"ethbtc", "xyzusdt"}, "eur")
+	if !slices.Equal(links, []string{"ethusdt", "eurusdt"}) {
+		t.Fatalf("links = %v, want ethusdt and eurusdt", links)
+	}
+}
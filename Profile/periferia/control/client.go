@@ -0,0 +1,271 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/Wladim1r/proto-crypto/gen/protos/aggregator-profile"
+	"github.com/Wladim1r/shared/shard"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ownerTrailer names the owning replica when a call reached another one
+const ownerTrailer = "aggregator-owner"
+
+// replicasHeader lists the replicas a Sync was split by
+const replicasHeader = "aggregator-replicas"
+
+// ErrReplicasChanged is returned by Sync when a replica knows other replicas
+// than the ones the symbols were split by, they are changing right now
+var ErrReplicasChanged = errors.New("aggregator replicas changed")
+
+// followCall is a Follow or Unfollow call on one replica
+type followCall func(
+	ctx context.Context,
+	cl aggregator.AggregatorControlClient,
+	opts ...grpc.CallOption,
+) (*aggregator.FollowResponse, error)
+
+// Dialer opens a connection to the Aggregator replica at addr
+type Dialer func(addr string) (grpc.ClientConnInterface, error)
+
+// Client tells the Aggregator replicas which users follow which symbols, every
+// symbol goes to the replica owning it. Calls are serialized, so a Sync never
+// undoes a Follow made while it was running
+type Client struct {
+	dial     Dialer
+	reg      *shard.Registry
+	fallback string
+	timeout  time.Duration
+	refresh  time.Duration
+	mu       sync.Mutex
+
+	clients   map[string]aggregator.AggregatorControlClient
+	replicas  []string
+	refreshed time.Time
+}
+
+// NewClient routes by the replicas in reg, while none are registered every
+// call goes to fallback as with a single Aggregator
+func NewClient(dial Dialer, reg *shard.Registry, fallback string) *Client {
+	return &Client{
+		dial:     dial,
+		reg:      reg,
+		fallback: fallback,
+		timeout:  getenv.GetTime("AGGREGATOR_TIMEOUT", 3*time.Second),
+		refresh:  getenv.GetTime("AGGREGATOR_REPLICAS_REFRESH", 5*time.Second),
+		clients:  make(map[string]aggregator.AggregatorControlClient),
+	}
+}
+
+// Follow returns the number of followers of symbol after the call
+func (c *Client) Follow(ctx context.Context, symbol string, userID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req := &aggregator.FollowRequest{Symbol: symbol, UserId: int64(userID)}
+	resp, err := c.routed(ctx, symbol, func(
+		ctx context.Context,
+		cl aggregator.AggregatorControlClient,
+		opts ...grpc.CallOption,
+	) (*aggregator.FollowResponse, error) {
+		return cl.Follow(ctx, req, opts...)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Followers), nil
+}
+
+// Unfollow returns the number of followers of symbol after the call
+func (c *Client) Unfollow(ctx context.Context, symbol string, userID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req := &aggregator.FollowRequest{Symbol: symbol, UserId: int64(userID)}
+	resp, err := c.routed(ctx, symbol, func(
+		ctx context.Context,
+		cl aggregator.AggregatorControlClient,
+		opts ...grpc.CallOption,
+	) (*aggregator.FollowResponse, error) {
+		return cl.Unfollow(ctx, req, opts...)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Followers), nil
+}
+
+// routed calls the owner of symbol. A replica that does not own it names the
+// owner in a trailer, then replicas are listed again and the call is retried once
+func (c *Client) routed(
+	ctx context.Context,
+	symbol string,
+	call followCall,
+) (*aggregator.FollowResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	addr := c.owner(ctx, symbol, false)
+	for attempt := 0; ; attempt++ {
+		cl, err := c.client(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var trailer metadata.MD
+		resp, err := call(ctx, cl, grpc.Trailer(&trailer))
+		if status.Code(err) != codes.FailedPrecondition || attempt > 0 {
+			return resp, err
+		}
+
+		slog.Info("Aggregator replica does not own symbol, rerouting",
+			"symbol", symbol,
+			"replica", addr,
+			"owner", trailer.Get(ownerTrailer))
+		addr = c.owner(ctx, symbol, true)
+		if owners := trailer.Get(ownerTrailer); len(owners) > 0 && owners[0] != "" {
+			addr = owners[0]
+		}
+	}
+}
+
+// Sync replaces all followers on the Aggregator with the wanted ones, each
+// replica gets the symbols it owns. wanted is called once no other call is running
+func (c *Client) Sync(ctx context.Context, wanted func() map[string][]int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	// Every replica is synced even without symbols, so it drops the stale ones
+	reqs := make(map[string]*aggregator.SyncRequest)
+	replicas := c.members(ctx, true)
+	for _, addr := range replicas {
+		reqs[addr] = &aggregator.SyncRequest{}
+	}
+
+	// Replicas check they split symbols the same way, the fallback does not
+	if len(c.replicas) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, replicasHeader, strings.Join(replicas, ","))
+	}
+	for symbol, users := range wanted() {
+		sf := &aggregator.SymbolFollowers{Symbol: symbol}
+		for _, id := range users {
+			sf.UserIds = append(sf.UserIds, int64(id))
+		}
+
+		addr := shard.Owner(symbol, replicas)
+		if reqs[addr] == nil {
+			reqs[addr] = &aggregator.SyncRequest{}
+		}
+		reqs[addr].Symbols = append(reqs[addr].Symbols, sf)
+	}
+
+	var errs []error
+	for addr, req := range reqs {
+		cl, err := c.client(addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		resp, err := cl.Sync(ctx, req)
+		if status.Code(err) == codes.Aborted {
+			errs = append(errs, fmt.Errorf("replica %s: %w: %w", addr, ErrReplicasChanged, err))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replica %s: %w", addr, err))
+			continue
+		}
+		if resp.Followed > 0 || resp.Unfollowed > 0 {
+			slog.Info("Aggregator followers synced",
+				"replica", addr,
+				"symbols", len(req.Symbols),
+				"followed", resp.Followed,
+				"unfollowed", resp.Unfollowed)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetDelivery sets delivery prefs of userID on every replica, any of them may
+// serve one of the symbols of the user
+func (c *Client) SetDelivery(ctx context.Context, userID int, interval time.Duration, thresholdBps int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req := &aggregator.DeliveryRequest{
+		UserId:       int64(userID),
+		IntervalMs:   interval.Milliseconds(),
+		ThresholdBps: int32(thresholdBps),
+	}
+
+	var errs []error
+	for _, addr := range c.members(ctx, true) {
+		cl, err := c.client(addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := cl.SetDelivery(ctx, req); err != nil {
+			// Invalid prefs are refused by every replica alike
+			if status.Code(err) == codes.InvalidArgument {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("replica %s: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) owner(ctx context.Context, symbol string, force bool) string {
+	return shard.Owner(symbol, c.members(ctx, force))
+}
+
+// members returns live replicas, listed again when force or older than refresh.
+// If they can not be listed the last known ones are used
+func (c *Client) members(ctx context.Context, force bool) []string {
+	if c.reg != nil && (force || time.Since(c.refreshed) > c.refresh) {
+		replicas, err := c.reg.Members(ctx)
+		if err != nil {
+			slog.Warn("Could not list Aggregator replicas", "error", err)
+		} else {
+			c.replicas = replicas
+			c.refreshed = time.Now()
+		}
+	}
+
+	if len(c.replicas) == 0 {
+		return []string{c.fallback}
+	}
+	return c.replicas
+}
+
+func (c *Client) client(addr string) (aggregator.AggregatorControlClient, error) {
+	if cl, ok := c.clients[addr]; ok {
+		return cl, nil
+	}
+
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial replica %s: %w", addr, err)
+	}
+	cl := aggregator.NewAggregatorControlClient(conn)
+	c.clients[addr] = cl
+	return cl, nil
+}
@@ -3,14 +3,24 @@ package reddis
 import (
 	"context"
 	"log/slog"
+	"strconv"
 	"sync"
 
+	"github.com/Wladim1r/profile/lib/getenv"
 	"github.com/redis/go-redis/v9"
 )
 
 type Message struct {
 	Channel string
 	Payload string
+	// Set for entries of Redis Streams, they are acknowledged with Ack
+	Stream string
+	ID     string
+}
+
+// UserChannel is where the Aggregator publishes prices of followed symbols for one user
+func UserChannel(userID int) string {
+	return "user:" + strconv.Itoa(userID)
 }
 
 type Subscriber struct {
@@ -19,17 +29,29 @@ type Subscriber struct {
 
 	subscriptions map[string]*redis.PubSub
 	mu            sync.RWMutex
+
+	// PRICE_TRANSPORT must match the one of the Aggregator
+	transport string
+	streams   streamConfig
+	// Subscribed stream keys, true once their pending entries were claimed
+	keys       map[string]bool
+	reading    bool
+	readerDone chan struct{}
 }
 
 func NewSubscriber() *Subscriber {
 	return &Subscriber{
 		Client: redis.NewClient(&redis.Options{
-			Addr:     "redis:6379",
+			Addr:     getenv.GetString("REDIS_ADDR", "redis:6379"),
 			Password: "",
 			DB:       0,
 		}),
 		Messages:      make(chan Message, 200),
 		subscriptions: make(map[string]*redis.PubSub),
+		transport:     getenv.GetString("PRICE_TRANSPORT", "pubsub"),
+		streams:       loadStreamConfig(),
+		keys:          make(map[string]bool),
+		readerDone:    make(chan struct{}),
 	}
 }
 
@@ -37,6 +59,10 @@ func (s *Subscriber) Subscribe(ctx context.Context, symbol string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.transport == TransportStreams {
+		return s.subscribeStream(ctx, symbol)
+	}
+
 	if _, exists := s.subscriptions[symbol]; exists {
 		slog.Debug("Already subscribed to channel", "channel", symbol)
 		return nil
@@ -62,6 +88,11 @@ func (s *Subscriber) Unsubscribe(ctx context.Context, symbol string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.transport == TransportStreams {
+		s.unsubscribeStream(symbol)
+		return nil
+	}
+
 	pubsub, exists := s.subscriptions[symbol]
 	if !exists {
 		slog.Debug("Not subscribed to channel", "channel", symbol)
@@ -114,6 +145,14 @@ func (s *Subscriber) listener(ctx context.Context, pubsub *redis.PubSub, symbol
 }
 
 func (s *Subscriber) Close() {
+	s.mu.Lock()
+	reading := s.reading
+	s.mu.Unlock()
+	// The stream reader stops with its context, it must not write into closed Messages
+	if reading {
+		<-s.readerDone
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -0,0 +1,65 @@
+package reddis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Wladim1r/profile/internal/models"
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/redis/go-redis/v9"
+)
+
+// The Aggregator keeps the last price and 24h stats of every followed symbol
+// in the hash "<PRICE_CACHE_PREFIX><symbol>"
+var cachePrefix = getenv.GetString("PRICE_CACHE_PREFIX", "last:")
+
+// PriceCache reads the prices cached by the Aggregator
+type PriceCache struct {
+	rdb *redis.Client
+}
+
+func NewPriceCache(rdb *redis.Client) *PriceCache {
+	return &PriceCache{rdb: rdb}
+}
+
+// LastPrices returns cached prices of symbols, symbols without a price are left out
+func (s *Subscriber) LastPrices(ctx context.Context, symbols []string) (map[string]models.LastPrice, error) {
+	return NewPriceCache(s.Client).LastPrices(ctx, symbols)
+}
+
+// LastPrices returns cached prices of symbols, symbols without a price are left out
+func (pc *PriceCache) LastPrices(ctx context.Context, symbols []string) (map[string]models.LastPrice, error) {
+	cmds := make(map[string]*redis.MapStringStringCmd, len(symbols))
+	_, err := pc.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, symbol := range symbols {
+			cmds[symbol] = pipe.HGetAll(ctx, cachePrefix+symbol)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]models.LastPrice, len(cmds))
+	for symbol, cmd := range cmds {
+		fields := cmd.Val()
+		price, err := strconv.ParseFloat(fields["p"], 64)
+		if err != nil {
+			continue
+		}
+
+		last := models.LastPrice{Price: price}
+		if ms, err := strconv.ParseInt(fields["t"], 10, 64); err == nil {
+			last.Time = time.UnixMilli(ms)
+		}
+		last.Stale, _ = strconv.ParseBool(fields["stale"])
+		if change, err := strconv.ParseFloat(fields["change_pct"], 64); err == nil {
+			last.HasDaily = true
+			last.ChangePct = change
+			last.DailyStale, _ = strconv.ParseBool(fields["daily_stale"])
+		}
+		prices[symbol] = last
+	}
+	return prices, nil
+}
@@ -0,0 +1,207 @@
+package reddis
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Wladim1r/profile/lib/getenv"
+	"github.com/redis/go-redis/v9"
+)
+
+const TransportStreams = "streams"
+
+// streamConfig is how prices are read when the Aggregator writes them into
+// Redis Streams. Every replica reads only streams of its connected users, so
+// they all share one consumer group and a user reconnecting to any replica
+// gets the ticks missed in between
+type streamConfig struct {
+	Prefix   string
+	Group    string
+	Consumer string
+	Block    time.Duration
+	Batch    int64
+}
+
+func loadStreamConfig() streamConfig {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "profile"
+	}
+
+	return streamConfig{
+		Prefix:   getenv.GetString("PRICE_STREAM_PREFIX", "prices:"),
+		Group:    getenv.GetString("PRICE_STREAM_GROUP", "profile"),
+		Consumer: getenv.GetString("PRICE_STREAM_CONSUMER", hostname),
+		Block:    getenv.GetTime("PRICE_STREAM_BLOCK", time.Second),
+		Batch:    int64(getenv.GetInt("PRICE_STREAM_BATCH", 100)),
+	}
+}
+
+// subscribeStream joins the consumer group of the stream, the group starts at
+// new entries when it is created and at the last acknowledged one afterwards
+func (s *Subscriber) subscribeStream(ctx context.Context, channel string) error {
+	key := s.streams.Prefix + channel
+	err := s.Client.XGroupCreateMkStream(ctx, key, s.streams.Group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		slog.Error("Failed to join redis stream group", "stream", key, "error", err)
+		return err
+	}
+
+	s.keys[key] = false
+	if !s.reading {
+		s.reading = true
+		go s.readStreams(ctx)
+	}
+	slog.Info("Subscribed to redis stream", "stream", key, "group", s.streams.Group)
+	return nil
+}
+
+func (s *Subscriber) unsubscribeStream(channel string) {
+	key := s.streams.Prefix + channel
+	delete(s.keys, key)
+	slog.Info("Unsubscribed from redis stream", "stream", key)
+}
+
+// readStreams delivers entries of subscribed streams until ctx is done.
+// Entries left unacknowledged by any consumer are claimed first
+func (s *Subscriber) readStreams(ctx context.Context) {
+	defer close(s.readerDone)
+
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		keys := make([]string, 0, len(s.keys))
+		var unclaimed []string
+		for key, claimed := range s.keys {
+			keys = append(keys, key)
+			if !claimed {
+				unclaimed = append(unclaimed, key)
+				s.keys[key] = true
+			}
+		}
+		s.mu.Unlock()
+
+		for _, key := range unclaimed {
+			s.claimPending(ctx, key)
+		}
+
+		if len(keys) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.streams.Block):
+			}
+			continue
+		}
+
+		slices.Sort(keys)
+		streams := append(keys, slices.Repeat([]string{">"}, len(keys))...)
+		res, err := s.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.streams.Group,
+			Consumer: s.streams.Consumer,
+			Streams:  streams,
+			Count:    s.streams.Batch,
+			Block:    s.streams.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			slog.Error("Failed to read redis streams", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.streams.Block):
+			}
+			continue
+		}
+
+		for _, stream := range res {
+			for _, entry := range stream.Messages {
+				if !s.deliver(ctx, stream.Stream, entry) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// claimPending takes over entries read but never acknowledged, by a replica
+// that went away or by this one before a restart
+func (s *Subscriber) claimPending(ctx context.Context, key string) {
+	start := "0-0"
+	for {
+		entries, next, err := s.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   key,
+			Group:    s.streams.Group,
+			Consumer: s.streams.Consumer,
+			Start:    start,
+			Count:    s.streams.Batch,
+		}).Result()
+		if err != nil {
+			slog.Warn("Failed to claim pending stream entries", "stream", key, "error", err)
+			return
+		}
+
+		for _, entry := range entries {
+			if !s.deliver(ctx, key, entry) {
+				return
+			}
+		}
+		if next == "0-0" || len(entries) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+// deliver waits for room instead of dropping, an entry is acknowledged once processed
+func (s *Subscriber) deliver(ctx context.Context, key string, entry redis.XMessage) bool {
+	payload, _ := entry.Values["data"].(string)
+	msg := Message{
+		Channel: strings.TrimPrefix(key, s.streams.Prefix),
+		Payload: payload,
+		Stream:  key,
+		ID:      entry.ID,
+	}
+
+	select {
+	case s.Messages <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Ack marks a stream entry as processed, Pub/Sub messages need nothing
+func (s *Subscriber) Ack(ctx context.Context, msg Message) {
+	if msg.ID == "" {
+		return
+	}
+	if err := s.Client.XAck(ctx, msg.Stream, s.streams.Group, msg.ID).Err(); err != nil {
+		slog.Warn("Failed to ack stream entry", "stream", msg.Stream, "id", msg.ID, "error", err)
+	}
+}
+
+// Replay returns up to n last ticks of channel oldest first, only streams keep them
+func (s *Subscriber) Replay(ctx context.Context, channel string, n int) ([]Message, error) {
+	if s.transport != TransportStreams || n <= 0 {
+		return nil, nil
+	}
+
+	key := s.streams.Prefix + channel
+	entries, err := s.Client.XRevRangeN(ctx, key, "+", "-", int64(n)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]Message, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		payload, _ := entries[i].Values["data"].(string)
+		msgs = append(msgs, Message{Channel: channel, Payload: payload})
+	}
+	return msgs, nil
+}
@@ -0,0 +1,340 @@
+package reddis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// memStreams answers the stream commands of subscribers in memory, their
+// clients never connect. Every stream has one consumer group
+type memStreams struct {
+	mu      sync.Mutex
+	entries map[string][]redis.XMessage
+	groups  map[string]*memGroup
+}
+
+type memGroup struct {
+	delivered int               // entries read with ">"
+	pending   map[string]string // consumer of every entry read and not acknowledged
+}
+
+func newMemStreams() *memStreams {
+	return &memStreams{
+		entries: make(map[string][]redis.XMessage),
+		groups:  make(map[string]*memGroup),
+	}
+}
+
+// add appends an entry to the stream, IDs are 1-0, 2-0 and so on
+func (m *memStreams) add(key, data string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := fmt.Sprintf("%d-0", len(m.entries[key])+1)
+	m.entries[key] = append(m.entries[key], redis.XMessage{ID: id, Values: map[string]any{"data": data}})
+}
+
+func (m *memStreams) pending(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if g, ok := m.groups[key]; ok {
+		return len(g.pending)
+	}
+	return 0
+}
+
+func (m *memStreams) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (m *memStreams) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (m *memStreams) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := make([]string, 0, len(cmd.Args()))
+		for _, arg := range cmd.Args() {
+			args = append(args, fmt.Sprint(arg))
+		}
+
+		switch args[0] {
+		case "xgroup":
+			m.createGroup(cmd.(*redis.StatusCmd), args[2])
+		case "xreadgroup":
+			m.readGroup(ctx, cmd.(*redis.XStreamSliceCmd), args)
+		case "xautoclaim":
+			m.autoClaim(cmd.(*redis.XAutoClaimCmd), args[1], args[3], args[5])
+		case "xack":
+			m.ack(cmd.(*redis.IntCmd), args[1], args[3:])
+		case "xrevrange":
+			m.revRange(cmd.(*redis.XMessageSliceCmd), args[1], args[5])
+		default:
+			cmd.SetErr(fmt.Errorf("unexpected command %v", args))
+		}
+		return cmd.Err()
+	}
+}
+
+// createGroup starts the group at new entries, as "$" does
+func (m *memStreams) createGroup(cmd *redis.StatusCmd, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.groups[key]; ok {
+		cmd.SetErr(errors.New("BUSYGROUP Consumer Group name already exists"))
+		return
+	}
+	m.groups[key] = &memGroup{delivered: len(m.entries[key]), pending: make(map[string]string)}
+	cmd.SetVal("OK")
+}
+
+func (m *memStreams) readGroup(ctx context.Context, cmd *redis.XStreamSliceCmd, args []string) {
+	consumer := args[3]
+	count, _ := strconv.Atoi(args[slices.Index(args, "count")+1])
+	block, _ := strconv.Atoi(args[slices.Index(args, "block")+1])
+	start := slices.Index(args, "streams") + 1
+	keys := args[start : start+(len(args)-start)/2]
+
+	m.mu.Lock()
+	var res []redis.XStream
+	for _, key := range keys {
+		g := m.groups[key]
+		stream := redis.XStream{Stream: key}
+		for ; g.delivered < len(m.entries[key]) && count > 0; count-- {
+			entry := m.entries[key][g.delivered]
+			g.pending[entry.ID] = consumer
+			g.delivered++
+			stream.Messages = append(stream.Messages, entry)
+		}
+		if len(stream.Messages) > 0 {
+			res = append(res, stream)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(res) > 0 {
+		cmd.SetVal(res)
+		return
+	}
+	select {
+	case <-ctx.Done():
+		cmd.SetErr(ctx.Err())
+	case <-time.After(time.Duration(block) * time.Millisecond):
+		cmd.SetErr(redis.Nil)
+	}
+}
+
+// autoClaim hands every pending entry over at once
+func (m *memStreams) autoClaim(cmd *redis.XAutoClaimCmd, key, consumer, start string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var claimed []redis.XMessage
+	for _, entry := range m.entries[key] {
+		if _, ok := m.groups[key].pending[entry.ID]; ok && entryNumber(entry.ID) >= entryNumber(start) {
+			m.groups[key].pending[entry.ID] = consumer
+			claimed = append(claimed, entry)
+		}
+	}
+	cmd.SetVal(claimed, "0-0")
+}
+
+func (m *memStreams) ack(cmd *redis.IntCmd, key string, ids []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var acked int64
+	for _, id := range ids {
+		if _, ok := m.groups[key].pending[id]; ok {
+			delete(m.groups[key].pending, id)
+			acked++
+		}
+	}
+	cmd.SetVal(acked)
+}
+
+func (m *memStreams) revRange(cmd *redis.XMessageSliceCmd, key, count string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, _ := strconv.Atoi(count)
+	entries := m.entries[key][max(0, len(m.entries[key])-n):]
+	res := slices.Clone(entries)
+	slices.Reverse(res)
+	cmd.SetVal(res)
+}
+
+func entryNumber(id string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(id, "-0"))
+	return n
+}
+
+// testSubscriber is a replica reading streams of m until its test ends
+func testSubscriber(t *testing.T, m *memStreams, consumer string) (*Subscriber, context.CancelFunc) {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: "memory:6379"})
+	client.AddHook(m)
+	s := &Subscriber{
+		Client:        client,
+		Messages:      make(chan Message, 10),
+		subscriptions: make(map[string]*redis.PubSub),
+		transport:     TransportStreams,
+		streams: streamConfig{
+			Prefix:   "prices:",
+			Group:    "profile",
+			Consumer: consumer,
+			Block:    10 * time.Millisecond,
+			Batch:    100,
+		},
+		keys:       make(map[string]bool),
+		readerDone: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			s.Close()
+		})
+	}
+	t.Cleanup(stop)
+
+	if err := s.Subscribe(ctx, UserChannel(7)); err != nil {
+		t.Fatal(err)
+	}
+	return s, stop
+}
+
+func receive(t *testing.T, s *Subscriber) Message {
+	t.Helper()
+
+	select {
+	case msg := <-s.Messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("%s got no message", s.streams.Consumer)
+		return Message{}
+	}
+}
+
+func expectNone(t *testing.T, s *Subscriber) {
+	t.Helper()
+
+	select {
+	case msg := <-s.Messages:
+		t.Fatalf("%s got %+v, want nothing", s.streams.Consumer, msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamsGroup(t *testing.T) {
+	m := newMemStreams()
+	key := "prices:" + UserChannel(7)
+	m.add(key, "before")
+
+	// The group starts at new entries
+	a, stopA := testSubscriber(t, m, "a")
+	m.add(key, "tick")
+	msg := receive(t, a)
+	want := Message{Channel: UserChannel(7), Payload: "tick", Stream: key, ID: "2-0"}
+	if msg != want {
+		t.Fatalf("message = %+v, want %+v", msg, want)
+	}
+	a.Ack(context.Background(), msg)
+	if n := m.pending(key); n != 0 {
+		t.Fatalf("%d entries pending after the ack", n)
+	}
+	stopA()
+
+	// Another replica joins the same group and goes on from there
+	b, _ := testSubscriber(t, m, "b")
+	m.add(key, "next")
+	if msg := receive(t, b); msg.Payload != "next" {
+		t.Fatalf("message = %+v, want the next tick", msg)
+	}
+	expectNone(t, b)
+}
+
+func TestStreamsRedelivery(t *testing.T) {
+	m := newMemStreams()
+	key := "prices:" + UserChannel(7)
+
+	// Replica a goes away before acknowledging what it read
+	a, stopA := testSubscriber(t, m, "a")
+	m.add(key, "tick")
+	if msg := receive(t, a); msg.Payload != "tick" {
+		t.Fatalf("message = %+v, want the tick", msg)
+	}
+	stopA()
+
+	// The user reconnects to replica b, which claims the tick first
+	b, stopB := testSubscriber(t, m, "b")
+	claimed := receive(t, b)
+	if claimed.Payload != "tick" || claimed.ID != "1-0" {
+		t.Fatalf("message = %+v, want the tick claimed", claimed)
+	}
+	b.Ack(context.Background(), claimed)
+
+	// b goes away too, before acknowledging the next tick
+	m.add(key, "next")
+	if msg := receive(t, b); msg.Payload != "next" {
+		t.Fatalf("message = %+v, want the next tick", msg)
+	}
+	stopB()
+
+	// Only the unacknowledged tick is delivered again
+	c, _ := testSubscriber(t, m, "c")
+	if msg := receive(t, c); msg.Payload != "next" {
+		t.Fatalf("message = %+v, want the next tick only", msg)
+	}
+	expectNone(t, c)
+}
+
+func TestStreamsReplay(t *testing.T) {
+	m := newMemStreams()
+	key := "prices:" + UserChannel(7)
+	s, _ := testSubscriber(t, m, "a")
+	for i := range 5 {
+		m.add(key, strconv.Itoa(i))
+	}
+	for range 5 {
+		receive(t, s)
+	}
+
+	msgs, err := s.Replay(context.Background(), UserChannel(7), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, msg := range msgs {
+		// Replayed ticks are not acknowledged
+		if msg.Channel != UserChannel(7) || msg.ID != "" {
+			t.Fatalf("message = %+v, want a tick of %s without an ID", msg, UserChannel(7))
+		}
+		payloads = append(payloads, msg.Payload)
+	}
+	if !slices.Equal(payloads, []string{"2", "3", "4"}) {
+		t.Fatalf("replayed %v, want the last 3 oldest first", payloads)
+	}
+
+	if msgs, err := s.Replay(context.Background(), UserChannel(7), 0); err != nil || msgs != nil {
+		t.Fatalf("replayed %v, %v without asking for ticks", msgs, err)
+	}
+	s.transport = "pubsub"
+	if msgs, err := s.Replay(context.Background(), UserChannel(7), 3); err != nil || msgs != nil {
+		t.Fatalf("replayed %v, %v from Pub/Sub", msgs, err)
+	}
+}
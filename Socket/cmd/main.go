@@ -19,10 +19,13 @@ func main() {
 	wg := new(sync.WaitGroup)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	connManager := connsock.NewConnectionManager(ctx, wg)
+	connManager := connsock.NewConnectionManager(ctx)
 
-	wg.Add(1)
-	go svr.StartServer(wg, connManager, ctx)
+	healthServer := svr.NewHealthServer()
+
+	wg.Add(2)
+	go svr.StartServer(wg, connManager, healthServer, ctx)
+	go svr.StartAdminServer(wg, connManager, healthServer, ctx)
 
 	slog.Info("🚀 Server started", "port", getenv.GetString("PORT", ":5052"))
 
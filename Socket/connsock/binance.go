@@ -0,0 +1,231 @@
+package connsock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+type binance struct {
+	url     string
+	restURL string
+	// Number of levels in the REST order book snapshot
+	snapshotLimit int
+	client        *http.Client
+}
+
+func newBinance() Exchange {
+	return &binance{
+		url:           getenv.GetString("BINANCE_WS_URL", "wss://stream.binance.com:443/stream"),
+		restURL:       getenv.GetString("BINANCE_REST_URL", "https://api.binance.com"),
+		snapshotLimit: getenv.GetInt("DEPTH_SNAPSHOT_LIMIT", 1000),
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (b *binance) Name() string   { return "binance" }
+func (b *binance) URL() string    { return b.url }
+func (b *binance) BatchSize() int { return 100 }
+
+func (b *binance) TradeStream(symbol string) string {
+	return strings.ToLower(symbol) + EvTypeAggTrade
+}
+
+func (b *binance) TickerStream(symbol string) string {
+	return strings.ToLower(symbol) + "@miniTicker"
+}
+
+func (b *binance) AllTickersStream() string {
+	return "!miniTicker@arr"
+}
+
+// binanceControl is a SUBSCRIBE/UNSUBSCRIBE request
+type binanceControl struct {
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+	ID     int64    `json:"id"`
+}
+
+func (b *binance) SubscribeMessages(streams []string, id int64) []any {
+	return []any{binanceControl{Method: "SUBSCRIBE", Params: streams, ID: id}}
+}
+
+func (b *binance) UnsubscribeMessages(streams []string, id int64) []any {
+	return []any{binanceControl{Method: "UNSUBSCRIBE", Params: streams, ID: id}}
+}
+
+// Binance sends WebSocket pings itself, answering them is enough
+func (b *binance) Heartbeat() Heartbeat {
+	return Heartbeat{}
+}
+
+// binanceFrame is a message of the combined stream endpoint
+type binanceFrame struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+
+	// Filled only in responses to control frames
+	ID    *int64 `json:"id"`
+	Error *struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"error"`
+}
+
+func (b *binance) Route(frame []byte) (string, []byte, error) {
+	var msg binanceFrame
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Error != nil {
+		return "", nil, &ControlError{Code: strconv.Itoa(msg.Error.Code), Msg: msg.Error.Msg}
+	}
+	return msg.Stream, msg.Data, nil
+}
+
+// EventType is listed so "e" is not matched to "E", json keys are case insensitive
+type binanceAggTrade struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	TradeID      int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+	BestMatch    bool   `json:"M"`
+}
+
+func (b *binance) NormalizeTrades(payload []byte) ([]Trade, error) {
+	var at binanceAggTrade
+	if err := json.Unmarshal(payload, &at); err != nil {
+		return nil, err
+	}
+
+	return []Trade{{
+		EventType:    eventTrade,
+		Exchange:     b.Name(),
+		EventTime:    at.EventTime,
+		Symbol:       at.Symbol,
+		TradeID:      strconv.FormatInt(at.TradeID, 10),
+		Price:        at.Price,
+		Quantity:     at.Quantity,
+		TradeTime:    at.TradeTime,
+		IsBuyerMaker: at.IsBuyerMaker,
+	}}, nil
+}
+
+type binanceMiniTicker struct {
+	EventType   string `json:"e"`
+	EventTime   int64  `json:"E"`
+	Symbol      string `json:"s"`
+	ClosePrice  string `json:"c"`
+	OpenPrice   string `json:"o"`
+	HighPrice   string `json:"h"`
+	LowPrice    string `json:"l"`
+	BaseVolume  string `json:"v"`
+	QuoteVolume string `json:"q"`
+}
+
+func (b *binance) NormalizeTickers(payload []byte) ([]Ticker, error) {
+	var arr []binanceMiniTicker
+	if len(payload) > 0 && payload[0] == '{' {
+		// Single symbol stream sends one object instead of an array
+		arr = make([]binanceMiniTicker, 1)
+		if err := json.Unmarshal(payload, &arr[0]); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	tickers := make([]Ticker, 0, len(arr))
+	for _, mt := range arr {
+		tickers = append(tickers, Ticker{
+			EventType:   eventTicker,
+			Exchange:    b.Name(),
+			EventTime:   mt.EventTime,
+			Symbol:      mt.Symbol,
+			ClosePrice:  mt.ClosePrice,
+			OpenPrice:   mt.OpenPrice,
+			HighPrice:   mt.HighPrice,
+			LowPrice:    mt.LowPrice,
+			BaseVolume:  mt.BaseVolume,
+			QuoteVolume: mt.QuoteVolume,
+		})
+	}
+	return tickers, nil
+}
+
+func (b *binance) DepthStream(symbol string) string {
+	return strings.ToLower(symbol) + "@depth@100ms"
+}
+
+type binanceDepthUpdate struct {
+	EventType     string      `json:"e"`
+	EventTime     int64       `json:"E"`
+	Symbol        string      `json:"s"`
+	FirstUpdateID int64       `json:"U"`
+	FinalUpdateID int64       `json:"u"`
+	Bids          [][2]string `json:"b"`
+	Asks          [][2]string `json:"a"`
+}
+
+func (b *binance) NormalizeDepth(payload []byte) (DepthUpdate, error) {
+	var du binanceDepthUpdate
+	if err := json.Unmarshal(payload, &du); err != nil {
+		return DepthUpdate{}, err
+	}
+
+	return DepthUpdate{
+		EventTime:     du.EventTime,
+		Symbol:        du.Symbol,
+		FirstUpdateID: du.FirstUpdateID,
+		FinalUpdateID: du.FinalUpdateID,
+		Bids:          du.Bids,
+		Asks:          du.Asks,
+	}, nil
+}
+
+type binanceDepthSnapshot struct {
+	LastUpdateID int64       `json:"lastUpdateId"`
+	Bids         [][2]string `json:"bids"`
+	Asks         [][2]string `json:"asks"`
+}
+
+func (b *binance) DepthSnapshot(ctx context.Context, symbol string) (DepthSnapshot, error) {
+	url := fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=%d",
+		b.restURL, strings.ToUpper(symbol), b.snapshotLimit)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return DepthSnapshot{}, err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return DepthSnapshot{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return DepthSnapshot{}, fmt.Errorf("depth snapshot: unexpected status %s", resp.Status)
+	}
+
+	var snap binanceDepthSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return DepthSnapshot{}, err
+	}
+
+	return DepthSnapshot{
+		LastUpdateID: snap.LastUpdateID,
+		Bids:         snap.Bids,
+		Asks:         snap.Asks,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package connsock
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+type bybit struct {
+	url string
+}
+
+func newBybit() Exchange {
+	return &bybit{
+		url: getenv.GetString("BYBIT_WS_URL", "wss://stream.bybit.com/v5/public/spot"),
+	}
+}
+
+func (b *bybit) Name() string { return "bybit" }
+func (b *bybit) URL() string  { return b.url }
+
+// Spot endpoint accepts up to 10 args per request
+func (b *bybit) BatchSize() int { return 10 }
+
+func (b *bybit) TradeStream(symbol string) string {
+	return "publicTrade." + strings.ToUpper(symbol)
+}
+
+func (b *bybit) TickerStream(symbol string) string {
+	return "tickers." + strings.ToUpper(symbol)
+}
+
+func (b *bybit) AllTickersStream() string {
+	return ""
+}
+
+type bybitControl struct {
+	ReqID string   `json:"req_id,omitempty"`
+	Op    string   `json:"op"`
+	Args  []string `json:"args,omitempty"`
+}
+
+func (b *bybit) SubscribeMessages(streams []string, id int64) []any {
+	return []any{bybitControl{Op: "subscribe", Args: streams}}
+}
+
+func (b *bybit) UnsubscribeMessages(streams []string, id int64) []any {
+	return []any{bybitControl{Op: "unsubscribe", Args: streams}}
+}
+
+// Bybit drops connections without a ping every 20 seconds
+func (b *bybit) Heartbeat() Heartbeat {
+	payload, _ := json.Marshal(bybitControl{Op: "ping"})
+	return Heartbeat{Interval: 20 * time.Second, Payload: payload}
+}
+
+type bybitFrame struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+
+	// Filled only in responses to control frames
+	Op      string `json:"op"`
+	Success *bool  `json:"success"`
+	RetMsg  string `json:"ret_msg"`
+}
+
+func (b *bybit) Route(frame []byte) (string, []byte, error) {
+	var msg bybitFrame
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Success != nil && !*msg.Success {
+		return "", nil, &ControlError{Code: msg.Op, Msg: msg.RetMsg}
+	}
+	if strings.HasPrefix(msg.Topic, "tickers.") {
+		// Ticker data has no timestamp of its own, the whole frame carries it in ts
+		return msg.Topic, frame, nil
+	}
+	return msg.Topic, msg.Data, nil
+}
+
+type bybitTrade struct {
+	TradeTime int64  `json:"T"`
+	Symbol    string `json:"s"`
+	Side      string `json:"S"` // side of the taker
+	Quantity  string `json:"v"`
+	Price     string `json:"p"`
+	TradeID   string `json:"i"`
+}
+
+func (b *bybit) NormalizeTrades(payload []byte) ([]Trade, error) {
+	var arr []bybitTrade
+	if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(arr))
+	for _, bt := range arr {
+		trades = append(trades, Trade{
+			EventType:    eventTrade,
+			Exchange:     b.Name(),
+			EventTime:    bt.TradeTime,
+			Symbol:       canonicalSymbol(bt.Symbol),
+			TradeID:      bt.TradeID,
+			Price:        bt.Price,
+			Quantity:     bt.Quantity,
+			TradeTime:    bt.TradeTime,
+			IsBuyerMaker: bt.Side == "Sell",
+		})
+	}
+	return trades, nil
+}
+
+type bybitTicker struct {
+	Symbol       string `json:"symbol"`
+	LastPrice    string `json:"lastPrice"`
+	PrevPrice24h string `json:"prevPrice24h"`
+	HighPrice24h string `json:"highPrice24h"`
+	LowPrice24h  string `json:"lowPrice24h"`
+	Volume24h    string `json:"volume24h"`
+	Turnover24h  string `json:"turnover24h"`
+}
+
+// bybitTickerFrame is the whole ticker frame, see Route
+type bybitTickerFrame struct {
+	Timestamp int64       `json:"ts"`
+	Data      bybitTicker `json:"data"`
+}
+
+func (b *bybit) NormalizeTickers(payload []byte) ([]Ticker, error) {
+	var frame bybitTickerFrame
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return nil, err
+	}
+	bt := frame.Data
+
+	return []Ticker{{
+		EventType:   eventTicker,
+		Exchange:    b.Name(),
+		EventTime:   frame.Timestamp,
+		Symbol:      canonicalSymbol(bt.Symbol),
+		ClosePrice:  bt.LastPrice,
+		OpenPrice:   bt.PrevPrice24h,
+		HighPrice:   bt.HighPrice24h,
+		LowPrice:    bt.LowPrice24h,
+		BaseVolume:  bt.Volume24h,
+		QuoteVolume: bt.Turnover24h,
+	}}, nil
+}
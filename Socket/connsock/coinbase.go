@@ -0,0 +1,173 @@
+package connsock
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+type coinbase struct {
+	url string
+}
+
+func newCoinbase() Exchange {
+	return &coinbase{
+		url: getenv.GetString("COINBASE_WS_URL", "wss://ws-feed.exchange.coinbase.com"),
+	}
+}
+
+func (c *coinbase) Name() string   { return "coinbase" }
+func (c *coinbase) URL() string    { return c.url }
+func (c *coinbase) BatchSize() int { return 100 }
+
+// productID turns "btcusd" into "BTC-USD"
+func (c *coinbase) productID(symbol string) string {
+	base, quote := splitPair(symbol)
+	if quote == "" {
+		return strings.ToUpper(symbol)
+	}
+	return strings.ToUpper(base + "-" + quote)
+}
+
+func (c *coinbase) TradeStream(symbol string) string {
+	return "matches:" + c.productID(symbol)
+}
+
+func (c *coinbase) TickerStream(symbol string) string {
+	return "ticker:" + c.productID(symbol)
+}
+
+func (c *coinbase) AllTickersStream() string {
+	return ""
+}
+
+type coinbaseChannel struct {
+	Name       string   `json:"name"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+type coinbaseControl struct {
+	Type     string            `json:"type"`
+	Channels []coinbaseChannel `json:"channels"`
+}
+
+func (c *coinbase) control(method string, streams []string) []any {
+	byChannel := make(map[string][]string)
+	for _, stream := range streams {
+		channel, product, _ := strings.Cut(stream, ":")
+		byChannel[channel] = append(byChannel[channel], product)
+	}
+
+	msg := coinbaseControl{Type: method}
+	for channel, products := range byChannel {
+		msg.Channels = append(msg.Channels, coinbaseChannel{Name: channel, ProductIDs: products})
+	}
+	slices.SortFunc(msg.Channels, func(a, b coinbaseChannel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return []any{msg}
+}
+
+func (c *coinbase) SubscribeMessages(streams []string, id int64) []any {
+	return c.control("subscribe", streams)
+}
+
+func (c *coinbase) UnsubscribeMessages(streams []string, id int64) []any {
+	return c.control("unsubscribe", streams)
+}
+
+// Coinbase keeps connections alive with WebSocket pings only
+func (c *coinbase) Heartbeat() Heartbeat {
+	return Heartbeat{}
+}
+
+type coinbaseFrame struct {
+	Type      string `json:"type"`
+	ProductID string `json:"product_id"`
+	Message   string `json:"message"`
+	Reason    string `json:"reason"`
+}
+
+func (c *coinbase) Route(frame []byte) (string, []byte, error) {
+	var msg coinbaseFrame
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return "", nil, err
+	}
+
+	switch msg.Type {
+	case "match", "last_match":
+		return "matches:" + msg.ProductID, frame, nil
+	case "ticker":
+		return "ticker:" + msg.ProductID, frame, nil
+	case "error":
+		return "", nil, &ControlError{Code: msg.Type, Msg: msg.Message + ": " + msg.Reason}
+	default:
+		// subscriptions, heartbeat
+		return "", nil, nil
+	}
+}
+
+type coinbaseMatch struct {
+	TradeID   int64  `json:"trade_id"`
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Size      string `json:"size"`
+	Side      string `json:"side"` // side of the maker
+	Time      string `json:"time"`
+}
+
+func (c *coinbase) NormalizeTrades(payload []byte) ([]Trade, error) {
+	var cm coinbaseMatch
+	if err := json.Unmarshal(payload, &cm); err != nil {
+		return nil, err
+	}
+
+	ts := unixMilli(cm.Time)
+	return []Trade{{
+		EventType:    eventTrade,
+		Exchange:     c.Name(),
+		EventTime:    ts,
+		Symbol:       canonicalSymbol(cm.ProductID),
+		TradeID:      strconv.FormatInt(cm.TradeID, 10),
+		Price:        cm.Price,
+		Quantity:     cm.Size,
+		TradeTime:    ts,
+		IsBuyerMaker: cm.Side == "buy",
+	}}, nil
+}
+
+type coinbaseTicker struct {
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Open24h   string `json:"open_24h"`
+	High24h   string `json:"high_24h"`
+	Low24h    string `json:"low_24h"`
+	Volume24h string `json:"volume_24h"`
+	Time      string `json:"time"`
+}
+
+func (c *coinbase) NormalizeTickers(payload []byte) ([]Ticker, error) {
+	var ct coinbaseTicker
+	if err := json.Unmarshal(payload, &ct); err != nil {
+		return nil, err
+	}
+
+	price, _ := strconv.ParseFloat(ct.Price, 64)
+	volume, _ := strconv.ParseFloat(ct.Volume24h, 64)
+
+	return []Ticker{{
+		EventType:   eventTicker,
+		Exchange:    c.Name(),
+		EventTime:   unixMilli(ct.Time),
+		Symbol:      canonicalSymbol(ct.ProductID),
+		ClosePrice:  ct.Price,
+		OpenPrice:   ct.Open24h,
+		HighPrice:   ct.High24h,
+		LowPrice:    ct.Low24h,
+		BaseVolume:  ct.Volume24h,
+		QuoteVolume: strconv.FormatFloat(price*volume, 'f', -1, 64),
+	}}, nil
+}
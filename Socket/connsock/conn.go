@@ -2,102 +2,403 @@ package connsock
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/Wladim1r/shared/recorder"
 	"github.com/gorilla/websocket"
 )
 
 const (
 	EvTypeAggTrade = "@aggTrade"
-	// Time to wait before attempting to reconnect
-	reconnectWaitTime = 5 * time.Second
+	// Venues limit the rate of incoming control messages, Binance allows 5 per second
+	controlInterval = 250 * time.Millisecond
 )
 
+// What kind of data a stream carries, it decides how frames are normalized
+type streamKind int
+
+const (
+	kindTrade streamKind = iota
+	kindTicker
+	kindDepth
+)
+
+// streamRoute is the destination of one stream, done is closed on unsubscribe
+type streamRoute struct {
+	kind    streamKind
+	symbol  string // canonical symbol, empty for all market streams
+	outChan chan []byte
+	done    chan struct{}
+}
+
+// socketProducer carries one or many streams of a venue over one WebSocket,
+// adds and drops streams with control frames and routes every frame by its stream
 type socketProducer struct {
-	outputChan    chan []byte
+	exchange      Exchange
 	urlConnection string
+	reconnect     *reconnector
+
+	mu      sync.Mutex
+	routes  map[string]streamRoute
+	pending map[string]bool // stream -> true (subscribe) / false (unsubscribe)
+	// Watchdog state of every stream
+	lastData map[string]time.Time
+	stale    map[string]bool
+	// Last time a stale stream was subscribed again
+	resubscribed map[string]time.Time
+
+	nextID atomic.Int64
+
+	// Raw frames are recorded when set
+	recorder *recorder.Recorder
+	// Frames are read from a recording instead of the venue when set
+	replay *replayConfig
+
+	stats      connStats
+	maxSilence maxSilence
 }
 
-func NewSocketProduecer(outChan chan []byte, url string) *socketProducer {
+func NewSocketProduecer(
+	exchange Exchange,
+	policy backoff.Policy,
+	breakers *backoff.Registry,
+) *socketProducer {
 	return &socketProducer{
-		outputChan:    outChan,
-		urlConnection: url,
+		exchange:      exchange,
+		urlConnection: exchange.URL(),
+		reconnect:     newReconnector(exchange.URL(), policy, breakers),
+		routes:        make(map[string]streamRoute),
+		pending:       make(map[string]bool),
+		lastData:      make(map[string]time.Time),
+		stale:         make(map[string]bool),
+		resubscribed:  make(map[string]time.Time),
+	}
+}
+
+// Subscribe adds stream of symbol to the connection, normalized frames of the stream go to outChan
+func (sp *socketProducer) Subscribe(stream, symbol string, kind streamKind, outChan chan []byte) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.routes[stream] = streamRoute{
+		kind:    kind,
+		symbol:  symbol,
+		outChan: outChan,
+		done:    make(chan struct{}),
+	}
+	sp.pending[stream] = true
+	sp.lastData[stream] = time.Now()
+}
+
+// Unsubscribe drops stream from the connection
+func (sp *socketProducer) Unsubscribe(stream string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	r, ok := sp.routes[stream]
+	if !ok {
+		return
 	}
+	close(r.done)
+	delete(sp.routes, stream)
+	delete(sp.lastData, stream)
+	delete(sp.stale, stream)
+	delete(sp.resubscribed, stream)
+	sp.pending[stream] = false
+}
+
+// Len returns the number of streams carried by the connection
+func (sp *socketProducer) Len() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	return len(sp.routes)
+}
+
+func (sp *socketProducer) route(stream string) (streamRoute, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	r, ok := sp.routes[stream]
+	return r, ok
 }
 
 func (sp *socketProducer) Start(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	defer sp.stats.setState(StateStopped)
+
+	if sp.replay != nil {
+		sp.startReplay(ctx)
+		return
+	}
+
 	for {
-		// Check for main context cancellation before attempting to connect
+		sp.stats.setState(StateConnecting)
+
+		// Blocks until connected, following the backoff policy and the circuit breaker
+		conn, err := sp.reconnect.dial(ctx)
+		if err != nil {
+			slog.Info("Producer shutting down.", "url", sp.urlConnection)
+			return
+		}
+		sp.stats.setState(StateConnected)
+
+		sp.setupPingHandler(conn)
+
+		// New connection knows nothing about our streams, subscribe all of them again
+		sp.resetPending()
+
+		sp.resetSilence(time.Now())
+
+		// Channel to signal an error from the reader, writer or watchdog goroutine
+		errChan := make(chan error, 3)
+		connCtx, cancelConn := context.WithCancel(ctx)
+
+		go sp.reader(connCtx, conn, errChan)
+		go sp.writer(connCtx, conn, errChan)
+		go sp.watchdog(connCtx, errChan)
+
+		// Supervise the connection
 		select {
 		case <-ctx.Done():
-			slog.Info("Producer shutting down.", "url", sp.urlConnection)
+			// Main service is shutting down
+			slog.Info("Main context cancelled, closing connection.", "url", sp.urlConnection)
+			cancelConn()
+			conn.Close()
 			return
-		default:
+		case err := <-errChan:
+			slog.Warn("Connection error, will reconnect.", "url", sp.urlConnection, "error", err)
+			cancelConn()
+			conn.Close()
 		}
 
-		slog.Info("Attempting to connect...", "url", sp.urlConnection)
-		conn, _, err := websocket.DefaultDialer.Dial(sp.urlConnection, nil)
+		sp.reconnect.disconnected()
+		sp.stats.reconnected()
+	}
+}
+
+func (sp *socketProducer) resetPending() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.pending = make(map[string]bool, len(sp.routes))
+	for stream := range sp.routes {
+		sp.pending[stream] = true
+	}
+}
+
+func (sp *socketProducer) reader(ctx context.Context, conn *websocket.Conn, errChan chan<- error) {
+	for {
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			slog.Error("Failed to connect, will retry...", "url", sp.urlConnection, "error", err)
-			time.Sleep(reconnectWaitTime)
-			continue // Go to the next iteration of the loop to retry connection
+			// If there is any error, report it and exit the goroutine
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
+			return
 		}
 
-		slog.Info("Connection established.", "url", sp.urlConnection)
-		sp.setupPingHandler(conn)
+		sp.stats.message(time.Now())
+		sp.recorder.Record(sp.exchange.Name(), msg)
 
-		// Channel to signal an error from the reader goroutine
-		errChan := make(chan error, 1)
-		readerCtx, cancelReader := context.WithCancel(ctx)
-
-		// Start the reader goroutine
-		go func() {
-			for {
-				_, msg, err := conn.ReadMessage()
-				if err != nil {
-					// If there is any error, report it and exit the goroutine
-					select {
-					case errChan <- err:
-					case <-readerCtx.Done():
-					}
-					return
-				}
+		if !sp.handleFrame(ctx, msg) {
+			return
+		}
+	}
+}
 
-				// Forward the message
-				select {
-				case sp.outputChan <- msg:
-				case <-readerCtx.Done():
+// handleFrame routes a raw venue frame to its stream, it returns false when ctx is done
+func (sp *socketProducer) handleFrame(ctx context.Context, msg []byte) bool {
+	stream, payload, err := sp.exchange.Route(msg)
+	if err != nil {
+		var ctrlErr *ControlError
+		if errors.As(err, &ctrlErr) {
+			slog.Error("Exchange rejected control frame", "url", sp.urlConnection, "error", err)
+		} else {
+			slog.Error("Could not parse frame", "url", sp.urlConnection, "error", err)
+		}
+		return true
+	}
+	if stream == "" {
+		// Ack, pong or another service frame
+		return true
+	}
+
+	r, ok := sp.route(stream)
+	if !ok {
+		// Frames of a just unsubscribed stream may still be in flight
+		return true
+	}
+
+	if sp.touch(stream, time.Now()) {
+		slog.Info("Stream is live again", "url", sp.urlConnection, "stream", stream)
+		if !sp.sendStale(ctx, stream, r, false, 0) {
+			return false
+		}
+	}
+
+	frames, err := sp.normalize(r.kind, payload)
+	if err != nil {
+		slog.Error("Could not normalize frame",
+			"url", sp.urlConnection,
+			"stream", stream,
+			"error", err)
+		return true
+	}
+
+	// Forward the messages
+	for _, frame := range frames {
+		select {
+		case r.outChan <- frame:
+		case <-r.done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// normalize turns a venue payload into canonical frames: one JSON object
+// per trade or depth update, or one JSON array with all tickers of the payload
+func (sp *socketProducer) normalize(kind streamKind, payload []byte) ([][]byte, error) {
+	switch kind {
+	case kindTicker:
+		tickers, err := sp.exchange.NormalizeTickers(payload)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := json.Marshal(tickers)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{frame}, nil
+	case kindDepth:
+		dex, ok := sp.exchange.(DepthExchange)
+		if !ok {
+			return nil, ErrDepthUnsupported
+		}
+		update, err := dex.NormalizeDepth(payload)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := json.Marshal(update)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{frame}, nil
+	}
+
+	trades, err := sp.exchange.NormalizeTrades(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([][]byte, 0, len(trades))
+	for _, trade := range trades {
+		frame, err := json.Marshal(trade)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// writer sends pending control frames no faster than the venue allows
+// and application level heartbeats the venue expects
+func (sp *socketProducer) writer(ctx context.Context, conn *websocket.Conn, errChan chan<- error) {
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+
+	var heartbeatC <-chan time.Time
+	heartbeat := sp.exchange.Heartbeat()
+	if heartbeat.Interval > 0 {
+		heartbeatTicker := time.NewTicker(heartbeat.Interval)
+		defer heartbeatTicker.Stop()
+		heartbeatC = heartbeatTicker.C
+	}
+
+	fail := func(err error) {
+		select {
+		case errChan <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeatC:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, heartbeat.Payload); err != nil {
+				fail(err)
+				return
+			}
+		case <-ticker.C:
+			msgs, subscribe, streams := sp.nextControlMessages()
+			if len(msgs) == 0 {
+				continue
+			}
+
+			for _, msg := range msgs {
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteJSON(msg); err != nil {
+					fail(err)
 					return
 				}
 			}
-		}()
+			slog.Info("Sent control frame",
+				"url", sp.urlConnection,
+				"subscribe", subscribe,
+				"streams", streams)
+		}
+	}
+}
 
-		// Supervise the connection
-	superviseLoop:
-		for {
-			select {
-			case <-ctx.Done():
-				// Main service is shutting down
-				slog.Info("Main context cancelled, closing connection.", "url", sp.urlConnection)
-				cancelReader()
-				conn.Close()
-				return // Exit Start method
-			case err := <-errChan:
-				// Reader goroutine failed
-				slog.Warn("Connection error, will reconnect.", "url", sp.urlConnection, "error", err)
-				cancelReader()
-				conn.Close()
-				break superviseLoop // Exit superviseLoop to trigger reconnect
-			}
+// nextControlMessages takes up to BatchSize pending streams of the same method
+func (sp *socketProducer) nextControlMessages() ([]any, bool, int) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if len(sp.pending) == 0 {
+		return nil, false, 0
+	}
+
+	// Unsubscribes go first, so a connection never carries more streams than allowed
+	subscribe := true
+	for _, sub := range sp.pending {
+		if !sub {
+			subscribe = false
+			break
 		}
+	}
+
+	var streams []string
+	for stream, sub := range sp.pending {
+		if sub != subscribe {
+			continue
+		}
+		streams = append(streams, stream)
+		delete(sp.pending, stream)
+		if len(streams) == sp.exchange.BatchSize() {
+			break
+		}
+	}
 
-		// Wait a moment before trying to reconnect
-		time.Sleep(reconnectWaitTime)
+	id := sp.nextID.Add(1)
+	if subscribe {
+		return sp.exchange.SubscribeMessages(streams, id), true, len(streams)
 	}
+	return sp.exchange.UnsubscribeMessages(streams, id), false, len(streams)
 }
 
 func (sp *socketProducer) setupPingHandler(conn *websocket.Conn) {
@@ -109,7 +410,7 @@ func (sp *socketProducer) setupPingHandler(conn *websocket.Conn) {
 			time.Now().Add(10*time.Second),
 		)
 		if err == nil {
-			slog.Info("Successfully sent Pong.", "url", sp.urlConnection)
+			slog.Debug("Successfully sent Pong.", "url", sp.urlConnection)
 		}
 		return err
 	})
@@ -2,74 +2,399 @@ package connsock
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/Wladim1r/shared/recorder"
 	"github.com/Wladimir/socket-service/lib/getenv"
 )
 
+const (
+	// One WebSocket per symbol
+	ModeSingle = "single"
+	// Many symbols over one WebSocket with SUBSCRIBE/UNSUBSCRIBE control frames
+	ModeCombined = "combined"
+
+	keyMiniTicker = "miniTicker"
+	keyDepth      = "depth:"
+)
+
+// feed is one upstream stream together with the hub serving its subscribers
+type feed struct {
+	key    string
+	hub    *Hub
+	cancel context.CancelFunc // stops the hub
+	stream string             // stream name on the producer connection
+	conn   *producerConn      // nil when the venue has no such stream
+	linger *time.Timer
+}
+
+// producerConn is a socket producer with the func stopping it
+type producerConn struct {
+	producer *socketProducer
+	cancel   context.CancelFunc
+}
+
 type ConnectionManager struct {
-	connections map[string]*socketProducer
-	mu          sync.RWMutex
-	mainCtx     context.Context
-	mainWg      *sync.WaitGroup
+	feeds   map[string]*feed
+	mu      sync.RWMutex
+	mainCtx context.Context
+	// Tracks every producer and hub goroutine, CloseAll waits for it
+	wg sync.WaitGroup
+
+	mode       string
+	maxStreams int
+	// Open producer connections by venue
+	pools map[string][]*producerConn
+
+	defaultExchange Exchange
+	exchanges       map[string]Exchange
+
+	bufferSize int
+	policy     string
+	lingerTime time.Duration
+	// Number of order book levels sent to depth subscribers
+	depthLevels int
+
+	reconnect backoff.Policy
+	breakers  *backoff.Registry
+
+	recorder   *recorder.Recorder
+	replay     *replayConfig
+	maxSilence maxSilence
 }
 
-func NewConnectionManager(ctx context.Context, wg *sync.WaitGroup) *ConnectionManager {
-	return &ConnectionManager{
-		connections: make(map[string]*socketProducer),
-		mainCtx:     ctx,
-		mainWg:      wg,
+func NewConnectionManager(ctx context.Context) *ConnectionManager {
+	mode := strings.ToLower(getenv.GetString("STREAM_MODE", ModeSingle))
+	maxStreams := getenv.GetInt("COMBINED_MAX_STREAMS", 200)
+	if mode != ModeCombined {
+		mode = ModeSingle
+		maxStreams = 1
+	}
+
+	defaultExchange := DefaultExchange()
+	slog.Info("Default exchange", "name", defaultExchange.Name(), "url", defaultExchange.URL())
+
+	// A replayed recording is not recorded again
+	replay := loadReplayConfig()
+	var rec *recorder.Recorder
+	if replay == nil {
+		rec = recorder.LoadFromEnv()
+	}
+
+	cm := &ConnectionManager{
+		feeds:           make(map[string]*feed),
+		mainCtx:         ctx,
+		mode:            mode,
+		maxStreams:      maxStreams,
+		pools:           make(map[string][]*producerConn),
+		defaultExchange: defaultExchange,
+		exchanges:       map[string]Exchange{defaultExchange.Name(): defaultExchange},
+		bufferSize:      getenv.GetInt("SUBSCRIBER_BUFFER", 256),
+		policy:          strings.ToLower(getenv.GetString("SLOW_CONSUMER_POLICY", PolicyDropOldest)),
+		lingerTime:      getenv.GetTime("UPSTREAM_LINGER", 30*time.Second),
+		depthLevels:     getenv.GetInt("DEPTH_LEVELS", 20),
+		reconnect:       backoff.LoadPolicy(),
+		breakers:        backoff.NewRegistry(),
+		recorder:        rec,
+		replay:          replay,
+		maxSilence:      loadMaxSilence(),
+	}
+
+	cm.wg.Add(1)
+	go cm.recorder.Start(ctx, &cm.wg)
+
+	return cm
+}
+
+// exchange returns the adapter of the venue, "" means the default one
+func (cm *ConnectionManager) exchange(venue string) (Exchange, error) {
+	if venue == "" {
+		return cm.defaultExchange, nil
+	}
+	if ex, ok := cm.exchanges[venue]; ok {
+		return ex, nil
+	}
+
+	ex, err := NewExchange(venue)
+	if err != nil {
+		return nil, err
 	}
+	cm.exchanges[venue] = ex
+	return ex, nil
 }
 
-func (cm *ConnectionManager) GetOrCreateConnection(symbol string) <-chan []byte {
+// GetOrCreateConnection subscribes to the trade feed of symbol, opening
+// the upstream connection on the first call. Symbol may be prefixed
+// with a venue, "okx:btcusdt", otherwise the default exchange is used
+func (cm *ConnectionManager) GetOrCreateConnection(symbol string) (*Subscriber, error) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	if conn, exists := cm.connections[symbol]; exists {
+	if f, exists := cm.feeds[symbol]; exists {
 		slog.Info("Reusing existing connection", "symbol", symbol)
-		return conn.outputChan
+		return cm.subscribe(f), nil
+	}
+
+	venue, pair := splitVenue(symbol)
+	if err := checkPair(pair); err != nil {
+		return nil, err
+	}
+	ex, err := cm.exchange(venue)
+	if err != nil {
+		return nil, err
 	}
 
 	slog.Info("Creating new connection", "symbol", symbol)
 
+	f := &feed{key: symbol}
 	outputChan := make(chan []byte, 100)
-	url := getenv.GetString("AGGTRADE_URL", "I don't know") + symbol + EvTypeAggTrade
-
-	socketConn := NewSocketProduecer(outputChan, url)
 
-	cm.mainWg.Add(1)
-	go socketConn.Start(cm.mainCtx, cm.mainWg)
+	f.stream = ex.TradeStream(pair)
+	f.conn = cm.addStream(ex, f.stream, canonicalSymbol(pair), kindTrade, outputChan)
 
-	cm.connections[symbol] = socketConn
-	return outputChan
+	cm.startHub(f, outputChan)
+	return cm.subscribe(f), nil
 }
 
-func (cm *ConnectionManager) GetMiniTickerConnection() <-chan []byte {
+// GetMiniTickerConnection subscribes to the all market ticker feed of the default exchange
+func (cm *ConnectionManager) GetMiniTickerConnection() *Subscriber {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	key := "miniTicker"
-	if conn, exists := cm.connections[key]; exists {
+	if f, exists := cm.feeds[keyMiniTicker]; exists {
 		slog.Info("Reusing existing miniTicker connection")
-		return conn.outputChan
+		return cm.subscribe(f)
 	}
 
 	slog.Info("Creating new miniTicker connection")
 
+	f := &feed{key: keyMiniTicker}
 	outputChan := make(chan []byte, 100)
-	url := getenv.GetString("MINITICKER_URL", "I don't care")
 
-	socketConn := NewSocketProduecer(outputChan, url)
+	if stream := cm.defaultExchange.AllTickersStream(); stream != "" {
+		f.stream = stream
+		f.conn = cm.addStream(cm.defaultExchange, stream, "", kindTicker, outputChan)
+	} else {
+		slog.Error("Exchange has no all market ticker stream",
+			"exchange", cm.defaultExchange.Name())
+	}
+
+	cm.startHub(f, outputChan)
+	return cm.subscribe(f)
+}
+
+// GetDepthConnection subscribes to the local order book of symbol, which is
+// built from the venue snapshot and diff stream on the first call
+func (cm *ConnectionManager) GetDepthConnection(symbol string) (*Subscriber, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	key := keyDepth + symbol
+	if f, exists := cm.feeds[key]; exists {
+		slog.Info("Reusing existing depth connection", "symbol", symbol)
+		return cm.subscribe(f), nil
+	}
+
+	venue, pair := splitVenue(symbol)
+	if err := checkPair(pair); err != nil {
+		return nil, err
+	}
+	ex, err := cm.exchange(venue)
+	if err != nil {
+		return nil, err
+	}
+	dex, ok := ex.(DepthExchange)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDepthUnsupported, ex.Name())
+	}
+	if cm.replay != nil {
+		// Snapshots come from REST and are not in the recording
+		return nil, fmt.Errorf("%w: not available in replay mode", ErrDepthUnsupported)
+	}
+
+	slog.Info("Creating new depth connection", "symbol", symbol)
+
+	f := &feed{key: key}
+	diffChan := make(chan []byte, 100)
+	bookChan := make(chan []byte, 100)
+
+	f.stream = dex.DepthStream(pair)
+	f.conn = cm.addStream(ex, f.stream, canonicalSymbol(pair), kindDepth, diffChan)
+
+	ctx := cm.startHub(f, bookChan)
 
-	cm.mainWg.Add(1)
-	go socketConn.Start(cm.mainCtx, cm.mainWg)
+	keeper := newDepthKeeper(dex, pair, cm.depthLevels, cm.reconnect)
+	cm.wg.Add(1)
+	go keeper.Run(ctx, &cm.wg, diffChan, bookChan)
 
-	cm.connections[key] = socketConn
-	return outputChan
+	return cm.subscribe(f), nil
 }
 
+// subscribe adds a reference to the feed and cancels a pending teardown
+func (cm *ConnectionManager) subscribe(f *feed) *Subscriber {
+	if f.linger != nil {
+		f.linger.Stop()
+		f.linger = nil
+		slog.Info("Feed is used again, teardown cancelled", "key", f.key)
+	}
+	return f.hub.Subscribe()
+}
+
+// addStream puts stream on the first connection of the venue with free room,
+// opening a new connection when all of them are full
+func (cm *ConnectionManager) addStream(
+	ex Exchange,
+	stream string,
+	symbol string,
+	kind streamKind,
+	outputChan chan []byte,
+) *producerConn {
+	var conn *producerConn
+	for _, pc := range cm.pools[ex.Name()] {
+		if pc.producer.Len() < cm.maxStreams {
+			conn = pc
+			break
+		}
+	}
+
+	if conn != nil {
+		conn.producer.Subscribe(stream, symbol, kind, outputChan)
+	} else {
+		ctx, cancel := context.WithCancel(cm.mainCtx)
+		conn = &producerConn{
+			producer: NewSocketProduecer(ex, cm.reconnect, cm.breakers),
+			cancel:   cancel,
+		}
+		conn.producer.recorder = cm.recorder
+		conn.producer.replay = cm.replay
+		conn.producer.maxSilence = cm.maxSilence
+
+		// Subscribed before start, so a replay does not skip the first frames
+		conn.producer.Subscribe(stream, symbol, kind, outputChan)
+
+		cm.wg.Add(1)
+		go conn.producer.Start(ctx, &cm.wg)
+
+		cm.pools[ex.Name()] = append(cm.pools[ex.Name()], conn)
+		slog.Info("Creating new upstream connection",
+			"exchange", ex.Name(),
+			"count", len(cm.pools[ex.Name()]))
+	}
+
+	slog.Info("Stream added to upstream connection",
+		"exchange", ex.Name(),
+		"stream", stream,
+		"streams", conn.producer.Len())
+	return conn
+}
+
+// startHub starts the hub of the feed, the returned ctx is done when the feed is torn down
+func (cm *ConnectionManager) startHub(f *feed, outputChan chan []byte) context.Context {
+	ctx, cancel := context.WithCancel(cm.mainCtx)
+	f.cancel = cancel
+	f.hub = newHub(f.key, cm.bufferSize, cm.policy, func() { cm.release(f) })
+
+	cm.wg.Add(1)
+	go f.hub.Run(ctx, &cm.wg, outputChan)
+
+	cm.feeds[f.key] = f
+	return ctx
+}
+
+// release is called when the last subscriber of the feed leaves,
+// the upstream is kept for lingerTime in case somebody comes back
+func (cm *ConnectionManager) release(f *feed) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.feeds[f.key] != f || f.linger != nil {
+		return
+	}
+
+	slog.Info("Feed has no subscribers, scheduling teardown", "key", f.key, "linger", cm.lingerTime)
+	f.linger = time.AfterFunc(cm.lingerTime, func() { cm.teardown(f) })
+}
+
+func (cm *ConnectionManager) teardown(f *feed) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Feed could be resubscribed while the timer was firing
+	if cm.feeds[f.key] != f || f.hub.Len() > 0 {
+		return
+	}
+
+	delete(cm.feeds, f.key)
+	f.cancel()
+
+	if f.conn != nil {
+		f.conn.producer.Unsubscribe(f.stream)
+		if f.conn.producer.Len() == 0 {
+			f.conn.cancel()
+			venue := f.conn.producer.exchange.Name()
+			cm.pools[venue] = slices.DeleteFunc(cm.pools[venue], func(pc *producerConn) bool {
+				return pc == f.conn
+			})
+			slog.Info("Upstream connection has no streams, closed",
+				"exchange", venue,
+				"count", len(cm.pools[venue]))
+		}
+	}
+
+	slog.Info("Upstream connection closed", "key", f.key, "feeds", len(cm.feeds))
+}
+
+// ConnectionStatus returns the state of every upstream connection
+func (cm *ConnectionManager) ConnectionStatus() []ConnectionStatus {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	venues := make([]string, 0, len(cm.pools))
+	for venue := range cm.pools {
+		venues = append(venues, venue)
+	}
+	slices.Sort(venues)
+
+	statuses := make([]ConnectionStatus, 0)
+	for _, venue := range venues {
+		for _, pc := range cm.pools[venue] {
+			statuses = append(statuses, pc.producer.Status())
+		}
+	}
+	return statuses
+}
+
+// BreakerStatus returns circuit breaker states of all upstream endpoints
+func (cm *ConnectionManager) BreakerStatus() []backoff.Status {
+	return cm.breakers.Status()
+}
+
+// CloseAll stops every upstream connection and waits for all producers to finish
 func (cm *ConnectionManager) CloseAll() {
-	slog.Info("Closing all connections", "count", len(cm.connections))
+	cm.mu.Lock()
+	slog.Info("Closing all connections", "feeds", len(cm.feeds), "venues", len(cm.pools))
+
+	for key, f := range cm.feeds {
+		if f.linger != nil {
+			f.linger.Stop()
+		}
+		f.cancel()
+		delete(cm.feeds, key)
+	}
+	for venue, pool := range cm.pools {
+		for _, pc := range pool {
+			pc.cancel()
+		}
+		delete(cm.pools, venue)
+	}
+	cm.mu.Unlock()
+
+	cm.wg.Wait()
+	slog.Info("All connections closed")
 }
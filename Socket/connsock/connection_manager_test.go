@@ -0,0 +1,138 @@
+package connsock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testManager replays an empty recording, producers carry streams without
+// connecting anywhere
+func testManager(t *testing.T, linger time.Duration) *ConnectionManager {
+	t.Helper()
+
+	t.Setenv("REPLAY_DIR", t.TempDir())
+	t.Setenv("EXCHANGE", "binance")
+	t.Setenv("STREAM_MODE", ModeCombined)
+	t.Setenv("UPSTREAM_LINGER", linger.String())
+
+	cm := NewConnectionManager(context.Background())
+	t.Cleanup(cm.CloseAll)
+	return cm
+}
+
+func (cm *ConnectionManager) feed(key string) *feed {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.feeds[key]
+}
+
+func (cm *ConnectionManager) conns(venue string) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.pools[venue])
+}
+
+// waitTeardown waits for the feed to go away, it must stay for at least after
+func waitTeardown(t *testing.T, cm *ConnectionManager, key string, start time.Time, after time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for cm.feed(key) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("feed %s is not torn down", key)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if waited := time.Since(start); waited < after {
+		t.Fatalf("feed %s torn down after %s, before its linger of %s", key, waited, after)
+	}
+}
+
+func TestLastUnsubscribeLingers(t *testing.T) {
+	linger := 100 * time.Millisecond
+	cm := testManager(t, linger)
+
+	a, err := cm.GetOrCreateConnection("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cm.GetOrCreateConnection("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := cm.feed("btcusdt")
+	if f == nil || f.hub.Len() != 2 || cm.conns("binance") != 1 {
+		t.Fatal("two subscribers do not share one feed")
+	}
+
+	a.Close()
+	time.Sleep(2 * linger)
+	if cm.feed("btcusdt") != f || f.linger != nil {
+		t.Fatal("feed is released with a subscriber left")
+	}
+
+	// The upstream is kept for the linger after the last one leaves
+	start := time.Now()
+	b.Close()
+	waitTeardown(t, cm, "btcusdt", start, linger)
+	if cm.conns("binance") != 0 {
+		t.Fatal("upstream connection without streams is kept open")
+	}
+}
+
+func TestResubscribeDuringLinger(t *testing.T) {
+	linger := 100 * time.Millisecond
+	cm := testManager(t, linger)
+
+	sub, err := cm.GetOrCreateConnection("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := cm.feed("btcusdt")
+	sub.Close()
+
+	time.Sleep(linger / 2)
+	sub, err = cm.GetOrCreateConnection("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same upstream is reused and outlives the linger
+	time.Sleep(linger)
+	if cm.feed("btcusdt") != f || f.hub.Len() != 1 {
+		t.Fatal("feed used again during its linger was torn down")
+	}
+
+	start := time.Now()
+	sub.Close()
+	waitTeardown(t, cm, "btcusdt", start, linger)
+}
+
+func TestTeardownKeepsSharedConnection(t *testing.T) {
+	linger := 20 * time.Millisecond
+	cm := testManager(t, linger)
+
+	btc, err := cm.GetOrCreateConnection("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.GetOrCreateConnection("ethusdt"); err != nil {
+		t.Fatal(err)
+	}
+	conn := cm.feed("btcusdt").conn
+	if cm.feed("ethusdt").conn != conn || conn.producer.Len() != 2 {
+		t.Fatal("combined streams do not share one upstream connection")
+	}
+
+	// Only the stream of the torn down feed leaves the connection
+	start := time.Now()
+	btc.Close()
+	waitTeardown(t, cm, "btcusdt", start, linger)
+	if cm.conns("binance") != 1 || conn.producer.Len() != 1 {
+		t.Fatalf("%d connections with %d streams, want ethusdt left", cm.conns("binance"), conn.producer.Len())
+	}
+	if _, ok := conn.producer.route(cm.feed("ethusdt").stream); !ok {
+		t.Fatal("stream of ethusdt is dropped")
+	}
+}
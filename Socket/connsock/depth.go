@@ -0,0 +1,319 @@
+package connsock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/shared/backoff"
+)
+
+const eventDepth = "depth"
+
+var ErrDepthUnsupported = errors.New("exchange has no order book depth stream")
+
+// DepthUpdate is a canonical diff of the order book. Updates of one symbol
+// form a chain: FirstUpdateID of the next update is FinalUpdateID of the previous one + 1
+type DepthUpdate struct {
+	EventType     string      `json:"e,omitempty"` // "stale" for a StaleEvent of the stream
+	EventTime     int64       `json:"E"`
+	Symbol        string      `json:"s"`
+	FirstUpdateID int64       `json:"U"`
+	FinalUpdateID int64       `json:"u"`
+	Bids          [][2]string `json:"b"` // price, quantity; zero quantity removes the level
+	Asks          [][2]string `json:"a"`
+}
+
+// DepthSnapshot is the full order book at LastUpdateID
+type DepthSnapshot struct {
+	LastUpdateID int64
+	Bids         [][2]string
+	Asks         [][2]string
+}
+
+// DepthBook is the canonical top of the local order book sent to clients
+type DepthBook struct {
+	EventType    string      `json:"e"` // always "depth"
+	Exchange     string      `json:"x"`
+	EventTime    int64       `json:"E"`
+	Symbol       string      `json:"s"`
+	LastUpdateID int64       `json:"u"`
+	Bids         [][2]string `json:"b"` // best first
+	Asks         [][2]string `json:"a"` // best first
+}
+
+// DepthExchange is implemented by venues with a diff depth stream and a REST snapshot
+type DepthExchange interface {
+	Exchange
+	DepthStream(symbol string) string
+	NormalizeDepth(payload []byte) (DepthUpdate, error)
+	DepthSnapshot(ctx context.Context, symbol string) (DepthSnapshot, error)
+}
+
+type level struct {
+	price    float64
+	priceStr string
+	qtyStr   string
+}
+
+// orderBook keeps price levels sorted best first
+type orderBook struct {
+	bids         []level
+	asks         []level
+	lastUpdateID int64
+}
+
+func (ob *orderBook) reset(snap DepthSnapshot) error {
+	ob.bids = ob.bids[:0]
+	ob.asks = ob.asks[:0]
+	ob.lastUpdateID = snap.LastUpdateID
+
+	var err error
+	if ob.bids, err = setLevels(ob.bids, true, snap.Bids); err != nil {
+		return err
+	}
+	ob.asks, err = setLevels(ob.asks, false, snap.Asks)
+	return err
+}
+
+// apply puts the update on the book, it returns false when updates were
+// missed between the book and the update, the book must be resynced then
+func (ob *orderBook) apply(u DepthUpdate) (bool, error) {
+	if u.FinalUpdateID <= ob.lastUpdateID {
+		// Already in the snapshot
+		return true, nil
+	}
+	if u.FirstUpdateID > ob.lastUpdateID+1 {
+		return false, nil
+	}
+
+	var err error
+	if ob.bids, err = setLevels(ob.bids, true, u.Bids); err != nil {
+		return false, err
+	}
+	if ob.asks, err = setLevels(ob.asks, false, u.Asks); err != nil {
+		return false, err
+	}
+	ob.lastUpdateID = u.FinalUpdateID
+	return true, nil
+}
+
+// setLevels updates levels sorted descending for bids and ascending for asks
+func setLevels(levels []level, desc bool, updates [][2]string) ([]level, error) {
+	for _, upd := range updates {
+		price, err := strconv.ParseFloat(upd[0], 64)
+		if err != nil {
+			return levels, fmt.Errorf("invalid price %q: %w", upd[0], err)
+		}
+		qty, err := strconv.ParseFloat(upd[1], 64)
+		if err != nil {
+			return levels, fmt.Errorf("invalid quantity %q: %w", upd[1], err)
+		}
+
+		i := sort.Search(len(levels), func(i int) bool {
+			if desc {
+				return levels[i].price <= price
+			}
+			return levels[i].price >= price
+		})
+		found := i < len(levels) && levels[i].price == price
+
+		switch {
+		case qty == 0 && found:
+			levels = slices.Delete(levels, i, i+1)
+		case qty == 0:
+		case found:
+			levels[i].qtyStr = upd[1]
+		default:
+			levels = slices.Insert(levels, i, level{price: price, priceStr: upd[0], qtyStr: upd[1]})
+		}
+	}
+	return levels, nil
+}
+
+func top(levels []level, n int) [][2]string {
+	n = min(n, len(levels))
+	out := make([][2]string, n)
+	for i := range n {
+		out[i] = [2]string{levels[i].priceStr, levels[i].qtyStr}
+	}
+	return out
+}
+
+// depthKeeper builds the local order book of one symbol from a REST snapshot
+// and the diff stream, and sends its top levels after every update.
+// A gap in update ids drops the book and starts over with a new snapshot
+type depthKeeper struct {
+	exchange  DepthExchange
+	symbol    string
+	levels    int
+	maxBuffer int
+	policy    backoff.Policy
+}
+
+func newDepthKeeper(ex DepthExchange, symbol string, levels int, policy backoff.Policy) *depthKeeper {
+	return &depthKeeper{
+		exchange:  ex,
+		symbol:    symbol,
+		levels:    levels,
+		maxBuffer: 1000,
+		policy:    policy,
+	}
+}
+
+func (dk *depthKeeper) Run(ctx context.Context, wg *sync.WaitGroup, inChan <-chan []byte, outChan chan<- []byte) {
+	defer wg.Done()
+
+	var (
+		book     orderBook
+		synced   bool
+		fetching bool
+		buffer   []DepthUpdate
+		snapChan chan DepthSnapshot
+	)
+
+	resync := func(reason string) {
+		slog.Warn("Order book out of sync, fetching new snapshot",
+			"exchange", dk.exchange.Name(),
+			"symbol", dk.symbol,
+			"reason", reason)
+		synced = false
+		fetching = false
+		buffer = buffer[:0]
+		// A snapshot of the previous attempt lands in the old channel and is dropped
+		snapChan = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case snap := <-snapChan:
+			snapChan = nil
+			if err := book.reset(snap); err != nil {
+				resync(err.Error())
+				continue
+			}
+			synced = true
+			slog.Info("Order book snapshot loaded",
+				"exchange", dk.exchange.Name(),
+				"symbol", dk.symbol,
+				"last_update_id", snap.LastUpdateID,
+				"buffered", len(buffer))
+
+			eventTime := time.Now().UnixMilli()
+			for _, u := range buffer {
+				ok, err := book.apply(u)
+				if err != nil || !ok {
+					resync(fmt.Sprintf("buffered update %d does not follow the snapshot", u.FirstUpdateID))
+					break
+				}
+				eventTime = u.EventTime
+			}
+			buffer = buffer[:0]
+			if synced && !dk.send(ctx, outChan, &book, eventTime) {
+				return
+			}
+
+		case msg := <-inChan:
+			var u DepthUpdate
+			if err := json.Unmarshal(msg, &u); err != nil {
+				slog.Error("Could not parse depth update", "symbol", dk.symbol, "error", err)
+				continue
+			}
+			if u.EventType == eventStale {
+				// Subscribers learn about the stale book as it is
+				select {
+				case outChan <- msg:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			if !synced {
+				// Updates are buffered until the snapshot comes, the oldest are
+				// dropped first, they are most likely covered by the snapshot
+				if len(buffer) == dk.maxBuffer {
+					buffer = slices.Delete(buffer, 0, 1)
+				}
+				buffer = append(buffer, u)
+
+				// The snapshot is requested after the first update, so the
+				// update chain is guaranteed to overlap it
+				if !fetching {
+					fetching = true
+					snapChan = make(chan DepthSnapshot, 1)
+					go dk.fetchSnapshot(ctx, snapChan)
+				}
+				continue
+			}
+
+			ok, err := book.apply(u)
+			if err != nil {
+				resync(err.Error())
+				continue
+			}
+			if !ok {
+				resync(fmt.Sprintf("expected update %d, got %d", book.lastUpdateID+1, u.FirstUpdateID))
+				continue
+			}
+			if !dk.send(ctx, outChan, &book, u.EventTime) {
+				return
+			}
+		}
+	}
+}
+
+func (dk *depthKeeper) send(ctx context.Context, outChan chan<- []byte, book *orderBook, eventTime int64) bool {
+	data, err := json.Marshal(DepthBook{
+		EventType:    eventDepth,
+		Exchange:     dk.exchange.Name(),
+		EventTime:    eventTime,
+		Symbol:       canonicalSymbol(dk.symbol),
+		LastUpdateID: book.lastUpdateID,
+		Bids:         top(book.bids, dk.levels),
+		Asks:         top(book.asks, dk.levels),
+	})
+	if err != nil {
+		slog.Error("Could not marshal order book", "symbol", dk.symbol, "error", err)
+		return true
+	}
+
+	select {
+	case outChan <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// fetchSnapshot requests the snapshot until it succeeds, following the reconnect policy
+func (dk *depthKeeper) fetchSnapshot(ctx context.Context, out chan<- DepthSnapshot) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && !backoff.Sleep(ctx, dk.policy.Delay(attempt)) {
+			return
+		}
+
+		snap, err := dk.exchange.DepthSnapshot(ctx, dk.symbol)
+		if err != nil {
+			slog.Warn("Could not fetch order book snapshot",
+				"exchange", dk.exchange.Name(),
+				"symbol", dk.symbol,
+				"attempt", attempt,
+				"error", err)
+			continue
+		}
+
+		out <- snap
+		return
+	}
+}
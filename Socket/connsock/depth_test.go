@@ -0,0 +1,202 @@
+package connsock
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wladim1r/shared/backoff"
+)
+
+func TestOrderBookApply(t *testing.T) {
+	var book orderBook
+	err := book.reset(DepthSnapshot{
+		LastUpdateID: 100,
+		Bids:         [][2]string{{"99", "1"}, {"100", "2"}},
+		Asks:         [][2]string{{"102", "1"}, {"101", "3"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		update   DepthUpdate
+		ok       bool
+		lastID   int64
+		wantBids [][2]string
+		wantAsks [][2]string
+	}{
+		{
+			name:     "covered by the snapshot",
+			update:   DepthUpdate{FirstUpdateID: 95, FinalUpdateID: 100, Bids: [][2]string{{"100", "0"}}},
+			ok:       true,
+			lastID:   100,
+			wantBids: [][2]string{{"100", "2"}, {"99", "1"}},
+			wantAsks: [][2]string{{"101", "3"}, {"102", "1"}},
+		},
+		{
+			name: "overlapping the snapshot",
+			update: DepthUpdate{
+				FirstUpdateID: 98, FinalUpdateID: 102,
+				Bids: [][2]string{{"100.5", "4"}, {"99", "0"}},
+				Asks: [][2]string{{"101", "1.5"}},
+			},
+			ok:       true,
+			lastID:   102,
+			wantBids: [][2]string{{"100.5", "4"}, {"100", "2"}},
+			wantAsks: [][2]string{{"101", "1.5"}, {"102", "1"}},
+		},
+		{
+			name: "next in the chain",
+			update: DepthUpdate{
+				FirstUpdateID: 103, FinalUpdateID: 103,
+				Asks: [][2]string{{"101", "0"}, {"103", "2"}, {"104", "0"}},
+			},
+			ok:       true,
+			lastID:   103,
+			wantBids: [][2]string{{"100.5", "4"}, {"100", "2"}},
+			wantAsks: [][2]string{{"102", "1"}, {"103", "2"}},
+		},
+		{
+			name:     "gap",
+			update:   DepthUpdate{FirstUpdateID: 105, FinalUpdateID: 106, Bids: [][2]string{{"98", "1"}}},
+			ok:       false,
+			lastID:   103,
+			wantBids: [][2]string{{"100.5", "4"}, {"100", "2"}},
+			wantAsks: [][2]string{{"102", "1"}, {"103", "2"}},
+		},
+	}
+
+	// Cases run in order, each one starts from the book the previous one left
+	for _, tt := range tests {
+		ok, err := book.apply(tt.update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if book.lastUpdateID != tt.lastID {
+			t.Errorf("%s: last update id = %d, want %d", tt.name, book.lastUpdateID, tt.lastID)
+		}
+		if got := top(book.bids, 10); !reflect.DeepEqual(got, tt.wantBids) {
+			t.Errorf("%s: bids = %v, want %v", tt.name, got, tt.wantBids)
+		}
+		if got := top(book.asks, 10); !reflect.DeepEqual(got, tt.wantAsks) {
+			t.Errorf("%s: asks = %v, want %v", tt.name, got, tt.wantAsks)
+		}
+	}
+}
+
+func TestOrderBookInvalidLevel(t *testing.T) {
+	var book orderBook
+	if err := book.reset(DepthSnapshot{LastUpdateID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := book.apply(DepthUpdate{FirstUpdateID: 2, FinalUpdateID: 2, Bids: [][2]string{{"x", "1"}}}); err == nil {
+		t.Fatal("expected an error for an invalid price")
+	}
+}
+
+// fakeDepth hands out the snapshots the test sends, one per request
+type fakeDepth struct {
+	Exchange
+	snaps chan DepthSnapshot
+}
+
+func (f *fakeDepth) Name() string              { return "fake" }
+func (f *fakeDepth) DepthStream(string) string { return "" }
+func (f *fakeDepth) NormalizeDepth([]byte) (DepthUpdate, error) {
+	return DepthUpdate{}, nil
+}
+
+func (f *fakeDepth) DepthSnapshot(ctx context.Context, _ string) (DepthSnapshot, error) {
+	select {
+	case snap := <-f.snaps:
+		return snap, nil
+	case <-ctx.Done():
+		return DepthSnapshot{}, ctx.Err()
+	}
+}
+
+func TestDepthKeeperSequencing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	ex := &fakeDepth{snaps: make(chan DepthSnapshot)}
+	inChan := make(chan []byte)
+	outChan := make(chan []byte)
+
+	dk := newDepthKeeper(ex, "btcusdt", 5, backoff.Policy{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1})
+	wg.Add(1)
+	go dk.Run(ctx, &wg, inChan, outChan)
+
+	send := func(first, final int64, bids [][2]string) {
+		t.Helper()
+		msg, _ := json.Marshal(DepthUpdate{EventTime: final, FirstUpdateID: first, FinalUpdateID: final, Bids: bids})
+		select {
+		case inChan <- msg:
+		case <-time.After(time.Second):
+			t.Fatalf("update %d-%d was not read", first, final)
+		}
+	}
+	snapshot := func(lastID int64, bids [][2]string) {
+		t.Helper()
+		select {
+		case ex.snaps <- DepthSnapshot{LastUpdateID: lastID, Bids: bids}:
+		case <-time.After(time.Second):
+			t.Fatalf("snapshot %d was not requested", lastID)
+		}
+	}
+	receive := func() DepthBook {
+		t.Helper()
+		select {
+		case msg := <-outChan:
+			var book DepthBook
+			if err := json.Unmarshal(msg, &book); err != nil {
+				t.Fatal(err)
+			}
+			return book
+		case <-time.After(time.Second):
+			t.Fatal("no book was sent")
+			return DepthBook{}
+		}
+	}
+
+	// Updates before the snapshot are buffered, the ones it covers are skipped
+	send(101, 102, [][2]string{{"10", "9"}})
+	send(103, 105, [][2]string{{"11", "1"}})
+	snapshot(103, [][2]string{{"10", "2"}})
+	book := receive()
+	if book.LastUpdateID != 105 {
+		t.Fatalf("book after snapshot at %d, want 105", book.LastUpdateID)
+	}
+	if want := [][2]string{{"11", "1"}, {"10", "2"}}; !reflect.DeepEqual(book.Bids, want) {
+		t.Fatalf("bids after snapshot = %v, want %v", book.Bids, want)
+	}
+
+	send(106, 107, [][2]string{{"11", "0"}})
+	if book = receive(); book.LastUpdateID != 107 {
+		t.Fatalf("book at %d, want 107", book.LastUpdateID)
+	}
+
+	// A gap drops the book, nothing is sent until a new snapshot is loaded
+	send(110, 112, [][2]string{{"12", "1"}})
+	send(113, 114, [][2]string{{"13", "1"}})
+	snapshot(113, [][2]string{{"12", "1"}})
+	book = receive()
+	if book.LastUpdateID != 114 {
+		t.Fatalf("book after resync at %d, want 114", book.LastUpdateID)
+	}
+	if want := [][2]string{{"13", "1"}, {"12", "1"}}; !reflect.DeepEqual(book.Bids, want) {
+		t.Fatalf("bids after resync = %v, want %v", book.Bids, want)
+	}
+}
@@ -0,0 +1,168 @@
+package connsock
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+// Trade is the canonical trade schema shared by all venues.
+// Field names follow Binance aggTrade, so consumers parsing aggTrade keep working
+type Trade struct {
+	EventType    string `json:"e"` // always "trade"
+	Exchange     string `json:"x"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"` // upper case without separators, BTCUSDT
+	TradeID      string `json:"t"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+}
+
+// Ticker is the canonical 24h rolling window ticker, it follows Binance miniTicker
+type Ticker struct {
+	EventType   string `json:"e"` // always "24hrMiniTicker"
+	Exchange    string `json:"x"`
+	EventTime   int64  `json:"E"`
+	Symbol      string `json:"s"`
+	ClosePrice  string `json:"c"`
+	OpenPrice   string `json:"o"`
+	HighPrice   string `json:"h"`
+	LowPrice    string `json:"l"`
+	BaseVolume  string `json:"v"`
+	QuoteVolume string `json:"q"`
+}
+
+const (
+	eventTrade  = "trade"
+	eventTicker = "24hrMiniTicker"
+)
+
+// Heartbeat is an application level ping the venue expects from clients
+type Heartbeat struct {
+	Interval time.Duration
+	Payload  []byte
+}
+
+// Exchange adapts one venue to the canonical schema
+type Exchange interface {
+	Name() string
+	// URL of the public WebSocket endpoint
+	URL() string
+	// Max number of streams put into one control frame
+	BatchSize() int
+
+	TradeStream(symbol string) string
+	TickerStream(symbol string) string
+	// AllTickersStream returns "" when the venue has no all market ticker stream
+	AllTickersStream() string
+
+	SubscribeMessages(streams []string, id int64) []any
+	UnsubscribeMessages(streams []string, id int64) []any
+	// Heartbeat with zero Interval means the venue relies on WebSocket pings only
+	Heartbeat() Heartbeat
+
+	// Route returns the stream a data frame belongs to and its payload,
+	// stream is "" for acks, pongs and other service frames
+	Route(frame []byte) (stream string, payload []byte, err error)
+	NormalizeTrades(payload []byte) ([]Trade, error)
+	NormalizeTickers(payload []byte) ([]Ticker, error)
+}
+
+// ControlError is returned by Route when the venue rejected a control frame
+type ControlError struct {
+	Code string
+	Msg  string
+}
+
+func (e *ControlError) Error() string {
+	return fmt.Sprintf("exchange rejected control frame: code=%s msg=%s", e.Code, e.Msg)
+}
+
+var exchanges = map[string]func() Exchange{
+	"binance":  newBinance,
+	"bybit":    newBybit,
+	"okx":      newOKX,
+	"kraken":   newKraken,
+	"coinbase": newCoinbase,
+}
+
+// NewExchange returns the adapter of the venue
+func NewExchange(name string) (Exchange, error) {
+	constructor, ok := exchanges[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown exchange %q", name)
+	}
+	return constructor(), nil
+}
+
+// DefaultExchange is the venue used for symbols without "venue:" prefix
+func DefaultExchange() Exchange {
+	name := getenv.GetString("EXCHANGE", "binance")
+	ex, err := NewExchange(name)
+	if err != nil {
+		slog.Error("Could not create default exchange, using binance", "error", err)
+		return newBinance()
+	}
+	return ex
+}
+
+// ErrInvalidSymbol is returned for symbols no venue can subscribe to
+var ErrInvalidSymbol = errors.New("invalid symbol")
+
+// splitVenue cuts an optional "venue:" prefix off the symbol, "okx:btcusdt" -> "okx", "btcusdt"
+func splitVenue(symbol string) (string, string) {
+	if venue, pair, ok := strings.Cut(symbol, ":"); ok {
+		return strings.ToLower(venue), pair
+	}
+	return "", symbol
+}
+
+// Quote assets ordered so that longer ones are matched first
+var quoteAssets = []string{
+	"fdusd", "usdt", "usdc", "busd", "tusd",
+	"usd", "eur", "gbp", "try", "btc", "eth", "bnb", "dai",
+}
+
+// splitPair splits a symbol like "btcusdt" into base and quote assets
+func splitPair(symbol string) (string, string) {
+	symbol = strings.ToLower(symbol)
+	for _, quote := range quoteAssets {
+		if base, ok := strings.CutSuffix(symbol, quote); ok && base != "" {
+			return base, quote
+		}
+	}
+	return symbol, ""
+}
+
+// checkPair rejects pairs that are empty or have characters no venue uses
+func checkPair(pair string) error {
+	if pair == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidSymbol)
+	}
+	for _, r := range canonicalSymbol(pair) {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%w: %q", ErrInvalidSymbol, pair)
+		}
+	}
+	return nil
+}
+
+// canonicalSymbol turns venue symbols like "BTC-USDT" or "BTC/USD" into "BTCUSDT"
+func canonicalSymbol(symbol string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", "/", "", "_", "").Replace(symbol))
+}
+
+// unixMilli parses RFC3339 timestamps used by Kraken and Coinbase
+func unixMilli(ts string) int64 {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
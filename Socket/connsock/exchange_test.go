@@ -0,0 +1,146 @@
+package connsock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFixtures replays the recorded frames of every venue through its adapter
+// and compares the canonical frames with fixtures/<venue>/expected.jsonl
+func TestFixtures(t *testing.T) {
+	tests := []struct {
+		venue   string
+		symbols []string
+	}{
+		{venue: "binance", symbols: []string{"btcusdt", "ethusdt"}},
+		{venue: "bybit", symbols: []string{"btcusdt"}},
+		{venue: "coinbase", symbols: []string{"btcusd"}},
+		{venue: "kraken", symbols: []string{"btcusd"}},
+		{venue: "okx", symbols: []string{"btcusdt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.venue, func(t *testing.T) {
+			ex, err := NewExchange(tt.venue)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Streams are routed to a kind the way the producer does after subscribing
+			kinds := make(map[string]streamKind)
+			for _, symbol := range tt.symbols {
+				kinds[ex.TradeStream(symbol)] = kindTrade
+				kinds[ex.TickerStream(symbol)] = kindTicker
+			}
+			if stream := ex.AllTickersStream(); stream != "" {
+				kinds[stream] = kindTicker
+			}
+			sp := &socketProducer{exchange: ex}
+
+			var got []string
+			for i, frame := range readLines(t, filepath.Join("fixtures", tt.venue, "frames.jsonl")) {
+				stream, payload, err := ex.Route([]byte(frame))
+				var ce *ControlError
+				if errors.As(err, &ce) {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("frame %d: route: %v", i+1, err)
+				}
+				if stream == "" {
+					continue
+				}
+
+				kind, ok := kinds[stream]
+				if !ok {
+					t.Fatalf("frame %d: unexpected stream %q", i+1, stream)
+				}
+				frames, err := sp.normalize(kind, payload)
+				if err != nil {
+					t.Fatalf("frame %d: normalize: %v", i+1, err)
+				}
+				for _, f := range frames {
+					got = append(got, stream+"\t"+string(f))
+				}
+			}
+
+			want := readLines(t, filepath.Join("fixtures", tt.venue, "expected.jsonl"))
+			if len(got) != len(want) {
+				t.Fatalf("got %d frames, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+			}
+			for i := range want {
+				if !sameFrame(t, tt.venue, got[i], want[i]) {
+					t.Errorf("frame %d:\n got %s\nwant %s", i+1, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// sameFrame compares two "<stream>\t<frame>" lines as JSON. Kraken tickers
+// are stamped with the receive time, so their E is not compared
+func sameFrame(t *testing.T, venue, got, want string) bool {
+	t.Helper()
+
+	gotStream, gotFrame, _ := strings.Cut(got, "\t")
+	wantStream, wantFrame, _ := strings.Cut(want, "\t")
+	if gotStream != wantStream {
+		return false
+	}
+
+	var g, w any
+	if err := json.Unmarshal([]byte(gotFrame), &g); err != nil {
+		t.Fatalf("could not parse frame %s: %v", gotFrame, err)
+	}
+	if err := json.Unmarshal([]byte(wantFrame), &w); err != nil {
+		t.Fatalf("could not parse expected frame %s: %v", wantFrame, err)
+	}
+	if venue == "kraken" {
+		dropTickerTime(g)
+		dropTickerTime(w)
+	}
+
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	return bytes.Equal(gb, wb)
+}
+
+func dropTickerTime(v any) {
+	tickers, ok := v.([]any)
+	if !ok {
+		return
+	}
+	for _, ticker := range tickers {
+		if m, ok := ticker.(map[string]any); ok {
+			delete(m, "E")
+		}
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
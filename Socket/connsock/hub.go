@@ -0,0 +1,212 @@
+package connsock
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// What to do with a subscriber whose buffer is full
+const (
+	PolicyDropOldest = "drop_oldest"
+	PolicyDropNewest = "drop_newest"
+	PolicyDisconnect = "disconnect"
+)
+
+var ErrSlowConsumer = errors.New("subscriber is too slow, disconnected")
+
+// Subscriber is one consumer of a Hub with its own bounded buffer
+type Subscriber struct {
+	ch      chan []byte
+	done    chan struct{}
+	once    sync.Once
+	err     error
+	dropped atomic.Uint64
+	hub     *Hub
+}
+
+// C returns channel with frames of the feed
+func (s *Subscriber) C() <-chan []byte {
+	return s.ch
+}
+
+// Done is closed when the hub stops serving the subscriber, Err tells why
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscriber) Err() error {
+	return s.err
+}
+
+// Dropped returns the number of frames lost because the buffer was full
+func (s *Subscriber) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close detaches the subscriber from the hub
+func (s *Subscriber) Close() {
+	s.hub.unsubscribe(s, nil)
+}
+
+func (s *Subscriber) stop(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+// Hub broadcasts every frame of one upstream feed to all of its subscribers
+type Hub struct {
+	name       string
+	bufferSize int
+	policy     string
+
+	mu   sync.RWMutex
+	subs map[*Subscriber]struct{}
+
+	// Called when the last subscriber leaves
+	onIdle func()
+}
+
+func newHub(name string, bufferSize int, policy string, onIdle func()) *Hub {
+	switch policy {
+	case PolicyDropOldest, PolicyDropNewest, PolicyDisconnect:
+	default:
+		slog.Warn("Unknown slow consumer policy, using default",
+			"policy", policy,
+			"default", PolicyDropOldest)
+		policy = PolicyDropOldest
+	}
+
+	return &Hub{
+		name:       name,
+		bufferSize: bufferSize,
+		policy:     policy,
+		subs:       make(map[*Subscriber]struct{}),
+		onIdle:     onIdle,
+	}
+}
+
+func (h *Hub) Subscribe() *Subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscriber{
+		ch:   make(chan []byte, h.bufferSize),
+		done: make(chan struct{}),
+		hub:  h,
+	}
+	h.subs[sub] = struct{}{}
+
+	slog.Info("Subscriber added to hub", "hub", h.name, "subscribers", len(h.subs))
+	return sub
+}
+
+// Len returns the number of active subscribers
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subs)
+}
+
+func (h *Hub) unsubscribe(sub *Subscriber, reason error) {
+	h.mu.Lock()
+	_, ok := h.subs[sub]
+	delete(h.subs, sub)
+	left := len(h.subs)
+	h.mu.Unlock()
+
+	sub.stop(reason)
+
+	if ok {
+		slog.Info("Subscriber removed from hub",
+			"hub", h.name,
+			"subscribers", left,
+			"dropped", sub.Dropped(),
+			"reason", reason)
+
+		if left == 0 && h.onIdle != nil {
+			h.onIdle()
+		}
+	}
+}
+
+// Run reads upstream frames from inChan and fans them out until ctx is done
+func (h *Hub) Run(ctx context.Context, wg *sync.WaitGroup, inChan <-chan []byte) {
+	defer wg.Done()
+	defer h.closeAll()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Hub shutting down", "hub", h.name)
+			return
+		case msg, ok := <-inChan:
+			if !ok {
+				slog.Warn("Hub input channel closed", "hub", h.name)
+				return
+			}
+			h.broadcast(msg)
+		}
+	}
+}
+
+func (h *Hub) broadcast(msg []byte) {
+	h.mu.RLock()
+	subs := make([]*Subscriber, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range subs {
+		if !h.deliver(sub, msg) {
+			h.unsubscribe(sub, ErrSlowConsumer)
+		}
+	}
+}
+
+// deliver never blocks, it returns false when the subscriber has to be disconnected
+func (h *Hub) deliver(sub *Subscriber, msg []byte) bool {
+	select {
+	case sub.ch <- msg:
+		return true
+	default:
+	}
+
+	switch h.policy {
+	case PolicyDisconnect:
+		return false
+	case PolicyDropNewest:
+		sub.dropped.Add(1)
+		return true
+	default:
+		// Free a slot by throwing away the oldest frame
+		select {
+		case <-sub.ch:
+			sub.dropped.Add(1)
+		default:
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped.Add(1)
+		}
+		return true
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	subs := h.subs
+	h.subs = make(map[*Subscriber]struct{})
+	h.mu.Unlock()
+
+	for sub := range subs {
+		sub.stop(nil)
+	}
+}
@@ -0,0 +1,124 @@
+package connsock
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// frames empties the buffer of the subscriber
+func frames(sub *Subscriber) []string {
+	var res []string
+	for {
+		select {
+		case msg := <-sub.C():
+			res = append(res, string(msg))
+		default:
+			return res
+		}
+	}
+}
+
+func TestHubPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    []string
+		dropped uint64
+		err     error
+	}{
+		{PolicyDropOldest, []string{"2", "3"}, 1, nil},
+		{PolicyDropNewest, []string{"1", "2"}, 1, nil},
+		{PolicyDisconnect, []string{"1", "2"}, 0, ErrSlowConsumer},
+		{"unknown", []string{"2", "3"}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			idle := 0
+			h := newHub("btcusdt", 2, tt.policy, func() { idle++ })
+			slow, fast := h.Subscribe(), h.Subscribe()
+
+			// fast keeps up, slow reads nothing
+			var got []string
+			for _, msg := range []string{"1", "2", "3"} {
+				h.broadcast([]byte(msg))
+				got = append(got, frames(fast)...)
+			}
+			if !slices.Equal(got, []string{"1", "2", "3"}) || fast.Dropped() != 0 {
+				t.Fatalf("fast subscriber got %v, dropped %d", got, fast.Dropped())
+			}
+
+			if got := frames(slow); !slices.Equal(got, tt.want) || slow.Dropped() != tt.dropped {
+				t.Fatalf("slow subscriber got %v, dropped %d, want %v and %d", got, slow.Dropped(), tt.want, tt.dropped)
+			}
+
+			select {
+			case <-slow.Done():
+				if !errors.Is(slow.Err(), tt.err) || tt.err == nil {
+					t.Fatalf("slow subscriber stopped with %v, want %v", slow.Err(), tt.err)
+				}
+				if h.Len() != 1 {
+					t.Fatalf("%d subscribers, want the slow one gone", h.Len())
+				}
+			default:
+				if tt.err != nil {
+					t.Fatalf("slow subscriber is still served, want %v", tt.err)
+				}
+			}
+			if idle != 0 {
+				t.Fatal("hub is idle with a subscriber left")
+			}
+		})
+	}
+}
+
+func TestHubIdle(t *testing.T) {
+	idle := 0
+	h := newHub("btcusdt", 1, PolicyDisconnect, func() { idle++ })
+	a, b := h.Subscribe(), h.Subscribe()
+
+	a.Close()
+	if idle != 0 {
+		t.Fatal("hub is idle with a subscriber left")
+	}
+
+	// The last one disconnected for being slow leaves the hub idle too
+	h.broadcast([]byte("1"))
+	h.broadcast([]byte("2"))
+	<-b.Done()
+	if idle != 1 || h.Len() != 0 {
+		t.Fatalf("idle called %d times with %d subscribers, want once", idle, h.Len())
+	}
+
+	// Closing twice does not report it again
+	b.Close()
+	a.Close()
+	if idle != 1 {
+		t.Fatalf("idle called %d times, want once", idle)
+	}
+}
+
+func TestHubRunStops(t *testing.T) {
+	h := newHub("btcusdt", 1, PolicyDropOldest, nil)
+	sub := h.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan []byte)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go h.Run(ctx, wg, in)
+
+	in <- []byte("1")
+	if msg := <-sub.C(); string(msg) != "1" {
+		t.Fatalf("got %q, want 1", msg)
+	}
+
+	// Subscribers are stopped without an error when the feed ends
+	cancel()
+	wg.Wait()
+	<-sub.Done()
+	if sub.Err() != nil || h.Len() != 0 {
+		t.Fatalf("subscriber stopped with %v, %d left", sub.Err(), h.Len())
+	}
+}
@@ -0,0 +1,211 @@
+package connsock
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+type kraken struct {
+	url string
+}
+
+func newKraken() Exchange {
+	return &kraken{
+		url: getenv.GetString("KRAKEN_WS_URL", "wss://ws.kraken.com/v2"),
+	}
+}
+
+func (k *kraken) Name() string   { return "kraken" }
+func (k *kraken) URL() string    { return k.url }
+func (k *kraken) BatchSize() int { return 50 }
+
+// pair turns "btcusd" into "BTC/USD"
+func (k *kraken) pair(symbol string) string {
+	base, quote := splitPair(symbol)
+	if quote == "" {
+		return strings.ToUpper(symbol)
+	}
+	return strings.ToUpper(base + "/" + quote)
+}
+
+func (k *kraken) TradeStream(symbol string) string {
+	return "trade:" + k.pair(symbol)
+}
+
+func (k *kraken) TickerStream(symbol string) string {
+	return "ticker:" + k.pair(symbol)
+}
+
+func (k *kraken) AllTickersStream() string {
+	return ""
+}
+
+type krakenParams struct {
+	Channel string   `json:"channel"`
+	Symbol  []string `json:"symbol"`
+}
+
+type krakenControl struct {
+	Method string        `json:"method"`
+	Params *krakenParams `json:"params,omitempty"`
+	ReqID  int64         `json:"req_id,omitempty"`
+}
+
+// control builds one request per channel, Kraken takes one channel per request
+func (k *kraken) control(method string, streams []string, id int64) []any {
+	byChannel := make(map[string][]string)
+	for _, stream := range streams {
+		channel, pair, _ := strings.Cut(stream, ":")
+		byChannel[channel] = append(byChannel[channel], pair)
+	}
+
+	channels := make([]string, 0, len(byChannel))
+	for channel := range byChannel {
+		channels = append(channels, channel)
+	}
+	slices.Sort(channels)
+
+	msgs := make([]any, 0, len(channels))
+	for _, channel := range channels {
+		msgs = append(msgs, krakenControl{
+			Method: method,
+			Params: &krakenParams{Channel: channel, Symbol: byChannel[channel]},
+			ReqID:  id,
+		})
+	}
+	return msgs
+}
+
+func (k *kraken) SubscribeMessages(streams []string, id int64) []any {
+	return k.control("subscribe", streams, id)
+}
+
+func (k *kraken) UnsubscribeMessages(streams []string, id int64) []any {
+	return k.control("unsubscribe", streams, id)
+}
+
+func (k *kraken) Heartbeat() Heartbeat {
+	payload, _ := json.Marshal(krakenControl{Method: "ping"})
+	return Heartbeat{Interval: 30 * time.Second, Payload: payload}
+}
+
+type krakenFrame struct {
+	Channel string            `json:"channel"`
+	Data    []json.RawMessage `json:"data"`
+
+	// Filled only in responses to requests
+	Method  string `json:"method"`
+	Success *bool  `json:"success"`
+	Error   string `json:"error"`
+}
+
+func (k *kraken) Route(frame []byte) (string, []byte, error) {
+	var msg krakenFrame
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Success != nil && !*msg.Success {
+		return "", nil, &ControlError{Code: msg.Method, Msg: msg.Error}
+	}
+
+	switch msg.Channel {
+	case "trade", "ticker":
+	default:
+		// heartbeat, status and responses to requests
+		return "", nil, nil
+	}
+	if len(msg.Data) == 0 {
+		return "", nil, nil
+	}
+
+	var first struct {
+		Symbol string `json:"symbol"`
+	}
+	if err := json.Unmarshal(msg.Data[0], &first); err != nil {
+		return "", nil, err
+	}
+
+	payload, err := json.Marshal(msg.Data)
+	if err != nil {
+		return "", nil, err
+	}
+	return msg.Channel + ":" + first.Symbol, payload, nil
+}
+
+type krakenTrade struct {
+	Symbol    string      `json:"symbol"`
+	Side      string      `json:"side"` // side of the taker
+	Price     json.Number `json:"price"`
+	Qty       json.Number `json:"qty"`
+	TradeID   int64       `json:"trade_id"`
+	Timestamp string      `json:"timestamp"`
+}
+
+func (k *kraken) NormalizeTrades(payload []byte) ([]Trade, error) {
+	var arr []krakenTrade
+	if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(arr))
+	for _, kt := range arr {
+		ts := unixMilli(kt.Timestamp)
+		trades = append(trades, Trade{
+			EventType:    eventTrade,
+			Exchange:     k.Name(),
+			EventTime:    ts,
+			Symbol:       canonicalSymbol(kt.Symbol),
+			TradeID:      strconv.FormatInt(kt.TradeID, 10),
+			Price:        kt.Price.String(),
+			Quantity:     kt.Qty.String(),
+			TradeTime:    ts,
+			IsBuyerMaker: kt.Side == "sell",
+		})
+	}
+	return trades, nil
+}
+
+type krakenTicker struct {
+	Symbol string      `json:"symbol"`
+	Last   json.Number `json:"last"`
+	High   json.Number `json:"high"`
+	Low    json.Number `json:"low"`
+	Volume json.Number `json:"volume"`
+	VWAP   json.Number `json:"vwap"`
+	Change json.Number `json:"change"`
+}
+
+func (k *kraken) NormalizeTickers(payload []byte) ([]Ticker, error) {
+	var arr []krakenTicker
+	if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	tickers := make([]Ticker, 0, len(arr))
+	for _, kt := range arr {
+		// Kraken has no open price, it is restored from the 24h change
+		last, _ := kt.Last.Float64()
+		change, _ := kt.Change.Float64()
+		volume, _ := kt.Volume.Float64()
+		vwap, _ := kt.VWAP.Float64()
+
+		tickers = append(tickers, Ticker{
+			EventType:   eventTicker,
+			Exchange:    k.Name(),
+			EventTime:   time.Now().UnixMilli(),
+			Symbol:      canonicalSymbol(kt.Symbol),
+			ClosePrice:  kt.Last.String(),
+			OpenPrice:   strconv.FormatFloat(last-change, 'f', -1, 64),
+			HighPrice:   kt.High.String(),
+			LowPrice:    kt.Low.String(),
+			BaseVolume:  kt.Volume.String(),
+			QuoteVolume: strconv.FormatFloat(volume*vwap, 'f', -1, 64),
+		})
+	}
+	return tickers, nil
+}
@@ -0,0 +1,175 @@
+package connsock
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+type okx struct {
+	url string
+}
+
+func newOKX() Exchange {
+	return &okx{
+		url: getenv.GetString("OKX_WS_URL", "wss://ws.okx.com:8443/ws/v5/public"),
+	}
+}
+
+func (o *okx) Name() string   { return "okx" }
+func (o *okx) URL() string    { return o.url }
+func (o *okx) BatchSize() int { return 50 }
+
+// instID turns "btcusdt" into "BTC-USDT"
+func (o *okx) instID(symbol string) string {
+	base, quote := splitPair(symbol)
+	if quote == "" {
+		return strings.ToUpper(symbol)
+	}
+	return strings.ToUpper(base + "-" + quote)
+}
+
+func (o *okx) TradeStream(symbol string) string {
+	return "trades:" + o.instID(symbol)
+}
+
+func (o *okx) TickerStream(symbol string) string {
+	return "tickers:" + o.instID(symbol)
+}
+
+func (o *okx) AllTickersStream() string {
+	return ""
+}
+
+type okxArg struct {
+	Channel string `json:"channel"`
+	InstID  string `json:"instId"`
+}
+
+type okxControl struct {
+	ID   string   `json:"id,omitempty"`
+	Op   string   `json:"op"`
+	Args []okxArg `json:"args"`
+}
+
+func (o *okx) control(op string, streams []string, id int64) []any {
+	msg := okxControl{Op: op, ID: strconv.FormatInt(id, 10)}
+	for _, stream := range streams {
+		channel, instID, _ := strings.Cut(stream, ":")
+		msg.Args = append(msg.Args, okxArg{Channel: channel, InstID: instID})
+	}
+	return []any{msg}
+}
+
+func (o *okx) SubscribeMessages(streams []string, id int64) []any {
+	return o.control("subscribe", streams, id)
+}
+
+func (o *okx) UnsubscribeMessages(streams []string, id int64) []any {
+	return o.control("unsubscribe", streams, id)
+}
+
+// OKX closes connections silent for 30 seconds, plain "ping" keeps them alive
+func (o *okx) Heartbeat() Heartbeat {
+	return Heartbeat{Interval: 25 * time.Second, Payload: []byte("ping")}
+}
+
+type okxFrame struct {
+	Arg  *okxArg         `json:"arg"`
+	Data json.RawMessage `json:"data"`
+
+	// Filled only in responses to control frames
+	Event string `json:"event"`
+	Code  string `json:"code"`
+	Msg   string `json:"msg"`
+}
+
+func (o *okx) Route(frame []byte) (string, []byte, error) {
+	if string(frame) == "pong" {
+		return "", nil, nil
+	}
+
+	var msg okxFrame
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Event == "error" {
+		return "", nil, &ControlError{Code: msg.Code, Msg: msg.Msg}
+	}
+	if msg.Event != "" || msg.Arg == nil {
+		return "", nil, nil
+	}
+	return msg.Arg.Channel + ":" + msg.Arg.InstID, msg.Data, nil
+}
+
+type okxTrade struct {
+	InstID  string `json:"instId"`
+	TradeID string `json:"tradeId"`
+	Price   string `json:"px"`
+	Size    string `json:"sz"`
+	Side    string `json:"side"` // side of the taker
+	TS      string `json:"ts"`
+}
+
+func (o *okx) NormalizeTrades(payload []byte) ([]Trade, error) {
+	var arr []okxTrade
+	if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(arr))
+	for _, ot := range arr {
+		ts, _ := strconv.ParseInt(ot.TS, 10, 64)
+		trades = append(trades, Trade{
+			EventType:    eventTrade,
+			Exchange:     o.Name(),
+			EventTime:    ts,
+			Symbol:       canonicalSymbol(ot.InstID),
+			TradeID:      ot.TradeID,
+			Price:        ot.Price,
+			Quantity:     ot.Size,
+			TradeTime:    ts,
+			IsBuyerMaker: ot.Side == "sell",
+		})
+	}
+	return trades, nil
+}
+
+type okxTicker struct {
+	InstID    string `json:"instId"`
+	Last      string `json:"last"`
+	Open24h   string `json:"open24h"`
+	High24h   string `json:"high24h"`
+	Low24h    string `json:"low24h"`
+	Vol24h    string `json:"vol24h"`
+	VolCcy24h string `json:"volCcy24h"`
+	TS        string `json:"ts"`
+}
+
+func (o *okx) NormalizeTickers(payload []byte) ([]Ticker, error) {
+	var arr []okxTicker
+	if err := json.Unmarshal(payload, &arr); err != nil {
+		return nil, err
+	}
+
+	tickers := make([]Ticker, 0, len(arr))
+	for _, ot := range arr {
+		ts, _ := strconv.ParseInt(ot.TS, 10, 64)
+		tickers = append(tickers, Ticker{
+			EventType:   eventTicker,
+			Exchange:    o.Name(),
+			EventTime:   ts,
+			Symbol:      canonicalSymbol(ot.InstID),
+			ClosePrice:  ot.Last,
+			OpenPrice:   ot.Open24h,
+			HighPrice:   ot.High24h,
+			LowPrice:    ot.Low24h,
+			BaseVolume:  ot.Vol24h,
+			QuoteVolume: ot.VolCcy24h,
+		})
+	}
+	return tickers, nil
+}
@@ -0,0 +1,69 @@
+package connsock
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/gorilla/websocket"
+)
+
+// reconnector dials an upstream endpoint following the shared reconnect policy
+type reconnector struct {
+	url     string
+	policy  backoff.Policy
+	breaker *backoff.Breaker
+	// Consecutive failed or broken connections
+	attempt int
+}
+
+func newReconnector(url string, policy backoff.Policy, breakers *backoff.Registry) *reconnector {
+	return &reconnector{
+		url:     url,
+		policy:  policy,
+		breaker: breakers.Get(url),
+	}
+}
+
+// dial blocks until a connection is established or ctx is cancelled
+func (r *reconnector) dial(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		if r.attempt > 0 {
+			delay := r.policy.Delay(r.attempt)
+			slog.Info("Waiting before reconnect", "url", r.url, "attempt", r.attempt, "delay", delay)
+			if !backoff.Sleep(ctx, delay) {
+				return nil, ctx.Err()
+			}
+		}
+
+		if wait, ok := r.breaker.Allow(); !ok {
+			slog.Debug("Circuit breaker is open, waiting", "url", r.url, "wait", wait)
+			if !backoff.Sleep(ctx, wait) {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		slog.Info("Attempting to connect...", "url", r.url)
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, r.url, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			r.breaker.Failure()
+			r.attempt++
+			slog.Error("Failed to connect, will retry...", "url", r.url, "error", err)
+			continue
+		}
+
+		r.breaker.Success()
+		r.attempt = 0
+		slog.Info("Connection established.", "url", r.url)
+		return conn, nil
+	}
+}
+
+// disconnected makes the next dial wait like after a failed attempt
+func (r *reconnector) disconnected() {
+	r.attempt++
+}
@@ -0,0 +1,110 @@
+package connsock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/Wladim1r/shared/recorder"
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+// replayConfig makes producers read venue frames from a recording
+// instead of the venue, the rest of the pipeline stays the same
+type replayConfig struct {
+	dir string
+	// 1 is the recorded speed, 10 is ten times faster, 0 is as fast as possible
+	speed float64
+	// Start over when the recording ends
+	loop bool
+}
+
+// loadReplayConfig returns nil when REPLAY_DIR is not set
+func loadReplayConfig() *replayConfig {
+	dir := getenv.GetString("REPLAY_DIR", "")
+	if dir == "" {
+		return nil
+	}
+
+	return &replayConfig{
+		dir:   dir,
+		speed: getenv.GetFloat("REPLAY_SPEED", 1),
+		loop:  getenv.GetBool("REPLAY_LOOP", false),
+	}
+}
+
+// startReplay sends recorded frames of the venue through handleFrame keeping
+// the recorded gaps between them. Every producer replays the recording from
+// the start and forwards only the streams it carries
+func (sp *socketProducer) startReplay(ctx context.Context) {
+	venue := sp.exchange.Name()
+	slog.Info("📼 Replaying recorded frames",
+		"exchange", venue,
+		"dir", sp.replay.dir,
+		"speed", sp.replay.speed,
+		"loop", sp.replay.loop)
+
+	sp.stats.setState(StateReplaying)
+
+	for {
+		count, err := sp.replayOnce(ctx, venue)
+		if err != nil {
+			slog.Error("Replay failed", "exchange", venue, "dir", sp.replay.dir, "error", err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Info("Recording is over", "exchange", venue, "frames", count)
+		if !sp.replay.loop {
+			return
+		}
+	}
+}
+
+func (sp *socketProducer) replayOnce(ctx context.Context, venue string) (int, error) {
+	reader, err := recorder.Open(sp.replay.dir)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var (
+		count     int
+		prevFrame int64
+		started   = time.Now()
+		offset    time.Duration
+	)
+
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if frame.Stream != venue {
+			continue
+		}
+
+		if sp.replay.speed > 0 && prevFrame != 0 {
+			// Sleep until the frame is due, relative to the start, so delays do not add up
+			offset += time.Duration(float64(frame.Time-prevFrame) / sp.replay.speed)
+			if !backoff.Sleep(ctx, time.Until(started.Add(offset))) {
+				return count, nil
+			}
+		}
+		prevFrame = frame.Time
+
+		sp.stats.message(time.Now())
+		if !sp.handleFrame(ctx, []byte(frame.Data)) {
+			return count, nil
+		}
+		count++
+	}
+}
@@ -0,0 +1,142 @@
+package connsock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// States of an upstream connection
+const (
+	StateConnecting = "connecting"
+	StateConnected  = "connected"
+	StateReplaying  = "replaying"
+	StateStopped    = "stopped"
+)
+
+// Message rate is averaged over this many complete seconds
+const rateWindow = 10
+
+// ConnectionStatus describes one upstream connection
+type ConnectionStatus struct {
+	Exchange       string    `json:"exchange"`
+	URL            string    `json:"url"`
+	State          string    `json:"state"`
+	ConnectedSince time.Time `json:"connected_since,omitzero"`
+	Reconnects     int       `json:"reconnects"`
+	LastMessage    time.Time `json:"last_message,omitzero"`
+	Messages       int64     `json:"messages"`
+	MessageRate    float64   `json:"message_rate"` // messages per second
+	StaleEvents    int       `json:"stale_events"`
+	LastStale      time.Time `json:"last_stale,omitzero"`
+	Streams        []string  `json:"streams"`
+	StaleStreams   []string  `json:"stale_streams,omitempty"`
+}
+
+// connStats is updated by the producer and read by the status endpoint
+type connStats struct {
+	mu             sync.Mutex
+	state          string
+	connectedSince time.Time
+	reconnects     int
+	lastMessage    time.Time
+	messages       int64
+	staleEvents    int
+	lastStale      time.Time
+	// Messages per second of the last rateWindow seconds, indexed by unix second
+	buckets [rateWindow]struct {
+		sec   int64
+		count int64
+	}
+}
+
+func (s *connStats) setState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+	if state == StateConnected || state == StateReplaying {
+		s.connectedSince = time.Now()
+	} else {
+		s.connectedSince = time.Time{}
+	}
+}
+
+func (s *connStats) reconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reconnects++
+}
+
+func (s *connStats) staleEvent(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.staleEvents++
+	s.lastStale = now
+}
+
+func (s *connStats) message(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastMessage = now
+	s.messages++
+
+	sec := now.Unix()
+	b := &s.buckets[sec%rateWindow]
+	if b.sec != sec {
+		b.sec = sec
+		b.count = 0
+	}
+	b.count++
+}
+
+func (s *connStats) status(now time.Time) ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The current second is not complete yet and is left out
+	sec := now.Unix()
+	var count int64
+	for _, b := range s.buckets {
+		if b.sec < sec && b.sec >= sec-rateWindow {
+			count += b.count
+		}
+	}
+
+	return ConnectionStatus{
+		State:          s.state,
+		ConnectedSince: s.connectedSince,
+		Reconnects:     s.reconnects,
+		LastMessage:    s.lastMessage,
+		Messages:       s.messages,
+		MessageRate:    float64(count) / rateWindow,
+		StaleEvents:    s.staleEvents,
+		LastStale:      s.lastStale,
+	}
+}
+
+// Status returns the state of the connection and the streams it carries
+func (sp *socketProducer) Status() ConnectionStatus {
+	status := sp.stats.status(time.Now())
+	status.Exchange = sp.exchange.Name()
+	status.URL = sp.urlConnection
+	if sp.replay != nil {
+		status.URL = "replay://" + sp.replay.dir
+	}
+
+	sp.mu.Lock()
+	for stream := range sp.routes {
+		status.Streams = append(status.Streams, stream)
+	}
+	for stream := range sp.stale {
+		status.StaleStreams = append(status.StaleStreams, stream)
+	}
+	sp.mu.Unlock()
+	slices.Sort(status.Streams)
+	slices.Sort(status.StaleStreams)
+
+	return status
+}
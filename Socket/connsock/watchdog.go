@@ -0,0 +1,201 @@
+package connsock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Wladimir/socket-service/lib/getenv"
+)
+
+const (
+	eventStale       = "stale"
+	watchdogInterval = time.Second
+)
+
+var errStaleConnection = errors.New("no data on any stream of the connection")
+
+// StaleEvent is sent to subscribers of a stream when it stops or resumes
+type StaleEvent struct {
+	EventType string `json:"e"` // always "stale"
+	Exchange  string `json:"x"`
+	EventTime int64  `json:"E"`
+	Symbol    string `json:"s"` // empty for all market streams
+	Kind      string `json:"k"` // trade, ticker or depth
+	Stream    string `json:"stream"`
+	Stale     bool   `json:"stale"` // false when data resumed
+	SilenceMs int64  `json:"silence_ms,omitempty"`
+}
+
+func (k streamKind) String() string {
+	switch k {
+	case kindTicker:
+		return "ticker"
+	case kindDepth:
+		return "depth"
+	default:
+		return "trade"
+	}
+}
+
+// maxSilence is how long a stream of each kind may go without data, zero disables the check
+type maxSilence map[streamKind]time.Duration
+
+func loadMaxSilence() maxSilence {
+	return maxSilence{
+		// Trades of illiquid symbols may pause for a while
+		kindTrade:  getenv.GetTime("WATCHDOG_TRADE_SILENCE", time.Minute),
+		kindTicker: getenv.GetTime("WATCHDOG_TICKER_SILENCE", 10*time.Second),
+		kindDepth:  getenv.GetTime("WATCHDOG_DEPTH_SILENCE", 10*time.Second),
+	}
+}
+
+// staleStream is a stream whose stale state changed
+type staleStream struct {
+	stream  string
+	route   streamRoute
+	silence time.Duration
+}
+
+// watchdog marks streams silent for longer than allowed as stale and subscribes
+// to them again once per silence window, a venue may drop a subscription
+// without telling. When all streams of the connection are silent the connection
+// fails and the supervisor reconnects, one quiet symbol does not drop a
+// connection carrying other busy streams
+func (sp *socketProducer) watchdog(ctx context.Context, errChan chan<- error) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stale, resubscribe, allSilent := sp.checkSilence(now)
+
+			for _, s := range stale {
+				slog.Warn("Stream is stale",
+					"url", sp.urlConnection,
+					"stream", s.stream,
+					"silence", s.silence)
+				sp.stats.staleEvent(now)
+				if !sp.sendStale(ctx, s.stream, s.route, true, s.silence) {
+					return
+				}
+			}
+
+			if len(resubscribe) > 0 && !allSilent {
+				slog.Warn("Subscribing to stale streams again",
+					"url", sp.urlConnection,
+					"streams", resubscribe)
+			}
+
+			if allSilent {
+				slog.Warn("Connection is stale, forcing reconnect", "url", sp.urlConnection)
+				select {
+				case errChan <- errStaleConnection:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}
+}
+
+// checkSilence returns streams which just became stale, stale streams which
+// are subscribed to again, and whether every watched stream of the connection is silent
+func (sp *socketProducer) checkSilence(now time.Time) ([]staleStream, []string, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	var (
+		stale       []staleStream
+		resubscribe []string
+		watched     int
+		silent      int
+	)
+	for stream, r := range sp.routes {
+		limit := sp.maxSilence[r.kind]
+		if limit <= 0 {
+			continue
+		}
+		watched++
+
+		silence := now.Sub(sp.lastData[stream])
+		if silence < limit {
+			continue
+		}
+		silent++
+
+		if !sp.stale[stream] {
+			sp.stale[stream] = true
+			stale = append(stale, staleStream{stream: stream, route: r, silence: silence})
+		}
+		if now.Sub(sp.resubscribed[stream]) >= limit {
+			sp.resubscribed[stream] = now
+			sp.pending[stream] = true
+			resubscribe = append(resubscribe, stream)
+		}
+	}
+
+	return stale, resubscribe, watched > 0 && silent == watched
+}
+
+// touch records data on stream, it returns true if the stream was stale
+func (sp *socketProducer) touch(stream string, now time.Time) bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.lastData[stream] = now
+	delete(sp.resubscribed, stream)
+	if sp.stale[stream] {
+		delete(sp.stale, stream)
+		return true
+	}
+	return false
+}
+
+// resetSilence gives every stream a full silence window on a new connection,
+// stale streams stay stale until their data comes
+func (sp *socketProducer) resetSilence(now time.Time) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for stream := range sp.routes {
+		sp.lastData[stream] = now
+	}
+	clear(sp.resubscribed)
+}
+
+func (sp *socketProducer) sendStale(
+	ctx context.Context,
+	stream string,
+	r streamRoute,
+	stale bool,
+	silence time.Duration,
+) bool {
+	data, err := json.Marshal(StaleEvent{
+		EventType: eventStale,
+		Exchange:  sp.exchange.Name(),
+		EventTime: time.Now().UnixMilli(),
+		Symbol:    r.symbol,
+		Kind:      r.kind.String(),
+		Stream:    stream,
+		Stale:     stale,
+		SilenceMs: silence.Milliseconds(),
+	})
+	if err != nil {
+		slog.Error("Could not marshal stale event", "stream", stream, "error", err)
+		return true
+	}
+
+	select {
+	case r.outChan <- data:
+	case <-r.done:
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package connsock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckSilence(t *testing.T) {
+	start := time.Now()
+	sp := &socketProducer{
+		routes: map[string]streamRoute{
+			"btcusdt@aggTrade": {kind: kindTrade, symbol: "BTCUSDT"},
+			"ethusdt@aggTrade": {kind: kindTrade, symbol: "ETHUSDT"},
+		},
+		pending:      make(map[string]bool),
+		lastData:     map[string]time.Time{"btcusdt@aggTrade": start, "ethusdt@aggTrade": start},
+		stale:        make(map[string]bool),
+		resubscribed: make(map[string]time.Time),
+		maxSilence:   maxSilence{kindTrade: 10 * time.Second},
+	}
+
+	// One busy stream and one silent one, the silent one is subscribed again
+	sp.touch("btcusdt@aggTrade", start.Add(9*time.Second))
+	stale, resubscribe, allSilent := sp.checkSilence(start.Add(10 * time.Second))
+	if len(stale) != 1 || stale[0].stream != "ethusdt@aggTrade" {
+		t.Fatalf("stale = %+v, want ethusdt@aggTrade", stale)
+	}
+	if !slices.Equal(resubscribe, []string{"ethusdt@aggTrade"}) || !sp.pending["ethusdt@aggTrade"] {
+		t.Fatalf("resubscribe = %v, pending = %v", resubscribe, sp.pending)
+	}
+	if allSilent {
+		t.Fatal("connection with a busy stream is reported silent")
+	}
+	delete(sp.pending, "ethusdt@aggTrade")
+
+	// Within the same window neither a stale event nor another subscribe
+	sp.touch("btcusdt@aggTrade", start.Add(15*time.Second))
+	stale, resubscribe, _ = sp.checkSilence(start.Add(15 * time.Second))
+	if len(stale) != 0 || len(resubscribe) != 0 {
+		t.Fatalf("stale = %+v, resubscribe = %v within one window", stale, resubscribe)
+	}
+
+	// Still silent a window later, subscribed once more
+	sp.touch("btcusdt@aggTrade", start.Add(20*time.Second))
+	_, resubscribe, _ = sp.checkSilence(start.Add(20 * time.Second))
+	if !slices.Equal(resubscribe, []string{"ethusdt@aggTrade"}) {
+		t.Fatalf("resubscribe = %v a window later", resubscribe)
+	}
+
+	// Data comes back, the stream is live again
+	if !sp.touch("ethusdt@aggTrade", start.Add(21*time.Second)) {
+		t.Fatal("touch of a stale stream did not report it")
+	}
+
+	// Every stream silent fails the connection
+	_, _, allSilent = sp.checkSilence(start.Add(40 * time.Second))
+	if !allSilent {
+		t.Fatal("connection with all streams silent is not reported")
+	}
+}
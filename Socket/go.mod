@@ -3,6 +3,7 @@ module github.com/Wladimir/socket-service
 go 1.24.4
 
 require (
+	github.com/Wladim1r/shared v0.0.0
 	github.com/gorilla/websocket v1.5.3
 	google.golang.org/grpc v1.76.0
 )
@@ -15,4 +16,9 @@ require (
 	google.golang.org/protobuf v1.36.10 // indirect
 )
 
-require github.com/Wladim1r/proto-crypto v0.1.3 // direct
+require github.com/Wladim1r/proto-crypto v0.3.0 // direct
+
+replace (
+	github.com/Wladim1r/proto-crypto => ../proto-crypto
+	github.com/Wladim1r/shared => ../shared
+)
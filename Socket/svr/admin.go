@@ -0,0 +1,96 @@
+package svr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/shared/backoff"
+	"github.com/Wladimir/socket-service/connsock"
+	"github.com/Wladimir/socket-service/lib/getenv"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type StatusSource interface {
+	ConnectionStatus() []connsock.ConnectionStatus
+	BreakerStatus() []backoff.Status
+}
+
+// NewHealthServer returns a health server reporting NOT_SERVING until StartServer is listening
+func NewHealthServer() *health.Server {
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return hs
+}
+
+// StartAdminServer serves liveness, readiness and upstream connection state over HTTP on PORT:
+//
+//	GET /healthz      - the process is alive
+//	GET /readyz       - the gRPC server accepts streams
+//	GET /connections  - every upstream connection
+//	GET /breakers     - circuit breakers of upstream endpoints
+func StartAdminServer(
+	wg *sync.WaitGroup,
+	source StatusSource,
+	hs *health.Server,
+	ctx context.Context,
+) {
+	defer wg.Done()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := hs.Check(r.Context(), &healthpb.HealthCheckRequest{})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": resp.GetStatus().String()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": resp.Status.String()})
+	})
+
+	mux.HandleFunc("GET /connections", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"connections": source.ConnectionStatus()})
+	})
+
+	mux.HandleFunc("GET /breakers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"breakers": source.BreakerStatus()})
+	})
+
+	server := http.Server{
+		Addr:    getenv.GetString("PORT", ":5052"),
+		Handler: mux,
+	}
+
+	go func() {
+		slog.Info("👂 Admin server listening", "address", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Failed to run admin server", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Got interruption signal, stopping admin server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to gracefully shutdown admin server", "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not write response", "error", err)
+	}
+}
@@ -2,18 +2,29 @@ package svr
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net"
 	"sync"
 
-	"github.com/Wladim1r/proto-crypto/gen/socket-aggregator"
+	"github.com/Wladim1r/proto-crypto/gen/protos/socket-aggregator"
+	"github.com/Wladim1r/shared/tlsconf"
+	"github.com/Wladimir/socket-service/connsock"
 	"github.com/Wladimir/socket-service/lib/getenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
+// Peers allowed to call the service when TLS_ALLOW is empty
+const defaultTLSAllow = "/socket.SocketService/*=aggregator;/grpc.health.v1.Health/*=*"
+
 type ConnectionManager interface {
-	GetOrCreateConnection(symbol string) <-chan []byte
-	GetMiniTickerConnection() <-chan []byte
+	GetOrCreateConnection(symbol string) (*connsock.Subscriber, error)
+	GetMiniTickerConnection() *connsock.Subscriber
+	GetDepthConnection(symbol string) (*connsock.Subscriber, error)
 }
 
 type server struct {
@@ -35,7 +46,8 @@ func (s *server) ReceiveRawMiniTicker(
 ) error {
 	slog.Info("Client connected to ReceiveRawMiniTicker stream")
 
-	outputChan := s.connManager.GetMiniTickerConnection()
+	sub := s.connManager.GetMiniTickerConnection()
+	defer sub.Close()
 
 	for {
 		select {
@@ -45,11 +57,10 @@ func (s *server) ReceiveRawMiniTicker(
 		case <-s.mainCtx.Done():
 			slog.Info("Got Interruption signal from streaming server from main context")
 			return stream.Context().Err()
-		case msg, ok := <-outputChan:
-			if !ok {
-				slog.Warn("Output chan closed")
-				return nil
-			}
+		case <-sub.Done():
+			slog.Warn("Subscription to miniTicker feed stopped", "error", sub.Err())
+			return subscriptionErr(sub)
+		case msg := <-sub.C():
 			if err := stream.Send(&socket.RawResponse{Data: msg}); err != nil {
 				slog.Error(
 					"Could not send raw message from miniTicker stream to client",
@@ -69,8 +80,13 @@ func (s *server) ReceiveRawAggTrade(
 	symbol := req.Symbol
 	slog.Info("Client connected to ReceiveRawAggTrade stream", "symbol", symbol)
 
-	outputChan := s.connManager.GetOrCreateConnection(symbol)
-	slog.Info("Got output channel for symbol", "symbol", symbol)
+	sub, err := s.connManager.GetOrCreateConnection(symbol)
+	if err != nil {
+		slog.Warn("Could not subscribe to aggTrade feed", "symbol", symbol, "error", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer sub.Close()
+	slog.Info("Got subscription for symbol", "symbol", symbol)
 
 	messageCount := 0
 	for {
@@ -86,11 +102,14 @@ func (s *server) ReceiveRawAggTrade(
 				"symbol", symbol,
 				"messages_sent", messageCount)
 			return stream.Context().Err()
-		case msg, ok := <-outputChan:
-			if !ok {
-				slog.Warn("Output chan closed", "symbol", symbol, "messages_sent", messageCount)
-				return nil
-			}
+		case <-sub.Done():
+			slog.Warn("Subscription to aggTrade feed stopped",
+				"symbol", symbol,
+				"messages_sent", messageCount,
+				"dropped", sub.Dropped(),
+				"error", sub.Err())
+			return subscriptionErr(sub)
+		case msg := <-sub.C():
 			messageCount++
 			if messageCount%100 == 0 {
 				slog.Debug(
@@ -114,7 +133,73 @@ func (s *server) ReceiveRawAggTrade(
 	}
 }
 
-func StartServer(wg *sync.WaitGroup, connManager ConnectionManager, ctx context.Context) {
+func (s *server) ReceiveDepth(
+	req *socket.RawAggTradeRequest,
+	stream socket.SocketService_ReceiveDepthServer,
+) error {
+	symbol := req.Symbol
+	slog.Info("Client connected to ReceiveDepth stream", "symbol", symbol)
+
+	sub, err := s.connManager.GetDepthConnection(symbol)
+	if err != nil {
+		slog.Warn("Could not subscribe to depth feed", "symbol", symbol, "error", err)
+		if errors.Is(err, connsock.ErrDepthUnsupported) {
+			return status.Error(codes.Unimplemented, err.Error())
+		}
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer sub.Close()
+
+	messageCount := 0
+	for {
+		select {
+		case <-stream.Context().Done():
+			slog.Warn("Got Interruption signal from streaming server from stream context",
+				"symbol", symbol,
+				"messages_sent", messageCount,
+				"error", stream.Context().Err())
+			return stream.Context().Err()
+		case <-s.mainCtx.Done():
+			slog.Info("Got Interruption signal from streaming server from main context",
+				"symbol", symbol,
+				"messages_sent", messageCount)
+			return stream.Context().Err()
+		case <-sub.Done():
+			slog.Warn("Subscription to depth feed stopped",
+				"symbol", symbol,
+				"messages_sent", messageCount,
+				"dropped", sub.Dropped(),
+				"error", sub.Err())
+			return subscriptionErr(sub)
+		case msg := <-sub.C():
+			messageCount++
+			if err := stream.Send(&socket.RawResponse{Data: msg}); err != nil {
+				slog.Error(
+					"Could not send order book to client",
+					"symbol", symbol,
+					"messages_sent", messageCount,
+					"error", err,
+				)
+				return err
+			}
+		}
+	}
+}
+
+// subscriptionErr turns the reason of a stopped subscription into a gRPC status
+func subscriptionErr(sub *connsock.Subscriber) error {
+	if errors.Is(sub.Err(), connsock.ErrSlowConsumer) {
+		return status.Error(codes.ResourceExhausted, sub.Err().Error())
+	}
+	return nil
+}
+
+func StartServer(
+	wg *sync.WaitGroup,
+	connManager ConnectionManager,
+	hs *health.Server,
+	ctx context.Context,
+) {
 	defer wg.Done()
 
 	address := getenv.GetString("ADDRESS", "0.0.0.0:12345")
@@ -125,12 +210,21 @@ func StartServer(wg *sync.WaitGroup, connManager ConnectionManager, ctx context.
 		return
 	}
 
-	svr := grpc.NewServer()
+	opts, err := tlsconf.ServerOptions(tlsconf.LoadFromEnv(), tlsconf.PolicyFromEnv(defaultTLSAllow))
+	if err != nil {
+		slog.Error("Could not set up TLS", "error", err)
+		return
+	}
+	svr := grpc.NewServer(opts...)
 
 	register(svr, connManager, ctx)
+	healthpb.RegisterHealthServer(svr, hs)
 
 	slog.Info("👂 Server listening", "address", address)
 
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus(socket.SocketService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
 	go func() {
 		if err := svr.Serve(listen); err != nil {
 			slog.Error("Failed to listening server")
@@ -139,5 +233,7 @@ func StartServer(wg *sync.WaitGroup, connManager ConnectionManager, ctx context.
 
 	<-ctx.Done()
 	slog.Info("Got interruption signal, stopping gRPC server")
+	// Health watchers learn about the shutdown before streams are closed
+	hs.Shutdown()
 	svr.GracefulStop()
 }
@@ -0,0 +1,200 @@
+package svr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/Wladim1r/proto-crypto/gen/protos/socket-aggregator"
+	"github.com/Wladimir/socket-service/connsock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type subKey struct {
+	kind   socket.StreamKind
+	symbol string
+}
+
+// subFrame is a frame of one subscription of the stream, err is set
+// when the hub stopped the subscription
+type subFrame struct {
+	key  subKey
+	sub  *connsock.Subscriber
+	data []byte
+	err  error
+}
+
+// Subscribe serves frames of every symbol the client added on one stream.
+// A symbol that cannot be subscribed is reported in a response with an error,
+// the stream goes on; a slow client loses the whole stream
+func (s *server) Subscribe(stream socket.SocketService_SubscribeServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	slog.Info("Client connected to Subscribe stream")
+
+	reqChan := make(chan *socket.SubscribeRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case reqChan <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	subs := make(map[subKey]*connsock.Subscriber)
+	defer func() {
+		for _, sub := range subs {
+			sub.Close()
+		}
+	}()
+	frames := make(chan subFrame, 100)
+
+	messageCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Warn("Got Interruption signal from streaming server from stream context",
+				"symbols", len(subs),
+				"messages_sent", messageCount,
+				"error", ctx.Err())
+			return ctx.Err()
+		case <-s.mainCtx.Done():
+			slog.Info("Got Interruption signal from streaming server from main context",
+				"symbols", len(subs),
+				"messages_sent", messageCount)
+			return stream.Context().Err()
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				slog.Info("Client closed Subscribe stream", "messages_sent", messageCount)
+				return nil
+			}
+			return err
+		case req := <-reqChan:
+			for _, symbol := range req.Symbols {
+				key := subKey{kind: req.Kind, symbol: symbol}
+				switch req.Action {
+				case socket.SubscribeRequest_ADD:
+					if _, exists := subs[key]; exists {
+						continue
+					}
+					sub, err := s.subscribe(key)
+					if err != nil {
+						slog.Warn("Could not subscribe", "symbol", symbol, "kind", req.Kind, "error", err)
+						if err := stream.Send(subscribeError(key, err)); err != nil {
+							return err
+						}
+						continue
+					}
+					subs[key] = sub
+					go forwardFrames(ctx, key, sub, frames)
+					slog.Info("Symbol added to Subscribe stream", "symbol", symbol, "kind", req.Kind)
+				case socket.SubscribeRequest_REMOVE:
+					if sub, exists := subs[key]; exists {
+						sub.Close()
+						delete(subs, key)
+						slog.Info("Symbol removed from Subscribe stream", "symbol", symbol, "kind", req.Kind)
+					}
+				default:
+					err := status.Errorf(codes.InvalidArgument, "unknown action %d", req.Action)
+					if err := stream.Send(subscribeError(key, err)); err != nil {
+						return err
+					}
+				}
+			}
+		case f := <-frames:
+			if subs[f.key] != f.sub {
+				// Removed while the frame was queued
+				continue
+			}
+			if f.err != nil {
+				slog.Warn("Subscription of Subscribe stream stopped",
+					"symbol", f.key.symbol,
+					"kind", f.key.kind,
+					"dropped", f.sub.Dropped(),
+					"error", f.err)
+				return subscriptionErr(f.sub)
+			}
+
+			messageCount++
+			if err := stream.Send(&socket.SubscribeResponse{
+				Symbol: f.key.symbol,
+				Kind:   f.key.kind,
+				Data:   f.data,
+			}); err != nil {
+				slog.Error("Could not send frame to Subscribe client",
+					"symbol", f.key.symbol,
+					"messages_sent", messageCount,
+					"error", err)
+				return err
+			}
+		}
+	}
+}
+
+func (s *server) subscribe(key subKey) (*connsock.Subscriber, error) {
+	switch key.kind {
+	case socket.StreamKind_TRADE:
+		sub, err := s.connManager.GetOrCreateConnection(key.symbol)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return sub, nil
+	case socket.StreamKind_DEPTH:
+		sub, err := s.connManager.GetDepthConnection(key.symbol)
+		if errors.Is(err, connsock.ErrDepthUnsupported) {
+			return nil, status.Error(codes.Unimplemented, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return sub, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown stream kind %d", key.kind)
+	}
+}
+
+func subscribeError(key subKey, err error) *socket.SubscribeResponse {
+	st := status.Convert(err)
+	return &socket.SubscribeResponse{
+		Symbol: key.symbol,
+		Kind:   key.kind,
+		Code:   uint32(st.Code()),
+		Error:  st.Message(),
+	}
+}
+
+// forwardFrames passes frames of sub to the sending loop of the stream
+func forwardFrames(ctx context.Context, key subKey, sub *connsock.Subscriber, out chan<- subFrame) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			if sub.Err() == nil {
+				// Closed by the stream
+				return
+			}
+			select {
+			case out <- subFrame{key: key, sub: sub, err: sub.Err()}:
+			case <-ctx.Done():
+			}
+			return
+		case msg := <-sub.C():
+			select {
+			case out <- subFrame{key: key, sub: sub, data: msg}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
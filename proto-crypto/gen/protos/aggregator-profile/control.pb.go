@@ -0,0 +1,593 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v3.21.12
+// source: protos/aggregator-profile/control.proto
+
+package aggregator
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FollowRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	UserId        int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FollowRequest) Reset() {
+	*x = FollowRequest{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FollowRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FollowRequest) ProtoMessage() {}
+
+func (x *FollowRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FollowRequest.ProtoReflect.Descriptor instead.
+func (*FollowRequest) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FollowRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *FollowRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+type FollowResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Followers     int32                  `protobuf:"varint,2,opt,name=followers,proto3" json:"followers,omitempty"` // followers of the symbol after the call
+	Changed       bool                   `protobuf:"varint,3,opt,name=changed,proto3" json:"changed,omitempty"`     // false when the call had nothing to do
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FollowResponse) Reset() {
+	*x = FollowResponse{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FollowResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FollowResponse) ProtoMessage() {}
+
+func (x *FollowResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FollowResponse.ProtoReflect.Descriptor instead.
+func (*FollowResponse) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FollowResponse) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *FollowResponse) GetFollowers() int32 {
+	if x != nil {
+		return x.Followers
+	}
+	return 0
+}
+
+func (x *FollowResponse) GetChanged() bool {
+	if x != nil {
+		return x.Changed
+	}
+	return false
+}
+
+type ListFollowersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"` // every symbol when empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFollowersRequest) Reset() {
+	*x = ListFollowersRequest{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFollowersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFollowersRequest) ProtoMessage() {}
+
+func (x *ListFollowersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFollowersRequest.ProtoReflect.Descriptor instead.
+func (*ListFollowersRequest) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListFollowersRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+type SymbolFollowers struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	UserIds       []int64                `protobuf:"varint,2,rep,packed,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SymbolFollowers) Reset() {
+	*x = SymbolFollowers{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SymbolFollowers) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SymbolFollowers) ProtoMessage() {}
+
+func (x *SymbolFollowers) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SymbolFollowers.ProtoReflect.Descriptor instead.
+func (*SymbolFollowers) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SymbolFollowers) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *SymbolFollowers) GetUserIds() []int64 {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+type ListFollowersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []*SymbolFollowers     `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFollowersResponse) Reset() {
+	*x = ListFollowersResponse{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFollowersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFollowersResponse) ProtoMessage() {}
+
+func (x *ListFollowersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFollowersResponse.ProtoReflect.Descriptor instead.
+func (*ListFollowersResponse) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListFollowersResponse) GetSymbols() []*SymbolFollowers {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type SyncRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []*SymbolFollowers     `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"` // the complete wanted state
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SyncRequest) GetSymbols() []*SymbolFollowers {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type SyncResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Followed      int32                  `protobuf:"varint,1,opt,name=followed,proto3" json:"followed,omitempty"`
+	Unfollowed    int32                  `protobuf:"varint,2,opt,name=unfollowed,proto3" json:"unfollowed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncResponse) Reset() {
+	*x = SyncResponse{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncResponse) ProtoMessage() {}
+
+func (x *SyncResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncResponse.ProtoReflect.Descriptor instead.
+func (*SyncResponse) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SyncResponse) GetFollowed() int32 {
+	if x != nil {
+		return x.Followed
+	}
+	return 0
+}
+
+func (x *SyncResponse) GetUnfollowed() int32 {
+	if x != nil {
+		return x.Unfollowed
+	}
+	return 0
+}
+
+type DeliveryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	IntervalMs    int64                  `protobuf:"varint,2,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`       // least time between two prices of a symbol, 0 sends every one
+	ThresholdBps  int32                  `protobuf:"varint,3,opt,name=threshold_bps,json=thresholdBps,proto3" json:"threshold_bps,omitempty"` // least price move in basis points, 0 sends every one
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeliveryRequest) Reset() {
+	*x = DeliveryRequest{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeliveryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeliveryRequest) ProtoMessage() {}
+
+func (x *DeliveryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeliveryRequest.ProtoReflect.Descriptor instead.
+func (*DeliveryRequest) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeliveryRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *DeliveryRequest) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+func (x *DeliveryRequest) GetThresholdBps() int32 {
+	if x != nil {
+		return x.ThresholdBps
+	}
+	return 0
+}
+
+type DeliveryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IntervalMs    int64                  `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	ThresholdBps  int32                  `protobuf:"varint,2,opt,name=threshold_bps,json=thresholdBps,proto3" json:"threshold_bps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeliveryResponse) Reset() {
+	*x = DeliveryResponse{}
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeliveryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeliveryResponse) ProtoMessage() {}
+
+func (x *DeliveryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_aggregator_profile_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeliveryResponse.ProtoReflect.Descriptor instead.
+func (*DeliveryResponse) Descriptor() ([]byte, []int) {
+	return file_protos_aggregator_profile_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeliveryResponse) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+func (x *DeliveryResponse) GetThresholdBps() int32 {
+	if x != nil {
+		return x.ThresholdBps
+	}
+	return 0
+}
+
+var File_protos_aggregator_profile_control_proto protoreflect.FileDescriptor
+
+const file_protos_aggregator_profile_control_proto_rawDesc = "" +
+	"\n" +
+	"'protos/aggregator-profile/control.proto\x12\n" +
+	"aggregator\"@\n" +
+	"\rFollowRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\"`\n" +
+	"\x0eFollowResponse\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x1c\n" +
+	"\tfollowers\x18\x02 \x01(\x05R\tfollowers\x12\x18\n" +
+	"\achanged\x18\x03 \x01(\bR\achanged\".\n" +
+	"\x14ListFollowersRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\"D\n" +
+	"\x0fSymbolFollowers\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x19\n" +
+	"\buser_ids\x18\x02 \x03(\x03R\auserIds\"N\n" +
+	"\x15ListFollowersResponse\x125\n" +
+	"\asymbols\x18\x01 \x03(\v2\x1b.aggregator.SymbolFollowersR\asymbols\"D\n" +
+	"\vSyncRequest\x125\n" +
+	"\asymbols\x18\x01 \x03(\v2\x1b.aggregator.SymbolFollowersR\asymbols\"J\n" +
+	"\fSyncResponse\x12\x1a\n" +
+	"\bfollowed\x18\x01 \x01(\x05R\bfollowed\x12\x1e\n" +
+	"\n" +
+	"unfollowed\x18\x02 \x01(\x05R\n" +
+	"unfollowed\"p\n" +
+	"\x0fDeliveryRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12\x1f\n" +
+	"\vinterval_ms\x18\x02 \x01(\x03R\n" +
+	"intervalMs\x12#\n" +
+	"\rthreshold_bps\x18\x03 \x01(\x05R\fthresholdBps\"X\n" +
+	"\x10DeliveryResponse\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\x03R\n" +
+	"intervalMs\x12#\n" +
+	"\rthreshold_bps\x18\x02 \x01(\x05R\fthresholdBps2\xf2\x02\n" +
+	"\x11AggregatorControl\x12?\n" +
+	"\x06Follow\x12\x19.aggregator.FollowRequest\x1a\x1a.aggregator.FollowResponse\x12A\n" +
+	"\bUnfollow\x12\x19.aggregator.FollowRequest\x1a\x1a.aggregator.FollowResponse\x12T\n" +
+	"\rListFollowers\x12 .aggregator.ListFollowersRequest\x1a!.aggregator.ListFollowersResponse\x129\n" +
+	"\x04Sync\x12\x17.aggregator.SyncRequest\x1a\x18.aggregator.SyncResponse\x12H\n" +
+	"\vSetDelivery\x12\x1b.aggregator.DeliveryRequest\x1a\x1c.aggregator.DeliveryResponseB\x1eZ\x1ccrypto.aggregator;aggregatorb\x06proto3"
+
+var (
+	file_protos_aggregator_profile_control_proto_rawDescOnce sync.Once
+	file_protos_aggregator_profile_control_proto_rawDescData []byte
+)
+
+func file_protos_aggregator_profile_control_proto_rawDescGZIP() []byte {
+	file_protos_aggregator_profile_control_proto_rawDescOnce.Do(func() {
+		file_protos_aggregator_profile_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_protos_aggregator_profile_control_proto_rawDesc), len(file_protos_aggregator_profile_control_proto_rawDesc)))
+	})
+	return file_protos_aggregator_profile_control_proto_rawDescData
+}
+
+var file_protos_aggregator_profile_control_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_protos_aggregator_profile_control_proto_goTypes = []any{
+	(*FollowRequest)(nil),         // 0: aggregator.FollowRequest
+	(*FollowResponse)(nil),        // 1: aggregator.FollowResponse
+	(*ListFollowersRequest)(nil),  // 2: aggregator.ListFollowersRequest
+	(*SymbolFollowers)(nil),       // 3: aggregator.SymbolFollowers
+	(*ListFollowersResponse)(nil), // 4: aggregator.ListFollowersResponse
+	(*SyncRequest)(nil),           // 5: aggregator.SyncRequest
+	(*SyncResponse)(nil),          // 6: aggregator.SyncResponse
+	(*DeliveryRequest)(nil),       // 7: aggregator.DeliveryRequest
+	(*DeliveryResponse)(nil),      // 8: aggregator.DeliveryResponse
+}
+var file_protos_aggregator_profile_control_proto_depIdxs = []int32{
+	3, // 0: aggregator.ListFollowersResponse.symbols:type_name -> aggregator.SymbolFollowers
+	3, // 1: aggregator.SyncRequest.symbols:type_name -> aggregator.SymbolFollowers
+	0, // 2: aggregator.AggregatorControl.Follow:input_type -> aggregator.FollowRequest
+	0, // 3: aggregator.AggregatorControl.Unfollow:input_type -> aggregator.FollowRequest
+	2, // 4: aggregator.AggregatorControl.ListFollowers:input_type -> aggregator.ListFollowersRequest
+	5, // 5: aggregator.AggregatorControl.Sync:input_type -> aggregator.SyncRequest
+	7, // 6: aggregator.AggregatorControl.SetDelivery:input_type -> aggregator.DeliveryRequest
+	1, // 7: aggregator.AggregatorControl.Follow:output_type -> aggregator.FollowResponse
+	1, // 8: aggregator.AggregatorControl.Unfollow:output_type -> aggregator.FollowResponse
+	4, // 9: aggregator.AggregatorControl.ListFollowers:output_type -> aggregator.ListFollowersResponse
+	6, // 10: aggregator.AggregatorControl.Sync:output_type -> aggregator.SyncResponse
+	8, // 11: aggregator.AggregatorControl.SetDelivery:output_type -> aggregator.DeliveryResponse
+	7, // [7:12] is the sub-list for method output_type
+	2, // [2:7] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_protos_aggregator_profile_control_proto_init() }
+func file_protos_aggregator_profile_control_proto_init() {
+	if File_protos_aggregator_profile_control_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_aggregator_profile_control_proto_rawDesc), len(file_protos_aggregator_profile_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_protos_aggregator_profile_control_proto_goTypes,
+		DependencyIndexes: file_protos_aggregator_profile_control_proto_depIdxs,
+		MessageInfos:      file_protos_aggregator_profile_control_proto_msgTypes,
+	}.Build()
+	File_protos_aggregator_profile_control_proto = out.File
+	file_protos_aggregator_profile_control_proto_goTypes = nil
+	file_protos_aggregator_profile_control_proto_depIdxs = nil
+}
@@ -0,0 +1,482 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v3.21.12
+// source: protos/socket-aggregator/socket.proto
+
+package socket
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// StreamKind selects the feed of a symbol
+type StreamKind int32
+
+const (
+	StreamKind_TRADE StreamKind = 0
+	StreamKind_DEPTH StreamKind = 1
+)
+
+// Enum value maps for StreamKind.
+var (
+	StreamKind_name = map[int32]string{
+		0: "TRADE",
+		1: "DEPTH",
+	}
+	StreamKind_value = map[string]int32{
+		"TRADE": 0,
+		"DEPTH": 1,
+	}
+)
+
+func (x StreamKind) Enum() *StreamKind {
+	p := new(StreamKind)
+	*p = x
+	return p
+}
+
+func (x StreamKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (StreamKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_socket_aggregator_socket_proto_enumTypes[0].Descriptor()
+}
+
+func (StreamKind) Type() protoreflect.EnumType {
+	return &file_protos_socket_aggregator_socket_proto_enumTypes[0]
+}
+
+func (x StreamKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use StreamKind.Descriptor instead.
+func (StreamKind) EnumDescriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{0}
+}
+
+type SubscribeRequest_Action int32
+
+const (
+	SubscribeRequest_ACTION_UNSPECIFIED SubscribeRequest_Action = 0
+	SubscribeRequest_ADD                SubscribeRequest_Action = 1
+	SubscribeRequest_REMOVE             SubscribeRequest_Action = 2
+)
+
+// Enum value maps for SubscribeRequest_Action.
+var (
+	SubscribeRequest_Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "ADD",
+		2: "REMOVE",
+	}
+	SubscribeRequest_Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"ADD":                1,
+		"REMOVE":             2,
+	}
+)
+
+func (x SubscribeRequest_Action) Enum() *SubscribeRequest_Action {
+	p := new(SubscribeRequest_Action)
+	*p = x
+	return p
+}
+
+func (x SubscribeRequest_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SubscribeRequest_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_protos_socket_aggregator_socket_proto_enumTypes[1].Descriptor()
+}
+
+func (SubscribeRequest_Action) Type() protoreflect.EnumType {
+	return &file_protos_socket_aggregator_socket_proto_enumTypes[1]
+}
+
+func (x SubscribeRequest_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SubscribeRequest_Action.Descriptor instead.
+func (SubscribeRequest_Action) EnumDescriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type RawAggTradeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawAggTradeRequest) Reset() {
+	*x = RawAggTradeRequest{}
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawAggTradeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawAggTradeRequest) ProtoMessage() {}
+
+func (x *RawAggTradeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawAggTradeRequest.ProtoReflect.Descriptor instead.
+func (*RawAggTradeRequest) Descriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RawAggTradeRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+type RawMiniTickerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawMiniTickerRequest) Reset() {
+	*x = RawMiniTickerRequest{}
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawMiniTickerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawMiniTickerRequest) ProtoMessage() {}
+
+func (x *RawMiniTickerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawMiniTickerRequest.ProtoReflect.Descriptor instead.
+func (*RawMiniTickerRequest) Descriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{1}
+}
+
+type RawResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"` // byte's slice
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawResponse) Reset() {
+	*x = RawResponse{}
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawResponse) ProtoMessage() {}
+
+func (x *RawResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawResponse.ProtoReflect.Descriptor instead.
+func (*RawResponse) Descriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RawResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// SubscribeRequest adds or removes symbols of one kind on the stream
+type SubscribeRequest struct {
+	state         protoimpl.MessageState  `protogen:"open.v1"`
+	Action        SubscribeRequest_Action `protobuf:"varint,1,opt,name=action,proto3,enum=socket.SubscribeRequest_Action" json:"action,omitempty"`
+	Symbols       []string                `protobuf:"bytes,2,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	Kind          StreamKind              `protobuf:"varint,3,opt,name=kind,proto3,enum=socket.StreamKind" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubscribeRequest) GetAction() SubscribeRequest_Action {
+	if x != nil {
+		return x.Action
+	}
+	return SubscribeRequest_ACTION_UNSPECIFIED
+}
+
+func (x *SubscribeRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetKind() StreamKind {
+	if x != nil {
+		return x.Kind
+	}
+	return StreamKind_TRADE
+}
+
+// SubscribeResponse is a frame of a subscribed symbol, or the reason its subscription failed
+type SubscribeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Kind          StreamKind             `protobuf:"varint,2,opt,name=kind,proto3,enum=socket.StreamKind" json:"kind,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`  // empty when error is set
+	Code          uint32                 `protobuf:"varint,4,opt,name=code,proto3" json:"code,omitempty"` // gRPC status code of a failed subscription
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeResponse) Reset() {
+	*x = SubscribeResponse{}
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeResponse) ProtoMessage() {}
+
+func (x *SubscribeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_socket_aggregator_socket_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeResponse.ProtoReflect.Descriptor instead.
+func (*SubscribeResponse) Descriptor() ([]byte, []int) {
+	return file_protos_socket_aggregator_socket_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubscribeResponse) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *SubscribeResponse) GetKind() StreamKind {
+	if x != nil {
+		return x.Kind
+	}
+	return StreamKind_TRADE
+}
+
+func (x *SubscribeResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *SubscribeResponse) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *SubscribeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_protos_socket_aggregator_socket_proto protoreflect.FileDescriptor
+
+const file_protos_socket_aggregator_socket_proto_rawDesc = "" +
+	"\n" +
+	"%protos/socket-aggregator/socket.proto\x12\x06socket\",\n" +
+	"\x12RawAggTradeRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\"\x16\n" +
+	"\x14RawMiniTickerRequest\"!\n" +
+	"\vRawResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\xc4\x01\n" +
+	"\x10SubscribeRequest\x127\n" +
+	"\x06action\x18\x01 \x01(\x0e2\x1f.socket.SubscribeRequest.ActionR\x06action\x12\x18\n" +
+	"\asymbols\x18\x02 \x03(\tR\asymbols\x12&\n" +
+	"\x04kind\x18\x03 \x01(\x0e2\x12.socket.StreamKindR\x04kind\"5\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\a\n" +
+	"\x03ADD\x10\x01\x12\n" +
+	"\n" +
+	"\x06REMOVE\x10\x02\"\x91\x01\n" +
+	"\x11SubscribeResponse\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12&\n" +
+	"\x04kind\x18\x02 \x01(\x0e2\x12.socket.StreamKindR\x04kind\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\rR\x04code\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error*\"\n" +
+	"\n" +
+	"StreamKind\x12\t\n" +
+	"\x05TRADE\x10\x00\x12\t\n" +
+	"\x05DEPTH\x10\x012\xae\x02\n" +
+	"\rSocketService\x12K\n" +
+	"\x14ReceiveRawMiniTicker\x12\x1c.socket.RawMiniTickerRequest\x1a\x13.socket.RawResponse0\x01\x12G\n" +
+	"\x12ReceiveRawAggTrade\x12\x1a.socket.RawAggTradeRequest\x1a\x13.socket.RawResponse0\x01\x12A\n" +
+	"\fReceiveDepth\x12\x1a.socket.RawAggTradeRequest\x1a\x13.socket.RawResponse0\x01\x12D\n" +
+	"\tSubscribe\x12\x18.socket.SubscribeRequest\x1a\x19.socket.SubscribeResponse(\x010\x01B\x16Z\x14crypto.socket;socketb\x06proto3"
+
+var (
+	file_protos_socket_aggregator_socket_proto_rawDescOnce sync.Once
+	file_protos_socket_aggregator_socket_proto_rawDescData []byte
+)
+
+func file_protos_socket_aggregator_socket_proto_rawDescGZIP() []byte {
+	file_protos_socket_aggregator_socket_proto_rawDescOnce.Do(func() {
+		file_protos_socket_aggregator_socket_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_protos_socket_aggregator_socket_proto_rawDesc), len(file_protos_socket_aggregator_socket_proto_rawDesc)))
+	})
+	return file_protos_socket_aggregator_socket_proto_rawDescData
+}
+
+var file_protos_socket_aggregator_socket_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_protos_socket_aggregator_socket_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_protos_socket_aggregator_socket_proto_goTypes = []any{
+	(StreamKind)(0),              // 0: socket.StreamKind
+	(SubscribeRequest_Action)(0), // 1: socket.SubscribeRequest.Action
+	(*RawAggTradeRequest)(nil),   // 2: socket.RawAggTradeRequest
+	(*RawMiniTickerRequest)(nil), // 3: socket.RawMiniTickerRequest
+	(*RawResponse)(nil),          // 4: socket.RawResponse
+	(*SubscribeRequest)(nil),     // 5: socket.SubscribeRequest
+	(*SubscribeResponse)(nil),    // 6: socket.SubscribeResponse
+}
+var file_protos_socket_aggregator_socket_proto_depIdxs = []int32{
+	1, // 0: socket.SubscribeRequest.action:type_name -> socket.SubscribeRequest.Action
+	0, // 1: socket.SubscribeRequest.kind:type_name -> socket.StreamKind
+	0, // 2: socket.SubscribeResponse.kind:type_name -> socket.StreamKind
+	3, // 3: socket.SocketService.ReceiveRawMiniTicker:input_type -> socket.RawMiniTickerRequest
+	2, // 4: socket.SocketService.ReceiveRawAggTrade:input_type -> socket.RawAggTradeRequest
+	2, // 5: socket.SocketService.ReceiveDepth:input_type -> socket.RawAggTradeRequest
+	5, // 6: socket.SocketService.Subscribe:input_type -> socket.SubscribeRequest
+	4, // 7: socket.SocketService.ReceiveRawMiniTicker:output_type -> socket.RawResponse
+	4, // 8: socket.SocketService.ReceiveRawAggTrade:output_type -> socket.RawResponse
+	4, // 9: socket.SocketService.ReceiveDepth:output_type -> socket.RawResponse
+	6, // 10: socket.SocketService.Subscribe:output_type -> socket.SubscribeResponse
+	7, // [7:11] is the sub-list for method output_type
+	3, // [3:7] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_protos_socket_aggregator_socket_proto_init() }
+func file_protos_socket_aggregator_socket_proto_init() {
+	if File_protos_socket_aggregator_socket_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_socket_aggregator_socket_proto_rawDesc), len(file_protos_socket_aggregator_socket_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_protos_socket_aggregator_socket_proto_goTypes,
+		DependencyIndexes: file_protos_socket_aggregator_socket_proto_depIdxs,
+		EnumInfos:         file_protos_socket_aggregator_socket_proto_enumTypes,
+		MessageInfos:      file_protos_socket_aggregator_socket_proto_msgTypes,
+	}.Build()
+	File_protos_socket_aggregator_socket_proto = out.File
+	file_protos_socket_aggregator_socket_proto_goTypes = nil
+	file_protos_socket_aggregator_socket_proto_depIdxs = nil
+}
@@ -0,0 +1,59 @@
+// Package backoff holds the reconnect policy shared by all upstream connections
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Wladim1r/shared/getenv"
+)
+
+// Policy describes exponential backoff with jitter
+type Policy struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Part of the delay (0..1) which is randomized, so clients don't retry in lockstep
+	Jitter float64
+}
+
+func LoadPolicy() Policy {
+	return Policy{
+		Initial:    getenv.GetTime("RECONNECT_INITIAL", 500*time.Millisecond),
+		Max:        getenv.GetTime("RECONNECT_MAX", time.Minute),
+		Multiplier: getenv.GetFloat("RECONNECT_MULTIPLIER", 2),
+		Jitter:     getenv.GetFloat("RECONNECT_JITTER", 0.5),
+	}
+}
+
+// Delay returns how long to wait before the attempt (starting from 1)
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(p.Initial) * math.Pow(p.Multiplier, float64(attempt-1))
+	if delay > float64(p.Max) || math.IsInf(delay, 0) || math.IsNaN(delay) {
+		delay = float64(p.Max)
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay -= delay * jitter * rand.Float64()
+
+	return time.Duration(delay)
+}
+
+// Sleep waits for d, it returns false if ctx was cancelled earlier
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,62 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := Policy{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		// Overflows to +Inf and is capped
+		{5000, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Fatalf("delay of attempt %d = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	tests := []struct {
+		jitter float64
+		min    time.Duration
+	}{
+		{0.5, 200 * time.Millisecond},
+		// Jitter is clamped to 0..1
+		{3, 0},
+		{-1, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		p := Policy{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: tt.jitter}
+		for range 100 {
+			if got := p.Delay(3); got < tt.min || got > 400*time.Millisecond {
+				t.Fatalf("delay with jitter %v = %s, want %s..400ms", tt.jitter, got, tt.min)
+			}
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if !Sleep(context.Background(), time.Millisecond) {
+		t.Fatal("sleep is cut short without a cancel")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if Sleep(ctx, time.Minute) || time.Since(start) > time.Second {
+		t.Fatal("sleep outlives its context")
+	}
+}
@@ -0,0 +1,187 @@
+package backoff
+
+import (
+	"log/slog"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/shared/getenv"
+)
+
+type State string
+
+const (
+	// Connections are allowed
+	StateClosed State = "closed"
+	// Endpoint is considered down, connections are rejected until the timeout passes
+	StateOpen State = "open"
+	// One probe connection is allowed to check the endpoint is back
+	StateHalfOpen State = "half-open"
+)
+
+// Status is a snapshot of a breaker state
+type Status struct {
+	Endpoint string    `json:"endpoint"`
+	State    State     `json:"state"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at,omitzero"`
+	RetryAt  time.Time `json:"retry_at,omitzero"`
+}
+
+// Breaker is a circuit breaker of one endpoint
+type Breaker struct {
+	endpoint    string
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow tells whether a connection attempt may be made now,
+// if not it returns how long to wait before asking again
+func (b *Breaker) Allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if wait := time.Until(b.openedAt.Add(b.openTimeout)); wait > 0 {
+			return wait, false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		slog.Info("Circuit breaker half-open, probing endpoint", "endpoint", b.endpoint)
+		return 0, true
+	case StateHalfOpen:
+		if b.probing {
+			// Somebody else is probing right now
+			return b.openTimeout, false
+		}
+		b.probing = true
+		return 0, true
+	default:
+		return 0, true
+	}
+}
+
+// Success reports a successful connection
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed {
+		slog.Info("Circuit breaker closed, endpoint is back", "endpoint", b.endpoint)
+	}
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+	b.openedAt = time.Time{}
+}
+
+// Failure reports a failed connection attempt
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		if b.state != StateOpen {
+			slog.Warn("Circuit breaker opened",
+				"endpoint", b.endpoint,
+				"failures", b.failures,
+				"timeout", b.openTimeout)
+		}
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := Status{
+		Endpoint: b.endpoint,
+		State:    b.state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+	if b.state == StateOpen {
+		st.RetryAt = b.openedAt.Add(b.openTimeout)
+	}
+	return st
+}
+
+// Registry keeps one breaker per endpoint
+type Registry struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		threshold:   getenv.GetInt("BREAKER_THRESHOLD", 5),
+		openTimeout: getenv.GetTime("BREAKER_OPEN_TIMEOUT", 30*time.Second),
+		breakers:    make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of the endpoint rawURL points to
+func (r *Registry) Get(rawURL string) *Breaker {
+	endpoint := Endpoint(rawURL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[endpoint]; ok {
+		return b
+	}
+
+	b := &Breaker{
+		endpoint:    endpoint,
+		threshold:   r.threshold,
+		openTimeout: r.openTimeout,
+		state:       StateClosed,
+	}
+	r.breakers[endpoint] = b
+	return b
+}
+
+// Status returns states of all breakers sorted by endpoint
+func (r *Registry) Status() []Status {
+	r.mu.Lock()
+	breakers := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Endpoint < statuses[j].Endpoint
+	})
+	return statuses
+}
+
+// Endpoint cuts the path off rawURL, so all streams of one host share a breaker
+func Endpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
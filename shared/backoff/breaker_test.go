@@ -0,0 +1,86 @@
+package backoff
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func testRegistry(threshold int, openTimeout time.Duration) *Registry {
+	r := NewRegistry()
+	r.threshold, r.openTimeout = threshold, openTimeout
+	return r
+}
+
+func expectState(t *testing.T, b *Breaker, want State) {
+	t.Helper()
+
+	if st := b.Status(); st.State != want {
+		t.Fatalf("breaker is %s, want %s", st.State, want)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	openTimeout := 50 * time.Millisecond
+	b := testRegistry(2, openTimeout).Get("wss://stream.binance.com:9443/ws/btcusdt@trade")
+
+	b.Failure()
+	expectState(t, b, StateClosed)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("connection refused below the threshold")
+	}
+
+	// Opens at the threshold and refuses until the timeout passes
+	b.Failure()
+	expectState(t, b, StateOpen)
+	if wait, ok := b.Allow(); ok || wait <= 0 || wait > openTimeout {
+		t.Fatalf("allow = %s, %v, want a wait up to %s", wait, ok, openTimeout)
+	}
+	if st := b.Status(); st.RetryAt != st.OpenedAt.Add(openTimeout) {
+		t.Fatalf("status = %+v, want a retry after the timeout", st)
+	}
+
+	// One probe at a time once half-open
+	time.Sleep(openTimeout)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("probe refused after the timeout")
+	}
+	expectState(t, b, StateHalfOpen)
+	if _, ok := b.Allow(); ok {
+		t.Fatal("second probe allowed while the first is running")
+	}
+
+	// A failed probe opens it again right away
+	b.Failure()
+	expectState(t, b, StateOpen)
+
+	time.Sleep(openTimeout)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("probe refused after the timeout")
+	}
+	b.Success()
+	if st := b.Status(); st.State != StateClosed || st.Failures != 0 || !st.OpenedAt.IsZero() {
+		t.Fatalf("status = %+v, want closed and reset", st)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := testRegistry(1, time.Minute)
+
+	// Streams of one host share a breaker
+	btc := r.Get("wss://stream.binance.com:9443/ws/btcusdt@trade")
+	if r.Get("wss://stream.binance.com:9443/stream?streams=ethusdt@trade") != btc {
+		t.Fatal("streams of one host got different breakers")
+	}
+	r.Get("wss://ws-feed.exchange.coinbase.com").Failure()
+	r.Get("not a url")
+
+	var endpoints []string
+	for _, st := range r.Status() {
+		endpoints = append(endpoints, st.Endpoint+" "+string(st.State))
+	}
+	want := []string{"not a url closed", "wss://stream.binance.com:9443 closed", "wss://ws-feed.exchange.coinbase.com open"}
+	if !slices.Equal(endpoints, want) {
+		t.Fatalf("status = %v, want %v", endpoints, want)
+	}
+}
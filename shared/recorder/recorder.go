@@ -0,0 +1,271 @@
+// Package recorder writes timestamped frames to gzip compressed segment files
+// and reads them back in the recorded order.
+//
+// A segment is JSON lines, one Frame per line, so it can be inspected with
+// `zcat segment.jsonl.gz | jq`. Segment names sort in the order they were written.
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wladim1r/shared/getenv"
+)
+
+const segmentExt = ".jsonl.gz"
+
+// Frame is one recorded frame
+type Frame struct {
+	Time   int64  `json:"t"` // unix nanoseconds when the frame was received
+	Stream string `json:"k"` // where the frame came from
+	Data   string `json:"d"`
+}
+
+// Recorder writes frames in the background, Record never blocks the caller:
+// frames are dropped when the buffer is full. A nil Recorder records nothing
+type Recorder struct {
+	dir         string
+	segmentSize int64
+	segmentAge  time.Duration
+
+	frames  chan Frame
+	dropped atomic.Int64
+
+	file     *os.File
+	gz       *gzip.Writer
+	buf      *bufio.Writer
+	written  int64
+	openedAt time.Time
+}
+
+func New(dir string, segmentSize int64, segmentAge time.Duration, buffer int) *Recorder {
+	return &Recorder{
+		dir:         dir,
+		segmentSize: segmentSize,
+		segmentAge:  segmentAge,
+		frames:      make(chan Frame, buffer),
+	}
+}
+
+// LoadFromEnv returns nil when RECORD_DIR is not set
+func LoadFromEnv() *Recorder {
+	dir := getenv.GetString("RECORD_DIR", "")
+	if dir == "" {
+		return nil
+	}
+
+	return New(
+		dir,
+		int64(getenv.GetInt("RECORD_SEGMENT_SIZE", 64<<20)),
+		getenv.GetTime("RECORD_SEGMENT_AGE", time.Hour),
+		getenv.GetInt("RECORD_BUFFER", 10000),
+	)
+}
+
+// Record queues a frame of stream received now
+func (r *Recorder) Record(stream string, data []byte) {
+	if r == nil {
+		return
+	}
+
+	frame := Frame{Time: time.Now().UnixNano(), Stream: stream, Data: string(data)}
+	select {
+	case r.frames <- frame:
+	default:
+		if r.dropped.Add(1)%1000 == 1 {
+			slog.Warn("Recorder buffer is full, dropping frames", "dropped", r.dropped.Load())
+		}
+	}
+}
+
+// Start writes queued frames until ctx is done, then flushes the queue and closes the segment
+func (r *Recorder) Start(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if r == nil {
+		return
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		slog.Error("Could not create record directory", "dir", r.dir, "error", err)
+		return
+	}
+
+	slog.Info("📼 Recording frames", "dir", r.dir, "segment_size", r.segmentSize, "segment_age", r.segmentAge)
+	defer r.closeSegment()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case frame := <-r.frames:
+					r.write(frame)
+				default:
+					slog.Info("Recorder stopped", "dropped", r.dropped.Load())
+					return
+				}
+			}
+		case frame := <-r.frames:
+			r.write(frame)
+		}
+	}
+}
+
+func (r *Recorder) write(frame Frame) {
+	if r.gz == nil || r.written >= r.segmentSize || time.Since(r.openedAt) >= r.segmentAge {
+		if err := r.rotate(); err != nil {
+			slog.Error("Could not open record segment", "dir", r.dir, "error", err)
+			return
+		}
+	}
+
+	line, err := json.Marshal(frame)
+	if err != nil {
+		slog.Error("Could not marshal frame", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	n, err := r.buf.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		slog.Error("Could not write frame", "file", r.file.Name(), "error", err)
+	}
+}
+
+func (r *Recorder) rotate() error {
+	r.closeSegment()
+
+	now := time.Now().UTC()
+	name := filepath.Join(r.dir, now.Format("20060102T150405.000000000")+segmentExt)
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.buf = bufio.NewWriterSize(r.gz, 64<<10)
+	r.written = 0
+	r.openedAt = now
+
+	slog.Info("Opened record segment", "file", name)
+	return nil
+}
+
+// closeSegment completes the gzip stream, so every closed segment is a valid file
+func (r *Recorder) closeSegment() {
+	if r.gz == nil {
+		return
+	}
+
+	if err := r.buf.Flush(); err != nil {
+		slog.Error("Could not flush record segment", "file", r.file.Name(), "error", err)
+	}
+	if err := r.gz.Close(); err != nil {
+		slog.Error("Could not close gzip stream", "file", r.file.Name(), "error", err)
+	}
+	if err := r.file.Close(); err != nil {
+		slog.Error("Could not close record segment", "file", r.file.Name(), "error", err)
+	}
+
+	r.file, r.gz, r.buf = nil, nil, nil
+}
+
+// Reader reads frames of all segments in dir in the recorded order
+type Reader struct {
+	files []string
+	next  int
+
+	file *os.File
+	gz   *gzip.Reader
+	dec  *json.Decoder
+}
+
+func Open(dir string) (*Reader, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no record segments in %s", dir)
+	}
+	slices.Sort(files)
+
+	return &Reader{files: files}, nil
+}
+
+// Next returns the next frame, io.EOF after the last one. A segment cut
+// short by a crash is read up to the last complete frame
+func (r *Reader) Next() (Frame, error) {
+	for {
+		if r.dec == nil {
+			if r.next == len(r.files) {
+				return Frame{}, io.EOF
+			}
+			name := r.files[r.next]
+			r.next++
+			if err := r.openSegment(name); err != nil {
+				if errors.Is(err, io.EOF) {
+					// Segment created right before a crash, nothing was written
+					continue
+				}
+				return Frame{}, err
+			}
+		}
+
+		var frame Frame
+		err := r.dec.Decode(&frame)
+		if err == nil {
+			return frame, nil
+		}
+
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			slog.Warn("Record segment is damaged, skipping the rest of it",
+				"file", r.file.Name(),
+				"error", err)
+		}
+		r.closeSegment()
+	}
+}
+
+func (r *Reader) openSegment(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	r.file, r.gz, r.dec = file, gz, json.NewDecoder(gz)
+	return nil
+}
+
+func (r *Reader) closeSegment() {
+	if r.dec == nil {
+		return
+	}
+	r.gz.Close()
+	r.file.Close()
+	r.file, r.gz, r.dec = nil, nil, nil
+}
+
+func (r *Reader) Close() error {
+	r.closeSegment()
+	return nil
+}
@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record writes frames to dir through a recorder and waits for it to stop
+func record(t *testing.T, dir string, segmentSize int64, frames ...string) {
+	t.Helper()
+
+	r := New(dir, segmentSize, time.Hour, len(frames))
+	for _, data := range frames {
+		r.Record("btcusdt@trade", []byte(data))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	r.Start(ctx, wg)
+}
+
+// replay reads back data of all frames in dir
+func replay(t *testing.T, dir string) []string {
+	t.Helper()
+
+	rd, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	var res []string
+	var last int64
+	for {
+		frame, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Stream != "btcusdt@trade" || frame.Time < last {
+			t.Fatalf("frame = %+v, want btcusdt@trade after %d", frame, last)
+		}
+		last = frame.Time
+		res = append(res, frame.Data)
+	}
+}
+
+func segments(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+	return files
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	for i := range 5 {
+		want = append(want, fmt.Sprintf(`{"p":"%d"}`, i))
+	}
+
+	// Every frame is over the segment size, so each one gets a segment
+	record(t, dir, 1, want...)
+	if files := segments(t, dir); len(files) != len(want) {
+		t.Fatalf("%d segments, want %d", len(files), len(want))
+	}
+	if got := replay(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir, 1<<20, "1", "2", "3")
+	record(t, dir, 1<<20, "4")
+
+	// The first segment is cut off in the middle of its last frame
+	files := segments(t, dir)
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = os.Create(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := gzip.NewWriter(f)
+	w.Write(data[:len(data)-5])
+	w.Flush()
+	f.Close()
+
+	// A segment created right before the crash is empty
+	if err := os.WriteFile(filepath.Join(dir, "99999999T999999.999999999"+segmentExt), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := replay(t, dir); !slices.Equal(got, []string{"1", "2", "4"}) {
+		t.Fatalf("replayed %v, want frames up to the cut and the next segment", got)
+	}
+}
+
+func TestOpenEmpty(t *testing.T) {
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Fatal("opened a directory without segments")
+	}
+
+	// A nil recorder records nothing
+	var r *Recorder
+	r.Record("btcusdt@trade", []byte("1"))
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	r.Start(context.Background(), wg)
+	wg.Wait()
+}
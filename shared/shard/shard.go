@@ -0,0 +1,92 @@
+// Package shard spreads symbols over Aggregator replicas. Replicas heartbeat
+// their control addresses into a Redis sorted set, and every symbol is owned
+// by the live replica ranked first by rendezvous hashing, so both Aggregator
+// and Profile agree on owners without talking to each other
+package shard
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Wladim1r/shared/getenv"
+	"github.com/redis/go-redis/v9"
+)
+
+// Owner returns the replica owning symbol, or "" when there are no replicas.
+// Losing a replica moves only the symbols it owned
+func Owner(symbol string, replicas []string) string {
+	var (
+		owner string
+		best  uint64
+	)
+	for _, replica := range replicas {
+		h := fnv.New64a()
+		h.Write([]byte(replica))
+		h.Write([]byte{0})
+		h.Write([]byte(symbol))
+		if score := mix(h.Sum64()); owner == "" || score > best || (score == best && replica < owner) {
+			owner, best = replica, score
+		}
+	}
+	return owner
+}
+
+// mix spreads the bits of FNV, alone it ranks similar symbols alike
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Registry is the set of live replicas, a replica is live while its last
+// heartbeat is younger than TTL
+type Registry struct {
+	rdb *redis.Client
+	key string
+	TTL time.Duration
+}
+
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{
+		rdb: rdb,
+		key: getenv.GetString("REPLICAS_KEY", "aggregator:replicas"),
+		TTL: getenv.GetTime("REPLICA_TTL", 10*time.Second),
+	}
+}
+
+// Members returns addresses of live replicas in sorted order
+func (r *Registry) Members(ctx context.Context) ([]string, error) {
+	since := time.Now().Add(-r.TTL).UnixMilli()
+	replicas, err := r.rdb.ZRangeByScore(ctx, r.key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(replicas)
+	return replicas, nil
+}
+
+// Heartbeat marks addr live and forgets replicas that stopped beating long ago
+func (r *Registry) Heartbeat(ctx context.Context, addr string) error {
+	now := time.Now()
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, r.key, redis.Z{Score: float64(now.UnixMilli()), Member: addr})
+		pipe.ZRemRangeByScore(ctx, r.key, "-inf",
+			strconv.FormatInt(now.Add(-10*r.TTL).UnixMilli(), 10))
+		return nil
+	})
+	return err
+}
+
+// Leave hands the symbols of addr over to other replicas right away
+func (r *Registry) Leave(ctx context.Context, addr string) error {
+	return r.rdb.ZRem(ctx, r.key, addr).Err()
+}
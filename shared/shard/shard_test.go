@@ -0,0 +1,94 @@
+package shard
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func symbols(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("coin%dusdt", i)
+	}
+	return out
+}
+
+func owners(syms, replicas []string) map[string]string {
+	out := make(map[string]string, len(syms))
+	for _, symbol := range syms {
+		out[symbol] = Owner(symbol, replicas)
+	}
+	return out
+}
+
+func TestOwnerNoReplicas(t *testing.T) {
+	if owner := Owner("btcusdt", nil); owner != "" {
+		t.Fatalf("owner = %q, want none", owner)
+	}
+}
+
+func TestOwnerIgnoresOrder(t *testing.T) {
+	replicas := []string{"agg-a:50061", "agg-b:50061", "agg-c:50061"}
+	reversed := slices.Clone(replicas)
+	slices.Reverse(reversed)
+
+	for _, symbol := range symbols(200) {
+		if a, b := Owner(symbol, replicas), Owner(symbol, reversed); a != b {
+			t.Fatalf("owner of %s is %s or %s depending on order", symbol, a, b)
+		}
+	}
+}
+
+func TestOwnerSpreadsSymbols(t *testing.T) {
+	replicas := []string{"agg-a:50061", "agg-b:50061", "agg-c:50061"}
+
+	counts := make(map[string]int)
+	for _, owner := range owners(symbols(3000), replicas) {
+		counts[owner]++
+	}
+	// Every replica gets roughly a third
+	for _, replica := range replicas {
+		if counts[replica] < 800 || counts[replica] > 1200 {
+			t.Fatalf("replica counts %v are uneven", counts)
+		}
+	}
+}
+
+func TestOwnerStableOnLeave(t *testing.T) {
+	replicas := []string{"agg-a:50061", "agg-b:50061", "agg-c:50061"}
+	syms := symbols(1000)
+	before := owners(syms, replicas)
+	after := owners(syms, []string{"agg-a:50061", "agg-c:50061"})
+
+	for _, symbol := range syms {
+		if before[symbol] != "agg-b:50061" && after[symbol] != before[symbol] {
+			t.Fatalf("%s moved from %s to %s, its owner did not leave", symbol, before[symbol], after[symbol])
+		}
+		if after[symbol] == "agg-b:50061" {
+			t.Fatalf("%s is owned by the replica that left", symbol)
+		}
+	}
+}
+
+func TestOwnerStableOnJoin(t *testing.T) {
+	replicas := []string{"agg-a:50061", "agg-b:50061"}
+	syms := symbols(1000)
+	before := owners(syms, replicas)
+	after := owners(syms, append(slices.Clone(replicas), "agg-c:50061"))
+
+	moved := 0
+	for _, symbol := range syms {
+		if after[symbol] == before[symbol] {
+			continue
+		}
+		// Symbols move only to the replica that joined
+		if after[symbol] != "agg-c:50061" {
+			t.Fatalf("%s moved from %s to %s", symbol, before[symbol], after[symbol])
+		}
+		moved++
+	}
+	if moved < 200 || moved > 470 {
+		t.Fatalf("%d of %d symbols moved to the new replica, want about a third", moved, len(syms))
+	}
+}
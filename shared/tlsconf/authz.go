@@ -0,0 +1,165 @@
+package tlsconf
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/Wladim1r/shared/getenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Policy lists the peers allowed to call a method. Keys are full method names
+// "/socket.SocketService/Subscribe", whole services "/socket.SocketService/*"
+// or "*" for every method; the most specific key wins. Methods matching no
+// key are refused, health checks must be listed too
+type Policy map[string][]string
+
+// PolicyFromEnv parses TLS_ALLOW, rules are used when it is empty, for example
+//
+//	TLS_ALLOW=/socket.SocketService/*=aggregator;/grpc.health.v1.Health/*=*
+//
+// Peers are separated by commas, "*" allows any verified peer. Without TLS and
+// TLS_ALLOW there are no peers to check and the policy is empty
+func PolicyFromEnv(rules string) Policy {
+	env := getenv.GetString("TLS_ALLOW", "")
+	if env == "" && !LoadFromEnv().Enabled() {
+		return nil
+	}
+	if env != "" {
+		rules = env
+	}
+
+	policy := make(Policy)
+	for _, rule := range strings.Split(rules, ";") {
+		method, peers, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok {
+			if rule != "" {
+				slog.Error("Invalid TLS_ALLOW rule, skipping", "rule", rule)
+			}
+			continue
+		}
+		method = strings.TrimSpace(method)
+		for _, p := range strings.Split(peers, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				policy[method] = append(policy[method], p)
+			}
+		}
+	}
+	return policy
+}
+
+func (p Policy) allowed(method string) ([]string, bool) {
+	if peers, ok := p[method]; ok {
+		return peers, true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if peers, ok := p[method[:i]+"/*"]; ok {
+			return peers, true
+		}
+	}
+	peers, ok := p["*"]
+	return peers, ok
+}
+
+// authorize returns PermissionDenied unless the verified client certificate
+// of the call names a peer allowed to call method
+func (p Policy) authorize(ctx context.Context, method string) error {
+	peers, ok := p.allowed(method)
+	if !ok {
+		slog.Warn("Method is not listed in TLS_ALLOW", "method", method)
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed to any peer", method)
+	}
+
+	names := PeerNames(ctx)
+	if len(names) == 0 {
+		return status.Errorf(codes.Unauthenticated, "%s requires a client certificate", method)
+	}
+	if slices.Contains(peers, "*") {
+		return nil
+	}
+	for _, name := range names {
+		if slices.Contains(peers, name) {
+			return nil
+		}
+	}
+
+	slog.Warn("Peer is not allowed to call method", "method", method, "peer", names)
+	return status.Errorf(codes.PermissionDenied, "%v may not call %s", names, method)
+}
+
+// PeerNames returns the common name and DNS names of the verified client
+// certificate of the call, nil for plaintext calls
+func PeerNames(ctx context.Context) []string {
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := pr.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return nil
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	names := slices.Clone(cert.DNSNames)
+	if cert.Subject.CommonName != "" && !slices.Contains(names, cert.Subject.CommonName) {
+		names = append([]string{cert.Subject.CommonName}, names...)
+	}
+	return names
+}
+
+func (p Policy) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := p.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (p Policy) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := p.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// ServerOptions returns credentials and the policy interceptors of a gRPC server
+func ServerOptions(cfg Config, policy Policy) ([]grpc.ServerOption, error) {
+	creds, err := ServerCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(policy) == 0 {
+		if cfg.Enabled() {
+			slog.Warn("TLS_ALLOW is empty, every call will be refused")
+		} else {
+			return []grpc.ServerOption{grpc.Creds(creds)}, nil
+		}
+	} else if !cfg.Enabled() {
+		slog.Warn("TLS_ALLOW is set without TLS, every call will be refused")
+	}
+
+	return []grpc.ServerOption{
+		grpc.Creds(creds),
+		grpc.ChainUnaryInterceptor(policy.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(policy.StreamInterceptor()),
+	}, nil
+}
@@ -0,0 +1,64 @@
+package tlsconf
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(name string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		},
+	})
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	t.Setenv("TLS_ALLOW", "")
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	policy := PolicyFromEnv("/socket.SocketService/*=aggregator;/socket.SocketService/Subscribe=aggregator,replay;/grpc.health.v1.Health/*=*")
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"listed peer", peerContext("aggregator"), "/socket.SocketService/ReceiveDepth", codes.OK},
+		{"other peer", peerContext("profile"), "/socket.SocketService/ReceiveDepth", codes.PermissionDenied},
+		{"method key wins", peerContext("replay"), "/socket.SocketService/Subscribe", codes.OK},
+		{"any peer", peerContext("profile"), "/grpc.health.v1.Health/Check", codes.OK},
+		{"no certificate", context.Background(), "/grpc.health.v1.Health/Check", codes.Unauthenticated},
+		{"unlisted method", peerContext("aggregator"), "/aggregator.AggregatorControl/Sync", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(policy.authorize(tt.ctx, tt.method)); got != tt.want {
+				t.Errorf("authorize = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_ALLOW", "")
+	if policy := PolicyFromEnv("*=*"); policy != nil {
+		t.Fatalf("plaintext policy = %v, want none", policy)
+	}
+
+	t.Setenv("TLS_ALLOW", "/auth.Auth/*=profile; bad rule ;/grpc.health.v1.Health/*=*")
+	policy := PolicyFromEnv("*=*")
+	if len(policy) != 2 || policy["/auth.Auth/*"][0] != "profile" {
+		t.Fatalf("policy = %v, want the rules of TLS_ALLOW", policy)
+	}
+}
@@ -0,0 +1,200 @@
+// Package tlsconf builds gRPC transport credentials for mutual TLS between
+// the services. Certificates are read from PEM files and read again when the
+// files change, so a rotated certificate is used by the next handshake
+// without a restart. Without TLS_CERT_FILE the credentials are insecure.
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Wladim1r/shared/getenv"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// CA of the peers, the server requires client certificates signed by it
+	CAFile string
+	// Name expected in the server certificate, the host of the address by default
+	ServerName string
+	// How often the files are checked for changes
+	ReloadInterval time.Duration
+}
+
+func LoadFromEnv() Config {
+	return Config{
+		CertFile:       getenv.GetString("TLS_CERT_FILE", ""),
+		KeyFile:        getenv.GetString("TLS_KEY_FILE", ""),
+		CAFile:         getenv.GetString("TLS_CA_FILE", ""),
+		ServerName:     getenv.GetString("TLS_SERVER_NAME", ""),
+		ReloadInterval: getenv.GetTime("TLS_RELOAD_INTERVAL", 30*time.Second),
+	}
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// ServerCredentials requires and verifies client certificates
+func ServerCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled() {
+		slog.Warn("TLS is disabled, serving gRPC in plaintext")
+		return insecure.NewCredentials(), nil
+	}
+
+	s, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The config is built per handshake to pick up rotated files
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := s.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				// The returned config replaces the one of credentials.NewTLS, which sets h2
+				NextProtos: []string{"h2"},
+			}, nil
+		},
+	}), nil
+}
+
+// ClientCredentials presents the client certificate and verifies the server one
+func ClientCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled() {
+		slog.Warn("TLS is disabled, dialing gRPC in plaintext")
+		return insecure.NewCredentials(), nil
+	}
+
+	s, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := s.current()
+			return cert, nil
+		},
+		// RootCAs cannot be swapped on a live config, the chain is verified
+		// against the current CA in VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, pool := s.current()
+			return verifyServer(cs, pool)
+		},
+	}), nil
+}
+
+func verifyServer(cs tls.ConnectionState, pool *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// store keeps the certificate and the CA pool loaded from files
+type store struct {
+	cfg Config
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time
+	checkedAt time.Time
+}
+
+func newStore(cfg Config) (*store, error) {
+	if cfg.KeyFile == "" || cfg.CAFile == "" {
+		return nil, errors.New("TLS_KEY_FILE and TLS_CA_FILE are required with TLS_CERT_FILE")
+	}
+
+	s := &store{cfg: cfg}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	slog.Info("🔐 TLS certificates loaded", "cert", cfg.CertFile, "ca", cfg.CAFile)
+	return s, nil
+}
+
+// current returns the certificate and the pool, reloading them when the files changed.
+// A failed reload keeps the previous ones, a half written file is picked up on the next check
+func (s *store) current() (*tls.Certificate, *x509.CertPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checkedAt) >= s.cfg.ReloadInterval {
+		s.checkedAt = time.Now()
+		if modTimes, err := s.stat(); err == nil && modTimes != s.modTimes {
+			if err := s.load(); err != nil {
+				slog.Error("Could not reload TLS certificates, keeping previous ones", "error", err)
+			} else {
+				slog.Info("🔐 TLS certificates reloaded", "cert", s.cfg.CertFile, "ca", s.cfg.CAFile)
+			}
+		}
+	}
+
+	return s.cert, s.pool
+}
+
+func (s *store) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, name := range []string{s.cfg.CertFile, s.cfg.KeyFile, s.cfg.CAFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (s *store) load() error {
+	modTimes, err := s.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("could not load key pair: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(s.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("could not read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates in %s", s.cfg.CAFile)
+	}
+
+	s.cert, s.pool, s.modTimes = &cert, pool, modTimes
+	return nil
+}